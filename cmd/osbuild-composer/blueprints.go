@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// blueprintsConfig is the format of the optional configuration of the git
+// repository which keeps the history of blueprints.
+type blueprintsConfig struct {
+	// the repository to synchronize blueprints with, none by default
+	Remote string `toml:"remote"`
+	Branch string `toml:"branch"`
+
+	// how often to synchronize with the remote, defaults to five minutes
+	SyncInterval string `toml:"sync_interval"`
+}
+
+// loadBlueprintsConfig reads the blueprints configuration from `path`. It
+// returns an empty configuration when the file doesn't exist.
+func loadBlueprintsConfig(path string) (*blueprintsConfig, error) {
+	var config blueprintsConfig
+	_, err := toml.DecodeFile(path, &config)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// syncInterval returns the interval in which blueprints are synchronized
+// with the remote.
+func (c *blueprintsConfig) syncInterval() (time.Duration, error) {
+	if c.SyncInterval == "" {
+		return 5 * time.Minute, nil
+	}
+
+	interval, err := time.ParseDuration(c.SyncInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sync_interval: %v", err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("sync_interval must be positive")
+	}
+	return interval, nil
+}
+
+// syncBlueprints synchronizes the blueprints of `s` with the remote every
+// `interval` until `ctx` is done.
+func syncBlueprints(ctx context.Context, s *store.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.SyncBlueprints()
+		if err != nil {
+			log.Printf("cannot synchronize blueprints: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,29 +1,214 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path"
+	"time"
 
 	"github.com/osbuild/osbuild-composer/internal/distro/fedora31"
 	"github.com/osbuild/osbuild-composer/internal/distro/fedora32"
 	"github.com/osbuild/osbuild-composer/internal/distro/rhel8"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue/fsjobqueue"
 
+	"github.com/osbuild/osbuild-composer/internal/cloudapi"
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/weldr"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 
+	"github.com/BurntSushi/toml"
 	"github.com/coreos/go-systemd/activation"
 )
 
+// authConfig is the format of the optional authentication configuration of
+// the weldr API.
+type authConfig struct {
+	// roles of users and groups connecting via the unix socket
+	Peer struct {
+		Users  map[string]string `toml:"users"`
+		Groups map[string]string `toml:"groups"`
+	} `toml:"peer"`
+
+	// roles of clients connecting via TCP, by the common name of their
+	// certificate
+	ClientCerts map[string]string `toml:"client_certs"`
+
+	// tokens of clients connecting via TCP
+	Tokens []struct {
+		Name  string `toml:"name"`
+		Token string `toml:"token"`
+		Role  string `toml:"role"`
+	} `toml:"tokens"`
+
+	// members and quotas of namespaces, keyed by namespace name
+	Namespaces map[string]namespaceConfig `toml:"namespaces"`
+
+	AuditLog string `toml:"audit_log"`
+}
+
+type namespaceConfig struct {
+	Users       []string `toml:"users"`
+	Groups      []string `toml:"groups"`
+	ClientCerts []string `toml:"client_certs"`
+	Tokens      []string `toml:"tokens"`
+
+	MaxBlueprints int `toml:"max_blueprints"`
+	MaxComposes   int `toml:"max_composes"`
+}
+
+// defaultNamespace is how the default namespace is called in the
+// configuration.
+const defaultNamespace = "default"
+
+// namespaceName returns the name of namespace `name` in the store.
+func namespaceName(name string) (string, error) {
+	if name == defaultNamespace {
+		return "", nil
+	}
+	if name == "" || !store.ValidNamespace.MatchString(name) {
+		return "", fmt.Errorf("invalid namespace name: %s", name)
+	}
+	return name, nil
+}
+
+// members returns the namespaces of the members configured by `field`,
+// which returns the members of one namespace.
+func (c *authConfig) members(field func(namespaceConfig) []string) (map[string]string, error) {
+	namespaces := make(map[string]string)
+	for name, config := range c.Namespaces {
+		namespace, err := namespaceName(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range field(config) {
+			if other, exists := namespaces[member]; exists && other != namespace {
+				return nil, fmt.Errorf("%s is a member of more than one namespace", member)
+			}
+			namespaces[member] = namespace
+		}
+	}
+	return namespaces, nil
+}
+
+// quotas returns the quotas of all namespaces which have one.
+func (c *authConfig) quotas() (map[string]store.Quota, error) {
+	quotas := make(map[string]store.Quota)
+	for name, config := range c.Namespaces {
+		namespace, err := namespaceName(name)
+		if err != nil {
+			return nil, err
+		}
+		quotas[namespace] = store.Quota{
+			Blueprints: config.MaxBlueprints,
+			Composes:   config.MaxComposes,
+		}
+	}
+	return quotas, nil
+}
+
+// loadAuthConfig reads the authentication configuration from `path`. When
+// it doesn't exist, root is an admin and members of the weldr group may
+// compose.
+func loadAuthConfig(path string) (*authConfig, error) {
+	var config authConfig
+	_, err := toml.DecodeFile(path, &config)
+	if os.IsNotExist(err) {
+		config.Peer.Users = map[string]string{"root": "admin"}
+		config.Peer.Groups = map[string]string{"weldr": "composer"}
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func parseRoles(roles map[string]string) (map[string]weldr.Role, error) {
+	parsed := make(map[string]weldr.Role)
+	for name, roleName := range roles {
+		role, err := weldr.ParseRole(roleName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		parsed[name] = role
+	}
+	return parsed, nil
+}
+
+func (c *authConfig) authenticators() ([]weldr.Authenticator, error) {
+	users, err := parseRoles(c.Peer.Users)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := parseRoles(c.Peer.Groups)
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := parseRoles(c.ClientCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	userNamespaces, err := c.members(func(n namespaceConfig) []string { return n.Users })
+	if err != nil {
+		return nil, err
+	}
+	groupNamespaces, err := c.members(func(n namespaceConfig) []string { return n.Groups })
+	if err != nil {
+		return nil, err
+	}
+	certNamespaces, err := c.members(func(n namespaceConfig) []string { return n.ClientCerts })
+	if err != nil {
+		return nil, err
+	}
+	tokenNamespaces, err := c.members(func(n namespaceConfig) []string { return n.Tokens })
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []weldr.Token
+	for _, t := range c.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("token %s is empty", t.Name)
+		}
+		role, err := weldr.ParseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		tokens = append(tokens, weldr.Token{
+			Name:      t.Name,
+			Token:     t.Token,
+			Role:      role,
+			Namespace: tokenNamespaces[t.Name],
+		})
+	}
+
+	return []weldr.Authenticator{
+		&weldr.PeerCredentialsAuthenticator{
+			Users:           users,
+			Groups:          groups,
+			UserNamespaces:  userNamespaces,
+			GroupNamespaces: groupNamespaces,
+		},
+		&weldr.ClientCertificateAuthenticator{
+			Subjects:   subjects,
+			Namespaces: certNamespaces,
+		},
+		&weldr.TokenAuthenticator{Tokens: tokens},
+	}, nil
+}
+
 type connectionConfig struct {
 	CACertFile     string
 	ServerKeyFile  string
@@ -119,7 +304,38 @@ func main() {
 		logger = log.New(os.Stdout, "", 0)
 	}
 
-	store := store.New(&stateDir, arch, logger)
+	blueprintsConfig, err := loadBlueprintsConfig("/etc/osbuild-composer/blueprints.toml")
+	if err != nil {
+		log.Fatalf("cannot load blueprints configuration: %v", err)
+	}
+	syncInterval, err := blueprintsConfig.syncInterval()
+	if err != nil {
+		log.Fatalf("invalid blueprints configuration: %v", err)
+	}
+	var blueprintsRepo *store.GitRepository
+	if _, err := exec.LookPath("git"); err == nil {
+		blueprintsRepo, err = store.OpenGitRepository(path.Join(stateDir, "blueprints"), blueprintsConfig.Remote, blueprintsConfig.Branch)
+		if err != nil {
+			log.Fatalf("cannot open blueprints repository: %v", err)
+		}
+	} else if blueprintsConfig.Remote != "" {
+		log.Fatalf("git is required to synchronize blueprints with %s", blueprintsConfig.Remote)
+	} else {
+		log.Printf("git is not installed, the history of blueprints is not kept in a git repository")
+	}
+
+	backend, err := openStorage("/etc/osbuild-composer/storage.toml", stateDir)
+	if err != nil {
+		log.Fatalf("cannot open storage: %v", err)
+	}
+
+	store, err := store.NewWithBackend(backend, arch, logger)
+	if err != nil {
+		log.Fatalf("cannot load store: %v", err)
+	}
+	if blueprintsRepo != nil {
+		store.SetGitRepository(blueprintsRepo)
+	}
 
 	queueDir := path.Join(stateDir, "jobs")
 	err = os.Mkdir(queueDir, 0700)
@@ -127,7 +343,7 @@ func main() {
 		log.Fatalf("cannot create queue directory: %v", err)
 	}
 
-	jobs, err := fsjobqueue.New(queueDir, []string{"osbuild"})
+	jobs, err := fsjobqueue.New(queueDir, []string{"osbuild", "upload"})
 	if err != nil {
 		log.Fatalf("cannot create jobqueue: %v", err)
 	}
@@ -143,6 +359,73 @@ func main() {
 	workers := worker.NewServer(logger, jobs, artifactsDir)
 	weldrAPI := weldr.New(rpm, arch, distribution, repoMap[common.CurrentArch()], logger, store, workers, compatOutputDir)
 
+	// validate manifests against the schemas of the installed osbuild, which
+	// runs them, if it can be found on this machine
+	schemas, err := osbuild.LoadSchemas("/usr/lib/osbuild")
+	if err != nil {
+		log.Printf("using vendored osbuild schemas: %v", err)
+		schemas = osbuild.VendoredSchemas()
+	}
+	weldrAPI.SetManifestSchemas(schemas)
+
+	// the cloud API is served next to the weldr API, which authenticates
+	// its clients
+	cloudAPI := cloudapi.NewServer(logger, workers, rpm, arch, weldrAPI.Namespace)
+	cloudAPI.SetManifestSchemas(schemas)
+	weldrAPI.Handle("/api/composer/v1", cloudAPI)
+
+	authConfig, err := loadAuthConfig("/etc/osbuild-composer/weldr-auth.toml")
+	if err != nil {
+		log.Fatalf("cannot load authentication configuration: %v", err)
+	}
+
+	authenticators, err := authConfig.authenticators()
+	if err != nil {
+		log.Fatalf("invalid authentication configuration: %v", err)
+	}
+	weldrAPI.SetAuthenticators(authenticators...)
+
+	quotas, err := authConfig.quotas()
+	if err != nil {
+		log.Fatalf("invalid authentication configuration: %v", err)
+	}
+	for namespace, quota := range quotas {
+		store.SetQuota(namespace, quota)
+	}
+
+	auditLogPath := authConfig.AuditLog
+	if auditLogPath == "" {
+		auditLogPath = path.Join(stateDir, "audit.log")
+	}
+	auditLog, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Fatalf("cannot open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	weldrAPI.SetAuditLog(auditLog)
+
+	retentionConfig, err := loadRetentionConfig("/etc/osbuild-composer/retention.toml")
+	if err != nil {
+		log.Fatalf("cannot load retention configuration: %v", err)
+	}
+	if retentionConfig != nil {
+		policy, interval, err := retentionConfig.policy()
+		if err != nil {
+			log.Fatalf("invalid retention configuration: %v", err)
+		}
+		weldrAPI.SetRetentionPolicy(policy, diskUsage(artifactsDir))
+		go weldrAPI.CollectGarbage(context.Background(), interval)
+	}
+
+	// cron expressions of schedules have a resolution of a minute
+	go weldrAPI.RunSchedules(context.Background(), time.Minute)
+
+	go weldrAPI.RunAdvisoryChecks(context.Background())
+
+	if blueprintsConfig.Remote != "" {
+		go syncBlueprints(context.Background(), store, syncInterval)
+	}
+
 	go func() {
 		err := workers.Serve(jobListener)
 		common.PanicOnError(err)
@@ -170,6 +453,30 @@ func main() {
 		}
 	}
 
+	if apiListeners, exists := listeners["osbuild-composer-api.socket"]; exists {
+		for _, listener := range apiListeners {
+			log.Printf("Starting remote API listener\n")
+
+			tlsConfig, err := createTLSConfig(&connectionConfig{
+				CACertFile:     "/etc/osbuild-composer/ca-crt.pem",
+				ServerKeyFile:  "/etc/osbuild-composer/composer-key.pem",
+				ServerCertFile: "/etc/osbuild-composer/composer-crt.pem",
+			})
+			if err != nil {
+				log.Fatalf("TLS configuration cannot be created: " + err.Error())
+			}
+
+			// clients may authenticate with a token instead of a certificate
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+			listener := tls.NewListener(listener, tlsConfig)
+			go func() {
+				err := weldrAPI.Serve(listener)
+				common.PanicOnError(err)
+			}()
+		}
+	}
+
 	err = weldrAPI.Serve(weldrListener)
 	common.PanicOnError(err)
 
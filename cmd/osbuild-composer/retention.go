@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/osbuild-composer/internal/weldr"
+)
+
+// retentionConfig is the format of the optional retention configuration,
+// which enables deleting old composes automatically.
+type retentionConfig struct {
+	// how often to look for composes to delete, defaults to an hour
+	Interval string `toml:"interval"`
+
+	MaxAge                  string  `toml:"max_age"`
+	MaxComposesPerBlueprint int     `toml:"max_composes_per_blueprint"`
+	KeepLastSuccessful      bool    `toml:"keep_last_successful"`
+	HighWatermark           float64 `toml:"high_watermark"`
+	LowWatermark            float64 `toml:"low_watermark"`
+}
+
+// loadRetentionConfig reads the retention configuration from `path`. It
+// returns nil when the file doesn't exist.
+func loadRetentionConfig(path string) (*retentionConfig, error) {
+	var config retentionConfig
+	_, err := toml.DecodeFile(path, &config)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// policy returns the retention policy and the interval of the garbage
+// collector.
+func (c *retentionConfig) policy() (weldr.RetentionPolicy, time.Duration, error) {
+	policy := weldr.RetentionPolicy{
+		MaxComposesPerBlueprint: c.MaxComposesPerBlueprint,
+		KeepLastSuccessful:      c.KeepLastSuccessful,
+		HighWatermark:           c.HighWatermark,
+		LowWatermark:            c.LowWatermark,
+	}
+
+	if c.MaxComposesPerBlueprint < 0 {
+		return policy, 0, fmt.Errorf("max_composes_per_blueprint must not be negative")
+	}
+	if c.HighWatermark < 0 || c.HighWatermark > 100 || c.LowWatermark < 0 || c.LowWatermark > 100 {
+		return policy, 0, fmt.Errorf("watermarks must be percentages between 0 and 100")
+	}
+
+	var err error
+	if c.MaxAge != "" {
+		policy.MaxAge, err = time.ParseDuration(c.MaxAge)
+		if err != nil {
+			return policy, 0, fmt.Errorf("invalid max_age: %v", err)
+		}
+	}
+
+	interval := time.Hour
+	if c.Interval != "" {
+		interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return policy, 0, fmt.Errorf("invalid interval: %v", err)
+		}
+		if interval <= 0 {
+			return policy, 0, fmt.Errorf("interval must be positive")
+		}
+	}
+
+	return policy, interval, nil
+}
+
+// diskUsage returns a function which returns the used and total bytes of the
+// file system `dir` is on.
+func diskUsage(dir string) weldr.DiskUsageFunc {
+	return func() (uint64, uint64, error) {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(dir, &stat)
+		if err != nil {
+			return 0, 0, err
+		}
+		total := stat.Blocks * uint64(stat.Bsize)
+		free := stat.Bavail * uint64(stat.Bsize)
+		return total - free, total, nil
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+
+	// the SQL drivers which can be configured
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// openStorage returns the backend configured in `configPath`, migrating the
+// state in `stateDir` to it if necessary.
+func openStorage(configPath, stateDir string) (store.Backend, error) {
+	config, err := store.LoadStorageConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, migrated, err := config.Backend(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		log.Printf("migrated the state in %s to the database", stateDir)
+	}
+
+	return backend, nil
+}
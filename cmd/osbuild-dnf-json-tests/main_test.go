@@ -44,6 +44,27 @@ func TestFetchChecksum(t *testing.T) {
 	assert.NotEqual(t, "", c["repo"], "The checksum is empty")
 }
 
+func TestFetchAdvisories(t *testing.T) {
+	dir, err := test.SetUpTemporaryRepository()
+	defer func(dir string) {
+		err := test.TearDownTemporaryRepository(dir)
+		assert.Nil(t, err, "Failed to clean up temporary repository.")
+	}(dir)
+	assert.Nilf(t, err, "Failed to set up temporary repository: %v", err)
+
+	repoCfg := rpmmd.RepoConfig{
+		Name:      "repo",
+		BaseURL:   fmt.Sprintf("file://%s", dir),
+		IgnoreSSL: true,
+	}
+
+	// the temporary repository has no updateinfo
+	rpmMetadata := rpmmd.NewRPMMD(path.Join(dir, "rpmmd"), "/usr/libexec/osbuild-composer/dnf-json")
+	advisories, err := rpmMetadata.FetchAdvisories([]rpmmd.RepoConfig{repoCfg}, "platform:f31", "x86_64")
+	assert.Nilf(t, err, "Failed to fetch advisories: %v", err)
+	assert.Empty(t, advisories)
+}
+
 // This test loads all the repositories available in /repositories directory
 // and tries to run depsolve for each architecture. With N architectures available
 // this should run cross-arch dependency solving N-1 times.
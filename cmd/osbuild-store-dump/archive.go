@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	// the SQL drivers which can be configured
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+const (
+	defaultStateDir      = "/var/lib/osbuild-composer"
+	defaultStorageConfig = "/etc/osbuild-composer/storage.toml"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: %[1]s [generate]
+       %[1]s export [-state-dir DIR] [-storage-config FILE] [-artifacts] ARCHIVE
+       %[1]s import [-state-dir DIR] [-storage-config FILE] [-replace] ARCHIVE
+
+export writes the blueprints with their history, sources, upload profiles,
+webhooks, and composes with their jobs to ARCHIVE, and with -artifacts also
+the images of the composes.
+
+import merges ARCHIVE into the state and lists what it didn't import because
+it conflicts with the state. With -replace, the state is replaced instead.
+
+The store is read from and written to where the storage configuration of
+osbuild-composer keeps it, state.json in the state directory by default.
+osbuild-composer must be stopped while exporting or importing.
+`, os.Args[0])
+	os.Exit(2)
+}
+
+func exportState(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = usage
+	stateDir := flags.String("state-dir", defaultStateDir, "state directory of osbuild-composer")
+	storageConfig := flags.String("storage-config", defaultStorageConfig, "storage configuration of osbuild-composer")
+	artifacts := flags.Bool("artifacts", false, "include the images of the composes")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	backend := openBackend(*storageConfig, *stateDir)
+
+	f, err := os.OpenFile(flags.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fail(err)
+	}
+
+	err = store.Export(backend, *stateDir, f, store.ExportOptions{Artifacts: *artifacts})
+	if err != nil {
+		f.Close()
+		os.Remove(flags.Arg(0))
+		fail(err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		fail(err)
+	}
+}
+
+func importState(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = usage
+	stateDir := flags.String("state-dir", defaultStateDir, "state directory of osbuild-composer")
+	storageConfig := flags.String("storage-config", defaultStorageConfig, "storage configuration of osbuild-composer")
+	replace := flags.Bool("replace", false, "replace the state instead of merging the archive into it")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	backend := openBackend(*storageConfig, *stateDir)
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+
+	conflicts, err := store.Import(backend, *stateDir, f, store.ImportOptions{Replace: *replace})
+	if err != nil {
+		fail(err)
+	}
+
+	for _, conflict := range conflicts {
+		fmt.Printf("not imported, exists with different content: %s\n", conflict)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// openBackend returns the backend which osbuild-composer keeps its store in
+// according to the storage configuration `configPath`. Like composer, it
+// migrates a state.json in `stateDir` to a configured database.
+func openBackend(configPath, stateDir string) store.Backend {
+	config, err := store.LoadStorageConfig(configPath)
+	if err != nil {
+		fail(fmt.Errorf("cannot load storage configuration: %v", err))
+	}
+
+	backend, migrated, err := config.Backend(stateDir)
+	if err != nil {
+		fail(fmt.Errorf("cannot open storage: %v", err))
+	}
+	if migrated {
+		fmt.Fprintf(os.Stderr, "migrated the state in %s to the database\n", stateDir)
+	}
+
+	return backend
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	os.Exit(1)
+}
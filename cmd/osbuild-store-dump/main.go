@@ -1,5 +1,10 @@
-// This fills and saves a store with more or less arbitrary data. It is meant to generate test stores as
-// test data for testing upgrades to composer.
+// osbuild-store-dump is an admin tool for the state of composer.
+//
+// Without a command, or with "generate", it fills and saves a store in the current directory with more
+// or less arbitrary data. It is meant to generate test stores as test data for testing upgrades to
+// composer.
+//
+// "export" and "import" back up the state of a composer or migrate it to another host, see usage().
 package main
 
 import (
@@ -35,6 +40,24 @@ func getManifest(bp blueprint.Blueprint, t distro.ImageType, a distro.Arch, d di
 }
 
 func main() {
+	command := "generate"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "generate":
+		generate()
+	case "export":
+		exportState(os.Args[2:])
+	case "import":
+		importState(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func generate() {
 	cwd, err := os.Getwd()
 	if err != nil {
 		panic(err)
@@ -156,27 +179,33 @@ func main() {
 		panic(err)
 	}
 	err = s.PushCompose(id1,
-		getManifest(bp2, t1, a, d, rpmmd, repos),
-		t1,
 		&bp2,
-		0,
-		[]*target.Target{
-			awsTarget,
+		[]store.ImageBuild{
+			{
+				Manifest:  getManifest(bp2, t1, a, d, rpmmd, repos),
+				ImageType: t1,
+				Targets: []*target.Target{
+					awsTarget,
+				},
+				JobID: id1,
+			},
 		},
-		id1,
 	)
 	if err != nil {
 		panic(err)
 	}
 	err = s.PushCompose(id2,
-		getManifest(bp2, t2, a, d, rpmmd, repos),
-		t2,
 		&bp2,
-		0,
-		[]*target.Target{
-			awsTarget,
+		[]store.ImageBuild{
+			{
+				Manifest:  getManifest(bp2, t2, a, d, rpmmd, repos),
+				ImageType: t2,
+				Targets: []*target.Target{
+					awsTarget,
+				},
+				JobID: id2,
+			},
 		},
-		id2,
 	)
 	if err != nil {
 		panic(err)
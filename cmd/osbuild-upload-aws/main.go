@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/osbuild/osbuild-composer/internal/upload/awsupload"
@@ -16,6 +17,10 @@ func main() {
 	var keyName string
 	var filename string
 	var imageName string
+	var shareWith string
+	var copyTo string
+	var bootMode string
+	var arch string
 	flag.StringVar(&accessKeyID, "access-key-id", "", "access key ID")
 	flag.StringVar(&secretAccessKey, "secret-access-key", "", "secret access key")
 	flag.StringVar(&region, "region", "", "target region")
@@ -23,6 +28,10 @@ func main() {
 	flag.StringVar(&keyName, "key", "", "target S3 key name")
 	flag.StringVar(&filename, "image", "", "image file to upload")
 	flag.StringVar(&imageName, "name", "", "AMI name")
+	flag.StringVar(&shareWith, "share-with", "", "comma-separated list of account IDs to share the AMI with")
+	flag.StringVar(&copyTo, "copy-to", "", "comma-separated list of regions to copy the AMI to")
+	flag.StringVar(&bootMode, "boot-mode", "", "boot mode of the AMI (legacy-bios or uefi)")
+	flag.StringVar(&arch, "arch", "x86_64", "architecture of the image (x86_64 or aarch64)")
 	flag.Parse()
 
 	a, err := awsupload.New(region, accessKeyID, secretAccessKey)
@@ -39,11 +48,25 @@ func main() {
 
 	fmt.Printf("file uploaded to %s\n", aws.StringValue(&uploadOutput.Location))
 
-	ami, err := a.Register(imageName, bucketName, keyName)
+	amis, err := a.RegisterWithOptions(imageName, bucketName, keyName, awsupload.RegisterOptions{
+		ShareWithAccounts: splitList(shareWith),
+		CopyToRegions:     splitList(copyTo),
+		BootMode:          bootMode,
+		Architecture:      arch,
+	})
 	if err != nil {
 		println(err.Error())
 		return
 	}
 
-	fmt.Printf("AMI registered: %s\n", aws.StringValue(ami))
+	for _, ami := range amis {
+		fmt.Printf("AMI registered in %s: %s\n", ami.Region, ami.ID)
+	}
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
 }
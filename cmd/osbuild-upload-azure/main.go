@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/osbuild/osbuild-composer/internal/upload/azure"
 )
@@ -23,11 +25,20 @@ func main() {
 	var fileName string
 	var containerName string
 	var threads int
+	var clientCredentials azure.ClientCredentials
+	var imageOptions azure.ManagedImageOptions
 	flag.StringVar(&storageAccount, "storage-account", "", "Azure storage account (mandatory)")
 	flag.StringVar(&storageAccessKey, "storage-access-key", "", "Azure storage access key (mandatory)")
 	flag.StringVar(&fileName, "image", "", "image to upload (mandatory)")
 	flag.StringVar(&containerName, "container", "", "name of storage container (see Azure docs for explanation, mandatory)")
 	flag.IntVar(&threads, "threads", 16, "number of threads for parallel upload")
+	flag.StringVar(&imageOptions.ResourceGroup, "resource-group", "", "resource group to create a managed image in (optional)")
+	flag.StringVar(&imageOptions.Location, "location", "", "location of the managed image")
+	flag.StringVar(&imageOptions.HyperVGeneration, "hyperv-generation", "V1", "hyper-v generation of the managed image (V1 for BIOS or V2 for UEFI)")
+	flag.StringVar(&clientCredentials.TenantID, "tenant-id", "", "tenant of the service principal creating the managed image")
+	flag.StringVar(&clientCredentials.ClientID, "client-id", "", "client ID of the service principal creating the managed image")
+	flag.StringVar(&clientCredentials.ClientSecret, "client-secret", "", "client secret of the service principal creating the managed image")
+	flag.StringVar(&clientCredentials.SubscriptionID, "subscription-id", "", "subscription to create the managed image in")
 	flag.Parse()
 
 	checkStringNotEmpty(storageAccount, "You need to specify storage account")
@@ -37,15 +48,33 @@ func main() {
 
 	fmt.Println("Image to upload is:", fileName)
 
+	metadata := azure.ImageMetadata{
+		ImageName:     path.Base(fileName),
+		ContainerName: containerName,
+	}
 	err := azure.UploadImage(azure.Credentials{
 		StorageAccount:   storageAccount,
 		StorageAccessKey: storageAccessKey,
-	}, azure.ImageMetadata{
-		ImageName:     path.Base(fileName),
-		ContainerName: containerName,
-	}, fileName, threads)
+	}, metadata, fileName, threads)
 
 	if err != nil {
 		fmt.Println("Error: ", err)
+		return
+	}
+
+	if imageOptions.ResourceGroup == "" {
+		return
 	}
+
+	checkStringNotEmpty(imageOptions.Location, "You need to specify the location of the managed image")
+
+	imageOptions.ImageName = strings.TrimSuffix(path.Base(fileName), ".vhd")
+	client := azure.NewManagementClient(clientCredentials)
+	imageID, err := client.CreateManagedImage(context.Background(), imageOptions, azure.BlobURL(storageAccount, metadata))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return
+	}
+
+	fmt.Println("Managed image created:", imageID)
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/upload/awsupload"
 	"github.com/osbuild/osbuild-composer/internal/upload/azure"
+	"github.com/osbuild/osbuild-composer/internal/upload/registry"
 	"github.com/osbuild/osbuild-composer/internal/upload/vmware"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 )
@@ -67,10 +68,10 @@ func (e *TargetsError) Error() string {
 	return errString
 }
 
-func RunJob(job *worker.Job, store string, uploadFunc func(uuid.UUID, string, io.Reader) error) (*osbuild.Result, error) {
+func RunJob(job *worker.Job, store string, uploadFunc func(uuid.UUID, string, io.Reader) error) (*osbuild.Result, []*target.TargetResult, error) {
 	outputDirectory, err := ioutil.TempDir("/var/tmp", "osbuild-worker-*")
 	if err != nil {
-		return nil, fmt.Errorf("error creating temporary output directory: %v", err)
+		return nil, nil, fmt.Errorf("error creating temporary output directory: %v", err)
 	}
 	defer func() {
 		err := os.RemoveAll(outputDirectory)
@@ -81,10 +82,11 @@ func RunJob(job *worker.Job, store string, uploadFunc func(uuid.UUID, string, io
 
 	result, err := RunOSBuild(job.Manifest, store, outputDirectory, os.Stderr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var r []error
+	var targetResults []*target.TargetResult
 
 	for _, t := range job.Targets {
 		switch options := t.Options.(type) {
@@ -111,49 +113,13 @@ func RunJob(job *worker.Job, store string, uploadFunc func(uuid.UUID, string, io
 				continue
 			}
 
-		case *target.AWSTargetOptions:
-
-			a, err := awsupload.New(options.Region, options.AccessKeyID, options.SecretAccessKey)
-			if err != nil {
-				r = append(r, err)
-				continue
-			}
-
-			if options.Key == "" {
-				options.Key = job.Id.String()
-			}
-
-			_, err = a.Upload(path.Join(outputDirectory, options.Filename), options.Bucket, options.Key)
-			if err != nil {
-				r = append(r, err)
-				continue
-			}
-
-			/* TODO: communicate back the AMI */
-			_, err = a.Register(t.ImageName, options.Bucket, options.Key)
-			if err != nil {
-				r = append(r, err)
-				continue
-			}
-		case *target.AzureTargetOptions:
-
-			credentials := azure.Credentials{
-				StorageAccount:   options.StorageAccount,
-				StorageAccessKey: options.StorageAccessKey,
-			}
-			metadata := azure.ImageMetadata{
-				ContainerName: options.Container,
-				ImageName:     t.ImageName,
+		case *target.AWSTargetOptions, *target.AzureTargetOptions, *target.RegistryTargetOptions:
+			// composer enqueues separate upload jobs for these targets,
+			// but jobs queued by older versions may still contain them
+			targetResult, err := uploadToTarget(t, outputDirectory, job.Id)
+			if targetResult != nil {
+				targetResults = append(targetResults, targetResult)
 			}
-
-			const azureMaxUploadGoroutines = 4
-			err := azure.UploadImage(
-				credentials,
-				metadata,
-				path.Join(outputDirectory, options.Filename),
-				azureMaxUploadGoroutines,
-			)
-
 			if err != nil {
 				r = append(r, err)
 				continue
@@ -169,10 +135,199 @@ func RunJob(job *worker.Job, store string, uploadFunc func(uuid.UUID, string, io
 	}
 
 	if len(r) > 0 {
-		return result, &TargetsError{r}
+		return result, targetResults, &TargetsError{r}
+	}
+
+	return result, targetResults, nil
+}
+
+// RunUploadJob downloads the image of an upload job with `downloadFunc` and
+// uploads it to the job's target.
+func RunUploadJob(job *worker.Job, downloadFunc func(uuid.UUID, string, io.Writer) error) ([]*target.TargetResult, error) {
+	if len(job.Targets) != 1 {
+		return nil, fmt.Errorf("upload job has %d targets, expected exactly one", len(job.Targets))
+	}
+
+	outputDirectory, err := ioutil.TempDir("/var/tmp", "osbuild-worker-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary output directory: %v", err)
+	}
+	defer func() {
+		err := os.RemoveAll(outputDirectory)
+		if err != nil {
+			log.Printf("Error removing temporary output directory (%s): %v", outputDirectory, err)
+		}
+	}()
+
+	f, err := os.Create(path.Join(outputDirectory, job.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("error creating image file: %v", err)
+	}
+	err = downloadFunc(job.ImageJobID, job.Filename, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image: %v", err)
+	}
+
+	targetResult, err := uploadToTarget(job.Targets[0], outputDirectory, job.ImageJobID)
+	if targetResult != nil {
+		return []*target.TargetResult{targetResult}, err
+	}
+
+	return nil, err
+}
+
+// Uploads the image in `outputDirectory` to `t`, which must not be a local
+// target. The result may be set even if uploading failed, when some
+// resources were created in the cloud before the error occurred.
+func uploadToTarget(t *target.Target, outputDirectory string, imageJobID uuid.UUID) (*target.TargetResult, error) {
+	switch options := t.Options.(type) {
+	case *target.AWSTargetOptions:
+		a, err := awsupload.New(options.Region, options.AccessKeyID, options.SecretAccessKey)
+		if err != nil {
+			return nil, err
+		}
+
+		key := options.Key
+		if key == "" {
+			key = imageJobID.String()
+		}
+
+		_, err = a.Upload(path.Join(outputDirectory, options.Filename), options.Bucket, key)
+		if err != nil {
+			return nil, err
+		}
+
+		amis, err := a.RegisterWithOptions(t.ImageName, options.Bucket, key, awsupload.RegisterOptions{
+			ShareWithAccounts: options.ShareWithAccounts,
+			CopyToRegions:     options.CopyToRegions,
+			Tags:              options.Tags,
+			EnaSupport:        options.EnaSupport,
+			SriovNetSupport:   options.SriovNetSupport,
+			BootMode:          options.BootMode,
+			Architecture:      options.Architecture,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resultOptions := &target.AWSTargetResultOptions{}
+		for _, ami := range amis {
+			resultOptions.AMIs = append(resultOptions.AMIs, target.AWSTargetResultAMI{
+				Region: ami.Region,
+				AMI:    ami.ID,
+			})
+		}
+		targetResult := target.NewAWSTargetResult(resultOptions)
+		targetResult.TargetUuid = t.Uuid
+		return targetResult, nil
+
+	case *target.AzureTargetOptions:
+		credentials := azure.Credentials{
+			StorageAccount:   options.StorageAccount,
+			StorageAccessKey: options.StorageAccessKey,
+		}
+		metadata := azure.ImageMetadata{
+			ContainerName: options.Container,
+			ImageName:     t.ImageName,
+		}
+
+		const azureMaxUploadGoroutines = 4
+		err := azure.UploadImage(
+			credentials,
+			metadata,
+			path.Join(outputDirectory, options.Filename),
+			azureMaxUploadGoroutines,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resultOptions := &target.AzureTargetResultOptions{
+			BlobURL: azure.BlobURL(options.StorageAccount, metadata),
+		}
+		if options.ResourceGroup != "" {
+			err = createAzureImage(options, t.ImageName, resultOptions)
+		}
+
+		targetResult := target.NewAzureTargetResult(resultOptions)
+		targetResult.TargetUuid = t.Uuid
+		return targetResult, err
+
+	case *target.RegistryTargetOptions:
+		credentials := registry.Credentials{
+			Username: options.Username,
+			Password: options.Password,
+		}
+
+		tlsVerify := true
+		if options.TLSVerify != nil {
+			tlsVerify = *options.TLSVerify
+		}
+
+		client, err := registry.New(options.Registry, credentials, tlsVerify)
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := client.PushArchive(path.Join(outputDirectory, options.Filename), options.Repository, options.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		targetResult := target.NewRegistryTargetResult(&target.RegistryTargetResultOptions{
+			Digest: digest,
+			Tags:   options.Tags,
+		})
+		targetResult.TargetUuid = t.Uuid
+		return targetResult, nil
+
+	default:
+		return nil, fmt.Errorf("invalid target type")
+	}
+}
+
+// Creates a managed image, and optionally a shared image gallery version, from
+// the uploaded blob in `result`. The IDs of all resources that were created are
+// added to `result`, even if creating the gallery image version failed.
+func createAzureImage(options *target.AzureTargetOptions, imageName string, result *target.AzureTargetResultOptions) error {
+	client := azure.NewManagementClient(azure.ClientCredentials{
+		TenantID:       options.TenantID,
+		ClientID:       options.ClientID,
+		ClientSecret:   options.ClientSecret,
+		SubscriptionID: options.SubscriptionID,
+	})
+
+	image := azure.ManagedImageOptions{
+		ResourceGroup:    options.ResourceGroup,
+		Location:         options.Location,
+		ImageName:        imageName,
+		HyperVGeneration: options.HyperVGeneration,
+	}
+
+	imageID, err := client.CreateManagedImage(context.Background(), image, result.BlobURL)
+	if err != nil {
+		return err
+	}
+	result.ImageID = imageID
+
+	if options.Gallery == "" {
+		return nil
 	}
 
-	return result, nil
+	versionID, err := client.CreateGalleryImageVersion(context.Background(), azure.GalleryImageVersionOptions{
+		Gallery:         options.Gallery,
+		ImageDefinition: options.GalleryImage,
+		Version:         options.GalleryImageVersion,
+	}, image, imageID)
+	if err != nil {
+		return err
+	}
+	result.GalleryImageVersionID = versionID
+
+	return nil
 }
 
 // Regularly ask osbuild-composer if the compose we're currently working on was
@@ -245,11 +400,16 @@ func main() {
 
 		fmt.Printf("Running job %s\n", job.Id)
 
+		if job.Type == "upload" {
+			runUploadJob(client, job)
+			continue
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
 		go WatchJob(ctx, client, job)
 
 		var status common.ImageBuildState
-		result, err := RunJob(job, store, client.UploadImage)
+		result, targetResults, err := RunJob(job, store, client.UploadImage)
 		if err != nil {
 			log.Printf("  Job failed: %v", err)
 			status = common.IBFailed
@@ -282,9 +442,37 @@ func main() {
 		// signal to WatchJob() that it can stop watching
 		cancel()
 
-		err = client.UpdateJob(job, status, result)
+		err = client.UpdateJob(job, status, result, targetResults)
 		if err != nil {
 			log.Fatalf("Error reporting job result: %v", err)
 		}
 	}
 }
+
+func runUploadJob(client *worker.Client, job *worker.Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go WatchJob(ctx, client, job)
+
+	status := common.IBFinished
+	targetResults, err := RunUploadJob(job, client.DownloadImage)
+	if err != nil {
+		log.Printf("  Upload failed: %v", err)
+		status = common.IBFailed
+	} else {
+		log.Printf("  🎉 Upload completed successfully: %s", job.Id)
+	}
+
+	// signal to WatchJob() that it can stop watching
+	cancel()
+
+	// composer relies on the success flag of the osbuild result to decide
+	// whether the job succeeded, see worker.UploadJob
+	result := &osbuild.Result{
+		Success: err == nil,
+	}
+
+	err = client.UpdateJob(job, status, result, targetResults)
+	if err != nil {
+		log.Fatalf("Error reporting job result: %v", err)
+	}
+}
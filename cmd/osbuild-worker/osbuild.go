@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"os"
 	"os/exec"
 
 	"github.com/osbuild/osbuild-composer/internal/distro"
@@ -19,13 +23,31 @@ func (e *OSBuildError) Error() string {
 	return e.Message
 }
 
+// osbuildSupportsMonitor returns whether the installed osbuild can write the
+// log of its monitor to a file descriptor, which versions before the one with
+// the LogMonitor can't.
+func osbuildSupportsMonitor() bool {
+	help, err := exec.Command("osbuild", "--help").Output()
+	return err == nil && bytes.Contains(help, []byte("--monitor-fd"))
+}
+
 func RunOSBuild(manifest distro.Manifest, store, outputDirectory string, errorWriter io.Writer) (*osbuild.Result, error) {
-	cmd := exec.Command(
-		"osbuild",
+	args := []string{
 		"--store", store,
 		"--output-directory", outputDirectory,
 		"--json", "-",
-	)
+	}
+
+	// osbuild doesn't report how long each stage ran in its result, only
+	// in the log of its monitor
+	monitor := osbuildSupportsMonitor()
+	if monitor {
+		args = append(args, "--monitor", "LogMonitor", "--monitor-fd", "3")
+	} else {
+		log.Printf("osbuild doesn't support --monitor-fd, stage durations are not reported")
+	}
+
+	cmd := exec.Command("osbuild", args...)
 	cmd.Stderr = errorWriter
 
 	stdin, err := cmd.StdinPipe()
@@ -38,11 +60,41 @@ func RunOSBuild(manifest distro.Manifest, store, outputDirectory string, errorWr
 		return nil, fmt.Errorf("error setting up stdout for osbuild: %v", err)
 	}
 
+	var monitorReader, monitorWriter *os.File
+	if monitor {
+		monitorReader, monitorWriter, err = os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("error setting up osbuild's monitor: %v", err)
+		}
+		defer monitorReader.Close()
+		// the writer is passed as fd 3
+		cmd.ExtraFiles = []*os.File{monitorWriter}
+	}
+
 	err = cmd.Start()
+	if monitorWriter != nil {
+		_ = monitorWriter.Close()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error starting osbuild: %v", err)
 	}
 
+	// read the log while osbuild is running, so that it never blocks
+	// writing to it
+	durations := make(chan map[string]float64, 1)
+	if monitor {
+		go func() {
+			d, err := osbuild.ParseMonitorLog(monitorReader)
+			if err != nil {
+				log.Printf("Error reading osbuild's monitor log: %v", err)
+				_, _ = io.Copy(ioutil.Discard, monitorReader)
+			}
+			durations <- d
+		}()
+	} else {
+		durations <- nil
+	}
+
 	err = json.NewEncoder(stdin).Encode(manifest)
 	if err != nil {
 		return nil, fmt.Errorf("error encoding osbuild pipeline: %v", err)
@@ -57,6 +109,7 @@ func RunOSBuild(manifest distro.Manifest, store, outputDirectory string, errorWr
 	}
 
 	err = cmd.Wait()
+	result.SetDurations(<-durations)
 	if err != nil {
 		return nil, &OSBuildError{
 			Message: fmt.Sprintf("running osbuild failed: %v", err),
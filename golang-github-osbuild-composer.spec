@@ -32,6 +32,7 @@ BuildRequires:  git
 BuildRequires:  golang(github.com/aws/aws-sdk-go)
 BuildRequires:  golang(github.com/Azure/azure-sdk-for-go)
 BuildRequires:  golang(github.com/Azure/azure-storage-blob-go/azblob)
+BuildRequires:  golang(github.com/Azure/go-autorest/autorest/adal)
 BuildRequires:  golang(github.com/BurntSushi/toml)
 BuildRequires:  golang(github.com/coreos/go-semver/semver)
 BuildRequires:  golang(github.com/coreos/go-systemd/activation)
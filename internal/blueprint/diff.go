@@ -0,0 +1,234 @@
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A DiffEntry is a difference between two blueprints. Old and New each map
+// the name of what changed to its value, like {"Package": Package{...}} or
+// {"Customizations.user": UserCustomization{...}}. Old is nil for something
+// which was added, New for something which was removed.
+type DiffEntry struct {
+	Old map[string]interface{} `json:"old"`
+	New map[string]interface{} `json:"new"`
+}
+
+// Diff returns the differences between blueprints `old` and `new`, in the
+// format of lorax-composer: the name, description and version first, then
+// modules, packages and groups, then the customizations.
+// Customizations are compared per field, and lists per element, like per
+// user, SSH key, port or service.
+func Diff(old, new *Blueprint) []DiffEntry {
+	d := &differ{entries: []DiffEntry{}}
+
+	d.value("Name", old.Name, new.Name)
+	d.value("Description", old.Description, new.Description)
+	d.value("Version", old.Version, new.Version)
+
+	d.list("Module", packagesByName(old.Modules), packagesByName(new.Modules))
+	d.list("Package", packagesByName(old.Packages), packagesByName(new.Packages))
+	d.list("Group", groupsByName(old.Groups), groupsByName(new.Groups))
+
+	oldC := old.Customizations
+	if oldC == nil {
+		oldC = &Customizations{}
+	}
+	newC := new.Customizations
+	if newC == nil {
+		newC = &Customizations{}
+	}
+
+	d.pointer("Customizations.hostname", oldC.Hostname, newC.Hostname)
+	d.pointer("Customizations.kernel.append", kernelAppend(oldC.Kernel), kernelAppend(newC.Kernel))
+	d.list("Customizations.sshkey", sshKeysByUser(oldC.SSHKey), sshKeysByUser(newC.SSHKey))
+	d.list("Customizations.user", usersByName(oldC.User), usersByName(newC.User))
+	d.list("Customizations.group", groupCustomizationsByName(oldC.Group), groupCustomizationsByName(newC.Group))
+
+	oldTimezone, newTimezone := timezoneOrEmpty(oldC.Timezone), timezoneOrEmpty(newC.Timezone)
+	d.pointer("Customizations.timezone.timezone", oldTimezone.Timezone, newTimezone.Timezone)
+	d.list("Customizations.timezone.ntpservers", stringsByValue(oldTimezone.NTPServers), stringsByValue(newTimezone.NTPServers))
+
+	oldLocale, newLocale := localeOrEmpty(oldC.Locale), localeOrEmpty(newC.Locale)
+	d.list("Customizations.locale.languages", stringsByValue(oldLocale.Languages), stringsByValue(newLocale.Languages))
+	d.pointer("Customizations.locale.keyboard", oldLocale.Keyboard, newLocale.Keyboard)
+
+	oldFirewall, newFirewall := firewallOrEmpty(oldC.Firewall), firewallOrEmpty(newC.Firewall)
+	d.list("Customizations.firewall.ports", stringsByValue(oldFirewall.Ports), stringsByValue(newFirewall.Ports))
+	d.list("Customizations.firewall.services.enabled", stringsByValue(oldFirewall.Services.Enabled), stringsByValue(newFirewall.Services.Enabled))
+	d.list("Customizations.firewall.services.disabled", stringsByValue(oldFirewall.Services.Disabled), stringsByValue(newFirewall.Services.Disabled))
+
+	oldServices, newServices := servicesOrEmpty(oldC.Services), servicesOrEmpty(newC.Services)
+	d.list("Customizations.services.enabled", stringsByValue(oldServices.Enabled), stringsByValue(newServices.Enabled))
+	d.list("Customizations.services.disabled", stringsByValue(oldServices.Disabled), stringsByValue(newServices.Disabled))
+
+	return d.entries
+}
+
+type differ struct {
+	entries []DiffEntry
+}
+
+func (d *differ) add(name string, old, new interface{}) {
+	var entry DiffEntry
+	if old != nil {
+		entry.Old = map[string]interface{}{name: old}
+	}
+	if new != nil {
+		entry.New = map[string]interface{}{name: new}
+	}
+	d.entries = append(d.entries, entry)
+}
+
+// value adds an entry if `old` and `new` differ. Both are always set.
+func (d *differ) value(name string, old, new interface{}) {
+	if !reflect.DeepEqual(old, new) {
+		d.add(name, old, new)
+	}
+}
+
+// pointer adds an entry if `old` and `new`, which are pointers, differ. A nil
+// pointer means that the value isn't set.
+func (d *differ) pointer(name string, old, new interface{}) {
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(new)
+
+	switch {
+	case oldValue.IsNil() && newValue.IsNil():
+	case oldValue.IsNil():
+		d.add(name, nil, newValue.Elem().Interface())
+	case newValue.IsNil():
+		d.add(name, oldValue.Elem().Interface(), nil)
+	default:
+		d.value(name, oldValue.Elem().Interface(), newValue.Elem().Interface())
+	}
+}
+
+// list adds entries for the elements which were added to, removed from and
+// changed between `old` and `new`, which map names to elements. Like
+// lorax-composer, it adds the added elements first, then the removed, then
+// the changed ones, each sorted by name.
+func (d *differ) list(name string, old, new map[string]interface{}) {
+	var added, removed, same []string
+	for n := range new {
+		if _, ok := old[n]; ok {
+			same = append(same, n)
+		} else {
+			added = append(added, n)
+		}
+	}
+	for n := range old {
+		if _, ok := new[n]; !ok {
+			removed = append(removed, n)
+		}
+	}
+
+	for _, n := range sortedNames(added) {
+		d.add(name, nil, new[n])
+	}
+	for _, n := range sortedNames(removed) {
+		d.add(name, old[n], nil)
+	}
+	for _, n := range sortedNames(same) {
+		d.value(name, old[n], new[n])
+	}
+}
+
+func sortedNames(names []string) []string {
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names
+}
+
+func packagesByName(packages []Package) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, p := range packages {
+		m[p.Name] = p
+	}
+	return m
+}
+
+func groupsByName(groups []Group) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, g := range groups {
+		m[g.Name] = g
+	}
+	return m
+}
+
+func sshKeysByUser(keys []SSHKeyCustomization) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, k := range keys {
+		m[k.User] = k
+	}
+	return m
+}
+
+func usersByName(users []UserCustomization) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, u := range users {
+		m[u.Name] = u
+	}
+	return m
+}
+
+func groupCustomizationsByName(groups []GroupCustomization) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, g := range groups {
+		m[g.Name] = g
+	}
+	return m
+}
+
+func stringsByValue(values []string) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, v := range values {
+		m[v] = v
+	}
+	return m
+}
+
+// kernelAppend returns the kernel command line arguments of `kernel`, or nil
+// if it isn't set.
+func kernelAppend(kernel *KernelCustomization) *string {
+	if kernel == nil {
+		return nil
+	}
+	return &kernel.Append
+}
+
+func timezoneOrEmpty(timezone *TimezoneCustomization) *TimezoneCustomization {
+	if timezone == nil {
+		return &TimezoneCustomization{}
+	}
+	return timezone
+}
+
+func localeOrEmpty(locale *LocaleCustomization) *LocaleCustomization {
+	if locale == nil {
+		return &LocaleCustomization{}
+	}
+	return locale
+}
+
+// firewallOrEmpty returns `firewall`, or an empty customization if it isn't
+// set. Its Services are never nil.
+func firewallOrEmpty(firewall *FirewallCustomization) *FirewallCustomization {
+	f := &FirewallCustomization{}
+	if firewall != nil {
+		*f = *firewall
+	}
+	if f.Services == nil {
+		f.Services = &FirewallServicesCustomization{}
+	}
+	return f
+}
+
+func servicesOrEmpty(services *ServicesCustomization) *ServicesCustomization {
+	if services == nil {
+		return &ServicesCustomization{}
+	}
+	return services
+}
@@ -0,0 +1,77 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	hostname := "host"
+	shell := "/bin/sh"
+	zsh := "/bin/zsh"
+	timezone := "UTC"
+
+	old := Blueprint{
+		Name:     "test",
+		Version:  "0.0.1",
+		Packages: []Package{{Name: "tmux", Version: "*"}, {Name: "httpd", Version: "2.4.*"}},
+		Groups:   []Group{{Name: "core"}},
+		Customizations: &Customizations{
+			Hostname: &hostname,
+			Kernel:   &KernelCustomization{Append: "nosmt"},
+			User:     []UserCustomization{{Name: "alice"}, {Name: "bob", Shell: &shell}},
+			Firewall: &FirewallCustomization{Ports: []string{"22:tcp"}},
+			Services: &ServicesCustomization{Enabled: []string{"sshd"}, Disabled: []string{"cups"}},
+		},
+	}
+	new := Blueprint{
+		Name:     "test",
+		Version:  "0.0.2",
+		Packages: []Package{{Name: "httpd", Version: "2.6.*"}, {Name: "vim", Version: "*"}, {Name: "Emacs"}},
+		Groups:   []Group{{Name: "core"}},
+		Customizations: &Customizations{
+			Kernel:   &KernelCustomization{Append: "nosmt quiet"},
+			SSHKey:   []SSHKeyCustomization{{User: "root", Key: "ssh-ed25519"}},
+			User:     []UserCustomization{{Name: "bob", Shell: &zsh}},
+			Timezone: &TimezoneCustomization{Timezone: &timezone},
+			Locale:   &LocaleCustomization{Languages: []string{"en_US.UTF-8"}},
+			Firewall: &FirewallCustomization{
+				Ports:    []string{"22:tcp", "80:tcp"},
+				Services: &FirewallServicesCustomization{Enabled: []string{"http"}},
+			},
+			Services: &ServicesCustomization{Enabled: []string{"sshd", "httpd"}},
+		},
+	}
+
+	require.Equal(t, []DiffEntry{
+		{Old: map[string]interface{}{"Version": "0.0.1"}, New: map[string]interface{}{"Version": "0.0.2"}},
+		{New: map[string]interface{}{"Package": Package{Name: "Emacs"}}},
+		{New: map[string]interface{}{"Package": Package{Name: "vim", Version: "*"}}},
+		{Old: map[string]interface{}{"Package": Package{Name: "tmux", Version: "*"}}},
+		{
+			Old: map[string]interface{}{"Package": Package{Name: "httpd", Version: "2.4.*"}},
+			New: map[string]interface{}{"Package": Package{Name: "httpd", Version: "2.6.*"}},
+		},
+		{Old: map[string]interface{}{"Customizations.hostname": "host"}},
+		{
+			Old: map[string]interface{}{"Customizations.kernel.append": "nosmt"},
+			New: map[string]interface{}{"Customizations.kernel.append": "nosmt quiet"},
+		},
+		{New: map[string]interface{}{"Customizations.sshkey": SSHKeyCustomization{User: "root", Key: "ssh-ed25519"}}},
+		{Old: map[string]interface{}{"Customizations.user": UserCustomization{Name: "alice"}}},
+		{
+			Old: map[string]interface{}{"Customizations.user": UserCustomization{Name: "bob", Shell: &shell}},
+			New: map[string]interface{}{"Customizations.user": UserCustomization{Name: "bob", Shell: &zsh}},
+		},
+		{New: map[string]interface{}{"Customizations.timezone.timezone": "UTC"}},
+		{New: map[string]interface{}{"Customizations.locale.languages": "en_US.UTF-8"}},
+		{New: map[string]interface{}{"Customizations.firewall.ports": "80:tcp"}},
+		{New: map[string]interface{}{"Customizations.firewall.services.enabled": "http"}},
+		{New: map[string]interface{}{"Customizations.services.enabled": "httpd"}},
+		{Old: map[string]interface{}{"Customizations.services.disabled": "cups"}},
+	}, Diff(&old, &new))
+
+	require.Empty(t, Diff(&old, &old))
+	require.Empty(t, Diff(&Blueprint{}, &Blueprint{Customizations: &Customizations{}}))
+}
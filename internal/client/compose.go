@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/osbuild/osbuild-composer/internal/weldr"
 )
@@ -59,36 +61,83 @@ func GetFailedComposesV0(socket *http.Client) ([]weldr.ComposeEntryV0, *APIRespo
 	return failed.Failed, nil, nil
 }
 
-// GetComposeStatusV0 returns a list of composes matching the optional filter parameters
-func GetComposeStatusV0(socket *http.Client, uuids, blueprint, status, composeType string) ([]weldr.ComposeEntryV0, *APIResponse, error) {
-	// Build the query string
-	route := "/api/v0/compose/status/" + uuids
+// ComposeStatusQuery holds the optional parameters of GetComposeStatusV0.
+// Zero values are not sent.
+type ComposeStatusQuery struct {
+	Blueprint    string
+	Status       string
+	Type         string
+	UploadStatus string
+	Since        time.Time
+	Until        time.Time
+
+	// Sort is one of "id" (the default), "created", "started", "finished"
+	// or "blueprint"
+	Sort       string
+	Descending bool
+
+	// Limit is the maximum number of composes returned, 0 returns all
+	// of them. Cursor is the cursor returned for the previous page.
+	Limit  uint
+	Cursor string
+}
 
+func (q ComposeStatusQuery) values() url.Values {
 	params := url.Values{}
-	if len(blueprint) > 0 {
-		params.Add("blueprint", blueprint)
+	if len(q.Blueprint) > 0 {
+		params.Add("blueprint", q.Blueprint)
+	}
+	if len(q.Status) > 0 {
+		params.Add("status", q.Status)
+	}
+	if len(q.Type) > 0 {
+		params.Add("type", q.Type)
+	}
+	if len(q.UploadStatus) > 0 {
+		params.Add("upload_status", q.UploadStatus)
+	}
+	if !q.Since.IsZero() {
+		params.Add("since", q.Since.Format(time.RFC3339))
 	}
-	if len(status) > 0 {
-		params.Add("status", status)
+	if !q.Until.IsZero() {
+		params.Add("until", q.Until.Format(time.RFC3339))
 	}
-	if len(composeType) > 0 {
-		params.Add("type", composeType)
+	if len(q.Sort) > 0 {
+		params.Add("sort", q.Sort)
 	}
+	if q.Descending {
+		params.Add("order", "desc")
+	}
+	if q.Limit > 0 {
+		params.Add("limit", strconv.FormatUint(uint64(q.Limit), 10))
+	}
+	if len(q.Cursor) > 0 {
+		params.Add("cursor", q.Cursor)
+	}
+	return params
+}
 
+// GetComposeStatusV0 returns a list of composes matching the optional query
+// parameters, and the cursor of the next page if there is one
+func GetComposeStatusV0(socket *http.Client, uuids string, query ComposeStatusQuery) ([]weldr.ComposeEntryV0, string, *APIResponse, error) {
+	// Build the query string
+	route := "/api/v0/compose/status/" + uuids
+
+	params := query.values()
 	if len(params) > 0 {
 		route = route + "?" + params.Encode()
 	}
 
 	body, resp, err := GetRaw(socket, "GET", route)
 	if resp != nil || err != nil {
-		return []weldr.ComposeEntryV0{}, resp, err
+		return []weldr.ComposeEntryV0{}, "", resp, err
 	}
 	var composes weldr.ComposeStatusResponseV0
 	err = json.Unmarshal(body, &composes)
 	if err != nil {
-		return []weldr.ComposeEntryV0{}, nil, err
+		return []weldr.ComposeEntryV0{}, "", nil, err
 	}
-	return composes.UUIDs, nil, nil
+	return composes.UUIDs, composes.NextCursor, nil, nil
 }
 
 // GetComposeTypesV0 returns a list of the failed composes
@@ -208,7 +208,7 @@ func TestComposeInvalidResultsV0(t *testing.T) {
 
 // Test status filter for unknown uuid
 func TestComposeInvalidStatusV0(t *testing.T) {
-	status, resp, err := GetComposeStatusV0(testState.socket, "c91818f9-8025-47af-89d2-f030d7000c2c", "", "", "")
+	status, _, resp, err := GetComposeStatusV0(testState.socket, "c91818f9-8025-47af-89d2-f030d7000c2c", ComposeStatusQuery{})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.Equal(t, 0, len(status))
@@ -216,7 +216,7 @@ func TestComposeInvalidStatusV0(t *testing.T) {
 
 // Test status filter for unknown blueprint
 func TestComposeUnknownBlueprintStatusV0(t *testing.T) {
-	status, resp, err := GetComposeStatusV0(testState.socket, "*", "unknown-blueprint-test", "", "")
+	status, _, resp, err := GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Blueprint: "unknown-blueprint-test"})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.Equal(t, 0, len(status))
@@ -224,7 +224,7 @@ func TestComposeUnknownBlueprintStatusV0(t *testing.T) {
 
 // Test status filter for blueprint with invalid characters
 func TestComposeInvalidBlueprintStatusV0(t *testing.T) {
-	status, resp, err := GetComposeStatusV0(testState.socket, "*", "I ｗ𝒊ll 𝟉ο𝘁 𝛠ａ𝔰ꜱ 𝘁𝒉𝝸𝚜", "", "")
+	status, _, resp, err := GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Blueprint: "I ｗ𝒊ll 𝟉ο𝘁 𝛠ａ𝔰ꜱ 𝘁𝒉𝝸𝚜"})
 	require.NoError(t, err, "failed with a client error")
 	require.NotNil(t, resp)
 	require.Equal(t, "InvalidChars", resp.Errors[0].ID)
@@ -316,19 +316,19 @@ func TestFailedComposeV0(t *testing.T) {
 	require.True(t, UUIDInComposeResults(buildID, failed), "%s not found in failed list: %#v", buildID, failed)
 
 	// Test status filter on failed compose
-	status, resp, err := GetComposeStatusV0(testState.socket, "*", "", "FAILED", "")
+	status, _, resp, err := GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Status: "FAILED"})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.True(t, UUIDInComposeResults(buildID, status), "%s not found in status list: %#v", buildID, status)
 
 	// Test status of build id
-	status, resp, err = GetComposeStatusV0(testState.socket, buildID.String(), "", "", "")
+	status, _, resp, err = GetComposeStatusV0(testState.socket, buildID.String(), ComposeStatusQuery{})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.True(t, UUIDInComposeResults(buildID, status), "%s not found in status list: %#v", buildID, status)
 
 	// Test status filter using FINISHED, should not be listed
-	status, resp, err = GetComposeStatusV0(testState.socket, "*", "", "FINISHED", "")
+	status, _, resp, err = GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Status: "FINISHED"})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.False(t, UUIDInComposeResults(buildID, status))
@@ -411,23 +411,40 @@ func TestFinishedComposeV0(t *testing.T) {
 	require.True(t, UUIDInComposeResults(buildID, finished), "%s not found in finished list: %#v", buildID, finished)
 
 	// Test status filter on finished compose
-	status, resp, err := GetComposeStatusV0(testState.socket, "*", "", "FINISHED", "")
+	status, _, resp, err := GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Status: "FINISHED"})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.True(t, UUIDInComposeResults(buildID, status), "%s not found in status list: %#v", buildID, status)
 
 	// Test status of build id
-	status, resp, err = GetComposeStatusV0(testState.socket, buildID.String(), "", "", "")
+	status, _, resp, err = GetComposeStatusV0(testState.socket, buildID.String(), ComposeStatusQuery{})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.True(t, UUIDInComposeResults(buildID, status), "%s not found in status list: %#v", buildID, status)
 
 	// Test status filter using FAILED, should not be listed
-	status, resp, err = GetComposeStatusV0(testState.socket, "*", "", "FAILED", "")
+	status, _, resp, err = GetComposeStatusV0(testState.socket, "*", ComposeStatusQuery{Status: "FAILED"})
 	require.NoError(t, err, "failed with a client error")
 	require.Nil(t, resp)
 	require.False(t, UUIDInComposeResults(buildID, status))
 
+	// Test paging through the finished composes, newest first
+	query := ComposeStatusQuery{Status: "FINISHED", Sort: "created", Descending: true, Limit: 1}
+	var pages []weldr.ComposeEntryV0
+	for {
+		var next string
+		status, next, resp, err = GetComposeStatusV0(testState.socket, "*", query)
+		require.NoError(t, err, "failed with a client error")
+		require.Nil(t, resp)
+		require.LessOrEqual(t, len(status), 1)
+		pages = append(pages, status...)
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+	require.True(t, UUIDInComposeResults(buildID, pages), "%s not found in status pages: %#v", buildID, pages)
+
 	// Test compose info for the finished compose
 	info, resp, err := GetComposeInfoV0(testState.socket, buildID.String())
 	require.NoError(t, err, "failed with a client error")
@@ -0,0 +1,3 @@
+//go:generate go run github.com/deepmap/oapi-codegen/cmd/oapi-codegen -package=api -generate types,server,skip-prune -o api.gen.go openapi.yml
+
+package api
@@ -0,0 +1,94 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/osbuild/osbuild-composer/internal/cloudapi/api"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// apiError is an error which is returned to the client as an api.Error.
+type apiError struct {
+	body api.Error
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.body.Id, e.body.Reason)
+}
+
+func newError(code int, id string, format string, args ...interface{}) error {
+	return &apiError{
+		body: api.Error{
+			Id:     id,
+			Code:   code,
+			Reason: fmt.Sprintf(format, args...),
+		},
+	}
+}
+
+// quotaError converts errors from pushing composes into api errors.
+func quotaError(err error) error {
+	if _, ok := err.(*store.QuotaExceededError); ok {
+		return newError(http.StatusForbidden, "QuotaExceeded", "%v", err)
+	}
+	return newError(http.StatusInternalServerError, "ComposePushErrored", "%v", err)
+}
+
+// errorHandler renders all errors as api.Error, including those returned by
+// echo itself, such as for unknown routes.
+func errorHandler(err error, ctx echo.Context) {
+	var body api.Error
+	switch e := err.(type) {
+	case *apiError:
+		body = e.body
+	case *echo.HTTPError:
+		body = api.Error{
+			Id:     strings.ReplaceAll(http.StatusText(e.Code), " ", ""),
+			Code:   e.Code,
+			Reason: fmt.Sprint(e.Message),
+		}
+	default:
+		body = api.Error{
+			Id:     "InternalError",
+			Code:   http.StatusInternalServerError,
+			Reason: err.Error(),
+		}
+	}
+
+	if ctx.Response().Committed {
+		return
+	}
+
+	err = ctx.JSON(body.Code, body)
+	if err != nil {
+		ctx.Logger().Error(err)
+	}
+}
+
+// A simple echo.Binder(), which only accepts application/json, but is more
+// strict than echo's DefaultBinder. It does not handle binding query
+// parameters either, and rejects unknown fields.
+type binder struct{}
+
+func (b binder) Bind(i interface{}, ctx echo.Context) error {
+	request := ctx.Request()
+
+	contentType := request.Header["Content-Type"]
+	if len(contentType) != 1 || contentType[0] != "application/json" {
+		return newError(http.StatusUnsupportedMediaType, "UnsupportedMediaType", "request must be json-encoded")
+	}
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(i)
+	if err != nil {
+		return newError(http.StatusBadRequest, "InvalidRequest", "cannot parse request body: %v", err)
+	}
+
+	return nil
+}
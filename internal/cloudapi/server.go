@@ -0,0 +1,480 @@
+// Package cloudapi implements the cloud API of osbuild-composer, a versioned
+// JSON API which builds and uploads images from self-contained requests.
+package cloudapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/cloudapi/api"
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/composes"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/target"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+// Server serves the cloud API. Composes created through it are stored in
+// the same store as those created through the weldr API.
+type Server struct {
+	echo      *echo.Echo
+	workers   *worker.Server
+	rpmmd     rpmmd.RPMMD
+	arch      distro.Arch
+	namespace NamespaceFunc
+
+	manifestSchemas *osbuild.Schemas
+}
+
+// NamespaceFunc returns the view of the store that belongs to the client
+// which sent `request`.
+type NamespaceFunc func(request *http.Request) *store.Store
+
+// NewServer returns a server which builds images for `arch` on `workers`.
+func NewServer(logger *log.Logger, workers *worker.Server, rpm rpmmd.RPMMD, arch distro.Arch, namespace NamespaceFunc) *Server {
+	s := &Server{
+		workers:   workers,
+		rpmmd:     rpm,
+		arch:      arch,
+		namespace: namespace,
+
+		manifestSchemas: osbuild.VendoredSchemas(),
+	}
+
+	s.echo = echo.New()
+	s.echo.Binder = binder{}
+	s.echo.HTTPErrorHandler = errorHandler
+	s.echo.StdLogger = logger
+
+	api.RegisterHandlers(s.echo, &apiHandlers{s})
+
+	return s
+}
+
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.echo.ServeHTTP(writer, request)
+}
+
+// SetManifestSchemas sets the schemas of osbuild's stages which manifests are
+// validated against before they're queued. They default to the schemas
+// vendored into composer.
+func (s *Server) SetManifestSchemas(schemas *osbuild.Schemas) {
+	s.manifestSchemas = schemas
+}
+
+// apiHandlers implements api.ServerInterface - the http api route handlers
+// generated from api/openapi.yml. This is a separate object, because these
+// handlers should not be exposed on the `Server` object.
+type apiHandlers struct {
+	server *Server
+}
+
+func (h *apiHandlers) PostCompose(ctx echo.Context) error {
+	var request api.ComposeRequest
+	err := ctx.Bind(&request)
+	if err != nil {
+		return err
+	}
+
+	if len(request.ImageRequests) == 0 {
+		return newError(http.StatusBadRequest, "InvalidImageRequests", "at least one image request is required")
+	}
+
+	distribution := h.server.arch.Distro()
+	if request.Distribution != distribution.Name() {
+		return newError(http.StatusBadRequest, "UnsupportedDistribution", "cannot build images for %s, only for %s", request.Distribution, distribution.Name())
+	}
+
+	bp := &blueprint.Blueprint{}
+	if request.Blueprint != nil {
+		bp, err = parseBlueprint(*request.Blueprint)
+		if err != nil {
+			return newError(http.StatusBadRequest, "InvalidBlueprint", "%v", err)
+		}
+	}
+
+	composeID := uuid.New()
+
+	var imageBuilds []store.ImageBuild
+	var imageRepos [][]rpmmd.RepoConfig
+	for i, ir := range request.ImageRequests {
+		if ir.Architecture != h.server.arch.Name() {
+			return newError(http.StatusBadRequest, "UnsupportedArchitecture", "cannot build images for %s, only for %s", ir.Architecture, h.server.arch.Name())
+		}
+		imageType, err := h.server.arch.GetImageType(ir.ImageType)
+		if err != nil {
+			return newError(http.StatusBadRequest, "UnknownImageType", "unknown image type for %s: %s", ir.Architecture, ir.ImageType)
+		}
+
+		repos, err := repositories(ir.Repositories)
+		if err != nil {
+			return newError(http.StatusBadRequest, "InvalidRepository", "%v", err)
+		}
+
+		targets := []*target.Target{
+			target.NewLocalTarget(&target.LocalTargetOptions{
+				ComposeId:       composeID,
+				ImageBuildId:    i,
+				Filename:        imageType.Filename(),
+				StreamOptimized: imageType.Name() == "vmdk", // TODO: move conversion to osbuild
+			}),
+		}
+		if ir.UploadRequests != nil {
+			for _, u := range *ir.UploadRequests {
+				t, err := uploadRequestToTarget(u, imageType)
+				if err != nil {
+					return newError(http.StatusBadRequest, "InvalidUploadRequest", "%v", err)
+				}
+				targets = append(targets, t)
+			}
+		}
+
+		imageBuilds = append(imageBuilds, store.ImageBuild{
+			ImageType: imageType,
+			Targets:   targets,
+			Size:      imageType.Size(0),
+		})
+		imageRepos = append(imageRepos, repos)
+	}
+
+	ns := h.server.namespace(ctx.Request())
+	err = ns.CheckComposeQuota()
+	if err != nil {
+		return quotaError(err)
+	}
+
+	for i := range imageBuilds {
+		ib := &imageBuilds[i]
+		packages, buildPackages, err := h.server.depsolve(bp, ib.ImageType, imageRepos[i])
+		if err != nil {
+			return newError(http.StatusBadRequest, "DepsolveError", "%v", err)
+		}
+
+		ib.Manifest, err = ib.ImageType.Manifest(bp.Customizations,
+			distro.ImageOptions{
+				Size: ib.Size,
+			},
+			imageRepos[i],
+			packages,
+			buildPackages)
+		if err != nil {
+			return newError(http.StatusBadRequest, "ManifestCreationFailed", "failed to create osbuild manifest: %v", err)
+		}
+		err = h.server.manifestSchemas.Validate(&ib.Manifest.Manifest)
+		if err != nil {
+			return newError(http.StatusBadRequest, "ManifestCreationFailed", "invalid manifest: %v", err)
+		}
+		ib.Packages = packages
+		ib.BuildPackages = buildPackages
+	}
+
+	err = composes.Push(h.server.workers, ns, composeID, bp, imageBuilds)
+	if err != nil {
+		return quotaError(err)
+	}
+
+	return ctx.JSON(http.StatusCreated, api.ComposeResult{
+		Id: composeID.String(),
+	})
+}
+
+func (h *apiHandlers) GetComposeId(ctx echo.Context, id string) error {
+	composeID, err := uuid.Parse(id)
+	if err != nil {
+		return newError(http.StatusBadRequest, "InvalidComposeId", "cannot parse compose id: %v", err)
+	}
+
+	compose, exists := h.server.namespace(ctx.Request()).GetCompose(composeID)
+	if !exists {
+		return newError(http.StatusNotFound, "UnknownCompose", "compose does not exist: %s", composeID)
+	}
+
+	imageStatuses := []api.ImageStatus{}
+	for _, ib := range compose.ImageBuilds {
+		imageStatus, err := h.server.imageStatus(ib)
+		if err != nil {
+			return newError(http.StatusInternalServerError, "InternalError", "cannot get status of compose %s: %v", composeID, err)
+		}
+		imageStatuses = append(imageStatuses, *imageStatus)
+	}
+
+	return ctx.JSON(http.StatusOK, api.ComposeStatus{
+		Id:            composeID.String(),
+		Status:        composeStatus(imageStatuses),
+		ImageStatuses: imageStatuses,
+	})
+}
+
+func (s *Server) depsolve(bp *blueprint.Blueprint, imageType distro.ImageType, repos []rpmmd.RepoConfig) ([]rpmmd.PackageSpec, []rpmmd.PackageSpec, error) {
+	modulePlatformID := s.arch.Distro().ModulePlatformID()
+
+	specs, excludeSpecs := imageType.Packages(*bp)
+	packages, _, err := s.rpmmd.Depsolve(specs, excludeSpecs, repos, modulePlatformID, s.arch.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buildPackages, _, err := s.rpmmd.Depsolve(imageType.BuildPackages(), nil, repos, modulePlatformID, s.arch.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return packages, buildPackages, nil
+}
+
+// imageStatus returns the status of `imageBuild` and all of its uploads.
+func (s *Server) imageStatus(imageBuild store.ImageBuild) (*api.ImageStatus, error) {
+	state, err := s.jobState(imageBuild)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[uuid.UUID]*target.TargetResult)
+	for _, result := range imageBuild.TargetResults {
+		results[result.TargetUuid] = result
+	}
+
+	uploadStatuses := []api.UploadStatus{}
+	for _, t := range imageBuild.Targets {
+		uploadType, isUpload := uploadTypes[t.Name]
+		if !isUpload {
+			continue
+		}
+
+		// uploads share the state of the image build until their job
+		// is enqueued
+		uploadState := state
+		if jobID, exists := imageBuild.UploadJobs[t.Uuid]; exists {
+			uploadJobStatus, err := s.workers.JobStatus(jobID)
+			if err != nil {
+				return nil, err
+			}
+			uploadState = uploadJobStatus.State
+			for _, result := range uploadJobStatus.Result.TargetResults {
+				results[result.TargetUuid] = result
+			}
+		}
+
+		status := api.UploadStatus{
+			Id:     t.Uuid.String(),
+			Type:   uploadType,
+			Status: stateToStatus(uploadState),
+		}
+		if result, exists := results[t.Uuid]; exists && uploadState == common.CFinished {
+			var options interface{} = result.Options
+			status.Options = &options
+		}
+		uploadStatuses = append(uploadStatuses, status)
+	}
+
+	return &api.ImageStatus{
+		Architecture:   imageBuild.ImageType.Arch().Name(),
+		ImageType:      imageBuild.ImageType.Name(),
+		Status:         stateToStatus(state),
+		UploadStatuses: uploadStatuses,
+	}, nil
+}
+
+// jobState returns the state of the job which builds `imageBuild`.
+func (s *Server) jobState(imageBuild store.ImageBuild) (common.ComposeState, error) {
+	// backwards compatibility: image builds from before the job queue
+	// existed, and test composes, don't have a job
+	if imageBuild.JobID == uuid.Nil {
+		switch imageBuild.QueueStatus {
+		case common.IBRunning:
+			return common.CRunning, nil
+		case common.IBFinished:
+			return common.CFinished, nil
+		case common.IBFailed:
+			return common.CFailed, nil
+		default:
+			return common.CWaiting, nil
+		}
+	}
+
+	jobStatus, err := s.workers.JobStatus(imageBuild.JobID)
+	if err != nil {
+		return common.CWaiting, err
+	}
+	return jobStatus.State, nil
+}
+
+// composeStatus summarizes the statuses of all images and uploads of a
+// compose: it failed when anything failed, and succeeded when everything
+// succeeded.
+func composeStatus(images []api.ImageStatus) api.Status {
+	var statuses []api.Status
+	for _, image := range images {
+		statuses = append(statuses, image.Status)
+		for _, upload := range image.UploadStatuses {
+			statuses = append(statuses, upload.Status)
+		}
+	}
+
+	pending := true
+	success := true
+	for _, status := range statuses {
+		if status == api.Status_failure {
+			return api.Status_failure
+		}
+		if status != api.Status_pending {
+			pending = false
+		}
+		if status != api.Status_success {
+			success = false
+		}
+	}
+
+	switch {
+	case success:
+		return api.Status_success
+	case pending:
+		return api.Status_pending
+	default:
+		return api.Status_running
+	}
+}
+
+func stateToStatus(state common.ComposeState) api.Status {
+	switch state {
+	case common.CRunning:
+		return api.Status_running
+	case common.CFinished:
+		return api.Status_success
+	case common.CFailed:
+		return api.Status_failure
+	default:
+		return api.Status_pending
+	}
+}
+
+// uploadTypes maps the names of the targets the cloud API supports to
+// their upload type.
+var uploadTypes = map[string]string{
+	"org.osbuild.aws":   "aws",
+	"org.osbuild.azure": "azure",
+}
+
+// parseBlueprint converts the free-form blueprint of a compose request into
+// a blueprint.
+func parseBlueprint(data map[string]interface{}) (*blueprint.Blueprint, error) {
+	var bp blueprint.Blueprint
+	err := convert(data, &bp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blueprint: %v", err)
+	}
+	return &bp, nil
+}
+
+func repositories(repos []api.Repository) ([]rpmmd.RepoConfig, error) {
+	if len(repos) == 0 {
+		return nil, errors.New("at least one repository is required")
+	}
+
+	var configs []rpmmd.RepoConfig
+	for i, repo := range repos {
+		config := rpmmd.RepoConfig{
+			Name: fmt.Sprintf("repo-%d", i),
+		}
+
+		var sources int
+		if repo.Baseurl != nil {
+			config.BaseURL = *repo.Baseurl
+			sources++
+		}
+		if repo.Metalink != nil {
+			config.Metalink = *repo.Metalink
+			sources++
+		}
+		if repo.Mirrorlist != nil {
+			config.MirrorList = *repo.Mirrorlist
+			sources++
+		}
+		if sources != 1 {
+			return nil, fmt.Errorf("repository %d must have exactly one of baseurl, metalink and mirrorlist", i)
+		}
+
+		if repo.Gpgkey != nil {
+			config.GPGKey = *repo.Gpgkey
+		}
+		if repo.CheckGpg != nil {
+			config.CheckGPG = *repo.CheckGpg
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func uploadRequestToTarget(u api.UploadRequest, imageType distro.ImageType) (*target.Target, error) {
+	switch u.Type {
+	case "aws":
+		var options api.AWSUploadRequestOptions
+		err := convert(u.Options, &options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws upload options: %v", err)
+		}
+
+		var shareWithAccounts []string
+		if options.ShareWithAccounts != nil {
+			shareWithAccounts = *options.ShareWithAccounts
+		}
+
+		t := target.NewAWSTarget(&target.AWSTargetOptions{
+			Filename:          imageType.Filename(),
+			Region:            options.Region,
+			AccessKeyID:       options.AccessKeyId,
+			SecretAccessKey:   options.SecretAccessKey,
+			Bucket:            options.Bucket,
+			Key:               uuid.New().String(),
+			ShareWithAccounts: shareWithAccounts,
+			Architecture:      imageType.Arch().Name(),
+		})
+		t.ImageName = options.ImageName
+		return t, nil
+
+	case "azure":
+		var options api.AzureUploadRequestOptions
+		err := convert(u.Options, &options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure upload options: %v", err)
+		}
+
+		t := target.NewAzureTarget(&target.AzureTargetOptions{
+			Filename:         imageType.Filename(),
+			StorageAccount:   options.StorageAccount,
+			StorageAccessKey: options.StorageAccessKey,
+			Container:        options.Container,
+		})
+		t.ImageName = options.ImageName
+		return t, nil
+
+	default:
+		return nil, fmt.Errorf("unknown upload type: %s", u.Type)
+	}
+}
+
+// convert decodes `data`, which was decoded from JSON into generic maps and
+// slices, into `v`. Unknown fields are rejected.
+func convert(data interface{}, v interface{}) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,263 @@
+package cloudapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/cloudapi"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/test"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+func newServer(t *testing.T) (*cloudapi.Server, *worker.Server, *store.Store) {
+	fixture := rpmmd_mock.NoComposesFixture()
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	namespace := func(*http.Request) *store.Store {
+		return fixture.Store
+	}
+	server := cloudapi.NewServer(nil, fixture.Workers, rpmmd_mock.NewRPMMDMock(fixture), arch, namespace)
+
+	return server, fixture.Workers, fixture.Store
+}
+
+// Finishes the next job in the queue of `workers`, like a worker would.
+func finishNextJob(t *testing.T, workers *worker.Server, update string) {
+	t.Helper()
+
+	request := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		workers.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	response := request("POST", "/job-queue/v1/jobs", `{}`)
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	var job struct {
+		Id string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+
+	response = request("PATCH", "/job-queue/v1/jobs/"+job.Id, update)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestErrors(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	server, _, _ := newServer(t)
+
+	imageRequest := `{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}]}`
+
+	var cases = []struct {
+		Method         string
+		Path           string
+		Body           string
+		ExpectedStatus int
+		ExpectedID     string
+	}{
+		{"GET", "/api/composer/v1/foo", ``, http.StatusNotFound, "NotFound"},
+		{"GET", "/api/composer/v1/compose", ``, http.StatusMethodNotAllowed, "MethodNotAllowed"},
+		{"POST", "/api/composer/v1/compose", `{`, http.StatusBadRequest, "InvalidRequest"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[],"unknown":1}`, http.StatusBadRequest, "InvalidRequest"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[]}`, http.StatusBadRequest, "InvalidImageRequests"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"fedora-32","image_requests":[` + imageRequest + `]}`, http.StatusBadRequest, "UnsupportedDistribution"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"s390x","image_type":"test_type","repositories":[]}]}`, http.StatusBadRequest, "UnsupportedArchitecture"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"vhd","repositories":[]}]}`, http.StatusBadRequest, "UnknownImageType"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[]}]}`, http.StatusBadRequest, "InvalidRepository"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com","metalink":"http://example.com"}]}]}`, http.StatusBadRequest, "InvalidRepository"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","blueprint":{"packages":"all"},"image_requests":[` + imageRequest + `]}`, http.StatusBadRequest, "InvalidBlueprint"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}],"upload_requests":[{"type":"gcp","options":{}}]}]}`, http.StatusBadRequest, "InvalidUploadRequest"},
+		{"POST", "/api/composer/v1/compose", `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}],"upload_requests":[{"type":"aws","options":{"region":"eu-central-1","bucket":1}}]}]}`, http.StatusBadRequest, "InvalidUploadRequest"},
+		{"GET", "/api/composer/v1/compose/foo", ``, http.StatusBadRequest, "InvalidComposeId"},
+		{"GET", "/api/composer/v1/compose/30000000-0000-0000-0000-000000000000", ``, http.StatusNotFound, "UnknownCompose"},
+	}
+
+	for _, c := range cases {
+		response := test.SendHTTP(server, false, c.Method, c.Path, c.Body)
+		require.Equalf(t, c.ExpectedStatus, response.StatusCode, "%s %s", c.Method, c.Path)
+
+		var reply struct {
+			ID   string `json:"id"`
+			Code int    `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+		require.Equalf(t, c.ExpectedID, reply.ID, "%s %s: %s", c.Method, c.Path, c.Body)
+		require.Equal(t, c.ExpectedStatus, reply.Code)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	server, workers, s := newServer(t)
+
+	request := `{
+		"distribution": "test-distro",
+		"blueprint": {"name": "cloud", "packages": [{"name": "tmux", "version": "*"}]},
+		"image_requests": [{
+			"architecture": "test_arch",
+			"image_type": "test_type",
+			"repositories": [{"baseurl": "http://example.com/repo", "check_gpg": true}],
+			"upload_requests": [{
+				"type": "aws",
+				"options": {
+					"region": "eu-central-1",
+					"access_key_id": "id",
+					"secret_access_key": "secret",
+					"bucket": "bucket",
+					"image_name": "cloud-image"
+				}
+			}]
+		}]
+	}`
+
+	response := test.SendHTTP(server, false, "POST", "/api/composer/v1/compose", request)
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	var result struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+
+	compose, exists := s.GetCompose(uuid.MustParse(result.ID))
+	require.True(t, exists)
+	require.Equal(t, "cloud", compose.Blueprint.Name)
+	require.Len(t, compose.ImageBuilds[0].Targets, 2)
+	require.Len(t, compose.ImageBuilds[0].UploadJobs, 1)
+	uploadID := compose.ImageBuilds[0].Targets[1].Uuid.String()
+
+	status := func(composeStatus, imageStatus, uploadStatus string) {
+		t.Helper()
+		expected := `{"id":"` + result.ID + `","status":"` + composeStatus + `","image_statuses":[{"architecture":"test_arch","image_type":"test_type","status":"` + imageStatus + `","upload_statuses":[{"id":"` + uploadID + `","type":"aws","status":"` + uploadStatus + `"}]}]}`
+		test.TestRoute(t, server, false, "GET", "/api/composer/v1/compose/"+result.ID, ``, http.StatusOK, expected)
+	}
+
+	status("pending", "pending", "pending")
+
+	finishNextJob(t, workers, `{"status":"FINISHED","result":{"success":true}}`)
+	status("running", "success", "pending")
+
+	finishNextJob(t, workers, `{"status":"FAILED","result":{"success":false}}`)
+	status("failure", "success", "failure")
+}
+
+func TestComposeMultipleImages(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	server, workers, s := newServer(t)
+
+	imageRequest := `{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}]}`
+	request := `{"distribution":"test-distro","image_requests":[` + imageRequest + `,` + imageRequest + `]}`
+
+	response := test.SendHTTP(server, false, "POST", "/api/composer/v1/compose", request)
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	var result struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+
+	compose, exists := s.GetCompose(uuid.MustParse(result.ID))
+	require.True(t, exists)
+	require.Len(t, compose.ImageBuilds, 2)
+	require.Equal(t, 1, compose.ImageBuilds[1].GetLocalTargetOptions().ImageBuildId)
+	require.NotEmpty(t, compose.ImageBuilds[1].Packages)
+
+	status := func(composeStatus, firstStatus, secondStatus string) {
+		t.Helper()
+		expected := `{"id":"` + result.ID + `","status":"` + composeStatus + `","image_statuses":[` +
+			`{"architecture":"test_arch","image_type":"test_type","status":"` + firstStatus + `","upload_statuses":[]},` +
+			`{"architecture":"test_arch","image_type":"test_type","status":"` + secondStatus + `","upload_statuses":[]}]}`
+		test.TestRoute(t, server, false, "GET", "/api/composer/v1/compose/"+result.ID, ``, http.StatusOK, expected)
+	}
+
+	status("pending", "pending", "pending")
+
+	finishNextJob(t, workers, `{"status":"FINISHED","result":{"success":true}}`)
+	status("running", "success", "pending")
+
+	finishNextJob(t, workers, `{"status":"FINISHED","result":{"success":true}}`)
+	status("success", "success", "success")
+}
+
+func TestComposeQuota(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	server, _, s := newServer(t)
+	s.SetQuota("", store.Quota{Composes: 1})
+
+	request := `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}]}]}`
+	test.TestRoute(t, server, false, "POST", "/api/composer/v1/compose", request, http.StatusCreated, `{}`, "id")
+	test.TestRoute(t, server, false, "POST", "/api/composer/v1/compose", request, http.StatusForbidden, `{"id":"QuotaExceeded","code":403}`, "reason")
+}
+
+// invalidManifestArch is test_arch, except that its image types create
+// manifests which osbuild would reject.
+type invalidManifestArch struct {
+	test_distro.TestArch
+}
+
+func (a *invalidManifestArch) GetImageType(name string) (distro.ImageType, error) {
+	imageType, err := a.TestArch.GetImageType(name)
+	if err != nil {
+		return nil, err
+	}
+	return &invalidManifestImageType{imageType}, nil
+}
+
+type invalidManifestImageType struct {
+	distro.ImageType
+}
+
+func (t *invalidManifestImageType) Manifest(b *blueprint.Customizations, options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (distro.Manifest, error) {
+	manifest, err := t.ImageType.Manifest(b, options, repos, packageSpecs, buildPackageSpecs)
+	if err != nil {
+		return distro.Manifest{}, err
+	}
+	// the locale stage requires a language
+	manifest.Pipeline.Stages = append(manifest.Pipeline.Stages, &osbuild.Stage{
+		Name:    "org.osbuild.locale",
+		Options: &osbuild.RawStageOptions{RawMessage: json.RawMessage(`{}`)},
+	})
+	return manifest, nil
+}
+
+func TestComposeInvalidManifest(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	fixture := rpmmd_mock.NoComposesFixture()
+	namespace := func(*http.Request) *store.Store {
+		return fixture.Store
+	}
+	server := cloudapi.NewServer(nil, fixture.Workers, rpmmd_mock.NewRPMMDMock(fixture), &invalidManifestArch{}, namespace)
+
+	request := `{"distribution":"test-distro","image_requests":[{"architecture":"test_arch","image_type":"test_type","repositories":[{"baseurl":"http://example.com"}]}]}`
+	test.TestRoute(t, server, false, "POST", "/api/composer/v1/compose", request, http.StatusBadRequest, `{"id":"ManifestCreationFailed","code":400}`, "reason")
+	require.Empty(t, fixture.Store.GetAllComposes())
+}
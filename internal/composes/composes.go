@@ -0,0 +1,73 @@
+// Package composes adds composes to the store together with the worker jobs
+// which build and upload their images. It is shared by the weldr and the
+// cloud API.
+package composes
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/target"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+// Push enqueues the jobs which build `imageBuilds` and upload them to their
+// targets other than the local one, and adds the compose to `ns`. The ids of
+// the jobs are set on `imageBuilds`. Either all of this succeeds, or the
+// compose is not added and none of its jobs are left behind.
+func Push(workers *worker.Server, ns *store.Store, composeID uuid.UUID, bp *blueprint.Blueprint, imageBuilds []store.ImageBuild) error {
+	var jobIDs []uuid.UUID
+	err := enqueueImageBuilds(workers, imageBuilds, &jobIDs)
+	if err == nil {
+		err = ns.PushCompose(composeID, bp, imageBuilds)
+	}
+	if err != nil {
+		// don't leave jobs behind which belong to no compose
+		for _, id := range jobIDs {
+			_ = workers.Cancel(id)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// enqueueImageBuilds enqueues the jobs of `imageBuilds` and appends their
+// ids to `jobIDs`. Local targets are built by the job of the image build,
+// all other targets are uploaded by separate jobs.
+func enqueueImageBuilds(workers *worker.Server, imageBuilds []store.ImageBuild, jobIDs *[]uuid.UUID) error {
+	for i := range imageBuilds {
+		ib := &imageBuilds[i]
+
+		var localTargets, uploadTargets []*target.Target
+		for _, t := range ib.Targets {
+			if t.Name == "org.osbuild.local" {
+				localTargets = append(localTargets, t)
+			} else {
+				uploadTargets = append(uploadTargets, t)
+			}
+		}
+
+		jobID, err := workers.Enqueue(ib.Manifest, localTargets)
+		if err != nil {
+			return err
+		}
+		*jobIDs = append(*jobIDs, jobID)
+		ib.JobID = jobID
+
+		for _, t := range uploadTargets {
+			uploadJobID, err := workers.EnqueueUpload(ib.JobID, ib.ImageType.Filename(), t)
+			if err != nil {
+				return err
+			}
+			*jobIDs = append(*jobIDs, uploadJobID)
+			if ib.UploadJobs == nil {
+				ib.UploadJobs = make(map[uuid.UUID]uuid.UUID)
+			}
+			ib.UploadJobs[t.Uuid] = uploadJobID
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package composes_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/composes"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue/testjobqueue"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/target"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+func TestPush(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+
+	server := worker.NewServer(nil, testjobqueue.New(), "")
+	s := store.New(nil, arch, nil)
+	s.SetQuota("", store.Quota{Composes: 1})
+
+	imageBuilds := func() []store.ImageBuild {
+		return []store.ImageBuild{{
+			ImageType: imageType,
+			Manifest:  manifest,
+			Targets: []*target.Target{
+				target.NewLocalTarget(&target.LocalTargetOptions{Filename: "disk.qcow2"}),
+				target.NewAWSTarget(&target.AWSTargetOptions{Filename: "disk.qcow2", Region: "eu-central-1"}),
+			},
+		}}
+	}
+
+	// uploads are enqueued together with the image build
+	composeID := uuid.New()
+	builds := imageBuilds()
+	err = composes.Push(server, s, composeID, &blueprint.Blueprint{}, builds)
+	require.NoError(t, err)
+	compose, exists := s.GetCompose(composeID)
+	require.True(t, exists)
+	require.Equal(t, builds[0].JobID, compose.ImageBuilds[0].JobID)
+	uploadJobID, exists := compose.ImageBuilds[0].UploadJobs[builds[0].Targets[1].Uuid]
+	require.True(t, exists)
+	status, err := server.JobStatus(uploadJobID)
+	require.NoError(t, err)
+	require.False(t, status.Canceled)
+
+	// when the compose cannot be added, none of its jobs are left behind
+	composeID = uuid.New()
+	builds = imageBuilds()
+	err = composes.Push(server, s, composeID, &blueprint.Blueprint{}, builds)
+	require.IsType(t, &store.QuotaExceededError{}, err)
+	_, exists = s.GetCompose(composeID)
+	require.False(t, exists)
+	status, err = server.JobStatus(builds[0].JobID)
+	require.NoError(t, err)
+	require.True(t, status.Canceled)
+	status, err = server.JobStatus(builds[0].UploadJobs[builds[0].Targets[1].Uuid])
+	require.NoError(t, err)
+	require.True(t, status.Canceled)
+}
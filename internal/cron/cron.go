@@ -0,0 +1,200 @@
+// Package cron parses cron expressions and computes when they are due next.
+//
+// Expressions have the five fields of crontab(5): minute, hour, day of month,
+// month and day of week. Fields are "*", numbers, ranges like "1-5", steps
+// like "*/15" or "0-30/10", or comma-separated lists of those. Months and
+// days of the week may also be given by the first three letters of their
+// English names. The shortcuts "@yearly", "@annually", "@monthly",
+// "@weekly", "@daily", "@midnight" and "@hourly" are supported as well.
+//
+// Like cron, when both the day of month and the day of week are restricted,
+// a day matches if either of them matches.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// whether the day of month or day of week field was "*"
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{"minute", 0, 59, nil}
+	hourField   = field{"hour", 0, 23, nil}
+	domField    = field{"day of month", 1, 31, nil}
+	monthField  = field{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// day of week accepts 7 for Sunday, too
+	dowField = field{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses the cron expression `expr`.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		expanded, ok := shortcuts[expr]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron shortcut: %s", expr)
+		}
+		expr = expanded
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// Sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return &s, nil
+}
+
+// parse returns the bit set of the values `expr` matches.
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangeExpr = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+		}
+
+		var first, last int
+		switch {
+		case rangeExpr == "*":
+			first, last = f.min, f.max
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if first, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if last, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if first > last {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, part)
+			}
+		default:
+			var err error
+			if first, err = f.value(rangeExpr); err != nil {
+				return 0, err
+			}
+			last = first
+			// "5/10" means from 5 to the end, in steps of 10
+			if step != 1 {
+				last = f.max
+			}
+		}
+
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %s", f.name, s)
+	}
+	return v, nil
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after `t` the schedule is due, in the location
+// of `t`, or the zero time if it is never due, like on February 30th.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// every date recurs within five years, including leap days
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"":              "cron expression must have 5 fields, got 0",
+		"* * * *":       "cron expression must have 5 fields, got 4",
+		"@often":        "unknown cron shortcut: @often",
+		"60 * * * *":    "invalid value in minute field: 60",
+		"* 24 * * *":    "invalid value in hour field: 24",
+		"* * 0 * *":     "invalid value in day of month field: 0",
+		"* * * foo *":   "invalid value in month field: foo",
+		"* * * * 8":     "invalid value in day of week field: 8",
+		"*/0 * * * *":   "invalid step in minute field: */0",
+		"5-1 * * * *":   "invalid range in minute field: 5-1",
+		"1-x * * * *":   "invalid value in minute field: x",
+		"* * * * mon-x": "invalid value in day of week field: x",
+	}
+
+	for expr, msg := range cases {
+		_, err := Parse(expr)
+		require.EqualErrorf(t, err, msg, "expression %q", expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a Wednesday
+	start := time.Date(2020, time.July, 15, 10, 30, 45, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.July, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.July, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2020, time.July, 15, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.July, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2020, time.July, 16, 2, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, time.July, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 4 * * sun", time.Date(2020, time.July, 19, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 7", time.Date(2020, time.July, 19, 4, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2020, time.July, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2020, time.July, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, time.August, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2020, time.July, 15, 10, 45, 0, 0, time.UTC)},
+		{"0,40 10 * * *", time.Date(2020, time.July, 15, 10, 40, 0, 0, time.UTC)},
+		{"0 10-12/2 * * *", time.Date(2020, time.July, 15, 12, 0, 0, 0, time.UTC)},
+		// either day of month or day of week
+		{"0 0 20 * fri", time.Date(2020, time.July, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * mon", time.Date(2020, time.July, 16, 0, 0, 0, 0, time.UTC)},
+		// never
+		{"0 0 30 feb *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		schedule, err := Parse(c.expr)
+		require.NoErrorf(t, err, "expression %q", c.expr)
+		require.Equalf(t, c.next, schedule.Next(start), "expression %q", c.expr)
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	// half-hour offset from UTC
+	location := time.FixedZone("IST", 5*3600+1800)
+	schedule, err := Parse("0 3 * * *")
+	require.NoError(t, err)
+
+	next := schedule.Next(time.Date(2020, time.July, 15, 10, 30, 0, 0, location))
+	require.Equal(t, time.Date(2020, time.July, 16, 3, 0, 0, 0, location), next)
+}
@@ -2,7 +2,6 @@ package distro
 
 import (
 	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 )
 
@@ -83,8 +83,9 @@ type ImageType interface {
 
 // The ImageOptions specify options for a specific image build
 type ImageOptions struct {
-	OSTree OSTreeImageOptions
-	Size   uint64
+	OSTree    OSTreeImageOptions
+	Container ContainerImageOptions
+	Size      uint64
 }
 
 // The OSTreeImageOptions specify ostree-specific image options
@@ -93,21 +94,18 @@ type OSTreeImageOptions struct {
 	Parent string
 }
 
-// A Manifest is an opaque JSON object, which is a valid input to osbuild
-type Manifest []byte
-
-func (m Manifest) MarshalJSON() ([]byte, error) {
-	return json.RawMessage(m).MarshalJSON()
+// The ContainerImageOptions specify container-specific image options
+type ContainerImageOptions struct {
+	// Labels are added to the image configuration of the container, in
+	// addition to the ones the image type sets itself.
+	Labels map[string]string
 }
 
-func (m *Manifest) UnmarshalJSON(payload []byte) error {
-	var raw json.RawMessage
-	err := (&raw).UnmarshalJSON(payload)
-	if err != nil {
-		return err
-	}
-	*m = Manifest(raw)
-	return nil
+// A Manifest is an osbuild manifest, which is a valid input to osbuild. Its
+// sources, stages and assembler can be inspected and modified after the
+// image type created it.
+type Manifest struct {
+	osbuild.Manifest
 }
 
 type Registry struct {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,7 +43,7 @@ func TestDistro_Manifest(t *testing.T, pipelinePath string, prefix string, distr
 		var tt struct {
 			ComposeRequest *composeRequest `json:"compose-request"`
 			RpmMD          *rpmMD          `json:"rpmmd"`
-			Manifest       distro.Manifest `json:"manifest,omitempty"`
+			Manifest       json.RawMessage `json:"manifest,omitempty"`
 		}
 		file, err := ioutil.ReadFile(fileName)
 		assert.NoErrorf(err, "Could not read test-case '%s': %v", fileName, err)
@@ -95,7 +96,20 @@ func TestDistro_Manifest(t *testing.T, pipelinePath string, prefix string, distr
 				return
 			}
 			if tt.Manifest != nil {
-				require.JSONEqf(t, string(tt.Manifest), string(got), "Distro: %s\nArch: %s\nImage type: %s\nTest case file: %s\n", d.Name(), arch.Name(), imageType.Name(), fileName)
+				gotJSON, err := json.Marshal(got)
+				require.NoError(t, err)
+				require.JSONEqf(t, string(tt.Manifest), string(gotJSON), "Distro: %s\nArch: %s\nImage type: %s\nTest case file: %s\n", d.Name(), arch.Name(), imageType.Name(), fileName)
+
+				err = osbuild.VendoredSchemas().Validate(&got.Manifest)
+				require.NoErrorf(t, err, "Test case file: %s", fileName)
+
+				// every manifest survives unmarshalling and marshalling
+				var manifest distro.Manifest
+				err = json.Unmarshal(tt.Manifest, &manifest)
+				require.NoErrorf(t, err, "Test case file: %s", fileName)
+				roundTrip, err := json.Marshal(manifest)
+				require.NoError(t, err)
+				require.JSONEqf(t, string(tt.Manifest), string(roundTrip), "Test case file: %s", fileName)
 			}
 		})
 	}
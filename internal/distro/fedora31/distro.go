@@ -1,7 +1,6 @@
 package fedora31
 
 import (
-	"encoding/json"
 	"errors"
 	"sort"
 
@@ -181,12 +180,12 @@ func (t *imageType) Manifest(c *blueprint.Customizations,
 		return distro.Manifest{}, err
 	}
 
-	return json.Marshal(
-		osbuild.Manifest{
+	return distro.Manifest{
+		Manifest: osbuild.Manifest{
 			Sources:  *sources(append(packageSpecs, buildPackageSpecs...)),
 			Pipeline: *pipeline,
 		},
-	)
+	}, nil
 }
 
 func New() *Fedora31 {
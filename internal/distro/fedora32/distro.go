@@ -1,7 +1,6 @@
 package fedora32
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
@@ -189,12 +188,12 @@ func (t *imageType) Manifest(c *blueprint.Customizations,
 		return distro.Manifest{}, err
 	}
 
-	return json.Marshal(
-		osbuild.Manifest{
+	return distro.Manifest{
+		Manifest: osbuild.Manifest{
 			Sources:  *sources(append(packageSpecs, buildPackageSpecs...)),
 			Pipeline: *pipeline,
 		},
-	)
+	}, nil
 }
 
 func (d *distribution) Name() string {
@@ -522,6 +521,19 @@ func ostreeCommitAssembler(options distro.ImageOptions, arch distro.Arch) *osbui
 	)
 }
 
+func containerAssembler(options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+	return osbuild.NewOCIArchiveAssembler(
+		&osbuild.OCIArchiveAssemblerOptions{
+			Filename:     "container.tar",
+			Architecture: osbuild.OCIArchitecture(arch.Name()),
+			Config: &osbuild.OCIArchiveConfig{
+				Cmd:    []string{"/bin/bash"},
+				Labels: options.Container.Labels,
+			},
+		},
+	)
+}
+
 // New creates a new distro object, defining the supported architectures and image types
 func New() distro.Distro {
 	const GigaByte = 1024 * 1024 * 1024
@@ -615,6 +627,32 @@ func New() distro.Distro {
 		},
 	}
 
+	containerImgType := imageType{
+		name:     "container",
+		filename: "container.tar",
+		mimeType: "application/x-tar",
+		packages: []string{
+			"bash",
+			"coreutils",
+			"glibc-minimal-langpack",
+			"rpm",
+			"dnf",
+			"tar",
+			"vim-minimal",
+			"rootfiles",
+			"selinux-policy-targeted",
+			"fedora-release-container",
+		},
+		excludedPackages: []string{
+			"kernel",
+			"dracut",
+		},
+		bootable: false,
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return containerAssembler(options, arch)
+		},
+	}
+
 	qcow2ImageType := imageType{
 		name:     "qcow2",
 		filename: "disk.qcow2",
@@ -772,6 +810,7 @@ func New() distro.Distro {
 	x8664.setImageTypes(
 		iotImgType,
 		amiImgType,
+		containerImgType,
 		qcow2ImageType,
 		openstackImgType,
 		vhdImgType,
@@ -792,6 +831,7 @@ func New() distro.Distro {
 	}
 	aarch64.setImageTypes(
 		amiImgType,
+		containerImgType,
 		qcow2ImageType,
 		openstackImgType,
 	)
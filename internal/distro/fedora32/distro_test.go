@@ -26,6 +26,12 @@ func TestFilenameFromType(t *testing.T) {
 			want:  "image.raw",
 			want1: "application/octet-stream",
 		},
+		{
+			name:  "container",
+			args:  args{"container"},
+			want:  "container.tar",
+			want1: "application/x-tar",
+		},
 		{
 			name:  "openstack",
 			args:  args{"openstack"},
@@ -142,6 +148,7 @@ func TestImageType_Name(t *testing.T) {
 			arch: "x86_64",
 			imgNames: []string{
 				"ami",
+				"container",
 				"qcow2",
 				"openstack",
 				"vhd",
@@ -152,6 +159,7 @@ func TestImageType_Name(t *testing.T) {
 			arch: "aarch64",
 			imgNames: []string{
 				"ami",
+				"container",
 				"qcow2",
 				"openstack",
 			},
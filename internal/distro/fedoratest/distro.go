@@ -1,7 +1,6 @@
 package fedoratest
 
 import (
-	"encoding/json"
 	"errors"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
@@ -97,12 +96,12 @@ func (t *imageType) Manifest(c *blueprint.Customizations,
 	packageSpecs,
 	buildPackageSpecs []rpmmd.PackageSpec) (distro.Manifest, error) {
 
-	return json.Marshal(
-		osbuild.Manifest{
+	return distro.Manifest{
+		Manifest: osbuild.Manifest{
 			Sources:  osbuild.Sources{},
 			Pipeline: osbuild.Pipeline{},
 		},
-	)
+	}, nil
 }
 
 func New() *FedoraTestDistro {
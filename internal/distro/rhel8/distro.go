@@ -1,7 +1,6 @@
 package rhel8
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
@@ -191,12 +190,12 @@ func (t *imageType) Manifest(c *blueprint.Customizations,
 		return distro.Manifest{}, err
 	}
 
-	return json.Marshal(
-		osbuild.Manifest{
+	return distro.Manifest{
+		Manifest: osbuild.Manifest{
 			Sources:  *sources(append(packageSpecs, buildPackageSpecs...)),
 			Pipeline: *pipeline,
 		},
-	)
+	}, nil
 }
 
 func (d *distribution) Name() string {
@@ -592,6 +591,19 @@ func ostreeCommitAssembler(options distro.ImageOptions, arch distro.Arch) *osbui
 	)
 }
 
+func containerAssembler(options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+	return osbuild.NewOCIArchiveAssembler(
+		&osbuild.OCIArchiveAssemblerOptions{
+			Filename:     "container.tar",
+			Architecture: osbuild.OCIArchitecture(arch.Name()),
+			Config: &osbuild.OCIArchiveConfig{
+				Cmd:    []string{"/bin/bash"},
+				Labels: options.Container.Labels,
+			},
+		},
+	)
+}
+
 // New creates a new distro object, defining the supported architectures and image types
 func New() distro.Distro {
 	const GigaByte = 1024 * 1024 * 1024
@@ -783,6 +795,32 @@ func New() distro.Distro {
 		},
 	}
 
+	containerImgType := imageType{
+		name:     "container",
+		filename: "container.tar",
+		mimeType: "application/x-tar",
+		packages: []string{
+			"bash",
+			"coreutils-single",
+			"glibc-minimal-langpack",
+			"rpm",
+			"dnf",
+			"tar",
+			"vim-minimal",
+			"rootfiles",
+			"selinux-policy-targeted",
+			"redhat-release",
+		},
+		excludedPackages: []string{
+			"kernel",
+			"dracut",
+		},
+		bootable: false,
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return containerAssembler(options, arch)
+		},
+	}
+
 	qcow2ImageType := imageType{
 		name:     "qcow2",
 		filename: "disk.qcow2",
@@ -1008,6 +1046,7 @@ func New() distro.Distro {
 	}
 	x8664.setImageTypes(
 		amiImgType,
+		containerImgType,
 		edgeImgTypeX86_64,
 		qcow2ImageType,
 		openstackImgType,
@@ -1030,6 +1069,7 @@ func New() distro.Distro {
 	}
 	aarch64.setImageTypes(
 		amiImgType,
+		containerImgType,
 		edgeImgTypeAarch64,
 		qcow2ImageType,
 		openstackImgType,
@@ -1054,6 +1094,7 @@ func New() distro.Distro {
 	}
 	ppc64le.setImageTypes(
 		qcow2ImageType,
+		containerImgType,
 		tarImgType,
 	)
 
@@ -1068,6 +1109,7 @@ func New() distro.Distro {
 	}
 	s390x.setImageTypes(
 		tarImgType,
+		containerImgType,
 		qcow2ImageType,
 	)
 
@@ -26,6 +26,12 @@ func TestFilenameFromType(t *testing.T) {
 			want:  "image.raw",
 			want1: "application/octet-stream",
 		},
+		{
+			name:  "container",
+			args:  args{"container"},
+			want:  "container.tar",
+			want1: "application/x-tar",
+		},
 		{
 			name:  "openstack",
 			args:  args{"openstack"},
@@ -140,6 +146,7 @@ func TestImageType_Name(t *testing.T) {
 			arch: "x86_64",
 			imgNames: []string{
 				"ami",
+				"container",
 				"qcow2",
 				"openstack",
 				"tar",
@@ -151,6 +158,7 @@ func TestImageType_Name(t *testing.T) {
 			arch: "aarch64",
 			imgNames: []string{
 				"ami",
+				"container",
 				"qcow2",
 				"openstack",
 				"tar",
@@ -159,6 +167,7 @@ func TestImageType_Name(t *testing.T) {
 		{
 			arch: "ppc64le",
 			imgNames: []string{
+				"container",
 				"qcow2",
 				"tar",
 			},
@@ -166,6 +175,7 @@ func TestImageType_Name(t *testing.T) {
 		{
 			arch: "s390x",
 			imgNames: []string{
+				"container",
 				"tar",
 			},
 		},
@@ -1,7 +1,6 @@
 package test_distro
 
 import (
-	"encoding/json"
 	"errors"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
@@ -76,12 +75,12 @@ func (t *TestImageType) BuildPackages() []string {
 }
 
 func (t *TestImageType) Manifest(b *blueprint.Customizations, options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (distro.Manifest, error) {
-	return json.Marshal(
-		osbuild.Manifest{
+	return distro.Manifest{
+		Manifest: osbuild.Manifest{
 			Sources:  osbuild.Sources{},
 			Pipeline: osbuild.Pipeline{},
 		},
-	)
+	}, nil
 }
 
 func New() *TestDistro {
@@ -145,13 +145,13 @@ func (q *fsJobQueue) Enqueue(jobType string, args interface{}, dependencies []uu
 	return j.Id, nil
 }
 
-func (q *fsJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, error) {
+func (q *fsJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, string, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	// Return early if the context is already canceled.
 	if err := ctx.Err(); err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
 
 	// Filter q.pending by the `jobTypes`. Ignore those job types that this
@@ -173,12 +173,16 @@ func (q *fsJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interf
 		q.mu.Lock()
 
 		if err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, "", err
 		}
 
 		j, err = q.readJob(id)
+		if err == jobqueue.ErrNotExist {
+			// The job was canceled and deleted before it was dequeued.
+			continue
+		}
 		if err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, "", err
 		}
 
 		if !j.Canceled {
@@ -188,17 +192,17 @@ func (q *fsJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interf
 
 	err := json.Unmarshal(j.Args, args)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("error unmarshaling arguments for job '%s': %v", j.Id, err)
+		return uuid.Nil, "", fmt.Errorf("error unmarshaling arguments for job '%s': %v", j.Id, err)
 	}
 
 	j.StartedAt = time.Now()
 
 	err = q.db.Write(j.Id.String(), j)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("error writing job %s: %v", j.Id, err)
+		return uuid.Nil, "", fmt.Errorf("error writing job %s: %v", j.Id, err)
 	}
 
-	return j.Id, nil
+	return j.Id, j.Type, nil
 }
 
 func (q *fsJobQueue) FinishJob(id uuid.UUID, result interface{}) error {
@@ -291,6 +295,39 @@ func (q *fsJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, starte
 	return
 }
 
+func (q *fsJobQueue) DeleteJob(id uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, err := q.readJob(id)
+	if err != nil {
+		return err
+	}
+
+	if j.FinishedAt.IsZero() && !j.Canceled {
+		return jobqueue.ErrNotDone
+	}
+
+	if len(q.dependants[id]) > 0 {
+		return jobqueue.ErrHasDependants
+	}
+
+	err = q.db.Delete(id.String())
+	if err != nil {
+		return err
+	}
+
+	// A canceled job might still wait for its dependencies.
+	for _, d := range j.Dependencies {
+		q.dependants[d] = removeUUID(q.dependants[d], id)
+		if len(q.dependants[d]) == 0 {
+			delete(q.dependants, d)
+		}
+	}
+
+	return nil
+}
+
 // Reads job with `id`. This is a thin wrapper around `q.db.Read`, which
 // returns the job directly, or and error if a job with `id` does not exist.
 func (q *fsJobQueue) readJob(id uuid.UUID) (*job, error) {
@@ -365,6 +402,17 @@ func uniqueUUIDList(ids []uuid.UUID) []uuid.UUID {
 	return l
 }
 
+// Returns `ids` without `id`.
+func removeUUID(ids []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	l := []uuid.UUID{}
+	for _, i := range ids {
+		if i != id {
+			l = append(l, i)
+		}
+	}
+	return l
+}
+
 // Select on a list of `chan uuid.UUID`s. Returns an error if one of the
 // channels is closed.
 //
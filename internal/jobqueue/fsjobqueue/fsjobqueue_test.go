@@ -43,9 +43,10 @@ func pushTestJob(t *testing.T, q jobqueue.JobQueue, jobType string, args interfa
 }
 
 func finishNextTestJob(t *testing.T, q jobqueue.JobQueue, jobType string, result interface{}) uuid.UUID {
-	id, err := q.Dequeue(context.Background(), []string{jobType}, &json.RawMessage{})
+	id, typ, err := q.Dequeue(context.Background(), []string{jobType}, &json.RawMessage{})
 	require.NoError(t, err)
 	require.NotEmpty(t, id)
+	require.Equal(t, jobType, typ)
 
 	err = q.FinishJob(id, result)
 	require.NoError(t, err)
@@ -90,14 +91,16 @@ func TestArgs(t *testing.T) {
 	two := pushTestJob(t, q, "octopus", twoargs, nil)
 
 	var args argument
-	id, err := q.Dequeue(context.Background(), []string{"octopus"}, &args)
+	id, typ, err := q.Dequeue(context.Background(), []string{"octopus"}, &args)
 	require.NoError(t, err)
 	require.Equal(t, two, id)
+	require.Equal(t, "octopus", typ)
 	require.Equal(t, twoargs, args)
 
-	id, err = q.Dequeue(context.Background(), []string{"fish"}, &args)
+	id, typ, err = q.Dequeue(context.Background(), []string{"fish"}, &args)
 	require.NoError(t, err)
 	require.Equal(t, one, id)
+	require.Equal(t, "fish", typ)
 	require.Equal(t, oneargs, args)
 }
 
@@ -113,7 +116,7 @@ func TestJobTypes(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
-	id, err := q.Dequeue(ctx, []string{"zebra"}, nil)
+	id, _, err := q.Dequeue(ctx, []string{"zebra"}, nil)
 	require.Equal(t, err, context.Canceled)
 	require.Equal(t, uuid.Nil, id)
 }
@@ -188,7 +191,7 @@ func TestMultipleWorkers(t *testing.T) {
 		defer close(done)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		id, err := q.Dequeue(ctx, []string{"octopus"}, &json.RawMessage{})
+		id, _, err := q.Dequeue(ctx, []string{"octopus"}, &json.RawMessage{})
 		require.NoError(t, err)
 		require.NotEmpty(t, id)
 	}()
@@ -199,7 +202,7 @@ func TestMultipleWorkers(t *testing.T) {
 
 	// This call to Dequeue() should not block on the one in the goroutine.
 	id := pushTestJob(t, q, "clownfish", nil, nil)
-	r, err := q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
+	r, _, err := q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
 	require.NoError(t, err)
 	require.Equal(t, id, r)
 
@@ -230,7 +233,7 @@ func TestCancel(t *testing.T) {
 	// Cancel a running job, which should not dequeue the canceled job from above
 	id = pushTestJob(t, q, "clownfish", nil, nil)
 	require.NotEmpty(t, id)
-	r, err := q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
+	r, _, err := q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
 	require.NoError(t, err)
 	require.Equal(t, id, r)
 	err = q.CancelJob(id)
@@ -244,7 +247,7 @@ func TestCancel(t *testing.T) {
 	// Cancel a finished job, which is a no-op
 	id = pushTestJob(t, q, "clownfish", nil, nil)
 	require.NotEmpty(t, id)
-	r, err = q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
+	r, _, err = q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
 	require.NoError(t, err)
 	require.Equal(t, id, r)
 	err = q.FinishJob(id, &testResult{})
@@ -255,3 +258,49 @@ func TestCancel(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, canceled)
 }
+
+func TestDelete(t *testing.T) {
+	q, dir := newTemporaryQueue(t, []string{"octopus", "clownfish"})
+	defer cleanupTempDir(t, dir)
+
+	// Delete a non-existing job
+	err := q.DeleteJob(uuid.New())
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
+	// Delete a pending job
+	id := pushTestJob(t, q, "clownfish", nil, nil)
+	err = q.DeleteJob(id)
+	require.Equal(t, jobqueue.ErrNotDone, err)
+
+	// Delete a job which another pending job depends on
+	dependant := pushTestJob(t, q, "octopus", nil, []uuid.UUID{id})
+	err = q.CancelJob(id)
+	require.NoError(t, err)
+	err = q.DeleteJob(id)
+	require.Equal(t, jobqueue.ErrHasDependants, err)
+
+	// Delete the canceled dependant, and then its dependency, which is
+	// also canceled
+	err = q.CancelJob(dependant)
+	require.NoError(t, err)
+	err = q.DeleteJob(dependant)
+	require.NoError(t, err)
+	err = q.DeleteJob(id)
+	require.NoError(t, err)
+	_, _, _, _, err = q.JobStatus(id, &testResult{})
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
+	// Delete a finished job, which should not dequeue the deleted jobs from above
+	id = pushTestJob(t, q, "clownfish", nil, nil)
+	require.Equal(t, id, finishNextTestJob(t, q, "clownfish", testResult{}))
+	err = q.DeleteJob(id)
+	require.NoError(t, err)
+	_, _, _, _, err = q.JobStatus(id, &testResult{})
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
+	// Deleted jobs are gone after reloading the queue
+	q, err = fsjobqueue.New(dir, []string{"octopus", "clownfish"})
+	require.NoError(t, err)
+	_, _, _, _, err = q.JobStatus(id, &testResult{})
+	require.Equal(t, jobqueue.ErrNotExist, err)
+}
@@ -39,10 +39,11 @@ type JobQueue interface {
 	// canceled.
 	//
 	// All jobs in `jobTypes` must take the same type of `args`, corresponding to
-	// the one that was passed to Enqueue().
+	// the one that was passed to Enqueue(). Pass a *json.RawMessage to dequeue
+	// jobs of types with differing arguments.
 	//
-	// Returns the job's id or an error.
-	Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, error)
+	// Returns the job's id and type, or an error.
+	Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, string, error)
 
 	// Mark the job with `id` as finished. `result` must fit the associated
 	// job type and must be serializable to JSON.
@@ -58,10 +59,16 @@ type JobQueue interface {
 	//
 	// If the job is finished, its result will be returned in `result`.
 	JobStatus(id uuid.UUID, result interface{}) (queued, started, finished time.Time, canceled bool, err error)
+
+	// Deletes a job which has finished or was canceled. The job must not
+	// be a dependency of another job which hasn't started yet.
+	DeleteJob(id uuid.UUID) error
 }
 
 var (
-	ErrNotExist   = errors.New("job does not exist")
-	ErrNotRunning = errors.New("job is not running")
-	ErrCanceled   = errors.New("job ws canceled")
+	ErrNotExist      = errors.New("job does not exist")
+	ErrNotRunning    = errors.New("job is not running")
+	ErrCanceled      = errors.New("job ws canceled")
+	ErrNotDone       = errors.New("job has neither finished nor was it canceled")
+	ErrHasDependants = errors.New("job is a dependency of a job which hasn't started")
 )
@@ -1,6 +1,6 @@
 // Package testjobqueue implements jobqueue interface. It is meant for testing,
-// and as such doesn't implement two invariants of jobqueue: it is not safe for
-// concurrent access and `Dequeue()` doesn't wait for new jobs to appear.
+// and as such doesn't implement one invariant of jobqueue: `Dequeue()` doesn't
+// wait for new jobs to appear.
 package testjobqueue
 
 import (
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +17,8 @@ import (
 )
 
 type testJobQueue struct {
+	mu sync.Mutex
+
 	jobs map[uuid.UUID]*job
 
 	pending map[string][]uuid.UUID
@@ -38,12 +41,16 @@ type job struct {
 
 func New() *testJobQueue {
 	return &testJobQueue{
-		jobs:    make(map[uuid.UUID]*job),
-		pending: make(map[string][]uuid.UUID),
+		jobs:       make(map[uuid.UUID]*job),
+		pending:    make(map[string][]uuid.UUID),
+		dependants: make(map[uuid.UUID][]uuid.UUID),
 	}
 }
 
 func (q *testJobQueue) Enqueue(jobType string, args interface{}, dependencies []uuid.UUID) (uuid.UUID, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	var j = job{
 		Id:           uuid.New(),
 		Type:         jobType,
@@ -79,8 +86,16 @@ func (q *testJobQueue) Enqueue(jobType string, args interface{}, dependencies []
 	return j.Id, nil
 }
 
-func (q *testJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, error) {
+func (q *testJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interface{}) (uuid.UUID, string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	for _, t := range jobTypes {
+		// skip canceled jobs, like fsjobqueue does
+		for len(q.pending[t]) > 0 && q.jobs[q.pending[t][0]].Canceled {
+			q.pending[t] = q.pending[t][1:]
+		}
+
 		if len(q.pending[t]) == 0 {
 			continue
 		}
@@ -92,17 +107,20 @@ func (q *testJobQueue) Dequeue(ctx context.Context, jobTypes []string, args inte
 
 		err := json.Unmarshal(j.Args, args)
 		if err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, "", err
 		}
 
 		j.StartedAt = time.Now()
-		return j.Id, nil
+		return j.Id, j.Type, nil
 	}
 
-	return uuid.Nil, errors.New("no job available")
+	return uuid.Nil, "", errors.New("no job available")
 }
 
 func (q *testJobQueue) FinishJob(id uuid.UUID, result interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	j, exists := q.jobs[id]
 	if !exists {
 		return jobqueue.ErrNotExist
@@ -136,6 +154,9 @@ func (q *testJobQueue) FinishJob(id uuid.UUID, result interface{}) error {
 }
 
 func (q *testJobQueue) CancelJob(id uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	j, exists := q.jobs[id]
 	if !exists {
 		return jobqueue.ErrNotExist
@@ -147,6 +168,9 @@ func (q *testJobQueue) CancelJob(id uuid.UUID) error {
 }
 
 func (q *testJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, started, finished time.Time, canceled bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	j, exists := q.jobs[id]
 	if !exists {
 		err = jobqueue.ErrNotExist
@@ -168,6 +192,46 @@ func (q *testJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, star
 	return
 }
 
+func (q *testJobQueue) DeleteJob(id uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, exists := q.jobs[id]
+	if !exists {
+		return jobqueue.ErrNotExist
+	}
+
+	if j.FinishedAt.IsZero() && !j.Canceled {
+		return jobqueue.ErrNotDone
+	}
+
+	if len(q.dependants[id]) > 0 {
+		return jobqueue.ErrHasDependants
+	}
+
+	delete(q.jobs, id)
+
+	pending := []uuid.UUID{}
+	for _, p := range q.pending[j.Type] {
+		if p != id {
+			pending = append(pending, p)
+		}
+	}
+	q.pending[j.Type] = pending
+
+	for _, d := range j.Dependencies {
+		dependants := []uuid.UUID{}
+		for _, dep := range q.dependants[d] {
+			if dep != id {
+				dependants = append(dependants, dep)
+			}
+		}
+		q.dependants[d] = dependants
+	}
+
+	return nil
+}
+
 // Returns the number of finished jobs in `ids`.
 func (q *testJobQueue) countFinishedJobs(ids []uuid.UUID) (int, error) {
 	n := 0
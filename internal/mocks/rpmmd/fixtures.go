@@ -82,6 +82,40 @@ func createBaseDepsolveFixture() []rpmmd.PackageSpec {
 	}
 }
 
+func createBaseAdvisoriesFixture() []rpmmd.Advisory {
+	return []rpmmd.Advisory{
+		{
+			ID:       "FEDORA-2020-0001",
+			Type:     "security",
+			Severity: "Important",
+			Title:    "dep-package1 security update",
+			Issued:   "2020-06-01 00:00:00",
+			CVEs:     []string{"CVE-2020-1234"},
+			Packages: []rpmmd.AdvisoryPackage{
+				{
+					Name:    "dep-package1",
+					Version: "1.33",
+					Release: "3.fc30",
+					Arch:    "x86_64",
+				},
+			},
+		},
+		{
+			ID:    "FEDORA-2019-0001",
+			Type:  "bugfix",
+			Title: "dep-package2 bugfix update",
+			Packages: []rpmmd.AdvisoryPackage{
+				{
+					Name:    "dep-package2",
+					Version: "2.8",
+					Release: "1.fc30",
+					Arch:    "x86_64",
+				},
+			},
+		},
+	}
+}
+
 func BaseFixture() Fixture {
 	return Fixture{
 		fetchPackageList{
@@ -94,6 +128,10 @@ func BaseFixture() Fixture {
 			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
+		fetchAdvisories{
+			createBaseAdvisoriesFixture(),
+			nil,
+		},
 		store.FixtureBase(),
 		createBaseWorkersFixture(),
 	}
@@ -111,6 +149,10 @@ func NoComposesFixture() Fixture {
 			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
+		fetchAdvisories{
+			createBaseAdvisoriesFixture(),
+			nil,
+		},
 		store.FixtureEmpty(),
 		createBaseWorkersFixture(),
 	}
@@ -131,6 +173,10 @@ func NonExistingPackage() Fixture {
 				Reason: "Error occurred when marking packages for installation: Problems in request:\nmissing packages: fash",
 			},
 		},
+		fetchAdvisories{
+			createBaseAdvisoriesFixture(),
+			nil,
+		},
 		store.FixtureBase(),
 		createBaseWorkersFixture(),
 	}
@@ -151,6 +197,10 @@ func BadDepsolve() Fixture {
 				Reason: "There was a problem depsolving ['go2rpm']: \n Problem: conflicting requests\n  - nothing provides askalono-cli needed by go2rpm-1-4.fc31.noarch",
 			},
 		},
+		fetchAdvisories{
+			createBaseAdvisoriesFixture(),
+			nil,
+		},
 		store.FixtureBase(),
 		createBaseWorkersFixture(),
 	}
@@ -174,6 +224,10 @@ func BadFetch() Fixture {
 				Reason: "There was a problem depsolving ['go2rpm']: \n Problem: conflicting requests\n  - nothing provides askalono-cli needed by go2rpm-1-4.fc31.noarch",
 			},
 		},
+		fetchAdvisories{
+			createBaseAdvisoriesFixture(),
+			nil,
+		},
 		store.FixtureBase(),
 		createBaseWorkersFixture(),
 	}
@@ -16,10 +16,15 @@ type depsolve struct {
 	checksums map[string]string
 	err       error
 }
+type fetchAdvisories struct {
+	ret []rpmmd.Advisory
+	err error
+}
 
 type Fixture struct {
 	fetchPackageList
 	depsolve
+	fetchAdvisories
 	*store.Store
 	Workers *worker.Server
 }
@@ -39,3 +44,7 @@ func (r *rpmmdMock) FetchMetadata(repos []rpmmd.RepoConfig, modulePlatformID str
 func (r *rpmmdMock) Depsolve(specs, excludeSpecs []string, repos []rpmmd.RepoConfig, modulePlatformID, arch string) ([]rpmmd.PackageSpec, map[string]string, error) {
 	return r.Fixture.depsolve.ret, r.Fixture.fetchPackageList.checksums, r.Fixture.depsolve.err
 }
+
+func (r *rpmmdMock) FetchAdvisories(repos []rpmmd.RepoConfig, modulePlatformID string, arch string) ([]rpmmd.Advisory, error) {
+	return r.Fixture.fetchAdvisories.ret, r.Fixture.fetchAdvisories.err
+}
@@ -16,6 +16,14 @@ type AssemblerOptions interface {
 	isAssemblerOptions()
 }
 
+// RawAssemblerOptions are the options of an assembler which is not known to
+// composer, kept as they are.
+type RawAssemblerOptions struct {
+	json.RawMessage
+}
+
+func (RawAssemblerOptions) isAssemblerOptions() {}
+
 type rawAssembler struct {
 	Name    string          `json:"name"`
 	Options json.RawMessage `json:"options"`
@@ -30,10 +38,15 @@ func (assembler *Assembler) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if rawAssembler.Name == "" {
+		return errors.New("assembler has no name")
+	}
 	var options AssemblerOptions
 	switch rawAssembler.Name {
 	case "org.osbuild.ostree.commit":
 		options = new(OSTreeCommitAssemblerOptions)
+	case "org.osbuild.oci-archive":
+		options = new(OCIArchiveAssemblerOptions)
 	case "org.osbuild.qemu":
 		options = new(QEMUAssemblerOptions)
 	case "org.osbuild.rawfs":
@@ -41,7 +54,7 @@ func (assembler *Assembler) UnmarshalJSON(data []byte) error {
 	case "org.osbuild.tar":
 		options = new(TarAssemblerOptions)
 	default:
-		return errors.New("unexpected assembler name")
+		options = new(RawAssemblerOptions)
 	}
 	err = json.Unmarshal(rawAssembler.Options, options)
 	if err != nil {
@@ -22,10 +22,13 @@ func TestAssembler_UnmarshalJSON(t *testing.T) {
 			errorExpected: true,
 		},
 		{
-			// valid JSON, but with an unknown assembler (org.osbuild.foo)
-			name:          "unknown assembler",
-			data:          []byte(`{"name":"org.osbuild.foo","options":{"bar":null}}`),
-			errorExpected: true,
+			// unknown assemblers (org.osbuild.foo) keep their options
+			name: "unknown assembler",
+			assembler: Assembler{
+				Name:    "org.osbuild.foo",
+				Options: &RawAssemblerOptions{json.RawMessage(`{"bar":null}`)},
+			},
+			data: []byte(`{"name":"org.osbuild.foo","options":{"bar":null}}`),
 		},
 		{
 			name:          "missing options",
@@ -121,6 +124,29 @@ func TestAssembler_UnmarshalJSON(t *testing.T) {
 			},
 			data: []byte(`{"name":"org.osbuild.ostree.commit","options":{"ref":"foo","tar":{"filename":"foo.tar"}}}`),
 		},
+		{
+			name: "oci-archive assembler empty",
+			assembler: Assembler{
+				Name:    "org.osbuild.oci-archive",
+				Options: &OCIArchiveAssemblerOptions{},
+			},
+			data: []byte(`{"name":"org.osbuild.oci-archive","options":{"filename":"","architecture":""}}`),
+		},
+		{
+			name: "oci-archive assembler full",
+			assembler: Assembler{
+				Name: "org.osbuild.oci-archive",
+				Options: &OCIArchiveAssemblerOptions{
+					Filename:     "container.tar",
+					Architecture: "amd64",
+					Config: &OCIArchiveConfig{
+						Cmd:    []string{"/bin/bash"},
+						Labels: map[string]string{"org.opencontainers.image.title": "foo"},
+					},
+				},
+			},
+			data: []byte(`{"name":"org.osbuild.oci-archive","options":{"filename":"container.tar","architecture":"amd64","config":{"Cmd":["/bin/bash"],"Labels":{"org.opencontainers.image.title":"foo"}}}}`),
+		},
 	}
 
 	assert := assert.New(t)
@@ -161,6 +187,15 @@ func TestNewTarAssembler(t *testing.T) {
 	assert.Equal(t, expectedAssembler, NewTarAssembler(options))
 }
 
+func TestNewOCIArchiveAssembler(t *testing.T) {
+	options := &OCIArchiveAssemblerOptions{}
+	expectedAssembler := &Assembler{
+		Name:    "org.osbuild.oci-archive",
+		Options: &OCIArchiveAssemblerOptions{},
+	}
+	assert.Equal(t, expectedAssembler, NewOCIArchiveAssembler(options))
+}
+
 func TestNewRawFSAssembler(t *testing.T) {
 	options := &RawFSAssemblerOptions{}
 	expectedAssembler := &Assembler{
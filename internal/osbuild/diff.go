@@ -0,0 +1,170 @@
+package osbuild
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// A Difference is a difference between two manifests. Path names the part of
+// the manifests which differs, like "pipeline.stages[3]" or
+// "sources.org.osbuild.files.urls.sha256:...". Old is nil for something which
+// was added, New for something which was removed.
+type Difference struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// DiffManifests returns the differences between manifests `old` and `new`.
+//
+// Files of the files source are compared per checksum. Stages are matched by
+// their names in order, so that adding or removing a stage doesn't make all
+// stages after it differ. The index in the path of a stage is the index in
+// `new`, or in `old` for a removed stage.
+func DiffManifests(old, new *Manifest) []Difference {
+	d := &differ{differences: []Difference{}}
+	d.sources(old.Sources, new.Sources)
+	d.pipeline("pipeline.", &old.Pipeline, &new.Pipeline)
+	return d.differences
+}
+
+type differ struct {
+	differences []Difference
+}
+
+func (d *differ) add(path string, old, new interface{}) {
+	d.differences = append(d.differences, Difference{Path: path, Old: old, New: new})
+}
+
+func (d *differ) sources(old, new Sources) {
+	var names []string
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := "sources." + name
+		oldSource, inOld := old[name]
+		newSource, inNew := new[name]
+		switch {
+		case !inOld:
+			d.add(path, nil, newSource)
+		case !inNew:
+			d.add(path, oldSource, nil)
+		default:
+			oldFiles, oldOK := oldSource.(*FilesSource)
+			newFiles, newOK := newSource.(*FilesSource)
+			if oldOK && newOK {
+				d.files(path+".urls.", oldFiles.URLs, newFiles.URLs)
+			} else if !reflect.DeepEqual(oldSource, newSource) {
+				d.add(path, oldSource, newSource)
+			}
+		}
+	}
+}
+
+func (d *differ) files(path string, old, new map[string]FileSource) {
+	var checksums []string
+	for checksum := range old {
+		checksums = append(checksums, checksum)
+	}
+	for checksum := range new {
+		if _, ok := old[checksum]; !ok {
+			checksums = append(checksums, checksum)
+		}
+	}
+	sort.Strings(checksums)
+
+	for _, checksum := range checksums {
+		oldFile, inOld := old[checksum]
+		newFile, inNew := new[checksum]
+		switch {
+		case !inOld:
+			d.add(path+checksum, nil, newFile)
+		case !inNew:
+			d.add(path+checksum, oldFile, nil)
+		case !reflect.DeepEqual(oldFile, newFile):
+			d.add(path+checksum, oldFile, newFile)
+		}
+	}
+}
+
+func (d *differ) pipeline(path string, old, new *Pipeline) {
+	switch {
+	case old.Build == nil && new.Build != nil:
+		d.add(path+"build", nil, new.Build)
+	case old.Build != nil && new.Build == nil:
+		d.add(path+"build", old.Build, nil)
+	case old.Build != nil && new.Build != nil:
+		if old.Build.Runner != new.Build.Runner {
+			d.add(path+"build.runner", old.Build.Runner, new.Build.Runner)
+		}
+		oldBuild, newBuild := old.Build.Pipeline, new.Build.Pipeline
+		if oldBuild == nil {
+			oldBuild = &Pipeline{}
+		}
+		if newBuild == nil {
+			newBuild = &Pipeline{}
+		}
+		d.pipeline(path+"build.pipeline.", oldBuild, newBuild)
+	}
+
+	d.stages(path+"stages", old.Stages, new.Stages)
+
+	switch {
+	case old.Assembler == nil && new.Assembler != nil:
+		d.add(path+"assembler", nil, new.Assembler)
+	case old.Assembler != nil && new.Assembler == nil:
+		d.add(path+"assembler", old.Assembler, nil)
+	case !reflect.DeepEqual(old.Assembler, new.Assembler):
+		d.add(path+"assembler", old.Assembler, new.Assembler)
+	}
+}
+
+// stages matches the stages of `old` and `new` by the longest common
+// subsequence of their names and adds the unmatched stages and the matched
+// stages whose options differ.
+func (d *differ) stages(path string, old, new []*Stage) {
+	// common[i][j] is the length of the longest common subsequence of
+	// old[i:] and new[j:]
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i].Name == new[j].Name {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i].Name == new[j].Name:
+			if !reflect.DeepEqual(old[i], new[j]) {
+				d.add(fmt.Sprintf("%s[%d]", path, j), old[i], new[j])
+			}
+			i++
+			j++
+		case j == len(new) || (i < len(old) && common[i+1][j] >= common[i][j+1]):
+			d.add(fmt.Sprintf("%s[%d]", path, i), old[i], nil)
+			i++
+		default:
+			d.add(fmt.Sprintf("%s[%d]", path, j), nil, new[j])
+			j++
+		}
+	}
+}
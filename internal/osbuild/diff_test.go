@@ -0,0 +1,95 @@
+package osbuild
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffManifests(t *testing.T) {
+	old := Manifest{
+		Sources: Sources{
+			"org.osbuild.files": &FilesSource{URLs: map[string]FileSource{
+				"sha256:1": {URL: "https://example.com/1.rpm"},
+				"sha256:2": {URL: "https://example.com/2.rpm"},
+			}},
+		},
+		Pipeline: Pipeline{
+			Build: &Build{
+				Pipeline: &Pipeline{Stages: []*Stage{NewRPMStage(&RPMStageOptions{})}},
+				Runner:   "org.osbuild.fedora31",
+			},
+			Stages: []*Stage{
+				NewRPMStage(&RPMStageOptions{Packages: []RPMPackage{{Checksum: "sha256:1"}}}),
+				NewLocaleStage(&LocaleStageOptions{Language: "en_US"}),
+				NewSELinuxStage(&SELinuxStageOptions{FileContexts: "file_contexts"}),
+			},
+			Assembler: NewTarAssembler(&TarAssemblerOptions{Filename: "root.tar"}),
+		},
+	}
+	new := Manifest{
+		Sources: Sources{
+			"org.osbuild.files": &FilesSource{URLs: map[string]FileSource{
+				"sha256:2": {URL: "https://mirror.example.com/2.rpm"},
+				"sha256:3": {URL: "https://example.com/3.rpm"},
+			}},
+		},
+		Pipeline: Pipeline{
+			Build: &Build{
+				Pipeline: &Pipeline{Stages: []*Stage{NewRPMStage(&RPMStageOptions{})}},
+				Runner:   "org.osbuild.fedora32",
+			},
+			Stages: []*Stage{
+				NewRPMStage(&RPMStageOptions{Packages: []RPMPackage{{Checksum: "sha256:1"}}}),
+				NewHostnameStage(&HostnameStageOptions{Hostname: "test"}),
+				NewLocaleStage(&LocaleStageOptions{Language: "de_DE"}),
+			},
+			Assembler: NewTarAssembler(&TarAssemblerOptions{Filename: "root.tar"}),
+		},
+	}
+
+	require.Equal(t, []Difference{
+		{Path: "sources.org.osbuild.files.urls.sha256:1", Old: FileSource{URL: "https://example.com/1.rpm"}},
+		{
+			Path: "sources.org.osbuild.files.urls.sha256:2",
+			Old:  FileSource{URL: "https://example.com/2.rpm"},
+			New:  FileSource{URL: "https://mirror.example.com/2.rpm"},
+		},
+		{Path: "sources.org.osbuild.files.urls.sha256:3", New: FileSource{URL: "https://example.com/3.rpm"}},
+		{Path: "pipeline.build.runner", Old: "org.osbuild.fedora31", New: "org.osbuild.fedora32"},
+		{Path: "pipeline.stages[1]", New: new.Pipeline.Stages[1]},
+		{Path: "pipeline.stages[2]", Old: old.Pipeline.Stages[1], New: new.Pipeline.Stages[2]},
+		{Path: "pipeline.stages[2]", Old: old.Pipeline.Stages[2]},
+	}, DiffManifests(&old, &new))
+
+	require.Empty(t, DiffManifests(&old, &old))
+
+	bare := Manifest{Sources: old.Sources, Pipeline: Pipeline{Stages: old.Pipeline.Stages}}
+	require.Equal(t, []Difference{
+		{Path: "pipeline.build", New: old.Pipeline.Build},
+		{Path: "pipeline.assembler", New: old.Pipeline.Assembler},
+	}, DiffManifests(&bare, &old))
+}
+
+func TestUnmarshalLegacyManifest(t *testing.T) {
+	var manifest Manifest
+	err := json.Unmarshal([]byte(`{
+		"sources": {"org.osbuild.files": {"urls": {"sha256:1": "https://example.com/1.rpm"}}},
+		"pipeline": {
+			"stages": [
+				{"name": "org.osbuild.rpm", "options": {"packages": ["sha256:1"]}},
+				{"name": "org.osbuild.users", "options": {"users": {"me": {"uid": "42", "gid": 43}}}},
+				{"name": "org.osbuild.grub2", "options": {"root_fs_uuid": "00000000-0000-0000-0000-000000000000", "legacy": true}}
+			]
+		}
+	}`), &manifest)
+	require.NoError(t, err)
+
+	require.Equal(t, FileSource{URL: "https://example.com/1.rpm"}, manifest.Sources["org.osbuild.files"].(*FilesSource).URLs["sha256:1"])
+	require.Equal(t, []RPMPackage{{Checksum: "sha256:1"}}, manifest.Pipeline.Stages[0].Options.(*RPMStageOptions).Packages)
+	user := manifest.Pipeline.Stages[1].Options.(*UsersStageOptions).Users["me"]
+	require.Equal(t, 42, *user.UID)
+	require.Equal(t, 43, *user.GID)
+	require.Equal(t, "i386-pc", manifest.Pipeline.Stages[2].Options.(*GRUB2StageOptions).Legacy)
+}
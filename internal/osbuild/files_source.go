@@ -1,5 +1,7 @@
 package osbuild
 
+import "encoding/json"
+
 type Secret struct {
 	Name string `json:"name,omitempty"`
 }
@@ -8,6 +10,19 @@ type FileSource struct {
 	Secrets *Secret `json:"secrets,omitempty"`
 }
 
+type rawFileSource FileSource
+
+// UnmarshalJSON unmarshals a FileSource. Older manifests only contain the URL
+// of a file instead of an object.
+func (source *FileSource) UnmarshalJSON(data []byte) error {
+	var url string
+	if json.Unmarshal(data, &url) == nil {
+		*source = FileSource{URL: url}
+		return nil
+	}
+	return json.Unmarshal(data, (*rawFileSource)(source))
+}
+
 // The FilesSourceOptions specifies a custom script to run in the image
 type FilesSource struct {
 	URLs map[string]FileSource `json:"urls"`
@@ -0,0 +1,129 @@
+// genschemas generates schemas.go of package osbuild, which contains the
+// schemas of the options of the osbuild modules composer uses. It reads them
+// from the SCHEMA strings of the modules in an osbuild checkout or
+// installation, which must be of the oldest version composer requires.
+//
+// It fails if a schema uses keywords which composer's validator doesn't
+// support, which must then be implemented first.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+)
+
+// modules are the modules composer uses, by their directory in osbuild.
+var modules = []struct {
+	dir      string
+	variable string
+	names    []string
+}{
+	{
+		dir:      "stages",
+		variable: "vendoredStageSchemas",
+		names: []string{
+			"org.osbuild.chrony",
+			"org.osbuild.firewall",
+			"org.osbuild.fix-bls",
+			"org.osbuild.fstab",
+			"org.osbuild.groups",
+			"org.osbuild.grub2",
+			"org.osbuild.hostname",
+			"org.osbuild.kernel-cmdline",
+			"org.osbuild.keymap",
+			"org.osbuild.locale",
+			"org.osbuild.rpm",
+			"org.osbuild.rpm-ostree",
+			"org.osbuild.script",
+			"org.osbuild.selinux",
+			"org.osbuild.systemd",
+			"org.osbuild.timezone",
+			"org.osbuild.users",
+			"org.osbuild.zipl",
+		},
+	},
+	{
+		dir:      "assemblers",
+		variable: "vendoredAssemblerSchemas",
+		names: []string{
+			"org.osbuild.oci-archive",
+			"org.osbuild.ostree.commit",
+			"org.osbuild.qemu",
+			"org.osbuild.rawfs",
+			"org.osbuild.tar",
+		},
+	},
+	{
+		dir:      "sources",
+		variable: "vendoredSourceSchemas",
+		names: []string{
+			"org.osbuild.files",
+		},
+	},
+}
+
+const header = `// Code generated by genschemas from the modules of osbuild; DO NOT EDIT.
+
+package osbuild
+
+// The schemas of the options of the stages, assemblers and sources composer
+// uses. Regenerate them with the oldest osbuild version which composer
+// requires, see VendoredSchemas.
+`
+
+func main() {
+	libdir := flag.String("libdir", "", "osbuild checkout or installation to read the modules from (default /usr/lib/osbuild)")
+	output := flag.String("o", "schemas.go", "file to write the schemas to")
+	flag.Parse()
+
+	if *libdir == "" {
+		*libdir = "/usr/lib/osbuild"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, m := range modules {
+		fmt.Fprintf(&buf, "\nvar %s = map[string]string{\n", m.variable)
+		for _, name := range m.names {
+			schema, err := osbuild.ReadModuleSchema(filepath.Join(*libdir, m.dir, name))
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(&buf, "%q: %s,\n", name, goString(schema))
+		}
+		buf.WriteString("}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("cannot format generated code: %v", err)
+	}
+	err = ioutil.WriteFile(*output, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// goString returns `schema`, indented, as a Go string literal.
+func goString(schema string) string {
+	var indented bytes.Buffer
+	err := json.Indent(&indented, []byte(schema), "\t", "\t")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if strings.Contains(indented.String(), "`") {
+		return strconv.Quote(indented.String())
+	}
+	return "`" + indented.String() + "`"
+}
@@ -1,6 +1,10 @@
 package osbuild
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
 
 // The GRUB2StageOptions describes the bootloader configuration.
 //
@@ -24,6 +28,30 @@ type GRUB2UEFI struct {
 
 func (GRUB2StageOptions) isStageOptions() {}
 
+// UnmarshalJSON unmarshals GRUB2StageOptions. In older manifests, `legacy` is
+// a boolean, which is true for the i386-pc platform.
+func (options *GRUB2StageOptions) UnmarshalJSON(data []byte) error {
+	type rawOptions GRUB2StageOptions
+	var legacy struct {
+		rawOptions
+		Legacy json.RawMessage `json:"legacy,omitempty"`
+	}
+	err := json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+
+	*options = GRUB2StageOptions(legacy.rawOptions)
+	switch string(legacy.Legacy) {
+	case "", "null", "false":
+	case "true":
+		options.Legacy = "i386-pc"
+	default:
+		err = json.Unmarshal(legacy.Legacy, &options.Legacy)
+	}
+	return err
+}
+
 // NewGRUB2Stage creates a new GRUB2 stage object.
 func NewGRUB2Stage(options *GRUB2StageOptions) *Stage {
 	return &Stage{
@@ -0,0 +1,50 @@
+package osbuild
+
+// OCIArchiveAssemblerOptions describe how to assemble a tree into an OCI image.
+//
+// The assembler packs the tree as a single layer into an OCI image archive,
+// together with an image configuration for the given architecture, and
+// stores the output with the given filename.
+type OCIArchiveAssemblerOptions struct {
+	Filename     string            `json:"filename"`
+	Architecture string            `json:"architecture"`
+	Config       *OCIArchiveConfig `json:"config,omitempty"`
+}
+
+// OCIArchiveConfig is the subset of the OCI image configuration that the
+// assembler allows to be set.
+type OCIArchiveConfig struct {
+	Cmd          []string          `json:"Cmd,omitempty"`
+	Env          []string          `json:"Env,omitempty"`
+	ExposedPorts []string          `json:"ExposedPorts,omitempty"`
+	User         string            `json:"User,omitempty"`
+	Labels       map[string]string `json:"Labels,omitempty"`
+	StopSignal   string            `json:"StopSignal,omitempty"`
+}
+
+func (OCIArchiveAssemblerOptions) isAssemblerOptions() {}
+
+// NewOCIArchiveAssembler creates a new OCI Archive Assembler object.
+func NewOCIArchiveAssembler(options *OCIArchiveAssemblerOptions) *Assembler {
+	return &Assembler{
+		Name:    "org.osbuild.oci-archive",
+		Options: options,
+	}
+}
+
+// OCIArchitecture returns the OCI/GOARCH name for an rpm architecture, or
+// the empty string if the architecture is not known.
+func OCIArchitecture(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "ppc64le":
+		return "ppc64le"
+	case "s390x":
+		return "s390x"
+	default:
+		return ""
+	}
+}
@@ -21,3 +21,22 @@ func NewOSTreeCommitAssembler(options *OSTreeCommitAssemblerOptions) *Assembler
 		Options: options,
 	}
 }
+
+// OSTreeCommitAssemblerMetadata describes the commit the assembler created,
+// as reported by rpm-ostree.
+type OSTreeCommitAssemblerMetadata struct {
+	Compose OSTreeCommitAssemblerCompose `json:"compose"`
+}
+
+// OSTreeCommitAssemblerCompose contains the fields of rpm-ostree's compose
+// description which identify the commit.
+type OSTreeCommitAssemblerCompose struct {
+	Ref             string `json:"ref"`
+	Commit          string `json:"ostree-commit"`
+	Version         string `json:"ostree-version,omitempty"`
+	InputHash       string `json:"rpm-ostree-inputhash,omitempty"`
+	ContentChecksum string `json:"ostree-content-checksum,omitempty"`
+	Timestamp       string `json:"ostree-timestamp,omitempty"`
+}
+
+func (OSTreeCommitAssemblerMetadata) isStageMetadata() {}
@@ -1,24 +1,27 @@
 package osbuild
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-type rawAssemblerResult struct {
-	Name    string          `json:"name"`
-	Options json.RawMessage `json:"options"`
-	Success bool            `json:"success"`
-	Output  string          `json:"output"`
-}
-
+// StageResult is the result of a stage or of the assembler.
 type StageResult struct {
 	Name     string          `json:"name"`
+	ID       string          `json:"id,omitempty"`
 	Options  json.RawMessage `json:"options"`
 	Success  bool            `json:"success"`
 	Output   string          `json:"output"`
 	Metadata StageMetadata   `json:"metadata"`
+	// Duration is how long the stage ran, in seconds. osbuild doesn't
+	// report it in its result; it is set from osbuild's log with
+	// SetDurations, and is zero if the log didn't contain the stage.
+	Duration float64 `json:"duration,omitempty"`
 }
 
 // StageMetadata specify the metadata of a given stage-type.
@@ -26,12 +29,24 @@ type StageMetadata interface {
 	isStageMetadata()
 }
 
+// RawStageMetadata is the metadata of stages composer doesn't know the
+// metadata of, as osbuild reported it.
+type RawStageMetadata json.RawMessage
+
+func (RawStageMetadata) isStageMetadata() {}
+
+func (metadata RawStageMetadata) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(metadata).MarshalJSON()
+}
+
 type rawStageResult struct {
 	Name     string          `json:"name"`
+	ID       string          `json:"id"`
 	Options  json.RawMessage `json:"options"`
 	Success  bool            `json:"success"`
 	Output   string          `json:"output"`
 	Metadata json.RawMessage `json:"metadata"`
+	Duration float64         `json:"duration"`
 }
 
 type buildResult struct {
@@ -41,12 +56,12 @@ type buildResult struct {
 }
 
 type Result struct {
-	TreeID    string              `json:"tree_id"`
-	OutputID  string              `json:"output_id"`
-	Build     *buildResult        `json:"build"`
-	Stages    []StageResult       `json:"stages"`
-	Assembler *rawAssemblerResult `json:"assembler"`
-	Success   bool                `json:"success"`
+	TreeID    string        `json:"tree_id"`
+	OutputID  string        `json:"output_id"`
+	Build     *buildResult  `json:"build"`
+	Stages    []StageResult `json:"stages"`
+	Assembler *StageResult  `json:"assembler"`
+	Success   bool          `json:"success"`
 }
 
 func (result *StageResult) UnmarshalJSON(data []byte) error {
@@ -56,26 +71,94 @@ func (result *StageResult) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	var metadata StageMetadata
-	switch rawStageResult.Name {
-	case "org.osbuild.rpm":
-		metadata = new(RPMStageMetadata)
-		err = json.Unmarshal(rawStageResult.Metadata, metadata)
-		if err != nil {
-			return err
+	if len(rawStageResult.Metadata) > 0 && string(rawStageResult.Metadata) != "null" {
+		switch rawStageResult.Name {
+		case "org.osbuild.rpm":
+			metadata = new(RPMStageMetadata)
+		case "org.osbuild.ostree.commit":
+			metadata = new(OSTreeCommitAssemblerMetadata)
+		default:
+			metadata = RawStageMetadata(rawStageResult.Metadata)
+		}
+		if _, raw := metadata.(RawStageMetadata); !raw {
+			err = json.Unmarshal(rawStageResult.Metadata, metadata)
+			if err != nil {
+				return fmt.Errorf("invalid metadata of %s: %v", rawStageResult.Name, err)
+			}
 		}
-	default:
-		metadata = nil
 	}
 
 	result.Name = rawStageResult.Name
+	result.ID = rawStageResult.ID
 	result.Options = rawStageResult.Options
 	result.Success = rawStageResult.Success
 	result.Output = rawStageResult.Output
 	result.Metadata = metadata
+	result.Duration = rawStageResult.Duration
 
 	return nil
 }
 
+var (
+	// the header osbuild's LogMonitor writes when a stage or the assembler
+	// starts: its name and id, followed by its options
+	monitorModuleRegexp = regexp.MustCompile(`^(?:Assembler )?(\S+): ([0-9a-f]{64}) `)
+	// the line osbuild's LogMonitor writes when a stage or the assembler
+	// finished
+	monitorDurationRegexp = regexp.MustCompile(`^⏱\s+Duration: ([0-9.]+)s$`)
+)
+
+// ParseMonitorLog reads the log osbuild writes with `--monitor LogMonitor`
+// and returns how long each stage and the assembler ran, in seconds, by id.
+// Stages which osbuild took from its store don't run and are not included.
+func ParseMonitorLog(log io.Reader) (map[string]float64, error) {
+	durations := map[string]float64{}
+	reader := bufio.NewReader(log)
+	var id string
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\n")
+		if match := monitorModuleRegexp.FindStringSubmatch(line); match != nil {
+			id = match[2]
+		} else if match := monitorDurationRegexp.FindStringSubmatch(line); match != nil && id != "" {
+			duration, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration of stage %s: %v", id, err)
+			}
+			durations[id] = duration
+			id = ""
+		}
+
+		if err == io.EOF {
+			return durations, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SetDurations sets the duration of every stage and of the assembler from
+// `durations`, as returned by ParseMonitorLog.
+func (cr *Result) SetDurations(durations map[string]float64) {
+	set := func(stage *StageResult) {
+		if duration, ok := durations[stage.ID]; ok && stage.ID != "" {
+			stage.Duration = duration
+		}
+	}
+
+	if cr.Build != nil {
+		for i := range cr.Build.Stages {
+			set(&cr.Build.Stages[i])
+		}
+	}
+	for i := range cr.Stages {
+		set(&cr.Stages[i])
+	}
+	if cr.Assembler != nil {
+		set(cr.Assembler)
+	}
+}
+
 func (cr *Result) Write(writer io.Writer) error {
 	if cr.Build == nil && len(cr.Stages) == 0 && cr.Assembler == nil {
 		fmt.Fprintf(writer, "The compose result is empty.\n")
@@ -86,13 +169,10 @@ func (cr *Result) Write(writer io.Writer) error {
 
 		for _, stage := range cr.Build.Stages {
 			fmt.Fprintf(writer, "Stage %s\n", stage.Name)
-			enc := json.NewEncoder(writer)
-			enc.SetIndent("", "  ")
-			err := enc.Encode(stage.Options)
+			err := stage.write(writer)
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(writer, "\nOutput:\n%s\n", stage.Output)
 		}
 	}
 
@@ -100,25 +180,43 @@ func (cr *Result) Write(writer io.Writer) error {
 		fmt.Fprintf(writer, "Stages:\n")
 		for _, stage := range cr.Stages {
 			fmt.Fprintf(writer, "Stage: %s\n", stage.Name)
-			enc := json.NewEncoder(writer)
-			enc.SetIndent("", "  ")
-			err := enc.Encode(stage.Options)
+			err := stage.write(writer)
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(writer, "\nOutput:\n%s\n", stage.Output)
 		}
 	}
 
 	if cr.Assembler != nil {
 		fmt.Fprintf(writer, "Assembler %s:\n", cr.Assembler.Name)
-		enc := json.NewEncoder(writer)
-		enc.SetIndent("", "  ")
-		err := enc.Encode(cr.Assembler.Options)
+		err := cr.Assembler.write(writer)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (stage *StageResult) write(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(stage.Options)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(writer, "\nOutput:\n%s\n", stage.Output)
+
+	if stage.Duration > 0 {
+		fmt.Fprintf(writer, "Duration: %.1fs\n", stage.Duration)
+	}
+
+	if stage.Metadata != nil {
+		fmt.Fprintf(writer, "Metadata:\n")
+		err = enc.Encode(stage.Metadata)
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(writer, "\nOutput:\n%s\n", cr.Assembler.Output)
 	}
 
 	return nil
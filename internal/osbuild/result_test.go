@@ -3,9 +3,12 @@ package osbuild
 import (
 	"bytes"
 	"encoding/json"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUnmarshall(t *testing.T) {
@@ -60,6 +63,115 @@ func TestUnmarshall(t *testing.T) {
 	assert.Equal(t, package1.SigMD5, "84fc907a5047aeebaf8da1642925a417")
 }
 
+func TestUnmarshalMetadata(t *testing.T) {
+	resultRaw := `{
+		"success": true,
+		"stages": [
+			{"name": "org.osbuild.locale", "success": true, "output": "", "metadata": null},
+			{"name": "org.osbuild.example", "success": true, "output": "", "metadata": {"checksum": "sha256:0a"}}
+		],
+		"assembler": {
+			"name": "org.osbuild.ostree.commit",
+			"success": true,
+			"output": "Committing...",
+			"metadata": {
+				"compose": {
+					"ref": "fedora/32/x86_64/iot",
+					"ostree-commit": "c4f9a9a94ba8c3e5d6ea95b5f6cd81f2d63b2c53d8b6f1e8f24e7f09c4c8b1ee",
+					"ostree-n-metadata-total": 6427,
+					"rpm-ostree-inputhash": "9a0b5d2f",
+					"ostree-content-checksum": "3d4f5e6a",
+					"ostree-timestamp": "2020-06-25T13:50:32Z"
+				}
+			}
+		}
+	}`
+
+	var result Result
+	err := json.Unmarshal([]byte(resultRaw), &result)
+	assert.NoError(t, err)
+
+	assert.Nil(t, result.Stages[0].Metadata)
+	assert.Equal(t, RawStageMetadata(`{"checksum": "sha256:0a"}`), result.Stages[1].Metadata)
+	assert.Equal(t, &OSTreeCommitAssemblerMetadata{
+		Compose: OSTreeCommitAssemblerCompose{
+			Ref:             "fedora/32/x86_64/iot",
+			Commit:          "c4f9a9a94ba8c3e5d6ea95b5f6cd81f2d63b2c53d8b6f1e8f24e7f09c4c8b1ee",
+			InputHash:       "9a0b5d2f",
+			ContentChecksum: "3d4f5e6a",
+			Timestamp:       "2020-06-25T13:50:32Z",
+		},
+	}, result.Assembler.Metadata)
+
+	data, err := json.Marshal(result.Stages[1].Metadata)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"checksum": "sha256:0a"}`, string(data))
+
+	err = json.Unmarshal([]byte(`{"name": "org.osbuild.rpm", "metadata": {"packages": "none"}}`), &StageResult{})
+	assert.Error(t, err)
+}
+
+func TestParseMonitorLog(t *testing.T) {
+	log, err := os.Open("testdata/monitor.log")
+	require.NoError(t, err)
+	defer log.Close()
+
+	durations, err := ParseMonitorLog(log)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{
+		"9eb0a6f6fd6e2995e107f5bcc6aa3b19643b02ec133bdc8a8ac614860b1bbf2d": 31,
+		"c84a5f2fb8b4f2fa9d5e8a1b9df0a2e49c0d24db8c8b0ae3d8a3c87b72f2fe1a": 117,
+		"4b8fe3a9d1c51d6c3a8c1a50d93e5c5d1a0e2f3b5e8f1a7c6d9b0e2f4a6c8d0e": 0,
+		"2e05d7cdbfb0c3f7b9ea1e8d2b0a7c2b6f1e8d9c0b7a6f5e4d3c2b1a09f8e7d6": 14,
+	}, durations)
+
+	// a stage which didn't finish has no duration
+	durations, err = ParseMonitorLog(strings.NewReader("org.osbuild.rpm: 9eb0a6f6fd6e2995e107f5bcc6aa3b19643b02ec133bdc8a8ac614860b1bbf2d {}\nBuilding..."))
+	require.NoError(t, err)
+	assert.Empty(t, durations)
+}
+
+func TestSetDurations(t *testing.T) {
+	// the build pipeline was taken from osbuild's store, so it didn't run
+	resultRaw := `{
+		"success": true,
+		"build": {
+			"success": true,
+			"stages": [
+				{"name": "org.osbuild.rpm", "id": "5d2c9c4e1b8a7f6e5d4c3b2a19087f6e5d4c3b2a19087f6e5d4c3b2a19087f6e", "success": true}
+			]
+		},
+		"stages": [
+			{"name": "org.osbuild.rpm", "id": "c84a5f2fb8b4f2fa9d5e8a1b9df0a2e49c0d24db8c8b0ae3d8a3c87b72f2fe1a", "success": true},
+			{"name": "org.osbuild.locale", "id": "4b8fe3a9d1c51d6c3a8c1a50d93e5c5d1a0e2f3b5e8f1a7c6d9b0e2f4a6c8d0e", "success": true}
+		],
+		"assembler": {"name": "org.osbuild.qemu", "id": "2e05d7cdbfb0c3f7b9ea1e8d2b0a7c2b6f1e8d9c0b7a6f5e4d3c2b1a09f8e7d6", "success": true}
+	}`
+
+	var result Result
+	require.NoError(t, json.Unmarshal([]byte(resultRaw), &result))
+
+	log, err := os.Open("testdata/monitor.log")
+	require.NoError(t, err)
+	defer log.Close()
+	durations, err := ParseMonitorLog(log)
+	require.NoError(t, err)
+	result.SetDurations(durations)
+
+	assert.Zero(t, result.Build.Stages[0].Duration)
+	assert.Equal(t, 117.0, result.Stages[0].Duration)
+	assert.Zero(t, result.Stages[1].Duration)
+	assert.Equal(t, 14.0, result.Assembler.Duration)
+
+	// composer keeps the durations when it stores the result
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var stored Result
+	require.NoError(t, json.Unmarshal(data, &stored))
+	assert.Equal(t, 117.0, stored.Stages[0].Duration)
+	assert.Equal(t, 14.0, stored.Assembler.Duration)
+}
+
 func TestWriteFull(t *testing.T) {
 
 	const testOptions = `{"msg": "test"}`
@@ -96,11 +208,12 @@ func TestWriteFull(t *testing.T) {
 		Success: true,
 	}
 
-	testAssembler := rawAssemblerResult{
-		Name:    "testAssembler",
-		Options: []byte(testOptions),
-		Success: true,
-		Output:  "Done",
+	testAssembler := StageResult{
+		Name:     "testAssembler",
+		Options:  []byte(testOptions),
+		Success:  true,
+		Output:   "Done",
+		Duration: 42.5,
 	}
 
 	testComposeResult := Result{
@@ -131,6 +244,19 @@ Stage: org.osbuild.rpm
 
 Output:
 Finished
+Metadata:
+{
+  "packages": [
+    {
+      "name": "foobar",
+      "version": "1",
+      "release": "1",
+      "epoch": null,
+      "arch": "noarch",
+      "sigmd5": "deadbeef"
+    }
+  ]
+}
 Assembler testAssembler:
 {
   "msg": "test"
@@ -138,6 +264,7 @@ Assembler testAssembler:
 
 Output:
 Done
+Duration: 42.5s
 `
 	assert.Equal(t, expectedMessage, b.String())
 }
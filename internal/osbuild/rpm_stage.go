@@ -1,5 +1,7 @@
 package osbuild
 
+import "encoding/json"
+
 // The RPMStageOptions describe the operations of the RPM stage.
 //
 // The RPM stage installs a given set of packages, identified by their
@@ -19,6 +21,19 @@ type RPMPackage struct {
 	CheckGPG bool   `json:"check_gpg,omitempty"`
 }
 
+type rawRPMPackage RPMPackage
+
+// UnmarshalJSON unmarshals an RPMPackage. Older manifests only contain the
+// checksum of a package instead of an object.
+func (pkg *RPMPackage) UnmarshalJSON(data []byte) error {
+	var checksum string
+	if json.Unmarshal(data, &checksum) == nil {
+		*pkg = RPMPackage{Checksum: checksum}
+		return nil
+	}
+	return json.Unmarshal(data, (*rawRPMPackage)(pkg))
+}
+
 func (RPMStageOptions) isStageOptions() {}
 
 // NewRPMStage creates a new RPM stage.
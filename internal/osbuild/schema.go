@@ -0,0 +1,659 @@
+package osbuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schemas are the JSON schemas of the options of the stages, assemblers and
+// sources of osbuild, which manifests are validated against.
+type Schemas struct {
+	stages     map[string]map[string]interface{}
+	assemblers map[string]map[string]interface{}
+	sources    map[string]map[string]interface{}
+}
+
+//go:generate go run ./genschemas -libdir $OSBUILD_LIBDIR -o schemas.go
+
+// VendoredSchemas returns the schemas of the stages, assemblers and sources
+// which composer uses, as they are in the oldest osbuild version composer
+// supports. They are generated from the modules of that version with
+// `OSBUILD_LIBDIR=<osbuild checkout> go generate`.
+func VendoredSchemas() *Schemas {
+	schemas := &Schemas{
+		stages:     make(map[string]map[string]interface{}),
+		assemblers: make(map[string]map[string]interface{}),
+		sources:    make(map[string]map[string]interface{}),
+	}
+	for _, v := range []struct {
+		vendored map[string]string
+		schemas  map[string]map[string]interface{}
+	}{
+		{vendoredStageSchemas, schemas.stages},
+		{vendoredAssemblerSchemas, schemas.assemblers},
+		{vendoredSourceSchemas, schemas.sources},
+	} {
+		for name, data := range v.vendored {
+			schema, err := parseSchema(data)
+			if err != nil {
+				panic(fmt.Sprintf("invalid vendored schema of %s: %v", name, err))
+			}
+			v.schemas[name] = schema
+		}
+	}
+	return schemas
+}
+
+// schemaPattern matches the schema of the options in an osbuild module, which
+// is the content of a JSON object. The first group is "r" for raw strings.
+var schemaPattern = regexp.MustCompile(`(?s)\nSCHEMA\s*=\s*(r?)"""(.*?)"""`)
+
+// pythonUnescaper replaces the escape sequences which may appear in the
+// schemas of modules which aren't raw strings.
+var pythonUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\'`, `'`, "\\\n", "")
+
+// ReadModuleSchema returns the schema of the options of the osbuild module in
+// file `path` as JSON. Modules without a schema accept any options. It fails
+// if the schema is invalid or uses keywords which the validator doesn't
+// support, so that such a schema doesn't silently accept invalid options.
+func ReadModuleSchema(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	m := schemaPattern.FindSubmatch(data)
+	if m == nil {
+		return "{}", nil
+	}
+	schema := string(m[2])
+	if len(m[1]) == 0 {
+		schema = pythonUnescaper.Replace(schema)
+	}
+	schema = "{" + schema + "}"
+
+	_, err = parseSchema(schema)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema in %s: %v", filepath.Base(path), err)
+	}
+	return schema, nil
+}
+
+// LoadSchemas loads the schemas from the modules of an installed osbuild in
+// `libdir`, which is usually /usr/lib/osbuild.
+func LoadSchemas(libdir string) (*Schemas, error) {
+	schemas := &Schemas{}
+	for _, v := range []struct {
+		dir     string
+		schemas *map[string]map[string]interface{}
+	}{
+		{"stages", &schemas.stages},
+		{"assemblers", &schemas.assemblers},
+		{"sources", &schemas.sources},
+	} {
+		*v.schemas = make(map[string]map[string]interface{})
+
+		files, err := ioutil.ReadDir(filepath.Join(libdir, v.dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasPrefix(file.Name(), "org.osbuild.") {
+				continue
+			}
+
+			data, err := ReadModuleSchema(filepath.Join(libdir, v.dir, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			schema, err := parseSchema(data)
+			if err != nil {
+				return nil, err
+			}
+			(*v.schemas)[file.Name()] = schema
+		}
+	}
+
+	if len(schemas.stages) == 0 {
+		return nil, &os.PathError{Op: "load schemas", Path: libdir, Err: os.ErrNotExist}
+	}
+	return schemas, nil
+}
+
+// parseSchema parses the schema of the options of a module. Like osbuild, it
+// requires the options to be an object.
+func parseSchema(data string) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	err := json.Unmarshal([]byte(data), &schema)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSchema("", schema)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	return schema, nil
+}
+
+// schemaKeywords are the keywords of JSON schema draft 4 which the validator
+// supports, and annotations, which don't affect validation.
+var schemaKeywords = map[string]bool{
+	"$ref": true, "type": true, "enum": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	"required": true, "properties": true, "patternProperties": true, "additionalProperties": true,
+	"minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+
+	"$schema": true, "id": true, "definitions": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+// checkSchema returns an error if `schema`, found at JSON pointer `path`,
+// or one of its subschemas uses a keyword the validator doesn't support or
+// contains a pattern which doesn't compile.
+func checkSchema(path string, schema map[string]interface{}) error {
+	var keywords []string
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		if !schemaKeywords[keyword] {
+			return fmt.Errorf("unsupported keyword %s at #%s", keyword, path)
+		}
+
+		var subschemas map[string]interface{}
+		switch keyword {
+		case "properties", "patternProperties", "definitions":
+			subschemas, _ = schema[keyword].(map[string]interface{})
+		case "additionalProperties", "items", "not":
+			if s, ok := schema[keyword].(map[string]interface{}); ok {
+				subschemas = map[string]interface{}{"": s}
+			} else if items, ok := schema[keyword].([]interface{}); ok {
+				subschemas = indexed(items)
+			}
+		case "allOf", "anyOf", "oneOf":
+			items, _ := schema[keyword].([]interface{})
+			subschemas = indexed(items)
+		case "pattern":
+			if pattern, ok := schema[keyword].(string); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return fmt.Errorf("invalid pattern %s at #%s: %v", pattern, path, err)
+				}
+			}
+		}
+
+		var names []string
+		for name := range subschemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if keyword == "patternProperties" {
+				if _, err := regexp.Compile(name); err != nil {
+					return fmt.Errorf("invalid pattern %s at #%s/%s: %v", name, path, keyword, err)
+				}
+			}
+			subpath := path + "/" + keyword
+			if name != "" {
+				subpath += "/" + name
+			}
+			if s, ok := subschemas[name].(map[string]interface{}); ok {
+				err := checkSchema(subpath, s)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexed returns `items` keyed by their index.
+func indexed(items []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for i, item := range items {
+		m[strconv.Itoa(i)] = item
+	}
+	return m
+}
+
+// A ValidationError describes why a part of a manifest is invalid. Path
+// names that part like the paths of DiffManifests, for example
+// "pipeline.stages[3].options.users.alice.uid".
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are all reasons why a manifest is invalid.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate validates the options of all stages, the assembler and the sources
+// of `manifest` against the schemas. It returns ValidationErrors if the
+// manifest is invalid.
+func (schemas *Schemas) Validate(manifest *Manifest) error {
+	v := &validator{}
+
+	var names []string
+	for name := range manifest.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.validateOptions("sources."+name, schemas.sources, "source", name, manifest.Sources[name])
+	}
+
+	v.validatePipeline(schemas, "pipeline.", &manifest.Pipeline)
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+type validator struct {
+	errors ValidationErrors
+	root   map[string]interface{}
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{path, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validatePipeline(schemas *Schemas, path string, pipeline *Pipeline) {
+	if pipeline.Build != nil {
+		if pipeline.Build.Runner == "" {
+			v.errorf(path+"build.runner", "is required")
+		}
+		if pipeline.Build.Pipeline == nil {
+			v.errorf(path+"build.pipeline", "is required")
+		} else {
+			v.validatePipeline(schemas, path+"build.pipeline.", pipeline.Build.Pipeline)
+		}
+	}
+
+	for i, stage := range pipeline.Stages {
+		stagePath := fmt.Sprintf("%sstages[%d]", path, i)
+		v.validateOptions(stagePath+".options", schemas.stages, "stage", stage.Name, stage.Options)
+	}
+
+	if pipeline.Assembler != nil {
+		v.validateOptions(path+"assembler.options", schemas.assemblers, "assembler", pipeline.Assembler.Name, pipeline.Assembler.Options)
+	}
+}
+
+// validateOptions validates the options of the stage, assembler or source
+// `name` against its schema in `schemas`.
+func (v *validator) validateOptions(path string, schemas map[string]map[string]interface{}, kind, name string, options interface{}) {
+	schema, ok := schemas[name]
+	if !ok {
+		v.errorf(strings.TrimSuffix(path, ".options"), "unknown %s %s", kind, name)
+		return
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		v.errorf(path, "cannot marshal: %v", err)
+		return
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		v.errorf(path, "cannot unmarshal: %v", err)
+		return
+	}
+	// osbuild treats missing options like empty ones
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+
+	v.root = schema
+	v.validate(path, schema, value)
+}
+
+// validate validates `value` against `schema`. It supports the keywords of
+// JSON schema draft 4 in schemaKeywords, parseSchema rejects schemas with
+// other keywords.
+func (v *validator) validate(path string, schema map[string]interface{}, value interface{}) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.errorf(path, "%v", err)
+			return
+		}
+		v.validate(path, resolved, value)
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !hasType(value, t) {
+		v.errorf(path, "expected %s, got %s", typeNames(t), typeOf(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.errorf(path, "must be one of %s", toJSON(enum))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(path, schema, value)
+	case []interface{}:
+		v.validateArray(path, schema, value)
+	case string:
+		v.validateString(path, schema, value)
+	case float64:
+		v.validateNumber(path, schema, value)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if s, ok := s.(map[string]interface{}); ok {
+				v.validate(path, s, value)
+			}
+		}
+	}
+	if any, ok := schema["anyOf"].([]interface{}); ok {
+		v.validateAlternatives(path, any, value, false)
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		v.validateAlternatives(path, one, value, true)
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok {
+		if len(v.try(path, not, value)) == 0 {
+			v.errorf(path, "must not match %s", toJSON(not))
+		}
+	}
+}
+
+func (v *validator) validateObject(path string, schema map[string]interface{}, object map[string]interface{}) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := object[name]; !ok {
+					v.errorf(path+"."+name, "is required")
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "." + key
+		matched := false
+
+		if s, ok := properties[key].(map[string]interface{}); ok {
+			matched = true
+			v.validate(keyPath, s, object[key])
+		}
+		for pattern, s := range patternProperties {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				v.errorf(path, "invalid pattern %s in schema", pattern)
+				continue
+			}
+			if re.MatchString(key) {
+				matched = true
+				if s, ok := s.(map[string]interface{}); ok {
+					v.validate(keyPath, s, object[key])
+				}
+			}
+		}
+
+		if !matched {
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					v.errorf(keyPath, "is not allowed")
+				}
+			case map[string]interface{}:
+				v.validate(keyPath, additional, object[key])
+			}
+		}
+	}
+
+	if min, ok := schema["minProperties"].(float64); ok && float64(len(object)) < min {
+		v.errorf(path, "must have at least %v properties", min)
+	}
+	if max, ok := schema["maxProperties"].(float64); ok && float64(len(object)) > max {
+		v.errorf(path, "must have at most %v properties", max)
+	}
+}
+
+func (v *validator) validateArray(path string, schema map[string]interface{}, array []interface{}) {
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		for i, item := range array {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), items, item)
+		}
+	case []interface{}:
+		for i, item := range array {
+			if i >= len(items) {
+				break
+			}
+			if s, ok := items[i].(map[string]interface{}); ok {
+				v.validate(fmt.Sprintf("%s[%d]", path, i), s, item)
+			}
+		}
+	}
+
+	if min, ok := schema["minItems"].(float64); ok && float64(len(array)) < min {
+		v.errorf(path, "must have at least %v items", min)
+	}
+	if max, ok := schema["maxItems"].(float64); ok && float64(len(array)) > max {
+		v.errorf(path, "must have at most %v items", max)
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if reflect.DeepEqual(array[i], array[j]) {
+					v.errorf(fmt.Sprintf("%s[%d]", path, j), "duplicates item %d", i)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(path string, schema map[string]interface{}, s string) {
+	length := float64(utf8.RuneCountInString(s))
+	if min, ok := schema["minLength"].(float64); ok && length < min {
+		v.errorf(path, "must be at least %v characters long", min)
+	}
+	if max, ok := schema["maxLength"].(float64); ok && length > max {
+		v.errorf(path, "must be at most %v characters long", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.errorf(path, "invalid pattern %s in schema", pattern)
+		} else if !re.MatchString(s) {
+			v.errorf(path, "%s doesn't match %s", toJSON(s), pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(path string, schema map[string]interface{}, n float64) {
+	if min, ok := schema["minimum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && n <= min {
+			v.errorf(path, "must be greater than %v", min)
+		} else if n < min {
+			v.errorf(path, "must be at least %v", min)
+		}
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && n <= min {
+		v.errorf(path, "must be greater than %v", min)
+	}
+	if max, ok := schema["maximum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && n >= max {
+			v.errorf(path, "must be less than %v", max)
+		} else if n > max {
+			v.errorf(path, "must be at most %v", max)
+		}
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && n >= max {
+		v.errorf(path, "must be less than %v", max)
+	}
+}
+
+// validateAlternatives validates that `value` matches any, or with `one`
+// exactly one, of `schemas`. When it matches none, the errors of the
+// alternative which it matches most closely are reported.
+func (v *validator) validateAlternatives(path string, schemas []interface{}, value interface{}, one bool) {
+	var closest ValidationErrors
+	matches := 0
+	for _, s := range schemas {
+		s, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		errs := v.try(path, s, value)
+		if len(errs) == 0 {
+			matches++
+		} else if closest == nil || len(errs) < len(closest) {
+			closest = errs
+		}
+	}
+
+	switch {
+	case matches == 0:
+		v.errors = append(v.errors, closest...)
+	case one && matches > 1:
+		v.errorf(path, "matches %d alternatives, but must match exactly one", matches)
+	}
+}
+
+// try returns the errors of validating `value` against `schema`, without
+// adding them to the errors of the validator.
+func (v *validator) try(path string, schema map[string]interface{}, value interface{}) ValidationErrors {
+	sub := &validator{root: v.root}
+	sub.validate(path, schema, value)
+	return sub.errors
+}
+
+// resolve resolves a reference to a part of the root schema, like
+// "#/definitions/user".
+func (v *validator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %s in schema", ref)
+	}
+
+	var current interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid reference %s in schema", ref)
+		}
+		current = object[part]
+	}
+
+	schema, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid reference %s in schema", ref)
+	}
+	return schema, nil
+}
+
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func hasType(value interface{}, t interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := typeOf(value)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, alternative := range t {
+			if hasType(value, alternative) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func typeNames(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		s := make([]string, len(names))
+		for i, name := range names {
+			s[i] = fmt.Sprint(name)
+		}
+		return strings.Join(s, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func toJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,190 @@
+package osbuild
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	uid := 42
+	manifest := Manifest{
+		Sources: Sources{
+			"org.osbuild.files": &FilesSource{URLs: map[string]FileSource{
+				"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef": {URL: "https://example.com/1.rpm"},
+			}},
+		},
+		Pipeline: Pipeline{
+			Build: &Build{
+				Pipeline: &Pipeline{Stages: []*Stage{NewRPMStage(&RPMStageOptions{Packages: []RPMPackage{}})}},
+				Runner:   "org.osbuild.fedora32",
+			},
+			Stages: []*Stage{
+				NewFirewallStage(&FirewallStageOptions{Ports: []string{"22:tcp"}}),
+				NewUsersStage(&UsersStageOptions{Users: map[string]UsersStageOptionsUser{"alice": {UID: &uid}}}),
+				NewFSTabStage(&FSTabStageOptions{FileSystems: []*FSTabEntry{{UUID: "76a22bf4-f153-4541-b6c7-0332c0dfaeac", Path: "/", VFSType: "ext4"}}}),
+			},
+			Assembler: NewTarAssembler(&TarAssemblerOptions{Filename: "root.tar.xz", Compression: "xz"}),
+		},
+	}
+
+	schemas := VendoredSchemas()
+	require.NoError(t, schemas.Validate(&manifest))
+
+	manifest.Sources["org.osbuild.files"].(*FilesSource).URLs["md5:nothex"] = FileSource{URL: "https://example.com/2.rpm"}
+	manifest.Pipeline.Build.Pipeline.Stages = append(manifest.Pipeline.Build.Pipeline.Stages, &Stage{Name: "org.osbuild.unknown", Options: &HostnameStageOptions{}})
+	manifest.Pipeline.Stages[0].Options.(*FirewallStageOptions).Ports = []string{"22"}
+	manifest.Pipeline.Stages[1].Options.(*UsersStageOptions).Users["not a user"] = UsersStageOptionsUser{}
+	manifest.Pipeline.Stages[2].Options.(*FSTabStageOptions).FileSystems[0].Path = ""
+	manifest.Pipeline.Assembler.Options.(*TarAssemblerOptions).Compression = "zip"
+
+	err := schemas.Validate(&manifest)
+	require.Equal(t, ValidationErrors{
+		{"sources.org.osbuild.files.urls.md5:nothex", "is not allowed"},
+		{"pipeline.build.pipeline.stages[1]", "unknown stage org.osbuild.unknown"},
+		{"pipeline.stages[0].options.ports[0]", `"22" doesn't match .:.`},
+		{"pipeline.stages[1].options.users.not a user", "is not allowed"},
+		{"pipeline.stages[2].options.filesystems[0].path", "is required"},
+		{"pipeline.assembler.options.compression", `must be one of ["gzip","bzip2","xz"]`},
+	}, err)
+	require.Contains(t, err.Error(), "pipeline.assembler.options.compression: must be one of")
+}
+
+func TestValidateKeywords(t *testing.T) {
+	schema, err := parseSchema(`{
+		"definitions": {"port": {"type": "integer", "minimum": 1, "maximum": 65535}},
+		"properties": {
+			"port": {"$ref": "#/definitions/port"},
+			"name": {"type": "string", "minLength": 1, "maxLength": 3},
+			"tags": {"type": "array", "uniqueItems": true, "maxItems": 2},
+			"mode": {"anyOf": [{"type": "string", "pattern": "^[0-7]+$"}, {"type": "integer"}]},
+			"either": {"oneOf": [{"type": "number"}, {"type": "integer"}]},
+			"other": {"not": {"type": "null"}}
+		},
+		"additionalProperties": {"type": "boolean"}
+	}`)
+	require.NoError(t, err)
+
+	validate := func(value interface{}) ValidationErrors {
+		v := &validator{root: schema}
+		v.validate("options", schema, value)
+		return v.errors
+	}
+
+	require.Empty(t, validate(map[string]interface{}{
+		"port": 22.0, "name": "abc", "tags": []interface{}{"a", "b"}, "mode": "0755", "either": 1.5, "other": "x", "extra": true,
+	}))
+	require.Equal(t, ValidationErrors{
+		{"options.either", "matches 2 alternatives, but must match exactly one"},
+		{"options.extra", "expected boolean, got string"},
+		{"options.mode", `"rwx" doesn't match ^[0-7]+$`},
+		{"options.name", "must be at most 3 characters long"},
+		{"options.other", `must not match {"type":"null"}`},
+		{"options.port", "must be at most 65535"},
+		{"options.tags", "must have at most 2 items"},
+		{"options.tags[1]", "duplicates item 0"},
+	}, validate(map[string]interface{}{
+		"port": 70000.0, "name": "abcd", "tags": []interface{}{"a", "a", "b"}, "mode": "rwx", "either": 1.0, "other": nil, "extra": "yes",
+	}))
+	require.Equal(t, ValidationErrors{{"options", "expected object, got array"}}, validate([]interface{}{}))
+}
+
+func TestLoadSchemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = LoadSchemas(dir)
+	require.Error(t, err)
+
+	for _, d := range []string{"stages", "assemblers", "sources"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, d), 0755))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "stages", "org.osbuild.hostname"), []byte(`#!/usr/bin/python3
+"""
+Set system hostname
+"""
+
+import sys
+
+SCHEMA = """
+"additionalProperties": false,
+"required": ["hostname"],
+"properties": {
+  "hostname": {"type": "string"}
+}
+"""
+
+def main(tree, options):
+    pass
+`), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "stages", "org.osbuild.noop"), []byte("#!/usr/bin/python3\n"), 0755))
+
+	schemas, err := LoadSchemas(dir)
+	require.NoError(t, err)
+
+	manifest := Manifest{Pipeline: Pipeline{Stages: []*Stage{
+		NewHostnameStage(&HostnameStageOptions{Hostname: "test"}),
+		{Name: "org.osbuild.noop", Options: &ScriptStageOptions{Script: "anything"}},
+	}}}
+	require.NoError(t, schemas.Validate(&manifest))
+
+	manifest.Pipeline.Stages = append(manifest.Pipeline.Stages, NewLocaleStage(&LocaleStageOptions{Language: "en_US"}))
+	require.Equal(t, ValidationErrors{{"pipeline.stages[2]", "unknown stage org.osbuild.locale"}}, schemas.Validate(&manifest))
+}
+
+func TestReadModuleSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0755))
+		return path
+	}
+
+	schema, err := ReadModuleSchema(write("org.osbuild.noop", "#!/usr/bin/python3\n"))
+	require.NoError(t, err)
+	require.Equal(t, "{}", schema)
+
+	// escape sequences are processed unless the schema is a raw string
+	schema, err = ReadModuleSchema(write("org.osbuild.escaped", `
+SCHEMA = """
+"pattern": "^\\\\S+$"
+"""
+`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pattern": "^\\S+$"}`, schema)
+	schema, err = ReadModuleSchema(write("org.osbuild.raw", `
+SCHEMA = r"""
+"pattern": "^\\S+$"
+"""
+`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pattern": "^\\S+$"}`, schema)
+
+	// keywords which the validator doesn't support are rejected
+	_, err = ReadModuleSchema(write("org.osbuild.unsupported", `
+SCHEMA = """
+"properties": {"name": {"type": "string", "format": "hostname"}}
+"""
+`))
+	require.EqualError(t, err, "invalid schema in org.osbuild.unsupported: unsupported keyword format at #/properties/name")
+	_, err = ReadModuleSchema(write("org.osbuild.pattern", `
+SCHEMA = """
+"patternProperties": {"(": {}}
+"""
+`))
+	require.Error(t, err)
+
+	for _, d := range []string{"stages", "assemblers", "sources"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, d), 0755))
+	}
+	require.NoError(t, os.Rename(filepath.Join(dir, "org.osbuild.unsupported"), filepath.Join(dir, "stages", "org.osbuild.unsupported")))
+	_, err = LoadSchemas(dir)
+	require.Error(t, err)
+}
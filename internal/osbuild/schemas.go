@@ -0,0 +1,347 @@
+package osbuild
+
+// The schemas of the options of the stages, assemblers and sources composer
+// uses, from the modules of osbuild. Regenerate them with the oldest osbuild
+// version which composer requires, see VendoredSchemas.
+
+var vendoredStageSchemas = map[string]string{
+	"org.osbuild.chrony": `{
+		"additionalProperties": false,
+		"required": ["timeservers"],
+		"properties": {
+			"timeservers": {"type": "array", "items": {"type": "string"}}
+		}
+	}`,
+	"org.osbuild.firewall": `{
+		"additionalProperties": false,
+		"properties": {
+			"ports": {"type": "array", "items": {"type": "string", "pattern": ".:."}},
+			"enabled_services": {"type": "array", "items": {"type": "string"}},
+			"disabled_services": {"type": "array", "items": {"type": "string"}}
+		}
+	}`,
+	"org.osbuild.fix-bls": `{
+		"additionalProperties": false
+	}`,
+	"org.osbuild.fstab": `{
+		"additionalProperties": false,
+		"required": ["filesystems"],
+		"properties": {
+			"filesystems": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"additionalProperties": false,
+					"oneOf": [{"required": ["uuid", "path"]}, {"required": ["label", "path"]}],
+					"properties": {
+						"uuid": {"type": "string"},
+						"label": {"type": "string"},
+						"path": {"type": "string"},
+						"vfs_type": {"type": "string"},
+						"options": {"type": "string"},
+						"freq": {"type": "number"},
+						"passno": {"type": "number"}
+					}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.groups": `{
+		"additionalProperties": false,
+		"properties": {
+			"groups": {
+				"type": "object",
+				"additionalProperties": false,
+				"patternProperties": {
+					"^[A-Za-z0-9_][A-Za-z0-9_-]{0,31}$": {
+						"type": "object",
+						"properties": {
+							"name": {"type": "string"},
+							"gid": {"type": "number"}
+						}
+					}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.grub2": `{
+		"additionalProperties": false,
+		"required": ["root_fs_uuid"],
+		"properties": {
+			"root_fs_uuid": {"type": "string"},
+			"boot_fs_uuid": {"type": "string"},
+			"kernel_opts": {"type": "string"},
+			"legacy": {"type": ["boolean", "string"]},
+			"uefi": {
+				"type": "object",
+				"additionalProperties": false,
+				"required": ["vendor"],
+				"properties": {
+					"vendor": {"type": "string"}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.hostname": `{
+		"additionalProperties": false,
+		"required": ["hostname"],
+		"properties": {
+			"hostname": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.kernel-cmdline": `{
+		"additionalProperties": false,
+		"properties": {
+			"root_fs_uuid": {"type": "string"},
+			"kernel_opts": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.keymap": `{
+		"additionalProperties": false,
+		"required": ["keymap"],
+		"properties": {
+			"keymap": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.locale": `{
+		"additionalProperties": false,
+		"required": ["language"],
+		"properties": {
+			"language": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.rpm": `{
+		"additionalProperties": false,
+		"properties": {
+			"gpgkeys": {"type": "array", "items": {"type": "string"}},
+			"packages": {
+				"type": "array",
+				"items": {
+					"oneOf": [
+						{"type": "string"},
+						{
+							"type": "object",
+							"additionalProperties": false,
+							"required": ["checksum"],
+							"properties": {
+								"checksum": {"type": "string"},
+								"check_gpg": {"type": "boolean"}
+							}
+						}
+					]
+				}
+			}
+		}
+	}`,
+	"org.osbuild.rpm-ostree": `{
+		"additionalProperties": false,
+		"properties": {
+			"etc_group_members": {"type": "array", "items": {"type": "string"}}
+		}
+	}`,
+	"org.osbuild.script": `{
+		"additionalProperties": false,
+		"required": ["script"],
+		"properties": {
+			"script": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.selinux": `{
+		"additionalProperties": false,
+		"required": ["file_contexts"],
+		"properties": {
+			"file_contexts": {"type": "string"},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+		}
+	}`,
+	"org.osbuild.systemd": `{
+		"additionalProperties": false,
+		"properties": {
+			"enabled_services": {"type": "array", "items": {"type": "string"}},
+			"disabled_services": {"type": "array", "items": {"type": "string"}},
+			"default_target": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.timezone": `{
+		"additionalProperties": false,
+		"required": ["zone"],
+		"properties": {
+			"zone": {"type": "string"}
+		}
+	}`,
+	"org.osbuild.users": `{
+		"additionalProperties": false,
+		"properties": {
+			"users": {
+				"type": "object",
+				"additionalProperties": false,
+				"patternProperties": {
+					"^[A-Za-z0-9_][A-Za-z0-9_-]{0,31}$": {
+						"type": "object",
+						"properties": {
+							"uid": {"type": "number"},
+							"gid": {"type": "number"},
+							"groups": {"type": "array", "items": {"type": "string"}},
+							"description": {"type": "string"},
+							"home": {"type": "string"},
+							"shell": {"type": "string"},
+							"password": {"type": "string"},
+							"key": {"type": "string"}
+						}
+					}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.zipl": `{
+		"additionalProperties": false,
+		"properties": {
+			"timeout": {"type": "number"}
+		}
+	}`,
+}
+
+var vendoredAssemblerSchemas = map[string]string{
+	"org.osbuild.oci-archive": `{
+		"additionalProperties": false,
+		"required": ["architecture", "filename"],
+		"properties": {
+			"architecture": {"type": "string"},
+			"filename": {"type": "string"},
+			"config": {
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"Cmd": {"type": "array", "items": {"type": "string"}},
+					"Env": {"type": "array", "items": {"type": "string"}},
+					"ExposedPorts": {"type": "array", "items": {"type": "string"}},
+					"User": {"type": "string"},
+					"Labels": {"type": "object", "additionalProperties": {"type": "string"}},
+					"StopSignal": {"type": "string"},
+					"Volumes": {"type": "array", "items": {"type": "string"}},
+					"WorkingDir": {"type": "string"}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.ostree.commit": `{
+		"additionalProperties": false,
+		"required": ["ref", "tar"],
+		"properties": {
+			"ref": {"type": "string"},
+			"os_version": {"type": "string"},
+			"parent": {"type": "string"},
+			"tar": {
+				"type": "object",
+				"additionalProperties": false,
+				"required": ["filename"],
+				"properties": {
+					"filename": {"type": "string"},
+					"compression": {"type": "string", "enum": ["gzip", "bzip2", "xz"]}
+				}
+			}
+		}
+	}`,
+	"org.osbuild.qemu": `{
+		"additionalProperties": false,
+		"required": ["format", "filename", "ptuuid", "size"],
+		"properties": {
+			"bootloader": {
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"type": {"type": "string", "enum": ["grub2", "zipl"]},
+					"platform": {"type": "string"}
+				}
+			},
+			"format": {"type": "string", "enum": ["raw", "raw.xz", "qcow2", "vdi", "vmdk", "vpc", "vhdx"]},
+			"filename": {"type": "string"},
+			"ptuuid": {"type": "string"},
+			"pttype": {"type": "string", "enum": ["mbr", "dos", "gpt"]},
+			"partitions": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {
+						"bootable": {"type": "boolean"},
+						"name": {"type": "string"},
+						"size": {"type": "integer", "minimum": 0},
+						"start": {"type": "integer", "minimum": 0},
+						"type": {"type": "string"},
+						"uuid": {"type": "string"},
+						"filesystem": {
+							"type": "object",
+							"additionalProperties": false,
+							"required": ["type", "mountpoint"],
+							"properties": {
+								"type": {"type": "string"},
+								"uuid": {"type": "string"},
+								"label": {"type": "string"},
+								"mountpoint": {"type": "string"}
+							}
+						}
+					}
+				}
+			},
+			"size": {"type": "integer", "minimum": 0}
+		}
+	}`,
+	"org.osbuild.rawfs": `{
+		"additionalProperties": false,
+		"required": ["filename", "root_fs_uuid", "size"],
+		"properties": {
+			"filename": {"type": "string"},
+			"root_fs_uuid": {"type": "string"},
+			"size": {"type": "integer", "minimum": 0},
+			"fs_type": {"type": "string", "enum": ["ext4", "xfs", "btrfs"]}
+		}
+	}`,
+	"org.osbuild.tar": `{
+		"additionalProperties": false,
+		"required": ["filename"],
+		"properties": {
+			"filename": {"type": "string"},
+			"compression": {"type": "string", "enum": ["gzip", "bzip2", "xz"]}
+		}
+	}`,
+}
+
+var vendoredSourceSchemas = map[string]string{
+	"org.osbuild.files": `{
+		"additionalProperties": false,
+		"required": ["urls"],
+		"definitions": {
+			"url": {
+				"oneOf": [
+					{"type": "string"},
+					{
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["url"],
+						"properties": {
+							"url": {"type": "string"},
+							"secrets": {
+								"type": "object",
+								"additionalProperties": false,
+								"required": ["name"],
+								"properties": {
+									"name": {"type": "string"}
+								}
+							}
+						}
+					}
+				]
+			}
+		},
+		"properties": {
+			"urls": {
+				"type": "object",
+				"additionalProperties": false,
+				"patternProperties": {
+					"^(md5|sha1|sha256|sha384|sha512):[0-9a-f]{32,128}$": {"$ref": "#/definitions/url"}
+				}
+			}
+		}
+	}`,
+}
@@ -2,7 +2,7 @@ package osbuild
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 )
 
 // A Sources map contains all the sources made available to an osbuild run
@@ -13,6 +13,13 @@ type Source interface {
 	isSource()
 }
 
+// RawSource is a source which is not known to composer, kept as it is.
+type RawSource struct {
+	json.RawMessage
+}
+
+func (RawSource) isSource() {}
+
 type rawSources map[string]json.RawMessage
 
 // UnmarshalJSON unmarshals JSON into a Source object. Each type of source has
@@ -25,12 +32,15 @@ func (sources *Sources) UnmarshalJSON(data []byte) error {
 	}
 	*sources = make(map[string]Source)
 	for name, rawSource := range rawSources {
+		if len(rawSource) == 0 || rawSource[0] != '{' {
+			return fmt.Errorf("source %s is not an object", name)
+		}
 		var source Source
 		switch name {
 		case "org.osbuild.files":
 			source = new(FilesSource)
 		default:
-			return errors.New("unexpected suorce name" + name)
+			source = new(RawSource)
 		}
 		err = json.Unmarshal(rawSource, source)
 		if err != nil {
@@ -30,10 +30,13 @@ func TestSource_UnmarshalJSON(t *testing.T) {
 		},
 		{
 			name: "unknown source",
+			fields: fields{
+				Name:   "org.osbuild.foo",
+				Source: &RawSource{json.RawMessage(`{"bar":null}`)},
+			},
 			args: args{
-				data: []byte(`{"name":"org.osbuild.foo","options":{"bar":null}}`),
+				data: []byte(`{"org.osbuild.foo":{"bar":null}}`),
 			},
-			wantErr: true,
 		},
 		{
 			name: "missing options",
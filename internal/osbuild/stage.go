@@ -2,7 +2,7 @@ package osbuild
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 )
 
 // A Stage transforms a filesystem tree.
@@ -20,6 +20,15 @@ type StageOptions interface {
 	isStageOptions()
 }
 
+// RawStageOptions are the options of a stage which is not known to composer.
+// They are kept as they are, so that manifests with newer stages can still
+// be read and written.
+type RawStageOptions struct {
+	json.RawMessage
+}
+
+func (RawStageOptions) isStageOptions() {}
+
 type rawStage struct {
 	Name    string          `json:"name"`
 	Options json.RawMessage `json:"options"`
@@ -33,6 +42,9 @@ func (stage *Stage) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if rawStage.Name == "" {
+		return errors.New("stage has no name")
+	}
 	var options StageOptions
 	switch rawStage.Name {
 	case "org.osbuild.fix-bls":
@@ -68,8 +80,12 @@ func (stage *Stage) UnmarshalJSON(data []byte) error {
 		options = new(SystemdStageOptions)
 	case "org.osbuild.script":
 		options = new(ScriptStageOptions)
+	case "org.osbuild.kernel-cmdline":
+		options = new(KernelCmdlineStageOptions)
+	case "org.osbuild.zipl":
+		options = new(ZiplStageOptions)
 	default:
-		return fmt.Errorf("unexpected stage name: %s", rawStage.Name)
+		options = new(RawStageOptions)
 	}
 	err = json.Unmarshal(rawStage.Options, options)
 	if err != nil {
@@ -33,10 +33,13 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 		},
 		{
 			name: "unknown stage",
+			fields: fields{
+				Name:    "org.osbuild.foo",
+				Options: &RawStageOptions{json.RawMessage(`{"bar":null}`)},
+			},
 			args: args{
 				data: []byte(`{"name":"org.osbuild.foo","options":{"bar":null}}`),
 			},
-			wantErr: true,
 		},
 		{
 			name: "missing options",
@@ -152,6 +155,16 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 				data: []byte(`{"name":"org.osbuild.hostname","options":{"hostname":""}}`),
 			},
 		},
+		{
+			name: "kernel-cmdline",
+			fields: fields{
+				Name:    "org.osbuild.kernel-cmdline",
+				Options: &KernelCmdlineStageOptions{RootFsUUID: nullUUID.String(), KernelOpts: "ro"},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.kernel-cmdline","options":{"root_fs_uuid":"00000000-0000-0000-0000-000000000000","kernel_opts":"ro"}}`),
+			},
+		},
 		{
 			name: "keymap",
 			fields: fields{
@@ -279,6 +292,16 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 				data: []byte(`{"name":"org.osbuild.users","options":{"users":null}}`),
 			},
 		},
+		{
+			name: "zipl",
+			fields: fields{
+				Name:    "org.osbuild.zipl",
+				Options: &ZiplStageOptions{},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.zipl","options":{}}`),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,5 +1,10 @@
 package osbuild
 
+import (
+	"encoding/json"
+	"strconv"
+)
+
 type UsersStageOptions struct {
 	Users map[string]UsersStageOptionsUser `json:"users"`
 }
@@ -17,6 +22,53 @@ type UsersStageOptionsUser struct {
 	Key         *string  `json:"key,omitempty"`
 }
 
+// UnmarshalJSON unmarshals a UsersStageOptionsUser. Older manifests contain
+// the UID and GID as strings.
+func (user *UsersStageOptionsUser) UnmarshalJSON(data []byte) error {
+	type rawUser UsersStageOptionsUser
+	var legacy struct {
+		rawUser
+		UID json.RawMessage `json:"uid,omitempty"`
+		GID json.RawMessage `json:"gid,omitempty"`
+	}
+	err := json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+
+	*user = UsersStageOptionsUser(legacy.rawUser)
+	user.UID, err = unmarshalID(legacy.UID)
+	if err != nil {
+		return err
+	}
+	user.GID, err = unmarshalID(legacy.GID)
+	return err
+}
+
+// unmarshalID unmarshals a UID or GID, which is either a number or a string
+// which contains a number.
+func unmarshalID(data json.RawMessage) (*int, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var id int
+	if json.Unmarshal(data, &id) == nil {
+		return &id, nil
+	}
+
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+	id, err = strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
 func NewUsersStage(options *UsersStageOptions) *Stage {
 	return &Stage{
 		Name:    "org.osbuild.users",
@@ -109,6 +109,21 @@ type PackageSpec struct {
 	CheckGPG       bool   `json:"check_gpg,omitempty"`
 }
 
+// GetNEVRA returns the name, epoch, version, release and architecture of the
+// package in the form dnf accepts as a package spec.
+func (pkg PackageSpec) GetNEVRA() string {
+	return fmt.Sprintf("%s-%d:%s-%s.%s", pkg.Name, pkg.Epoch, pkg.Version, pkg.Release, pkg.Arch)
+}
+
+// GetEVR returns the epoch, version and release of the package, leaving out
+// an epoch of 0, the way rpm does.
+func (pkg PackageSpec) GetEVR() string {
+	if pkg.Epoch == 0 {
+		return pkg.Version + "-" + pkg.Release
+	}
+	return fmt.Sprintf("%d:%s-%s", pkg.Epoch, pkg.Version, pkg.Release)
+}
+
 type dnfPackageSpec struct {
 	Name           string `json:"name"`
 	Epoch          uint   `json:"epoch"`
@@ -160,6 +175,10 @@ type RPMMD interface {
 	// or repositories, and platform ID for modularity. It returns a list of all packages (with solved
 	// dependencies) that will be installed into the system.
 	Depsolve(specs, excludeSpecs []string, repos []RepoConfig, modulePlatformID, arch string) ([]PackageSpec, map[string]string, error)
+
+	// FetchAdvisories returns the advisories (errata) the repositories currently publish in their
+	// updateinfo metadata.
+	FetchAdvisories(repos []RepoConfig, modulePlatformID string, arch string) ([]Advisory, error)
 }
 
 type DNFError struct {
@@ -0,0 +1,183 @@
+package rpmmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// An Advisory is an erratum of a repository, as described by its updateinfo
+// metadata. It ships new versions of Packages, which fix bugs or
+// security issues, or add enhancements.
+type Advisory struct {
+	ID string `json:"id"`
+	// Type is "security", "bugfix", "enhancement" or "newpackage"
+	Type     string `json:"type"`
+	Severity string `json:"severity,omitempty"`
+	Title    string `json:"title"`
+	Issued   string `json:"issued,omitempty"`
+	// CVEs are the ids of the vulnerabilities the advisory fixes
+	CVEs     []string          `json:"cves,omitempty"`
+	Packages []AdvisoryPackage `json:"packages"`
+}
+
+// AdvisoryPackage is a package an advisory ships.
+type AdvisoryPackage struct {
+	Name    string `json:"name"`
+	Epoch   uint   `json:"epoch"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+}
+
+// EVR returns the epoch, version and release of the package, leaving out an
+// epoch of 0, the way rpm does.
+func (pkg AdvisoryPackage) EVR() string {
+	if pkg.Epoch == 0 {
+		return pkg.Version + "-" + pkg.Release
+	}
+	return fmt.Sprintf("%d:%s-%s", pkg.Epoch, pkg.Version, pkg.Release)
+}
+
+// dnfAdvisory is an advisory as dnf-json returns it.
+type dnfAdvisory struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Severity   string `json:"severity"`
+	Title      string `json:"title"`
+	Issued     string `json:"issued"`
+	References []struct {
+		Type  string `json:"type"`
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"references"`
+	Packages []AdvisoryPackage `json:"packages"`
+}
+
+var cvePattern = regexp.MustCompile(`CVE-[0-9]{4}-[0-9]+`)
+
+// toAdvisory converts the advisory dnf-json returned.
+//
+// CVEs are taken from references of type "cve", and from the titles of all
+// other references, because Fedora only references the bugs which track them.
+func (a dnfAdvisory) toAdvisory() Advisory {
+	advisory := Advisory{
+		ID:       strings.TrimSpace(a.ID),
+		Type:     a.Type,
+		Severity: strings.TrimSpace(a.Severity),
+		Title:    strings.TrimSpace(a.Title),
+		Issued:   a.Issued,
+		Packages: a.Packages,
+	}
+	if advisory.Severity == "None" {
+		advisory.Severity = ""
+	}
+	if advisory.Packages == nil {
+		advisory.Packages = []AdvisoryPackage{}
+	}
+
+	cves := make(map[string]bool)
+	for _, reference := range a.References {
+		if reference.Type == "cve" && cvePattern.MatchString(reference.ID) {
+			cves[reference.ID] = true
+		}
+		for _, cve := range cvePattern.FindAllString(reference.Title, -1) {
+			cves[cve] = true
+		}
+	}
+	for cve := range cves {
+		advisory.CVEs = append(advisory.CVEs, cve)
+	}
+	sort.Strings(advisory.CVEs)
+
+	return advisory
+}
+
+// AffectedPackage is an installed package which an advisory ships a newer
+// version of.
+type AffectedPackage struct {
+	Installed PackageSpec
+	Fixed     AdvisoryPackage
+}
+
+// AdvisoryMatch is an advisory which affects some installed packages.
+type AdvisoryMatch struct {
+	Advisory Advisory
+	Packages []AffectedPackage
+}
+
+// MatchAdvisories returns the advisories which ship newer versions of
+// `installed` packages of the same architecture, sorted by their ids.
+// Advisories for older versions than the installed ones were applied already
+// and are left out.
+func MatchAdvisories(advisories []Advisory, installed []PackageSpec) []AdvisoryMatch {
+	packages := make(map[string][]PackageSpec)
+	for _, pkg := range installed {
+		packages[pkg.Name] = append(packages[pkg.Name], pkg)
+	}
+
+	matches := []AdvisoryMatch{}
+	for _, advisory := range advisories {
+		var affected []AffectedPackage
+		seen := make(map[string]bool)
+		for _, fixed := range advisory.Packages {
+			for _, pkg := range packages[fixed.Name] {
+				if pkg.Arch != fixed.Arch || seen[pkg.GetNEVRA()] {
+					continue
+				}
+				if CompareEVR(fixed.Epoch, fixed.Version, fixed.Release, pkg.Epoch, pkg.Version, pkg.Release) > 0 {
+					affected = append(affected, AffectedPackage{Installed: pkg, Fixed: fixed})
+					seen[pkg.GetNEVRA()] = true
+				}
+			}
+		}
+		if len(affected) > 0 {
+			matches = append(matches, AdvisoryMatch{Advisory: advisory, Packages: affected})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Advisory.ID < matches[j].Advisory.ID
+	})
+
+	return matches
+}
+
+// FetchAdvisories returns the advisories of the updateinfo metadata of all
+// `repos`, which ship a version of a package the repositories contain. The
+// metadata is downloaded by dnf and shares its cache with FetchMetadata and
+// Depsolve.
+func (r *rpmmdImpl) FetchAdvisories(repos []RepoConfig, modulePlatformID string, arch string) ([]Advisory, error) {
+	var dnfRepoConfigs []dnfRepoConfig
+	for i, repo := range repos {
+		dnfRepo, err := repo.toDNFRepoConfig(r, i)
+		if err != nil {
+			return nil, err
+		}
+		dnfRepoConfigs = append(dnfRepoConfigs, dnfRepo)
+	}
+
+	var arguments = struct {
+		Repos            []dnfRepoConfig `json:"repos"`
+		CacheDir         string          `json:"cachedir"`
+		ModulePlatformID string          `json:"module_platform_id"`
+		Arch             string          `json:"arch"`
+	}{dnfRepoConfigs, r.CacheDir, modulePlatformID, arch}
+	var reply struct {
+		Checksums  map[string]string `json:"checksums"`
+		Advisories []dnfAdvisory     `json:"advisories"`
+	}
+
+	err := runDNF(r.dnfJsonPath, "advisories", arguments, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	advisories := make([]Advisory, len(reply.Advisories))
+	for i, advisory := range reply.Advisories {
+		advisories[i] = advisory.toAdvisory()
+	}
+
+	return advisories, nil
+}
@@ -0,0 +1,123 @@
+package rpmmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDNFAdvisories is the reply of dnf-json's "advisories" command for a
+// repository with two advisories.
+const testDNFAdvisories = `{
+  "checksums": {"0": "sha256:0123"},
+  "advisories": [
+    {
+      "id": "FEDORA-2020-1a2b3c",
+      "type": "security",
+      "severity": "Important",
+      "title": "openssl-1.1.1g-1.fc32",
+      "issued": "2020-04-24 01:02:03",
+      "references": [
+        {"type": "bugzilla", "id": "1", "title": "CVE-2020-1967 openssl: Segmentation fault in SSL_check_chain [fedora-all]"},
+        {"type": "cve", "id": "CVE-2020-0001", "title": "CVE-2020-0001"}
+      ],
+      "packages": [
+        {"name": "openssl", "epoch": 1, "version": "1.1.1g", "release": "1.fc32", "arch": "x86_64"},
+        {"name": "openssl-libs", "epoch": 1, "version": "1.1.1g", "release": "1.fc32", "arch": "x86_64"}
+      ]
+    },
+    {
+      "id": "FEDORA-2020-4d5e6f",
+      "type": "bugfix",
+      "severity": "None",
+      "title": "bash-5.0.17-1.fc32",
+      "issued": "",
+      "references": [],
+      "packages": [
+        {"name": "bash", "epoch": 0, "version": "5.0.17", "release": "1.fc32", "arch": "x86_64"}
+      ]
+    }
+  ]
+}
+`
+
+func testAdvisories() []Advisory {
+	return []Advisory{
+		{
+			ID:       "FEDORA-2020-1a2b3c",
+			Type:     "security",
+			Severity: "Important",
+			Title:    "openssl-1.1.1g-1.fc32",
+			Issued:   "2020-04-24 01:02:03",
+			CVEs:     []string{"CVE-2020-0001", "CVE-2020-1967"},
+			Packages: []AdvisoryPackage{
+				{Name: "openssl", Epoch: 1, Version: "1.1.1g", Release: "1.fc32", Arch: "x86_64"},
+				{Name: "openssl-libs", Epoch: 1, Version: "1.1.1g", Release: "1.fc32", Arch: "x86_64"},
+			},
+		},
+		{
+			ID:    "FEDORA-2020-4d5e6f",
+			Type:  "bugfix",
+			Title: "bash-5.0.17-1.fc32",
+			Packages: []AdvisoryPackage{
+				{Name: "bash", Version: "5.0.17", Release: "1.fc32", Arch: "x86_64"},
+			},
+		},
+	}
+}
+
+func TestMatchAdvisories(t *testing.T) {
+	installed := []PackageSpec{
+		{Name: "openssl", Epoch: 1, Version: "1.1.1f", Release: "1.fc32", Arch: "x86_64"},
+		{Name: "openssl-libs", Epoch: 1, Version: "1.1.1g", Release: "1.fc32", Arch: "x86_64"},
+		{Name: "openssl-libs", Epoch: 1, Version: "1.1.1d", Release: "1.fc32", Arch: "i686"},
+		{Name: "bash", Version: "5.0.17", Release: "2.fc32", Arch: "x86_64"},
+	}
+
+	advisories := testAdvisories()
+	matches := MatchAdvisories(advisories, installed)
+	require.Equal(t, []AdvisoryMatch{
+		{
+			Advisory: advisories[0],
+			Packages: []AffectedPackage{
+				{Installed: installed[0], Fixed: advisories[0].Packages[0]},
+			},
+		},
+	}, matches)
+
+	require.Equal(t, []AdvisoryMatch{}, MatchAdvisories(advisories, nil))
+}
+
+// writeFakeDNFJSON writes a script to `dir`, which replies `reply` to every
+// command and exits with `exitCode`, and returns its path.
+func writeFakeDNFJSON(t *testing.T, dir, reply string, exitCode int) string {
+	path := filepath.Join(dir, fmt.Sprintf("dnf-json-%d", exitCode))
+	script := fmt.Sprintf("#!/bin/sh\ncat >/dev/null\ncat <<'EOF'\n%s\nEOF\nexit %d\n", reply, exitCode)
+	err := ioutil.WriteFile(path, []byte(script), 0755)
+	require.NoError(t, err)
+
+	return path
+}
+
+func TestFetchAdvisories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmmd-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &rpmmdImpl{dnfJsonPath: writeFakeDNFJSON(t, dir, testDNFAdvisories, 0)}
+
+	advisories, err := r.FetchAdvisories([]RepoConfig{{Name: "updates", BaseURL: "http://example.com/updates/"}}, "platform:f32", "x86_64")
+	require.NoError(t, err)
+	require.Equal(t, testAdvisories(), advisories)
+
+	_, err = r.FetchAdvisories([]RepoConfig{{Name: "rhsm", BaseURL: "http://example.com/rhsm/", RHSM: true}}, "platform:f32", "x86_64")
+	require.EqualError(t, err, "RHSM secrets not found on host")
+
+	r.dnfJsonPath = writeFakeDNFJSON(t, dir, `{"kind": "RepoError", "reason": "cannot download repomd.xml"}`, 10)
+	_, err = r.FetchAdvisories([]RepoConfig{{Name: "updates", BaseURL: "http://example.com/updates/"}}, "platform:f32", "x86_64")
+	require.EqualError(t, err, "DNF error occured: RepoError: cannot download repomd.xml")
+}
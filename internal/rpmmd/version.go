@@ -0,0 +1,131 @@
+package rpmmd
+
+import "strings"
+
+// CompareEVR compares the epoch, version and release of two packages the way
+// rpm does. It returns -1 if the first one is older, 1 if it is newer, and 0
+// if they are the same.
+func CompareEVR(epoch1 uint, version1, release1 string, epoch2 uint, version2, release2 string) int {
+	switch {
+	case epoch1 < epoch2:
+		return -1
+	case epoch1 > epoch2:
+		return 1
+	}
+
+	if c := rpmvercmp(version1, version2); c != 0 {
+		return c
+	}
+	return rpmvercmp(release1, release2)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// rpmvercmp compares two version or release strings, like rpmvercmp() of
+// rpm. They are split into alternating segments of digits and of letters,
+// which are compared numerically and alphabetically. All other characters
+// separate segments, except for "~", which sorts before everything, even the
+// end of the string, and "^", which sorts after the end of the string, but
+// before anything else.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	span := func(s string, pred func(byte) bool) (string, string) {
+		i := 0
+		for i < len(s) && pred(s[i]) {
+			i++
+		}
+		return s[:i], s[i:]
+	}
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^'
+	}
+
+	for {
+		_, a = span(a, isSeparator)
+		_, b = span(b, isSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		var segmentA, segmentB string
+		numeric := isDigit(a[0])
+		if numeric {
+			segmentA, a = span(a, isDigit)
+			segmentB, b = span(b, isDigit)
+		} else {
+			segmentA, a = span(a, isAlpha)
+			segmentB, b = span(b, isAlpha)
+		}
+
+		// numeric segments are newer than alphabetic ones
+		if segmentB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			segmentA = strings.TrimLeft(segmentA, "0")
+			segmentB = strings.TrimLeft(segmentB, "0")
+			if len(segmentA) != len(segmentB) {
+				if len(segmentA) > len(segmentB) {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		if c := strings.Compare(segmentA, segmentB); c != 0 {
+			return c
+		}
+	}
+
+	// the string with segments left over is newer
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
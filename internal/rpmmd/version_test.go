@@ -0,0 +1,48 @@
+package rpmmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPMVerCmp(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"1.0aa", "1.0a", 1},
+		{"10", "9", 1},
+		{"010", "10", 0},
+		{"1.0", "1.fc30", 1},
+		{"1_0", "1.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git1", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+	}
+
+	for _, c := range cases {
+		require.Equalf(t, c.want, rpmvercmp(c.a, c.b), "rpmvercmp(%q, %q)", c.a, c.b)
+		require.Equalf(t, -c.want, rpmvercmp(c.b, c.a), "rpmvercmp(%q, %q)", c.b, c.a)
+	}
+}
+
+func TestCompareEVR(t *testing.T) {
+	require.Equal(t, 1, CompareEVR(1, "1.0", "1", 0, "2.0", "1"))
+	require.Equal(t, -1, CompareEVR(0, "1.0", "1.fc32", 0, "1.0", "2.fc32"))
+	require.Equal(t, 0, CompareEVR(2, "1.0", "1", 2, "1.0", "1"))
+}
@@ -0,0 +1,98 @@
+package sbom
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CycloneDXDocument is a CycloneDX 1.2 bill of materials in its JSON
+// serialization.
+type CycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     CycloneDXMetadata    `json:"metadata"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []CycloneDXTool    `json:"tools"`
+	Component CycloneDXComponent `json:"component"`
+}
+
+type CycloneDXTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+type CycloneDXComponent struct {
+	Type      string          `json:"type"`
+	BOMRef    string          `json:"bom-ref,omitempty"`
+	Publisher string          `json:"publisher,omitempty"`
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	PURL      string          `json:"purl,omitempty"`
+	Hashes    []CycloneDXHash `json:"hashes,omitempty"`
+}
+
+type CycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+// the names CycloneDX uses for the checksum algorithms of rpm repositories
+var cycloneDXAlgorithms = map[string]string{
+	"md5":    "MD5",
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+	"sha384": "SHA-384",
+	"sha512": "SHA-512",
+}
+
+// CycloneDX returns a CycloneDX bill of materials describing the image, which
+// lists all of its packages as components.
+func (image *Image) CycloneDX() *CycloneDXDocument {
+	// the serial number is the same for every document generated for the
+	// same image, because they are all the same
+	serial := uuid.NewSHA1(uuid.NameSpaceURL, []byte(image.namespace()))
+
+	doc := &CycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.2",
+		SerialNumber: serial.URN(),
+		Version:      1,
+		Metadata: CycloneDXMetadata{
+			Timestamp: image.Created.UTC().Format(time.RFC3339),
+			Tools:     []CycloneDXTool{{Vendor: "osbuild", Name: "osbuild-composer"}},
+			Component: CycloneDXComponent{
+				Type:    "operating-system",
+				Name:    image.Name,
+				Version: image.Version,
+			},
+		},
+		Components: []CycloneDXComponent{},
+	}
+
+	for _, pkg := range image.Packages {
+		purl := pkg.purl(image.vendor())
+		component := CycloneDXComponent{
+			Type:      "library",
+			BOMRef:    purl,
+			Publisher: image.vendor(),
+			Name:      pkg.Name,
+			Version:   pkg.EVR(),
+			PURL:      purl,
+		}
+		if algorithm, value, ok := checksum(pkg.Checksum); ok {
+			if alg, ok := cycloneDXAlgorithms[algorithm]; ok {
+				component.Hashes = []CycloneDXHash{{Algorithm: alg, Content: value}}
+			}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+
+	return doc
+}
@@ -0,0 +1,160 @@
+// Package sbom generates software bills of materials for images, listing the
+// packages installed into them. Documents are generated in the SPDX and the
+// CycloneDX JSON formats.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+)
+
+// Package is an RPM installed into an image. Checksum and RemoteLocation are
+// only known for packages which composer depsolved itself.
+type Package struct {
+	Name           string
+	Epoch          uint
+	Version        string
+	Release        string
+	Arch           string
+	Checksum       string
+	RemoteLocation string
+}
+
+// EVR returns the epoch, version and release of the package, leaving out an
+// epoch of 0, the way rpm does.
+func (pkg Package) EVR() string {
+	if pkg.Epoch == 0 {
+		return pkg.Version + "-" + pkg.Release
+	}
+	return fmt.Sprintf("%d:%s-%s", pkg.Epoch, pkg.Version, pkg.Release)
+}
+
+func (pkg Package) nevra() string {
+	return fmt.Sprintf("%s-%d:%s-%s.%s", pkg.Name, pkg.Epoch, pkg.Version, pkg.Release, pkg.Arch)
+}
+
+// purl returns the package URL of the package, with `vendor` as namespace.
+func (pkg Package) purl(vendor string) string {
+	qualifiers := url.Values{}
+	qualifiers.Set("arch", pkg.Arch)
+	if pkg.Epoch != 0 {
+		qualifiers.Set("epoch", fmt.Sprint(pkg.Epoch))
+	}
+	purl := "pkg:rpm/"
+	if vendor != "" {
+		purl += url.PathEscape(vendor) + "/"
+	}
+	return purl + url.PathEscape(pkg.Name) + "@" + url.PathEscape(pkg.Version+"-"+pkg.Release) + "?" + qualifiers.Encode()
+}
+
+// ImagePackages returns the packages installed into an image, sorted by name
+// and architecture.
+//
+// They are taken from the metadata osbuild reported for the rpm stages of the
+// image's pipeline, which lists what was actually installed, and completed
+// with the checksums and locations of `packages`, the packages composer
+// depsolved for the image. Results without rpm metadata, like those of older
+// osbuild versions, fall back to `packages` alone.
+func ImagePackages(result *osbuild.Result, packages []rpmmd.PackageSpec) []Package {
+	specs := make(map[string]rpmmd.PackageSpec)
+	for _, spec := range packages {
+		specs[spec.GetNEVRA()] = spec
+	}
+
+	var pkgs []Package
+	hasMetadata := false
+	if result != nil {
+		for _, stage := range result.Stages {
+			metadata, ok := stage.Metadata.(*osbuild.RPMStageMetadata)
+			if !ok {
+				continue
+			}
+			hasMetadata = true
+			for _, m := range metadata.Packages {
+				pkg := Package{
+					Name:    m.Name,
+					Version: m.Version,
+					Release: m.Release,
+					Arch:    m.Arch,
+				}
+				if m.Epoch != nil {
+					epoch, err := strconv.ParseUint(*m.Epoch, 10, 32)
+					if err == nil {
+						pkg.Epoch = uint(epoch)
+					}
+				}
+				if spec, ok := specs[pkg.nevra()]; ok {
+					pkg.Checksum = spec.Checksum
+					pkg.RemoteLocation = spec.RemoteLocation
+				}
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+
+	if !hasMetadata {
+		for _, spec := range packages {
+			pkgs = append(pkgs, Package{
+				Name:           spec.Name,
+				Epoch:          spec.Epoch,
+				Version:        spec.Version,
+				Release:        spec.Release,
+				Arch:           spec.Arch,
+				Checksum:       spec.Checksum,
+				RemoteLocation: spec.RemoteLocation,
+			})
+		}
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Arch < pkgs[j].Arch
+	})
+
+	return pkgs
+}
+
+// Image describes the image a bill of materials is generated for.
+type Image struct {
+	// ID identifies the image uniquely, e.g. by the compose and image
+	// build which built it
+	ID string
+	// Name and Version are those of the blueprint the image was built from
+	Name    string
+	Version string
+	// Distro is the name of the distribution of the image, like
+	// "fedora-32". Its part before the first dash is the vendor of its
+	// packages.
+	Distro string
+	// Created is when the image was built
+	Created  time.Time
+	Packages []Package
+}
+
+func (image *Image) vendor() string {
+	return strings.SplitN(image.Distro, "-", 2)[0]
+}
+
+// namespace returns a URI which uniquely identifies documents about the
+// image.
+func (image *Image) namespace() string {
+	return "https://osbuild.org/sbom/" + url.PathEscape(image.Name) + "/" + url.PathEscape(image.ID)
+}
+
+// checksum splits a checksum of the form "<algorithm>:<hex>".
+func checksum(sum string) (string, string, bool) {
+	parts := strings.SplitN(sum, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return strings.ToLower(parts[0]), parts[1], true
+}
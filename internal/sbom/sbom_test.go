@@ -0,0 +1,129 @@
+package sbom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+)
+
+var testImage = Image{
+	ID:      "30000000-0000-0000-0000-000000000002",
+	Name:    "test",
+	Version: "0.0.1",
+	Distro:  "fedora-32",
+	Created: time.Date(2020, 6, 25, 13, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+	Packages: []Package{
+		{Name: "bash", Version: "5.0.11", Release: "2.fc32", Arch: "x86_64", Checksum: "sha256:0a1b", RemoteLocation: "https://example.com/bash.rpm"},
+		{Name: "shadow-utils", Epoch: 2, Version: "4.8.1", Release: "2.fc32", Arch: "x86_64"},
+	},
+}
+
+func TestImagePackages(t *testing.T) {
+	epoch := "2"
+	result := &osbuild.Result{
+		Stages: []osbuild.StageResult{
+			{Name: "org.osbuild.rpm", Metadata: &osbuild.RPMStageMetadata{
+				Packages: []osbuild.RPMPackageMetadata{
+					{Name: "shadow-utils", Epoch: &epoch, Version: "4.8.1", Release: "2.fc32", Arch: "x86_64"},
+					{Name: "bash", Version: "5.0.11", Release: "2.fc32", Arch: "x86_64"},
+				},
+			}},
+			{Name: "org.osbuild.locale"},
+		},
+	}
+	specs := []rpmmd.PackageSpec{
+		{Name: "bash", Version: "5.0.11", Release: "2.fc32", Arch: "x86_64", Checksum: "sha256:0a1b", RemoteLocation: "https://example.com/bash.rpm"},
+		{Name: "unused", Version: "1", Release: "1", Arch: "noarch"},
+	}
+
+	require.Equal(t, testImage.Packages, ImagePackages(result, specs))
+
+	// without rpm metadata, the depsolved packages are all there is
+	require.Equal(t, []Package{
+		specPackage(specs[0]),
+		{Name: "unused", Version: "1", Release: "1", Arch: "noarch"},
+	}, ImagePackages(&osbuild.Result{}, specs))
+	require.Empty(t, ImagePackages(nil, nil))
+}
+
+func specPackage(spec rpmmd.PackageSpec) Package {
+	return Package{
+		Name:           spec.Name,
+		Version:        spec.Version,
+		Release:        spec.Release,
+		Arch:           spec.Arch,
+		Checksum:       spec.Checksum,
+		RemoteLocation: spec.RemoteLocation,
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	doc := testImage.SPDX()
+
+	require.Equal(t, "SPDX-2.2", doc.SPDXVersion)
+	require.Equal(t, "https://osbuild.org/sbom/test/30000000-0000-0000-0000-000000000002", doc.DocumentNamespace)
+	require.Equal(t, "2020-06-25T11:00:00Z", doc.CreationInfo.Created)
+	require.Equal(t, []string{"SPDXRef-Image"}, doc.DocumentDescribes)
+	require.Len(t, doc.Packages, 3)
+
+	require.Equal(t, SPDXPackage{
+		SPDXID:           "SPDXRef-Package-1",
+		Name:             "bash",
+		VersionInfo:      "5.0.11-2.fc32",
+		Supplier:         "Organization: fedora",
+		DownloadLocation: "https://example.com/bash.rpm",
+		Checksums:        []SPDXChecksum{{Algorithm: "SHA256", ChecksumValue: "0a1b"}},
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		ExternalRefs: []SPDXExternalRef{
+			{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: "pkg:rpm/fedora/bash@5.0.11-2.fc32?arch=x86_64"},
+		},
+	}, doc.Packages[1])
+
+	shadow := doc.Packages[2]
+	require.Equal(t, "2:4.8.1-2.fc32", shadow.VersionInfo)
+	require.Equal(t, "NOASSERTION", shadow.DownloadLocation)
+	require.Nil(t, shadow.Checksums)
+	require.Equal(t, "pkg:rpm/fedora/shadow-utils@4.8.1-2.fc32?arch=x86_64&epoch=2", shadow.ExternalRefs[0].ReferenceLocator)
+
+	require.Equal(t, []SPDXRelationship{
+		{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-1"},
+		{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-2"},
+	}, doc.Relationships)
+}
+
+func TestCycloneDX(t *testing.T) {
+	doc := testImage.CycloneDX()
+
+	require.Equal(t, "CycloneDX", doc.BOMFormat)
+	require.Equal(t, "1.2", doc.SpecVersion)
+	require.Regexp(t, "^urn:uuid:[0-9a-f-]{36}$", doc.SerialNumber)
+	require.Equal(t, doc.SerialNumber, testImage.CycloneDX().SerialNumber)
+	require.Equal(t, "2020-06-25T11:00:00Z", doc.Metadata.Timestamp)
+	require.Equal(t, CycloneDXComponent{Type: "operating-system", Name: "test", Version: "0.0.1"}, doc.Metadata.Component)
+
+	require.Equal(t, []CycloneDXComponent{
+		{
+			Type:      "library",
+			BOMRef:    "pkg:rpm/fedora/bash@5.0.11-2.fc32?arch=x86_64",
+			Publisher: "fedora",
+			Name:      "bash",
+			Version:   "5.0.11-2.fc32",
+			PURL:      "pkg:rpm/fedora/bash@5.0.11-2.fc32?arch=x86_64",
+			Hashes:    []CycloneDXHash{{Algorithm: "SHA-256", Content: "0a1b"}},
+		},
+		{
+			Type:      "library",
+			BOMRef:    "pkg:rpm/fedora/shadow-utils@4.8.1-2.fc32?arch=x86_64&epoch=2",
+			Publisher: "fedora",
+			Name:      "shadow-utils",
+			Version:   "2:4.8.1-2.fc32",
+			PURL:      "pkg:rpm/fedora/shadow-utils@4.8.1-2.fc32?arch=x86_64&epoch=2",
+		},
+	}, doc.Components)
+}
@@ -0,0 +1,127 @@
+package sbom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SPDXDocument is an SPDX 2.2 document in its JSON serialization.
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	DocumentDescribes []string           `json:"documentDescribes"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type SPDXPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	Supplier         string            `json:"supplier,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []SPDXChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs,omitempty"`
+}
+
+type SPDXChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX returns an SPDX document describing the image, which contains all of
+// its packages.
+func (image *Image) SPDX() *SPDXDocument {
+	const imageID = "SPDXRef-Image"
+
+	doc := &SPDXDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              image.Name + "-" + image.Version,
+		DocumentNamespace: image.namespace(),
+		CreationInfo: SPDXCreationInfo{
+			Created:  image.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: osbuild-composer"},
+		},
+		DocumentDescribes: []string{imageID},
+		Packages: []SPDXPackage{
+			{
+				SPDXID:           imageID,
+				Name:             image.Name,
+				VersionInfo:      image.Version,
+				DownloadLocation: "NOASSERTION",
+				LicenseConcluded: "NOASSERTION",
+				LicenseDeclared:  "NOASSERTION",
+				CopyrightText:    "NOASSERTION",
+			},
+		},
+		Relationships: []SPDXRelationship{},
+	}
+
+	for i, pkg := range image.Packages {
+		// SPDX ids may only contain letters, numbers, "." and "-"
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+
+		p := SPDXPackage{
+			SPDXID:           id,
+			Name:             pkg.Name,
+			VersionInfo:      pkg.EVR(),
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs: []SPDXExternalRef{
+				{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator:  pkg.purl(image.vendor()),
+				},
+			},
+		}
+		if vendor := image.vendor(); vendor != "" {
+			p.Supplier = "Organization: " + vendor
+		}
+		if pkg.RemoteLocation != "" {
+			p.DownloadLocation = pkg.RemoteLocation
+		}
+		if algorithm, value, ok := checksum(pkg.Checksum); ok {
+			p.Checksums = []SPDXChecksum{{Algorithm: strings.ToUpper(algorithm), ChecksumValue: value}}
+		}
+
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, SPDXRelationship{
+			SPDXElementID:      imageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
@@ -0,0 +1,521 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// The directories of the state directory which are archived next to the
+// store, as laid out by osbuild-composer.
+const (
+	archiveJobsDir      = "jobs"
+	archiveArtifactsDir = "artifacts"
+	archiveOutputsDir   = "outputs"
+)
+
+// ExportOptions configure what Export puts into an archive.
+type ExportOptions struct {
+	// Artifacts includes the images built by the composes, which can be
+	// large.
+	Artifacts bool
+}
+
+// ImportOptions configure how Import applies an archive.
+type ImportOptions struct {
+	// Replace replaces the state with the archive's, instead of merging
+	// the archive into it.
+	Replace bool
+}
+
+// An ImportConflict is something in an archive which was not imported,
+// because the state already contains something different under the same
+// name. Kind is one of "blueprint", "source", "upload_profile", "webhook", or
+// "job".
+type ImportConflict struct {
+	Kind string
+	Name string
+}
+
+func (c ImportConflict) String() string {
+	return c.Kind + " " + c.Name
+}
+
+// Export writes an archive of the store persisted in `backend` and the jobs
+// and images in `stateDir` to `w`. The archive is a gzip-compressed tarball
+// which contains the store as `state.json`, the jobs of all composes in
+// `jobs/`, and optionally the images of the composes in `artifacts/` and
+// `outputs/`. It fails if the store is empty, which usually means that
+// `stateDir` or the storage configuration is wrong. osbuild-composer must not
+// be running.
+func Export(backend Backend, stateDir string, w io.Writer, options ExportOptions) error {
+	state, err := backend.load()
+	if err != nil {
+		return err
+	}
+	if allChanged(&state).empty() {
+		return fmt.Errorf("there is no state to export in %s", stateDir)
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:     StoreDBName + ".json",
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortedUUIDs(composeIDsV0(state.Composes)) {
+		for _, jobID := range sortedUUIDs(jobIDsV0(state.Composes[id])) {
+			err = archiveFile(tw, stateDir, path.Join(archiveJobsDir, jobID.String()+".json"))
+			if err != nil {
+				return err
+			}
+			if options.Artifacts {
+				err = archiveFile(tw, stateDir, path.Join(archiveArtifactsDir, jobID.String()))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if options.Artifacts {
+			err = archiveFile(tw, stateDir, path.Join(archiveOutputsDir, id.String()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// archiveFile adds the file or directory `name` of `stateDir` to the
+// archive, if it exists.
+func archiveFile(tw *tar.Writer, stateDir, name string) error {
+	err := filepath.Walk(path.Join(stateDir, name), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name, err = filepath.Rel(stateDir, p)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Import reads an archive written by Export from `r` and applies it to the
+// store persisted in `backend` and the jobs and images in `stateDir`.
+//
+// Unless options.Replace is set, the archive is merged into the state:
+// blueprints, sources, composes, upload profiles, webhooks, and schedules
+// which don't exist yet are added, together with the jobs and images of the
+// composes. Those which exist with different content are kept and returned
+// as conflicts, except for composes and schedules, which are identified by
+// their unique id. osbuild-composer must not be running.
+func Import(backend Backend, stateDir string, r io.Reader, options ImportOptions) ([]ImportConflict, error) {
+	staging, err := ioutil.TempDir(stateDir, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	archived, err := extractArchive(r, staging)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %v", err)
+	}
+
+	if options.Replace {
+		for _, dir := range []string{archiveJobsDir, archiveArtifactsDir, archiveOutputsDir} {
+			err = os.RemoveAll(path.Join(stateDir, dir))
+			if err != nil {
+				return nil, err
+			}
+			err = moveIfExists(path.Join(staging, dir), path.Join(stateDir, dir))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, backend.replace(&archived)
+	}
+
+	state, err := backend.load()
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, imported := mergeStoreV0(&state, archived)
+
+	for _, id := range sortedUUIDs(imported) {
+		for _, jobID := range sortedUUIDs(jobIDsV0(state.Composes[id])) {
+			name := path.Join(archiveJobsDir, jobID.String()+".json")
+			if _, err := os.Stat(path.Join(stateDir, name)); err == nil {
+				conflicts = append(conflicts, ImportConflict{"job", jobID.String()})
+				continue
+			}
+			for _, name := range []string{name, path.Join(archiveArtifactsDir, jobID.String())} {
+				err = moveIfExists(path.Join(staging, name), path.Join(stateDir, name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		name := path.Join(archiveOutputsDir, id.String())
+		err = moveIfExists(path.Join(staging, name), path.Join(stateDir, name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = backend.replace(&state)
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// extractArchive extracts the jobs and images in the archive read from `r`
+// to `dir`, and returns the store it contains. The store must be the first
+// file of the archive.
+func extractArchive(r io.Reader, dir string) (storeV0, error) {
+	var state storeV0
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return state, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return state, err
+	}
+	if header.Name != StoreDBName+".json" {
+		return state, fmt.Errorf("archive doesn't start with %s.json", StoreDBName)
+	}
+	err = json.NewDecoder(tr).Decode(&state)
+	if err != nil {
+		return state, err
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return state, err
+		}
+
+		name := path.Clean(header.Name)
+		parts := strings.Split(name, "/")
+		if len(parts) < 2 || path.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return state, fmt.Errorf("unexpected file: %s", header.Name)
+		}
+		switch parts[0] {
+		case archiveJobsDir, archiveArtifactsDir, archiveOutputsDir:
+		default:
+			return state, fmt.Errorf("unexpected file: %s", header.Name)
+		}
+		if _, err := uuid.Parse(strings.TrimSuffix(parts[1], ".json")); err != nil {
+			return state, fmt.Errorf("unexpected file: %s", header.Name)
+		}
+
+		p := path.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, 0700)
+		case tar.TypeReg:
+			err = extractFile(tr, p, os.FileMode(header.Mode).Perm())
+		default:
+			err = fmt.Errorf("unexpected file type of %s", header.Name)
+		}
+		if err != nil {
+			return state, err
+		}
+	}
+
+	return state, nil
+}
+
+func extractFile(r io.Reader, p string, perm os.FileMode) error {
+	err := os.MkdirAll(path.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// moveIfExists moves `from` to `to`, creating the parent directory of `to`.
+// It does nothing if `from` doesn't exist.
+func moveIfExists(from, to string) error {
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := os.MkdirAll(path.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// mergeStoreV0 adds everything in `archived` to `state` which doesn't
+// conflict with it. It returns the conflicts and the ids of the composes
+// which were added.
+func mergeStoreV0(state *storeV0, archived storeV0) ([]ImportConflict, []uuid.UUID) {
+	var conflicts []ImportConflict
+
+	if state.Blueprints == nil {
+		state.Blueprints = make(blueprintsV0)
+	}
+	if state.Workspace == nil {
+		state.Workspace = make(workspaceV0)
+	}
+	if state.Changes == nil {
+		state.Changes = make(changesV0)
+	}
+	if state.Commits == nil {
+		state.Commits = make(commitsV0)
+	}
+
+	// a blueprint, its workspace copy, and its history are merged as a
+	// whole, because they only make sense together
+	keys := make(map[string]bool)
+	for key := range archived.Blueprints {
+		keys[key] = true
+	}
+	for key := range archived.Workspace {
+		keys[key] = true
+	}
+	for key := range archived.Changes {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		_, inBlueprints := state.Blueprints[key]
+		_, inWorkspace := state.Workspace[key]
+		_, inChanges := state.Changes[key]
+		if inBlueprints || inWorkspace || inChanges {
+			if !sameJSON(state.Blueprints[key], archived.Blueprints[key]) ||
+				!sameJSON(state.Workspace[key], archived.Workspace[key]) ||
+				!sameJSON(state.Changes[key], archived.Changes[key]) {
+				conflicts = append(conflicts, ImportConflict{"blueprint", key})
+			}
+			continue
+		}
+
+		if bp, ok := archived.Blueprints[key]; ok {
+			state.Blueprints[key] = bp
+		}
+		if bp, ok := archived.Workspace[key]; ok {
+			state.Workspace[key] = bp
+		}
+		if changes, ok := archived.Changes[key]; ok {
+			state.Changes[key] = changes
+		}
+		if commits, ok := archived.Commits[key]; ok {
+			state.Commits[key] = commits
+		}
+	}
+
+	if state.Sources == nil {
+		state.Sources = make(sourcesV0)
+	}
+	for key, source := range archived.Sources {
+		if existing, ok := state.Sources[key]; ok {
+			if existing != source {
+				conflicts = append(conflicts, ImportConflict{"source", key})
+			}
+			continue
+		}
+		state.Sources[key] = source
+	}
+
+	// compose ids are unique, so a compose which exists already is the
+	// same compose, which may only have been loaded by a newer store
+	var imported []uuid.UUID
+	if state.Composes == nil {
+		state.Composes = make(composesV0)
+	}
+	for id, compose := range archived.Composes {
+		if _, ok := state.Composes[id]; ok {
+			continue
+		}
+		state.Composes[id] = compose
+		imported = append(imported, id)
+	}
+
+	if state.UploadProfiles == nil {
+		state.UploadProfiles = make(uploadProfilesV0)
+	}
+	for provider, profiles := range archived.UploadProfiles {
+		if state.UploadProfiles[provider] == nil {
+			state.UploadProfiles[provider] = make(map[string]json.RawMessage)
+		}
+		for name, settings := range profiles {
+			if existing, ok := state.UploadProfiles[provider][name]; ok {
+				if !sameJSON(existing, settings) {
+					conflicts = append(conflicts, ImportConflict{"upload_profile", provider + "/" + name})
+				}
+				continue
+			}
+			state.UploadProfiles[provider][name] = settings
+		}
+	}
+
+	if state.Webhooks == nil {
+		state.Webhooks = make(webhooksV0)
+	}
+	for id, webhook := range archived.Webhooks {
+		if existing, ok := state.Webhooks[id]; ok {
+			if !sameJSON(existing, webhook) {
+				conflicts = append(conflicts, ImportConflict{"webhook", id.String()})
+			}
+			continue
+		}
+		state.Webhooks[id] = webhook
+	}
+
+	// like composes, schedules are identified by their unique id, and
+	// their last run changes without them being different schedules
+	if state.Schedules == nil {
+		state.Schedules = make(schedulesV0)
+	}
+	for id, schedule := range archived.Schedules {
+		if _, ok := state.Schedules[id]; ok {
+			continue
+		}
+		state.Schedules[id] = schedule
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Kind != conflicts[j].Kind {
+			return conflicts[i].Kind < conflicts[j].Kind
+		}
+		return conflicts[i].Name < conflicts[j].Name
+	})
+
+	return conflicts, imported
+}
+
+// sameJSON returns whether `a` and `b` serialize to the same JSON.
+func sameJSON(a, b interface{}) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	return bytes.Equal(aJSON, bJSON)
+}
+
+// jobIDsV0 returns the ids of the jobs which build and upload the images of
+// `compose`.
+func jobIDsV0(compose composeV0) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, ib := range compose.ImageBuilds {
+		if ib.JobID != uuid.Nil {
+			ids = append(ids, ib.JobID)
+		}
+		for _, jobID := range ib.UploadJobs {
+			ids = append(ids, jobID)
+		}
+	}
+	return ids
+}
+
+func composeIDsV0(composes composesV0) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(composes))
+	for id := range composes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func sortedUUIDs(ids []uuid.UUID) []uuid.UUID {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	return ids
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+// newArchiveTestState returns a state directory with a blueprint, a source,
+// and a compose whose job and image exist.
+func newArchiveTestState(t *testing.T, arch distro.Arch, bp blueprint.Blueprint) (string, uuid.UUID, uuid.UUID) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+
+	s := New(&dir, arch, nil)
+	require.NoError(t, s.PushBlueprint(bp, "commit "+bp.Name))
+	s.PushSource(bp.Name, SourceConfig{Name: bp.Name, Type: "yum-baseurl", URL: "https://example.com/" + bp.Name})
+
+	imageType, err := arch.GetImageType("test_type")
+	require.NoError(t, err)
+	composeID := uuid.New()
+	jobID := uuid.New()
+	require.NoError(t, s.PushCompose(composeID, &bp, []ImageBuild{{ImageType: imageType, JobID: jobID}}))
+
+	require.NoError(t, os.MkdirAll(path.Join(dir, "jobs"), 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "jobs", jobID.String()+".json"), []byte(`{"id":"`+jobID.String()+`"}`), 0600))
+	require.NoError(t, os.MkdirAll(path.Join(dir, "artifacts", jobID.String()), 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "artifacts", jobID.String(), "disk.img"), []byte("image"), 0600))
+
+	return dir, composeID, jobID
+}
+
+func TestExportImport(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	source, composeID, jobID := newArchiveTestState(t, arch, blueprint.Blueprint{Name: "exported", Version: "1.0.0"})
+	defer os.RemoveAll(source)
+
+	var archive bytes.Buffer
+	require.NoError(t, Export(NewJSONBackend(source), source, &archive, ExportOptions{}))
+	var archiveWithArtifacts bytes.Buffer
+	require.NoError(t, Export(NewJSONBackend(source), source, &archiveWithArtifacts, ExportOptions{Artifacts: true}))
+
+	// merge into a state which has other blueprints
+	target, otherComposeID, otherJobID := newArchiveTestState(t, arch, blueprint.Blueprint{Name: "local", Version: "2.0.0"})
+	defer os.RemoveAll(target)
+
+	conflicts, err := Import(NewJSONBackend(target), target, bytes.NewReader(archive.Bytes()), ImportOptions{})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	s := New(&target, arch, nil)
+	require.Equal(t, []string{"exported", "local"}, s.ListBlueprints())
+	changes := s.GetBlueprintChanges("exported")
+	require.Len(t, changes, 1)
+	require.Equal(t, "commit exported", changes[0].Message)
+	require.NotNil(t, s.GetSource("exported"))
+	_, exists := s.GetCompose(composeID)
+	require.True(t, exists)
+	_, exists = s.GetCompose(otherComposeID)
+	require.True(t, exists)
+	_, err = os.Stat(path.Join(target, "jobs", jobID.String()+".json"))
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(target, "artifacts", jobID.String()))
+	require.True(t, os.IsNotExist(err))
+
+	// importing the same archive again doesn't conflict
+	conflicts, err = Import(NewJSONBackend(target), target, bytes.NewReader(archive.Bytes()), ImportOptions{})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	// different content under the same names conflicts, and is not imported
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "exported", Version: "3.0.0"}, "changed"))
+	s.PushSource("exported", SourceConfig{Name: "exported", Type: "yum-baseurl", URL: "https://example.com/changed"})
+	conflicts, err = Import(NewJSONBackend(target), target, bytes.NewReader(archive.Bytes()), ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []ImportConflict{{"blueprint", "exported"}, {"source", "exported"}}, conflicts)
+	s = New(&target, arch, nil)
+	require.Equal(t, "3.0.0", s.GetBlueprintCommitted("exported").Version)
+	require.Equal(t, "https://example.com/changed", s.GetSource("exported").URL)
+
+	// replacing drops everything which isn't in the archive
+	conflicts, err = Import(NewJSONBackend(target), target, bytes.NewReader(archiveWithArtifacts.Bytes()), ImportOptions{Replace: true})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	s = New(&target, arch, nil)
+	require.Equal(t, []string{"exported"}, s.ListBlueprints())
+	require.Equal(t, "1.0.0", s.GetBlueprintCommitted("exported").Version)
+	_, exists = s.GetCompose(otherComposeID)
+	require.False(t, exists)
+	_, err = os.Stat(path.Join(target, "jobs", otherJobID.String()+".json"))
+	require.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(path.Join(target, "artifacts", jobID.String(), "disk.img"))
+	require.NoError(t, err)
+	require.Equal(t, "image", string(data))
+
+	// the staging directory is removed
+	entries, err := ioutil.ReadDir(target)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), ".import-")
+	}
+}
+
+func TestExportImportSQL(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	source, composeID, jobID := newArchiveTestState(t, arch, blueprint.Blueprint{Name: "exported", Version: "1.0.0"})
+	defer os.RemoveAll(source)
+
+	var archive bytes.Buffer
+	require.NoError(t, Export(NewJSONBackend(source), source, &archive, ExportOptions{}))
+
+	target, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(target)
+
+	// the store is imported into the database, the jobs into the state
+	// directory
+	backend, err := NewSQLBackend(openSQLiteDB(t, target), "sqlite3")
+	require.NoError(t, err)
+	conflicts, err := Import(backend, target, bytes.NewReader(archive.Bytes()), ImportOptions{})
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	_, err = os.Stat(path.Join(target, StoreDBName+".json"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(target, "jobs", jobID.String()+".json"))
+	require.NoError(t, err)
+
+	s, err := NewWithBackend(backend, arch, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"exported"}, s.ListBlueprints())
+	_, exists := s.GetCompose(composeID)
+	require.True(t, exists)
+
+	// replacing the state deletes the records which aren't in the archive
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "local", Version: "2.0.0"}, "local"))
+	_, err = Import(backend, target, bytes.NewReader(archive.Bytes()), ImportOptions{Replace: true})
+	require.NoError(t, err)
+	s, err = NewWithBackend(backend, arch, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"exported"}, s.ListBlueprints())
+
+	var exported bytes.Buffer
+	require.NoError(t, Export(backend, target, &exported, ExportOptions{}))
+	require.NotZero(t, exported.Len())
+}
+
+func TestExportMissingState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var archive bytes.Buffer
+	err = Export(NewJSONBackend(dir), dir, &archive, ExportOptions{})
+	require.Error(t, err)
+	require.Zero(t, archive.Len())
+}
+
+func TestImportInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = Import(NewJSONBackend(dir), dir, bytes.NewReader([]byte("not an archive")), ImportOptions{})
+	require.Error(t, err)
+
+	// nothing was written
+	_, err = os.Stat(path.Join(dir, StoreDBName+".json"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestMergeStoreV0(t *testing.T) {
+	webhookID := uuid.New()
+	scheduleID := uuid.New()
+	newScheduleID := uuid.New()
+	state := storeV0{
+		UploadProfiles: uploadProfilesV0{"aws": {"prod": json.RawMessage(`{"region": "a"}`)}},
+		Webhooks:       webhooksV0{webhookID: {URL: "https://a.example.com"}},
+		Schedules:      schedulesV0{scheduleID: {Blueprint: "a", Cron: "@daily"}},
+	}
+	archived := storeV0{
+		UploadProfiles: uploadProfilesV0{"aws": {
+			"prod": json.RawMessage(`{"region": "b"}`),
+			"test": json.RawMessage(`{"region": "c"}`),
+		}},
+		Webhooks: webhooksV0{webhookID: {URL: "https://b.example.com"}},
+		Schedules: schedulesV0{
+			scheduleID:    {Blueprint: "a", Cron: "@daily", LastCompose: uuid.New()},
+			newScheduleID: {Blueprint: "b", OnChange: true},
+		},
+	}
+
+	conflicts, imported := mergeStoreV0(&state, archived)
+	require.Equal(t, []ImportConflict{{"upload_profile", "aws/prod"}, {"webhook", webhookID.String()}}, conflicts)
+	require.Empty(t, imported)
+	require.JSONEq(t, `{"region": "a"}`, string(state.UploadProfiles["aws"]["prod"]))
+	require.JSONEq(t, `{"region": "c"}`, string(state.UploadProfiles["aws"]["test"]))
+	require.Equal(t, "https://a.example.com", state.Webhooks[webhookID].URL)
+	require.Equal(t, uuid.Nil, state.Schedules[scheduleID].LastCompose)
+	require.Equal(t, "b", state.Schedules[newScheduleID].Blueprint)
+}
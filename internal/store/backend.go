@@ -0,0 +1,115 @@
+package store
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
+)
+
+// A Backend persists the state of a store. The store keeps all of its state
+// in memory, and after every change, it passes the backend the records which
+// changed, so that backends can write only those.
+//
+// Backends are implemented in this package: NewJSONBackend keeps the state
+// in one JSON document, NewSQLBackend in an SQL database.
+type Backend interface {
+	// load returns the persisted state.
+	load() (storeV0, error)
+
+	// save persists the records in `changed` as they are in `s`. It is
+	// called with the lock of `s` held.
+	save(s *Store, changed *changeSet) error
+
+	// replace persists `state` in place of the persisted state.
+	replace(state *storeV0) error
+}
+
+// A changeSet contains the keys of the records of a store which changed.
+// Blueprints are keyed by their key in the store and include their workspace
+// copy and history, upload profiles by their provider and name.
+type changeSet struct {
+	blueprints     map[string]bool
+	sources        map[string]bool
+	composes       map[uuid.UUID]bool
+	uploadProfiles map[[2]string]bool
+	webhooks       map[uuid.UUID]bool
+	schedules      map[uuid.UUID]bool
+}
+
+func newChangeSet() *changeSet {
+	return &changeSet{
+		blueprints:     make(map[string]bool),
+		sources:        make(map[string]bool),
+		composes:       make(map[uuid.UUID]bool),
+		uploadProfiles: make(map[[2]string]bool),
+		webhooks:       make(map[uuid.UUID]bool),
+		schedules:      make(map[uuid.UUID]bool),
+	}
+}
+
+// allChanged returns a change set which contains all records of `state`.
+func allChanged(state *storeV0) *changeSet {
+	changed := newChangeSet()
+	for key := range state.Blueprints {
+		changed.blueprints[key] = true
+	}
+	for key := range state.Workspace {
+		changed.blueprints[key] = true
+	}
+	for key := range state.Changes {
+		changed.blueprints[key] = true
+	}
+	for key := range state.Sources {
+		changed.sources[key] = true
+	}
+	for id := range state.Composes {
+		changed.composes[id] = true
+	}
+	for provider, profiles := range state.UploadProfiles {
+		for name := range profiles {
+			changed.uploadProfiles[[2]string{provider, name}] = true
+		}
+	}
+	for id := range state.Webhooks {
+		changed.webhooks[id] = true
+	}
+	for id := range state.Schedules {
+		changed.schedules[id] = true
+	}
+	return changed
+}
+
+func (c *changeSet) empty() bool {
+	return len(c.blueprints) == 0 && len(c.sources) == 0 && len(c.composes) == 0 &&
+		len(c.uploadProfiles) == 0 && len(c.webhooks) == 0 && len(c.schedules) == 0
+}
+
+func (c *changeSet) reset() {
+	*c = *newChangeSet()
+}
+
+// jsonBackend keeps the state in the JSON document StoreDBName, which is
+// rewritten on every change.
+type jsonBackend struct {
+	db *jsondb.JSONDatabase
+}
+
+// NewJSONBackend returns a backend which keeps the state in `state.json` in
+// `stateDir`.
+func NewJSONBackend(stateDir string) Backend {
+	return &jsonBackend{jsondb.New(stateDir, 0600)}
+}
+
+func (b *jsonBackend) load() (storeV0, error) {
+	var state storeV0
+	_, err := b.db.Read(StoreDBName, &state)
+	return state, err
+}
+
+func (b *jsonBackend) save(s *Store, changed *changeSet) error {
+	return b.db.Write(StoreDBName, s.toStoreV0())
+}
+
+func (b *jsonBackend) replace(state *storeV0) error {
+	return b.db.Write(StoreDBName, state)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/target"
 )
 
@@ -29,6 +30,21 @@ type ImageBuild struct {
 	JobFinished time.Time
 	Size        uint64
 	JobID       uuid.UUID
+	// Results the worker reported for the targets, once the job finished.
+	TargetResults []*target.TargetResult
+	// Maps target UUIDs to the jobs which upload to them, if they are not
+	// uploaded by the job which builds the image.
+	UploadJobs map[uuid.UUID]uuid.UUID
+	// Counts how often the upload to a target was retried automatically,
+	// keyed by target UUID.
+	UploadRetries map[uuid.UUID]int
+	// The packages installed into the image and into its build root, as
+	// they were depsolved when the compose was created. Together with the
+	// OSTree options, these allow rebuilding the same image later. They
+	// are empty for image builds from before they were recorded.
+	Packages      []rpmmd.PackageSpec
+	BuildPackages []rpmmd.PackageSpec
+	OSTree        distro.OSTreeImageOptions
 	// Kept for backwards compatibility. Image builds which were done
 	// before the move to the job queue use this to store whether they
 	// finished successfully.
@@ -42,6 +58,24 @@ func (ib *ImageBuild) DeepCopy() ImageBuild {
 		newTarget := *t
 		newTargets = append(newTargets, &newTarget)
 	}
+	var newTargetResults []*target.TargetResult
+	for _, r := range ib.TargetResults {
+		newTargetResults = append(newTargetResults, r.DeepCopy())
+	}
+	var newUploadJobs map[uuid.UUID]uuid.UUID
+	if ib.UploadJobs != nil {
+		newUploadJobs = make(map[uuid.UUID]uuid.UUID)
+		for targetID, jobID := range ib.UploadJobs {
+			newUploadJobs[targetID] = jobID
+		}
+	}
+	var newUploadRetries map[uuid.UUID]int
+	if ib.UploadRetries != nil {
+		newUploadRetries = make(map[uuid.UUID]int)
+		for targetID, retries := range ib.UploadRetries {
+			newUploadRetries[targetID] = retries
+		}
+	}
 	// Create new image build struct
 	return ImageBuild{
 		ID:          ib.ID,
@@ -54,6 +88,14 @@ func (ib *ImageBuild) DeepCopy() ImageBuild {
 		JobFinished: ib.JobFinished,
 		Size:        ib.Size,
 		JobID:       ib.JobID,
+
+		TargetResults: newTargetResults,
+		UploadJobs:    newUploadJobs,
+		UploadRetries: newUploadRetries,
+
+		Packages:      append([]rpmmd.PackageSpec(nil), ib.Packages...),
+		BuildPackages: append([]rpmmd.PackageSpec(nil), ib.BuildPackages...),
+		OSTree:        ib.OSTree,
 	}
 }
 
@@ -72,8 +114,12 @@ func (ib *ImageBuild) GetLocalTargetOptions() *target.LocalTargetOptions {
 // It contains all the information necessary to generate the inputs for the job, as
 // well as the job's state.
 type Compose struct {
-	Blueprint  *blueprint.Blueprint
-	ImageBuild ImageBuild
+	// Namespace is the namespace the compose belongs to, empty for the
+	// default namespace.
+	Namespace string
+	Blueprint *blueprint.Blueprint
+	// The images of the compose. The ID of every image build is its index.
+	ImageBuilds []ImageBuild
 }
 
 // DeepCopy creates a copy of the Compose structure
@@ -83,8 +129,45 @@ func (c *Compose) DeepCopy() Compose {
 		bpCopy := *c.Blueprint
 		newBpPtr = &bpCopy
 	}
+	var newImageBuilds []ImageBuild
+	for _, ib := range c.ImageBuilds {
+		newImageBuilds = append(newImageBuilds, ib.DeepCopy())
+	}
 	return Compose{
-		Blueprint:  newBpPtr,
-		ImageBuild: c.ImageBuild.DeepCopy(),
+		Namespace:   c.Namespace,
+		Blueprint:   newBpPtr,
+		ImageBuilds: newImageBuilds,
+	}
+}
+
+// GetImageBuild returns the image build with the given id.
+func (c *Compose) GetImageBuild(id int) (*ImageBuild, bool) {
+	if id < 0 || id >= len(c.ImageBuilds) {
+		return nil, false
+	}
+	return &c.ImageBuilds[id], true
+}
+
+// ImageBuildByJobID returns the image build that is built by the job
+// `jobID`.
+func (c *Compose) ImageBuildByJobID(jobID uuid.UUID) (*ImageBuild, bool) {
+	for i := range c.ImageBuilds {
+		if c.ImageBuilds[i].JobID == jobID {
+			return &c.ImageBuilds[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindTarget returns the target with the given id and the image build it
+// belongs to.
+func (c *Compose) FindTarget(id uuid.UUID) (*ImageBuild, *target.Target, bool) {
+	for i := range c.ImageBuilds {
+		for _, t := range c.ImageBuilds[i].Targets {
+			if t.Uuid == id {
+				return &c.ImageBuilds[i], t, true
+			}
+		}
 	}
+	return nil, nil, false
 }
@@ -67,47 +67,55 @@ func FixtureBase() *Store {
 	s.composes = map[uuid.UUID]Compose{
 		uuid.MustParse("30000000-0000-0000-0000-000000000000"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBWaiting,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBWaiting,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000001"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBRunning,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget},
-				JobCreated:  date,
-				JobStarted:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBRunning,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000002"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000003"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFailed,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFailed,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 	}
@@ -170,35 +178,41 @@ func FixtureFinished() *Store {
 	s.composes = map[uuid.UUID]Compose{
 		uuid.MustParse("30000000-0000-0000-0000-000000000000"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000001"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget},
-				JobCreated:  date,
-				JobStarted:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000003"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFailed,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFailed,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 	}
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+// gitRemoteName is the name of the remote the repository is synchronized
+// with.
+const gitRemoteName = "origin"
+
+// A GitRepository keeps the history of blueprints in a git repository, like
+// lorax-composer did. Every blueprint is a TOML file named after its key in
+// the store, so that blueprints of namespaces other than the default one are
+// in a directory named after the namespace. Revisions are tags named
+// `<file>/r<revision>`.
+//
+// If the repository has a remote, changes merged into the remote's branch
+// are imported into the store, and commits made by the store are pushed to
+// it.
+type GitRepository struct {
+	dir    string
+	remote string
+	branch string
+
+	mu sync.Mutex // serializes git commands
+}
+
+// A gitChange is a change to a blueprint pulled from the remote. Blueprint
+// is nil when the blueprint was deleted.
+type gitChange struct {
+	key       string
+	commit    string
+	message   string
+	timestamp time.Time
+	blueprint *blueprint.Blueprint
+}
+
+// OpenGitRepository opens the git repository in `dir`, creating it if it
+// doesn't exist. If `remote` is not empty, the repository is synchronized
+// with `branch` of it. `branch` defaults to "master".
+func OpenGitRepository(dir, remote, branch string) (*GitRepository, error) {
+	if branch == "" {
+		branch = "master"
+	}
+
+	r := &GitRepository{
+		dir:    dir,
+		remote: remote,
+		branch: branch,
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path.Join(dir, ".git")); os.IsNotExist(err) {
+		_, err = r.git("init", "-q")
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.git("symbolic-ref", "HEAD", "refs/heads/"+branch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config := [][]string{
+		{"user.name", "osbuild-composer"},
+		{"user.email", "osbuild-composer@localhost"},
+		{"commit.gpgsign", "false"},
+		{"tag.gpgsign", "false"},
+	}
+	for _, c := range config {
+		_, err = r.git("config", c[0], c[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the remote is configuration, the one in the repository is replaced
+	_, _ = r.git("remote", "remove", gitRemoteName)
+	if remote != "" {
+		_, err = r.git("remote", "add", gitRemoteName, remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// git runs git with `args` in the repository and returns its output.
+func (r *GitRepository) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// head returns the id of the current commit, or the empty string if there
+// are no commits yet.
+func (r *GitRepository) head() string {
+	out, err := r.git("rev-parse", "-q", "--verify", "HEAD^{commit}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitBlueprint commits `bp` as the blueprint with key `key` and returns
+// the id of the commit.
+func (r *GitRepository) commitBlueprint(key string, bp blueprint.Blueprint, message string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var data bytes.Buffer
+	err := toml.NewEncoder(&data).Encode(bp)
+	if err != nil {
+		return "", err
+	}
+
+	file := key + ".toml"
+	err = os.MkdirAll(path.Dir(path.Join(r.dir, file)), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(path.Join(r.dir, file), data.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = r.git("add", "--", file)
+	if err != nil {
+		return "", err
+	}
+
+	return r.commit(message)
+}
+
+// deleteBlueprint commits the deletion of the blueprint with key `key`.
+func (r *GitRepository) deleteBlueprint(key, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.git("rm", "-q", "--ignore-unmatch", "--", key+".toml")
+	if err != nil {
+		return err
+	}
+
+	_, err = r.commit(message)
+	return err
+}
+
+// commit commits the index and returns the id of the commit. The store
+// records a change whenever a blueprint is pushed, so empty commits are
+// allowed.
+func (r *GitRepository) commit(message string) (string, error) {
+	_, err := r.git("commit", "-q", "--allow-empty", "--allow-empty-message", "-m", message)
+	if err != nil {
+		return "", err
+	}
+
+	return r.head(), nil
+}
+
+// tagBlueprint tags `commit` as revision `revision` of the blueprint with
+// key `key`. Commits which are not in the repository, because they were made
+// before the store used it, are not tagged.
+func (r *GitRepository) tagBlueprint(key, commit string, revision int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.git("cat-file", "-e", commit+"^{commit}")
+	if err != nil {
+		return nil
+	}
+
+	_, err = r.git("tag", "-f", fmt.Sprintf("%s.toml/r%d", key, revision), commit)
+	return err
+}
+
+// blueprintAtCommit returns the blueprint with key `key` as it was committed
+// in `commit`.
+func (r *GitRepository) blueprintAtCommit(key, commit string) (*blueprint.Blueprint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.blueprintAt(commit, key+".toml")
+}
+
+// fetch fetches the branch of the remote. It does nothing if there is no
+// remote or the remote doesn't have the branch yet.
+func (r *GitRepository) fetch() error {
+	if r.remote == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, err := r.git("ls-remote", "--heads", gitRemoteName, r.branch)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", r.branch, gitRemoteName, r.branch)
+	_, err = r.git("fetch", "-q", gitRemoteName, refspec)
+	return err
+}
+
+// merge merges the fetched branch of the remote and returns the changes to
+// blueprints which were pulled, oldest first. Files which are not valid
+// blueprints, or whose name doesn't match the blueprint's name, are ignored.
+// The merge is aborted if it conflicts with local commits.
+func (r *GitRepository) merge() ([]gitChange, error) {
+	if r.remote == "" {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upstream := gitRemoteName + "/" + r.branch
+	_, err := r.git("rev-parse", "-q", "--verify", "refs/remotes/"+upstream)
+	if err != nil {
+		return nil, nil
+	}
+
+	old := r.head()
+	_, err = r.git("merge", "-q", "--no-edit", "--allow-unrelated-histories", upstream)
+	if err != nil {
+		_, _ = r.git("merge", "--abort")
+		return nil, fmt.Errorf("cannot merge %s: %v", upstream, err)
+	}
+
+	revisions := "HEAD"
+	if old != "" {
+		revisions = old + "..HEAD"
+	}
+	out, err := r.git("rev-list", "--reverse", "--no-merges", revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []gitChange
+	for _, commit := range strings.Fields(string(out)) {
+		commitChanges, err := r.changesOf(commit)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, commitChanges...)
+	}
+
+	return changes, nil
+}
+
+// changesOf returns the changes to blueprints made by `commit`.
+func (r *GitRepository) changesOf(commit string) ([]gitChange, error) {
+	out, err := r.git("show", "-s", "--format=%ct%n%B", commit)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(string(out), "\n", 2)
+	seconds, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit time of %s: %v", commit, err)
+	}
+	message := ""
+	if len(lines) > 1 {
+		message = strings.TrimSpace(lines[1])
+	}
+
+	out, err = r.git("diff-tree", "-z", "-r", "--root", "--no-commit-id", "--name-status", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []gitChange
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, file := fields[i], fields[i+1]
+
+		key, ok := blueprintKeyOf(file)
+		if !ok {
+			continue
+		}
+
+		change := gitChange{
+			key:       key,
+			commit:    commit,
+			message:   message,
+			timestamp: time.Unix(seconds, 0),
+		}
+
+		if status != "D" {
+			bp, err := r.blueprintAt(commit, file)
+			if err != nil {
+				continue
+			}
+			_, name := splitKey(key)
+			if bp.Name != name {
+				continue
+			}
+			change.blueprint = bp
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// blueprintAt returns the blueprint in `file` at `commit`.
+func (r *GitRepository) blueprintAt(commit, file string) (*blueprint.Blueprint, error) {
+	data, err := r.git("show", commit+":"+file)
+	if err != nil {
+		return nil, err
+	}
+
+	var bp blueprint.Blueprint
+	_, err = toml.Decode(string(data), &bp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bp.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &bp, nil
+}
+
+// push pushes the local commits and tags to the remote. It does nothing if
+// there is no remote or no commits yet.
+func (r *GitRepository) push() error {
+	if r.remote == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.head() == "" {
+		return nil
+	}
+
+	_, err := r.git("push", "-q", gitRemoteName, "HEAD:refs/heads/"+r.branch)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.git("push", "-q", "-f", gitRemoteName, "refs/tags/*:refs/tags/*")
+	return err
+}
+
+// blueprintKeyOf returns the key of the blueprint in `file`, and whether
+// `file` can contain a blueprint at all.
+func blueprintKeyOf(file string) (string, bool) {
+	if !strings.HasSuffix(file, ".toml") {
+		return "", false
+	}
+
+	key := strings.TrimSuffix(file, ".toml")
+	namespace, name := splitKey(key)
+	if name == "" || strings.Contains(name, "/") || !ValidNamespace.MatchString(namespace) {
+		return "", false
+	}
+
+	return key, true
+}
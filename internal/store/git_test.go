@@ -0,0 +1,193 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+// runGit runs git with `args` in `dir` and returns its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// newGitStore returns a store whose blueprints are kept in a git repository
+// in `dir`, which is synchronized with `remote`.
+func newGitStore(t *testing.T, dir, remote string) *Store {
+	t.Helper()
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	repo, err := OpenGitRepository(dir, remote, "main")
+	require.NoError(t, err)
+
+	s := New(nil, arch, nil)
+	s.SetGitRepository(repo)
+	return s
+}
+
+func TestGitRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newGitStore(t, path.Join(dir, "local"), "")
+
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprint(bp, "first"))
+	bp.Description = "changed"
+	require.NoError(t, s.PushBlueprint(bp, "second"))
+	require.NoError(t, s.Namespace("team").PushBlueprint(bp, "team"))
+
+	// commits of the store are commits of the repository
+	changes := s.GetBlueprintChanges("test")
+	require.Len(t, changes, 2)
+	require.Equal(t, changes[1].Commit, runGit(t, path.Join(dir, "local"), "rev-parse", "HEAD~1"))
+	require.Equal(t, "second", runGit(t, path.Join(dir, "local"), "log", "-1", "--format=%s", changes[1].Commit))
+	require.Contains(t, runGit(t, path.Join(dir, "local"), "show", "HEAD~1:test.toml"), `version = "0.0.2"`)
+	require.Contains(t, runGit(t, path.Join(dir, "local"), "show", "HEAD:team/test.toml"), `name = "test"`)
+
+	require.NoError(t, s.TagBlueprint("test"))
+	require.Equal(t, changes[1].Commit, runGit(t, path.Join(dir, "local"), "rev-list", "-n1", "test.toml/r1"))
+
+	require.NoError(t, s.DeleteBlueprint("test"))
+	require.Equal(t, "Recipe test deleted", runGit(t, path.Join(dir, "local"), "log", "-1", "--format=%s"))
+	require.Equal(t, "team/test.toml", runGit(t, path.Join(dir, "local"), "ls-files"))
+
+	// without a remote, syncing does nothing
+	require.NoError(t, s.SyncBlueprints())
+}
+
+func TestGitRepositorySync(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remote := path.Join(dir, "remote.git")
+	runGit(t, dir, "init", "-q", "--bare", remote)
+
+	first := newGitStore(t, path.Join(dir, "first"), remote)
+	second := newGitStore(t, path.Join(dir, "second"), remote)
+
+	var changed []string
+	second.OnBlueprintChange(func(namespace, name string) {
+		changed = append(changed, namespace+"/"+name)
+	})
+
+	// syncing with an empty remote works
+	require.NoError(t, first.SyncBlueprints())
+
+	require.NoError(t, first.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.1"}, "from first"))
+	require.NoError(t, first.SyncBlueprints())
+	require.NoError(t, second.SyncBlueprints())
+
+	bp := second.GetBlueprintCommitted("test")
+	require.NotNil(t, bp)
+	require.Equal(t, "0.0.1", bp.Version)
+	require.Equal(t, first.GetBlueprintChanges("test"), second.GetBlueprintChanges("test"))
+	require.Equal(t, []string{"/test"}, changed)
+
+	// a change merged into the remote by someone else
+	clone := path.Join(dir, "clone")
+	runGit(t, dir, "clone", "-q", "-b", "main", remote, clone)
+	require.NoError(t, os.Mkdir(path.Join(clone, "team"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(clone, "team", "web.toml"), []byte("name = \"web\"\nversion = \"1.0.0\"\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(clone, "wrong-name.toml"), []byte("name = \"other\"\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(clone, "README"), []byte("blueprints\n"), 0644))
+	runGit(t, clone, "add", ".")
+	runGit(t, clone, "commit", "-q", "-m", "Add web")
+	runGit(t, clone, "rm", "-q", "test.toml")
+	runGit(t, clone, "commit", "-q", "-m", "Remove test")
+	runGit(t, clone, "push", "-q", "origin", "main")
+
+	// local commits are merged with the remote's
+	require.NoError(t, second.PushBlueprint(blueprint.Blueprint{Name: "local", Version: "0.1.0"}, "from second"))
+	require.NoError(t, second.SyncBlueprints())
+
+	require.Nil(t, second.GetBlueprintCommitted("test"))
+	require.Nil(t, second.GetBlueprintCommitted("other"))
+	require.Nil(t, second.GetBlueprintCommitted("wrong-name"))
+	require.NotNil(t, second.GetBlueprintCommitted("local"))
+	web := second.Namespace("team").GetBlueprintCommitted("web")
+	require.NotNil(t, web)
+	require.Equal(t, "1.0.0", web.Version)
+	changes := second.Namespace("team").GetBlueprintChanges("web")
+	require.Len(t, changes, 1)
+	require.Equal(t, "Add web", changes[0].Message)
+
+	require.NoError(t, first.SyncBlueprints())
+	require.NotNil(t, first.GetBlueprintCommitted("local"))
+	require.NotNil(t, first.Namespace("team").GetBlueprintCommitted("web"))
+	require.Nil(t, first.GetBlueprintCommitted("test"))
+
+	// conflicting changes are not merged
+	runGit(t, clone, "pull", "-q", "--no-rebase", "origin", "main")
+	require.NoError(t, ioutil.WriteFile(path.Join(clone, "local.toml"), []byte("name = \"local\"\nversion = \"2.0.0\"\n"), 0644))
+	runGit(t, clone, "commit", "-q", "-am", "Update local")
+	runGit(t, clone, "push", "-q", "origin", "main")
+
+	require.NoError(t, first.PushBlueprint(blueprint.Blueprint{Name: "local", Version: "3.0.0"}, "conflict"))
+	require.Error(t, first.SyncBlueprints())
+	require.Equal(t, "3.0.0", first.GetBlueprintCommitted("local").Version)
+	require.Empty(t, runGit(t, path.Join(dir, "first"), "status", "--porcelain"))
+}
+
+func TestGitBlueprintAtCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newGitStore(t, dir, "")
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.1"}, "first"))
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.1", Description: "changed"}, "second"))
+	changes := s.GetBlueprintChanges("test")
+
+	// a store which didn't make the commits reads them from the repository
+	loaded := newGitStore(t, dir, "")
+	loaded.blueprintsChanges = s.blueprintsChanges
+	for commit, change := range loaded.blueprintsChanges["test"] {
+		change.Blueprint = blueprint.Blueprint{}
+		loaded.blueprintsChanges["test"][commit] = change
+	}
+
+	bp, err := loaded.GetBlueprintAtCommit("test", changes[0].Commit)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.1", bp.Version)
+	require.Equal(t, "", bp.Description)
+
+	bp, err = loaded.GetBlueprintAtCommit("test", changes[1].Commit)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.2", bp.Version)
+	require.Equal(t, "changed", bp.Description)
+
+	_, err = loaded.GetBlueprintAtCommit("test", "unknown")
+	require.Error(t, err)
+}
@@ -1,15 +1,18 @@
 package store
 
 import (
+	"encoding/json"
 	"errors"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/target"
 )
 
@@ -20,6 +23,10 @@ type storeV0 struct {
 	Sources    sourcesV0    `json:"sources"`
 	Changes    changesV0    `json:"changes"`
 	Commits    commitsV0    `json:"commits"`
+
+	UploadProfiles uploadProfilesV0 `json:"upload_profiles,omitempty"`
+	Webhooks       webhooksV0       `json:"webhooks,omitempty"`
+	Schedules      schedulesV0      `json:"schedules,omitempty"`
 }
 
 type blueprintsV0 map[string]blueprint.Blueprint
@@ -29,6 +36,7 @@ type workspaceV0 map[string]blueprint.Blueprint
 // It contains all the information necessary to generate the inputs for the job, as
 // well as the job's state.
 type composeV0 struct {
+	Namespace   string               `json:"namespace,omitempty"`
 	Blueprint   *blueprint.Blueprint `json:"blueprint"`
 	ImageBuilds []imageBuildV0       `json:"image_builds"`
 }
@@ -47,6 +55,15 @@ type imageBuildV0 struct {
 	Size        uint64           `json:"size"`
 	JobID       uuid.UUID        `json:"jobid,omitempty"`
 
+	TargetResults []*target.TargetResult  `json:"target_results,omitempty"`
+	UploadJobs    map[uuid.UUID]uuid.UUID `json:"upload_jobs,omitempty"`
+	UploadRetries map[uuid.UUID]int       `json:"upload_retries,omitempty"`
+
+	Packages      []rpmmd.PackageSpec `json:"packages,omitempty"`
+	BuildPackages []rpmmd.PackageSpec `json:"build_packages,omitempty"`
+	OSTreeRef     string              `json:"ostree_ref,omitempty"`
+	OSTreeParent  string              `json:"ostree_parent,omitempty"`
+
 	// Kept for backwards compatibility. Image builds which were done
 	// before the move to the job queue use this to store whether they
 	// finished successfully.
@@ -69,13 +86,40 @@ type changeV0 struct {
 	Message   string `json:"message"`
 	Revision  *int   `json:"revision"`
 	Timestamp string `json:"timestamp"`
-	// BUG: We are currently not (un)marshalling the Blueprint field.
+	// The blueprint as it was committed, missing in changes from before
+	// it was recorded.
+	Blueprint *blueprint.Blueprint `json:"blueprint,omitempty"`
 }
 
 type changesV0 map[string]map[string]changeV0
 
 type commitsV0 map[string][]string
 
+type uploadProfilesV0 map[string]map[string]json.RawMessage
+
+type webhookV0 struct {
+	Namespace string   `json:"namespace,omitempty"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events,omitempty"`
+}
+
+type webhooksV0 map[uuid.UUID]webhookV0
+
+type scheduleV0 struct {
+	Namespace   string          `json:"namespace,omitempty"`
+	Blueprint   string          `json:"blueprint"`
+	ImageTypes  []string        `json:"image_types"`
+	Upload      json.RawMessage `json:"upload,omitempty"`
+	Cron        string          `json:"cron,omitempty"`
+	OnChange    bool            `json:"on_change,omitempty"`
+	Created     time.Time       `json:"created"`
+	LastChecked time.Time       `json:"last_checked"`
+	LastCompose uuid.UUID       `json:"last_compose"`
+}
+
+type schedulesV0 map[uuid.UUID]scheduleV0
+
 func newBlueprintsFromV0(blueprintsStruct blueprintsV0) map[string]blueprint.Blueprint {
 	blueprints := make(map[string]blueprint.Blueprint)
 	for name, blueprint := range blueprintsStruct {
@@ -136,21 +180,40 @@ func newImageBuildFromV0(imageBuildStruct imageBuildV0, arch distro.Arch) (Image
 		Size:        imageBuildStruct.Size,
 		JobID:       imageBuildStruct.JobID,
 		QueueStatus: queueStatus,
+
+		TargetResults: imageBuildStruct.TargetResults,
+		UploadJobs:    imageBuildStruct.UploadJobs,
+		UploadRetries: imageBuildStruct.UploadRetries,
+
+		Packages:      imageBuildStruct.Packages,
+		BuildPackages: imageBuildStruct.BuildPackages,
+		OSTree: distro.OSTreeImageOptions{
+			Ref:    imageBuildStruct.OSTreeRef,
+			Parent: imageBuildStruct.OSTreeParent,
+		},
 	}, nil
 }
 
 func newComposeFromV0(composeStruct composeV0, arch distro.Arch) (Compose, error) {
-	if len(composeStruct.ImageBuilds) != 1 {
-		return Compose{}, errors.New("compose with unsupported number of image builds")
+	if len(composeStruct.ImageBuilds) == 0 {
+		return Compose{}, errors.New("compose without image builds")
 	}
-	ib, err := newImageBuildFromV0(composeStruct.ImageBuilds[0], arch)
-	if err != nil {
-		return Compose{}, err
+	var imageBuilds []ImageBuild
+	for i, imageBuildStruct := range composeStruct.ImageBuilds {
+		if imageBuildStruct.ID != i {
+			return Compose{}, errors.New("compose with unordered image builds")
+		}
+		ib, err := newImageBuildFromV0(imageBuildStruct, arch)
+		if err != nil {
+			return Compose{}, err
+		}
+		imageBuilds = append(imageBuilds, ib)
 	}
 	bp := composeStruct.Blueprint.DeepCopy()
 	return Compose{
-		Blueprint:  &bp,
-		ImageBuild: ib,
+		Namespace:   composeStruct.Namespace,
+		Blueprint:   &bp,
+		ImageBuilds: imageBuilds,
 	}, nil
 }
 
@@ -170,12 +233,16 @@ func newChangesFromV0(changesStruct changesV0) map[string]map[string]blueprint.C
 	for name, commitsStruct := range changesStruct {
 		commits := make(map[string]blueprint.Change)
 		for commitID, change := range commitsStruct {
-			commits[commitID] = blueprint.Change{
+			c := blueprint.Change{
 				Commit:    change.Commit,
 				Message:   change.Message,
 				Revision:  change.Revision,
 				Timestamp: change.Timestamp,
 			}
+			if change.Blueprint != nil {
+				c.Blueprint = change.Blueprint.DeepCopy()
+			}
+			commits[commitID] = c
 		}
 		changes[name] = commits
 	}
@@ -227,13 +294,109 @@ func newCommitsFromV0(commitsMapStruct commitsV0, changesMapStruct changesV0) ma
 
 func newStoreFromV0(storeStruct storeV0, arch distro.Arch, log *log.Logger) *Store {
 	return &Store{
+		mu:                &sync.RWMutex{},
+		changed:           newChangeSet(),
+		quotas:            make(map[string]Quota),
 		blueprints:        newBlueprintsFromV0(storeStruct.Blueprints),
 		workspace:         newWorkspaceFromV0(storeStruct.Workspace),
 		composes:          newComposesFromV0(storeStruct.Composes, arch, log),
 		sources:           newSourceConfigsFromV0(storeStruct.Sources),
 		blueprintsChanges: newChangesFromV0(storeStruct.Changes),
 		blueprintsCommits: newCommitsFromV0(storeStruct.Commits, storeStruct.Changes),
+		uploadProfiles:    newUploadProfilesFromV0(storeStruct.UploadProfiles),
+		webhooks:          newWebhooksFromV0(storeStruct.Webhooks),
+		schedules:         newSchedulesFromV0(storeStruct.Schedules),
+	}
+}
+
+func newWebhooksFromV0(webhooksStruct webhooksV0) map[uuid.UUID]Webhook {
+	webhooks := make(map[uuid.UUID]Webhook)
+	for id, webhook := range webhooksStruct {
+		webhooks[id] = Webhook{
+			ID:        id,
+			Namespace: webhook.Namespace,
+			URL:       webhook.URL,
+			Secret:    webhook.Secret,
+			Events:    webhook.Events,
+		}
+	}
+	return webhooks
+}
+
+func newWebhooksV0(webhooks map[uuid.UUID]Webhook) webhooksV0 {
+	webhooksStruct := make(webhooksV0)
+	for id, webhook := range webhooks {
+		webhooksStruct[id] = webhookV0{
+			Namespace: webhook.Namespace,
+			URL:       webhook.URL,
+			Secret:    webhook.Secret,
+			Events:    webhook.Events,
+		}
+	}
+	return webhooksStruct
+}
+
+func newSchedulesFromV0(schedulesStruct schedulesV0) map[uuid.UUID]Schedule {
+	schedules := make(map[uuid.UUID]Schedule)
+	for id, schedule := range schedulesStruct {
+		schedules[id] = Schedule{
+			ID:          id,
+			Namespace:   schedule.Namespace,
+			Blueprint:   schedule.Blueprint,
+			ImageTypes:  schedule.ImageTypes,
+			Upload:      schedule.Upload,
+			Cron:        schedule.Cron,
+			OnChange:    schedule.OnChange,
+			Created:     schedule.Created,
+			LastChecked: schedule.LastChecked,
+			LastCompose: schedule.LastCompose,
+		}
+	}
+	return schedules
+}
+
+func newScheduleV0(schedule Schedule) scheduleV0 {
+	return scheduleV0{
+		Namespace:   schedule.Namespace,
+		Blueprint:   schedule.Blueprint,
+		ImageTypes:  schedule.ImageTypes,
+		Upload:      schedule.Upload,
+		Cron:        schedule.Cron,
+		OnChange:    schedule.OnChange,
+		Created:     schedule.Created,
+		LastChecked: schedule.LastChecked,
+		LastCompose: schedule.LastCompose,
+	}
+}
+
+func newSchedulesV0(schedules map[uuid.UUID]Schedule) schedulesV0 {
+	schedulesStruct := make(schedulesV0)
+	for id, schedule := range schedules {
+		schedulesStruct[id] = newScheduleV0(schedule)
 	}
+	return schedulesStruct
+}
+
+func newUploadProfilesFromV0(profilesStruct uploadProfilesV0) map[string]map[string]json.RawMessage {
+	profiles := make(map[string]map[string]json.RawMessage)
+	for provider, providerProfiles := range profilesStruct {
+		profiles[provider] = make(map[string]json.RawMessage)
+		for name, settings := range providerProfiles {
+			profiles[provider][name] = settings
+		}
+	}
+	return profiles
+}
+
+func newUploadProfilesV0(profiles map[string]map[string]json.RawMessage) uploadProfilesV0 {
+	profilesStruct := make(uploadProfilesV0)
+	for provider, providerProfiles := range profiles {
+		profilesStruct[provider] = make(map[string]json.RawMessage)
+		for name, settings := range providerProfiles {
+			profilesStruct[provider][name] = settings
+		}
+	}
+	return profilesStruct
 }
 
 func newBlueprintsV0(blueprints map[string]blueprint.Blueprint) blueprintsV0 {
@@ -254,22 +417,34 @@ func newWorkspaceV0(workspace map[string]blueprint.Blueprint) workspaceV0 {
 
 func newComposeV0(compose Compose) composeV0 {
 	bp := compose.Blueprint.DeepCopy()
+	imageBuilds := []imageBuildV0{}
+	for _, ib := range compose.ImageBuilds {
+		imageBuilds = append(imageBuilds, imageBuildV0{
+			ID:          ib.ID,
+			ImageType:   imageTypeToCompatString(ib.ImageType),
+			Manifest:    ib.Manifest,
+			Targets:     ib.Targets,
+			JobCreated:  ib.JobCreated,
+			JobStarted:  ib.JobStarted,
+			JobFinished: ib.JobFinished,
+			Size:        ib.Size,
+			JobID:       ib.JobID,
+			QueueStatus: ib.QueueStatus,
+
+			TargetResults: ib.TargetResults,
+			UploadJobs:    ib.UploadJobs,
+			UploadRetries: ib.UploadRetries,
+
+			Packages:      ib.Packages,
+			BuildPackages: ib.BuildPackages,
+			OSTreeRef:     ib.OSTree.Ref,
+			OSTreeParent:  ib.OSTree.Parent,
+		})
+	}
 	return composeV0{
-		Blueprint: &bp,
-		ImageBuilds: []imageBuildV0{
-			{
-				ID:          compose.ImageBuild.ID,
-				ImageType:   imageTypeToCompatString(compose.ImageBuild.ImageType),
-				Manifest:    compose.ImageBuild.Manifest,
-				Targets:     compose.ImageBuild.Targets,
-				JobCreated:  compose.ImageBuild.JobCreated,
-				JobStarted:  compose.ImageBuild.JobStarted,
-				JobFinished: compose.ImageBuild.JobFinished,
-				Size:        compose.ImageBuild.Size,
-				JobID:       compose.ImageBuild.JobID,
-				QueueStatus: compose.ImageBuild.QueueStatus,
-			},
-		},
+		Namespace:   compose.Namespace,
+		Blueprint:   &bp,
+		ImageBuilds: imageBuilds,
 	}
 }
 
@@ -294,12 +469,17 @@ func newChangesV0(changes map[string]map[string]blueprint.Change) changesV0 {
 	for name, commits := range changes {
 		commitsStruct := make(map[string]changeV0)
 		for commitID, change := range commits {
-			commitsStruct[commitID] = changeV0{
+			c := changeV0{
 				Commit:    change.Commit,
 				Message:   change.Message,
 				Revision:  change.Revision,
 				Timestamp: change.Timestamp,
 			}
+			if change.Blueprint.Name != "" {
+				bp := change.Blueprint.DeepCopy()
+				c.Blueprint = &bp
+			}
+			commitsStruct[commitID] = c
 		}
 		changesStruct[name] = commitsStruct
 	}
@@ -322,6 +502,10 @@ func (store *Store) toStoreV0() *storeV0 {
 		Sources:    newSourcesV0(store.sources),
 		Changes:    newChangesV0(store.blueprintsChanges),
 		Commits:    newCommitsV0(store.blueprintsCommits),
+
+		UploadProfiles: newUploadProfilesV0(store.uploadProfiles),
+		Webhooks:       newWebhooksV0(store.webhooks),
+		Schedules:      newSchedulesV0(store.schedules),
 	}
 }
 
@@ -335,6 +519,7 @@ var imageTypeCompatMapping = map[string]string{
 	"ext4-filesystem":   "Raw-filesystem",
 	"partitioned-disk":  "Partitioned-disk",
 	"tar":               "Tar",
+	"container":         "Container",
 	"fedora-iot-commit": "fedora-iot-commit",
 	"rhel-edge-commit":  "rhel-edge-commit",
 	"test_type":         "test_type",         // used only in json_test.go
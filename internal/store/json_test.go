@@ -1,8 +1,11 @@
 package store
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -15,6 +18,8 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/distro/fedora32"
 	"github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
 	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -129,6 +134,40 @@ func TestMarshalFinished(t *testing.T) {
 	}
 }
 
+func TestLoadUnknownStage(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+	imageType, err := arch.GetImageType("test_type")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a state written by a composer which knows a stage this one doesn't
+	id := uuid.New()
+	manifest := distro.Manifest{Manifest: osbuild.Manifest{Pipeline: osbuild.Pipeline{
+		Stages: []*osbuild.Stage{osbuild.NewLocaleStage(&osbuild.LocaleStageOptions{Language: "en_US"})},
+	}}}
+	s := New(&dir, arch, nil)
+	require.NoError(t, s.PushCompose(id, &blueprint.Blueprint{Name: "test"}, []ImageBuild{{ImageType: imageType, Manifest: manifest, JobID: uuid.New()}}))
+	state, err := ioutil.ReadFile(path.Join(dir, "state.json"))
+	require.NoError(t, err)
+	state = bytes.Replace(state, []byte(`"org.osbuild.locale"`), []byte(`"org.osbuild.foo"`), 1)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "state.json"), state, 0600))
+
+	// the stage is kept as it is, also when the state is written again
+	for i := 0; i < 2; i++ {
+		s = New(&dir, arch, nil)
+		compose, exists := s.GetCompose(id)
+		require.True(t, exists)
+		stage := compose.ImageBuilds[0].Manifest.Pipeline.Stages[0]
+		require.Equal(t, "org.osbuild.foo", stage.Name)
+		require.Equal(t, &osbuild.RawStageOptions{RawMessage: json.RawMessage(`{"language":"en_US"}`)}, stage.Options)
+		require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "other"}, "rewrite the state"))
+	}
+}
+
 func TestStore_toStoreV0(t *testing.T) {
 	type fields struct {
 		blueprints        map[string]blueprint.Blueprint
@@ -153,6 +192,10 @@ func TestStore_toStoreV0(t *testing.T) {
 				Sources:    make(sourcesV0),
 				Changes:    make(changesV0),
 				Commits:    make(commitsV0),
+
+				UploadProfiles: make(uploadProfilesV0),
+				Webhooks:       make(webhooksV0),
+				Schedules:      make(schedulesV0),
 			},
 		},
 	}
@@ -989,30 +1032,32 @@ func Test_newComposeV0(t *testing.T) {
 			name: "qcow2 compose",
 			compose: Compose{
 				Blueprint: &bp,
-				ImageBuild: ImageBuild{
-					ID:        0,
-					ImageType: &test_distro.TestImageType{},
-					Manifest:  []byte("JSON MANIFEST GOES HERE"),
-					Targets: []*target.Target{
-						{
-							Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-							ImageName: "",
-							Name:      "org.osbuild.local",
-							Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-							Status:    common.IBWaiting,
-							Options: target.LocalTargetOptions{
-								ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-								ImageBuildId: 0,
-								Filename:     "disk.qcow2",
+				ImageBuilds: []ImageBuild{
+					{
+						ID:        0,
+						ImageType: &test_distro.TestImageType{},
+						Manifest:  distro.Manifest{},
+						Targets: []*target.Target{
+							{
+								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+								ImageName: "",
+								Name:      "org.osbuild.local",
+								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+								Status:    common.IBWaiting,
+								Options: target.LocalTargetOptions{
+									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+									ImageBuildId: 0,
+									Filename:     "disk.qcow2",
+								},
 							},
 						},
+						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+						Size:        2147483648,
+						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+						QueueStatus: common.IBFinished,
 					},
-					JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-					JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-					JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-					Size:        2147483648,
-					JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-					QueueStatus: common.IBFinished,
 				},
 			},
 			want: composeV0{
@@ -1021,7 +1066,7 @@ func Test_newComposeV0(t *testing.T) {
 					{
 						ID:        0,
 						ImageType: "test_type",
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
+						Manifest:  distro.Manifest{},
 						Targets: []*target.Target{
 							{
 								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1089,7 +1134,7 @@ func Test_newComposeFromV0(t *testing.T) {
 					{
 						ID:        0,
 						ImageType: "test_type",
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
+						Manifest:  distro.Manifest{},
 						Targets: []*target.Target{
 							{
 								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1115,30 +1160,32 @@ func Test_newComposeFromV0(t *testing.T) {
 			},
 			want: Compose{
 				Blueprint: &bp,
-				ImageBuild: ImageBuild{
-					ID:        0,
-					ImageType: &test_distro.TestImageType{},
-					Manifest:  []byte("JSON MANIFEST GOES HERE"),
-					Targets: []*target.Target{
-						{
-							Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-							ImageName: "",
-							Name:      "org.osbuild.local",
-							Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-							Status:    common.IBWaiting,
-							Options: target.LocalTargetOptions{
-								ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-								ImageBuildId: 0,
-								Filename:     "disk.qcow2",
+				ImageBuilds: []ImageBuild{
+					{
+						ID:        0,
+						ImageType: &test_distro.TestImageType{},
+						Manifest:  distro.Manifest{},
+						Targets: []*target.Target{
+							{
+								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+								ImageName: "",
+								Name:      "org.osbuild.local",
+								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+								Status:    common.IBWaiting,
+								Options: target.LocalTargetOptions{
+									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+									ImageBuildId: 0,
+									Filename:     "disk.qcow2",
+								},
 							},
 						},
+						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+						Size:        2147483648,
+						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+						QueueStatus: common.IBFinished,
 					},
-					JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-					JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-					JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-					Size:        2147483648,
-					JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-					QueueStatus: common.IBFinished,
 				},
 			},
 		},
@@ -1176,58 +1223,62 @@ func Test_newComposesV0(t *testing.T) {
 			composes: map[uuid.UUID]Compose{
 				uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  distro.Manifest{},
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 				uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  distro.Manifest{},
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 			},
@@ -1238,7 +1289,7 @@ func Test_newComposesV0(t *testing.T) {
 						imageBuildV0{
 							ID:        0,
 							ImageType: "test_type",
-							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Manifest:  distro.Manifest{},
 							Targets: []*target.Target{
 								{
 									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1268,7 +1319,7 @@ func Test_newComposesV0(t *testing.T) {
 						imageBuildV0{
 							ID:        0,
 							ImageType: "test_type",
-							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Manifest:  distro.Manifest{},
 							Targets: []*target.Target{
 								{
 									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
@@ -1335,7 +1386,7 @@ func Test_newComposesFromV0(t *testing.T) {
 						{
 							ID:        0,
 							ImageType: "test_type",
-							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Manifest:  distro.Manifest{},
 							Targets: []*target.Target{
 								{
 									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1365,7 +1416,7 @@ func Test_newComposesFromV0(t *testing.T) {
 						{
 							ID:        0,
 							ImageType: "test_type",
-							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Manifest:  distro.Manifest{},
 							Targets: []*target.Target{
 								{
 									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
@@ -1393,58 +1444,62 @@ func Test_newComposesFromV0(t *testing.T) {
 			want: map[uuid.UUID]Compose{
 				uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  distro.Manifest{},
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 				uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  distro.Manifest{},
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 			},
@@ -1481,7 +1536,7 @@ func Test_newImageBuildFromV0(t *testing.T) {
 			ib: imageBuildV0{
 				ID:        0,
 				ImageType: "test_type",
-				Manifest:  []byte("JSON MANIFEST GOES HERE"),
+				Manifest:  distro.Manifest{},
 				Targets: []*target.Target{
 					{
 						Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1506,7 +1561,7 @@ func Test_newImageBuildFromV0(t *testing.T) {
 			want: ImageBuild{
 				ID:        0,
 				ImageType: &test_distro.TestImageType{},
-				Manifest:  []byte("JSON MANIFEST GOES HERE"),
+				Manifest:  distro.Manifest{},
 				Targets: []*target.Target{
 					{
 						Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
@@ -1529,6 +1584,43 @@ func Test_newImageBuildFromV0(t *testing.T) {
 				QueueStatus: common.IBFinished,
 			},
 		},
+		{
+			name:  "image build with frozen packages",
+			arch:  &test_distro.TestArch{},
+			errOk: false,
+			ib: imageBuildV0{
+				ID:        0,
+				ImageType: "test_type",
+				Manifest:  distro.Manifest{},
+				JobID:     uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+				Packages: []rpmmd.PackageSpec{
+					{Name: "tmux", Version: "3.1", Release: "1.fc32", Arch: "x86_64", Checksum: "sha256:aaaa"},
+				},
+				BuildPackages: []rpmmd.PackageSpec{
+					{Name: "rpm", Version: "4.15.1", Release: "2.fc32", Arch: "x86_64", Checksum: "sha256:bbbb"},
+				},
+				OSTreeRef:    "fedora/32/x86_64/iot",
+				OSTreeParent: "02604b2da6e954bd34b8b82a835e5a77d2b60ffa",
+				QueueStatus:  common.IBFinished,
+			},
+			want: ImageBuild{
+				ID:        0,
+				ImageType: &test_distro.TestImageType{},
+				Manifest:  distro.Manifest{},
+				JobID:     uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+				Packages: []rpmmd.PackageSpec{
+					{Name: "tmux", Version: "3.1", Release: "1.fc32", Arch: "x86_64", Checksum: "sha256:aaaa"},
+				},
+				BuildPackages: []rpmmd.PackageSpec{
+					{Name: "rpm", Version: "4.15.1", Release: "2.fc32", Arch: "x86_64", Checksum: "sha256:bbbb"},
+				},
+				OSTree: distro.OSTreeImageOptions{
+					Ref:    "fedora/32/x86_64/iot",
+					Parent: "02604b2da6e954bd34b8b82a835e5a77d2b60ffa",
+				},
+				QueueStatus: common.IBFinished,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
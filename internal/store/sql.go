@@ -0,0 +1,642 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+// sqlMigrations are the migrations of the SQL schema, in order. The version
+// of the schema is the number of migrations which were applied to it.
+//
+// Records are stored as JSON in the format of storeV0, so that the tables
+// don't have to change when a field is added to a record. The history of a
+// blueprint is in a row per change.
+var sqlMigrations = [][]string{
+	{
+		`CREATE TABLE blueprints (id TEXT PRIMARY KEY, blueprint TEXT NOT NULL)`,
+		`CREATE TABLE workspace (id TEXT PRIMARY KEY, blueprint TEXT NOT NULL)`,
+		`CREATE TABLE blueprint_changes (id TEXT NOT NULL, seq INTEGER NOT NULL, commit_id TEXT NOT NULL, message TEXT NOT NULL, revision INTEGER, created TEXT NOT NULL, PRIMARY KEY (id, commit_id))`,
+		`CREATE TABLE sources (id TEXT PRIMARY KEY, source TEXT NOT NULL)`,
+		`CREATE TABLE composes (id TEXT PRIMARY KEY, namespace TEXT NOT NULL, compose TEXT NOT NULL)`,
+		`CREATE TABLE upload_profiles (provider TEXT NOT NULL, name TEXT NOT NULL, settings TEXT NOT NULL, PRIMARY KEY (provider, name))`,
+		`CREATE TABLE webhooks (id TEXT PRIMARY KEY, webhook TEXT NOT NULL)`,
+	},
+	{
+		`CREATE TABLE schedules (id TEXT PRIMARY KEY, schedule TEXT NOT NULL)`,
+	},
+	{
+		`ALTER TABLE blueprint_changes ADD COLUMN blueprint TEXT`,
+	},
+}
+
+// sqlTables are the tables which contain the records of the state.
+var sqlTables = []string{"blueprints", "workspace", "blueprint_changes", "sources", "composes", "upload_profiles", "webhooks", "schedules"}
+
+// sqlBackend keeps the state in an SQL database, with a table per kind of
+// record. Every change of the store is written in one transaction, which
+// only touches the rows of the records which changed.
+type sqlBackend struct {
+	db *sql.DB
+
+	// whether placeholders are numbered ($1, $2, ...) instead of "?"
+	numberedPlaceholders bool
+}
+
+// NewSQLBackend returns a backend which keeps the state in `db`, which was
+// opened with the driver `driverName`. It migrates the schema to the newest
+// version.
+//
+// The SQL is kept to what PostgreSQL and SQLite have in common. MySQL is not
+// supported, because it cannot index TEXT keys. The drivers "postgres" and
+// "pgx" use numbered placeholders.
+func NewSQLBackend(db *sql.DB, driverName string) (Backend, error) {
+	b := &sqlBackend{
+		db:                   db,
+		numberedPlaceholders: driverName == "postgres" || driverName == "pgx",
+	}
+
+	err := b.migrate()
+	if err != nil {
+		return nil, fmt.Errorf("cannot migrate schema: %v", err)
+	}
+
+	return b, nil
+}
+
+// query rewrites the placeholders of `q` for the driver.
+func (b *sqlBackend) query(q string) string {
+	if !b.numberedPlaceholders {
+		return q
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// schemaVersion returns the number of migrations which were applied.
+func (b *sqlBackend) schemaVersion() (int, error) {
+	_, err := b.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL)`)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := b.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	version := 0
+	for rows.Next() {
+		var v int
+		err = rows.Scan(&v)
+		if err != nil {
+			return 0, err
+		}
+		if v > version {
+			version = v
+		}
+	}
+	return version, rows.Err()
+}
+
+// migrate applies the migrations which were not applied yet, each in its
+// own transaction.
+func (b *sqlBackend) migrate() error {
+	version, err := b.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(sqlMigrations) {
+		return fmt.Errorf("schema version %d is newer than this version of osbuild-composer supports (%d)", version, len(sqlMigrations))
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		err = b.transaction(func(tx *sql.Tx) error {
+			for _, statement := range sqlMigrations[i] {
+				_, err := tx.Exec(statement)
+				if err != nil {
+					return fmt.Errorf("migration %d: %v", i+1, err)
+				}
+			}
+			_, err := tx.Exec(b.query(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *sqlBackend) load() (storeV0, error) {
+	state := storeV0{
+		Blueprints:     make(blueprintsV0),
+		Workspace:      make(workspaceV0),
+		Composes:       make(composesV0),
+		Sources:        make(sourcesV0),
+		Changes:        make(changesV0),
+		Commits:        make(commitsV0),
+		UploadProfiles: make(uploadProfilesV0),
+		Webhooks:       make(webhooksV0),
+		Schedules:      make(schedulesV0),
+	}
+
+	err := b.loadJSON(`SELECT id, blueprint FROM blueprints`, func(id string, data []byte) error {
+		var bp blueprint.Blueprint
+		err := json.Unmarshal(data, &bp)
+		state.Blueprints[id] = bp
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadJSON(`SELECT id, blueprint FROM workspace`, func(id string, data []byte) error {
+		var bp blueprint.Blueprint
+		err := json.Unmarshal(data, &bp)
+		state.Workspace[id] = bp
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadChanges(&state)
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadJSON(`SELECT id, source FROM sources`, func(id string, data []byte) error {
+		var source sourceV0
+		err := json.Unmarshal(data, &source)
+		state.Sources[id] = source
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadJSON(`SELECT id, compose FROM composes`, func(id string, data []byte) error {
+		composeID, err := uuid.Parse(id)
+		if err != nil {
+			return err
+		}
+		var compose composeV0
+		err = json.Unmarshal(data, &compose)
+		state.Composes[composeID] = compose
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadJSON(`SELECT id, webhook FROM webhooks`, func(id string, data []byte) error {
+		webhookID, err := uuid.Parse(id)
+		if err != nil {
+			return err
+		}
+		var webhook webhookV0
+		err = json.Unmarshal(data, &webhook)
+		state.Webhooks[webhookID] = webhook
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	err = b.loadJSON(`SELECT id, schedule FROM schedules`, func(id string, data []byte) error {
+		scheduleID, err := uuid.Parse(id)
+		if err != nil {
+			return err
+		}
+		var schedule scheduleV0
+		err = json.Unmarshal(data, &schedule)
+		state.Schedules[scheduleID] = schedule
+		return err
+	})
+	if err != nil {
+		return state, err
+	}
+
+	rows, err := b.db.Query(`SELECT provider, name, settings FROM upload_profiles`)
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var provider, name, settings string
+		err = rows.Scan(&provider, &name, &settings)
+		if err != nil {
+			return state, err
+		}
+		if state.UploadProfiles[provider] == nil {
+			state.UploadProfiles[provider] = make(map[string]json.RawMessage)
+		}
+		state.UploadProfiles[provider][name] = json.RawMessage(settings)
+	}
+
+	return state, rows.Err()
+}
+
+// loadJSON calls `f` with the id and JSON document of every row returned by
+// query `q`.
+func (b *sqlBackend) loadJSON(q string, f func(id string, data []byte) error) error {
+	rows, err := b.db.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return err
+		}
+		err = f(id, []byte(data))
+		if err != nil {
+			return fmt.Errorf("invalid record %s: %v", id, err)
+		}
+	}
+	return rows.Err()
+}
+
+func (b *sqlBackend) loadChanges(state *storeV0) error {
+	rows, err := b.db.Query(`SELECT id, seq, commit_id, message, revision, created, blueprint FROM blueprint_changes`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type row struct {
+		seq    int
+		change changeV0
+	}
+	changes := make(map[string][]row)
+
+	for rows.Next() {
+		var id string
+		var r row
+		var revision sql.NullInt64
+		var bp sql.NullString
+		err = rows.Scan(&id, &r.seq, &r.change.Commit, &r.change.Message, &revision, &r.change.Timestamp, &bp)
+		if err != nil {
+			return err
+		}
+		if revision.Valid {
+			rev := int(revision.Int64)
+			r.change.Revision = &rev
+		}
+		if bp.Valid {
+			r.change.Blueprint = &blueprint.Blueprint{}
+			err = json.Unmarshal([]byte(bp.String), r.change.Blueprint)
+			if err != nil {
+				return fmt.Errorf("cannot decode blueprint of change %s of %s: %v", r.change.Commit, id, err)
+			}
+		}
+		changes[id] = append(changes[id], r)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, rs := range changes {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].seq < rs[j].seq })
+		state.Changes[id] = make(map[string]changeV0)
+		for _, r := range rs {
+			state.Changes[id][r.change.Commit] = r.change
+			state.Commits[id] = append(state.Commits[id], r.change.Commit)
+		}
+	}
+
+	return nil
+}
+
+func (b *sqlBackend) save(s *Store, changed *changeSet) error {
+	if changed.empty() {
+		return nil
+	}
+
+	return b.transaction(func(tx *sql.Tx) error {
+		return b.saveChanges(tx, s, changed)
+	})
+}
+
+func (b *sqlBackend) replace(state *storeV0) error {
+	return b.transaction(func(tx *sql.Tx) error {
+		for _, table := range sqlTables {
+			_, err := tx.Exec(`DELETE FROM ` + table)
+			if err != nil {
+				return err
+			}
+		}
+		return b.saveV0(tx, state)
+	})
+}
+
+// transaction calls `f` in a transaction, which is committed if `f`
+// succeeds and rolled back otherwise.
+func (b *sqlBackend) transaction(f func(tx *sql.Tx) error) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveChanges replaces the rows of the records in `changed` with the records
+// in `s`, or deletes them when they don't exist anymore.
+func (b *sqlBackend) saveChanges(tx *sql.Tx, s *Store, changed *changeSet) error {
+	for key := range changed.blueprints {
+		err := b.delete(tx, "blueprints", key)
+		if err != nil {
+			return err
+		}
+		if bp, exists := s.blueprints[key]; exists {
+			err = b.insertJSON(tx, "blueprints", "blueprint", key, bp)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = b.delete(tx, "workspace", key)
+		if err != nil {
+			return err
+		}
+		if bp, exists := s.workspace[key]; exists {
+			err = b.insertJSON(tx, "workspace", "blueprint", key, bp)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = b.delete(tx, "blueprint_changes", key)
+		if err != nil {
+			return err
+		}
+		changes := newChangesV0(map[string]map[string]blueprint.Change{key: s.blueprintsChanges[key]})
+		err = b.insertChanges(tx, key, s.blueprintsCommits[key], changes[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	for key := range changed.sources {
+		err := b.delete(tx, "sources", key)
+		if err != nil {
+			return err
+		}
+		if source, exists := s.sources[key]; exists {
+			err = b.insertJSON(tx, "sources", "source", key, sourceV0(source))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for id := range changed.composes {
+		err := b.delete(tx, "composes", id.String())
+		if err != nil {
+			return err
+		}
+		if compose, exists := s.composes[id]; exists {
+			err = b.insertCompose(tx, id, newComposeV0(compose))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for key := range changed.uploadProfiles {
+		provider, name := key[0], key[1]
+		_, err := tx.Exec(b.query(`DELETE FROM upload_profiles WHERE provider = ? AND name = ?`), provider, name)
+		if err != nil {
+			return err
+		}
+		if settings, exists := s.uploadProfiles[provider][name]; exists {
+			err = b.insertUploadProfile(tx, provider, name, settings)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for id := range changed.webhooks {
+		err := b.delete(tx, "webhooks", id.String())
+		if err != nil {
+			return err
+		}
+		if webhook, exists := s.webhooks[id]; exists {
+			record := webhookV0{Namespace: webhook.Namespace, URL: webhook.URL, Secret: webhook.Secret, Events: webhook.Events}
+			err = b.insertJSON(tx, "webhooks", "webhook", id.String(), record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for id := range changed.schedules {
+		err := b.delete(tx, "schedules", id.String())
+		if err != nil {
+			return err
+		}
+		if schedule, exists := s.schedules[id]; exists {
+			err = b.insertJSON(tx, "schedules", "schedule", id.String(), newScheduleV0(schedule))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// saveV0 inserts all records of `state` into the empty tables.
+func (b *sqlBackend) saveV0(tx *sql.Tx, state *storeV0) error {
+	for key, bp := range state.Blueprints {
+		err := b.insertJSON(tx, "blueprints", "blueprint", key, bp)
+		if err != nil {
+			return err
+		}
+	}
+	for key, bp := range state.Workspace {
+		err := b.insertJSON(tx, "workspace", "blueprint", key, bp)
+		if err != nil {
+			return err
+		}
+	}
+
+	// commits are derived from the changes for old states, like when
+	// loading them
+	commits := newCommitsFromV0(state.Commits, state.Changes)
+	for key, changes := range state.Changes {
+		err := b.insertChanges(tx, key, commits[key], changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, source := range state.Sources {
+		err := b.insertJSON(tx, "sources", "source", key, source)
+		if err != nil {
+			return err
+		}
+	}
+	for id, compose := range state.Composes {
+		err := b.insertCompose(tx, id, compose)
+		if err != nil {
+			return err
+		}
+	}
+	for provider, profiles := range state.UploadProfiles {
+		for name, settings := range profiles {
+			err := b.insertUploadProfile(tx, provider, name, settings)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id, webhook := range state.Webhooks {
+		err := b.insertJSON(tx, "webhooks", "webhook", id.String(), webhook)
+		if err != nil {
+			return err
+		}
+	}
+	for id, schedule := range state.Schedules {
+		err := b.insertJSON(tx, "schedules", "schedule", id.String(), schedule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// delete deletes the rows with `id` from `table`.
+func (b *sqlBackend) delete(tx *sql.Tx, table, id string) error {
+	_, err := tx.Exec(b.query(`DELETE FROM `+table+` WHERE id = ?`), id)
+	return err
+}
+
+// insertJSON inserts `record` as row `id` of `table`, as JSON in `column`.
+func (b *sqlBackend) insertJSON(tx *sql.Tx, table, column, id string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(b.query(`INSERT INTO `+table+` (id, `+column+`) VALUES (?, ?)`), id, string(data))
+	return err
+}
+
+// insertChanges inserts the history of the blueprint with key `key`, in the
+// order of `commits`.
+func (b *sqlBackend) insertChanges(tx *sql.Tx, key string, commits []string, changes map[string]changeV0) error {
+	for seq, commit := range commits {
+		change, exists := changes[commit]
+		if !exists {
+			continue
+		}
+		var revision sql.NullInt64
+		if change.Revision != nil {
+			revision = sql.NullInt64{Int64: int64(*change.Revision), Valid: true}
+		}
+		var bp sql.NullString
+		if change.Blueprint != nil {
+			data, err := json.Marshal(change.Blueprint)
+			if err != nil {
+				return err
+			}
+			bp = sql.NullString{String: string(data), Valid: true}
+		}
+		_, err := tx.Exec(b.query(`INSERT INTO blueprint_changes (id, seq, commit_id, message, revision, created, blueprint) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			key, seq, change.Commit, change.Message, revision, change.Timestamp, bp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *sqlBackend) insertCompose(tx *sql.Tx, id uuid.UUID, compose composeV0) error {
+	data, err := json.Marshal(compose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(b.query(`INSERT INTO composes (id, namespace, compose) VALUES (?, ?, ?)`), id.String(), compose.Namespace, string(data))
+	return err
+}
+
+func (b *sqlBackend) insertUploadProfile(tx *sql.Tx, provider, name string, settings json.RawMessage) error {
+	_, err := tx.Exec(b.query(`INSERT INTO upload_profiles (provider, name, settings) VALUES (?, ?, ?)`), provider, name, string(settings))
+	return err
+}
+
+// MigrateJSONToSQL moves the state in `state.json` in `stateDir` to
+// `backend`, which must have been returned by NewSQLBackend, if there is such
+// a state and the database is empty. The state file is renamed to
+// `state.json.migrated` afterwards, so that it is only migrated once. It
+// returns whether the state was migrated.
+//
+// Records are moved as they are, so that composes whose image types are not
+// supported by the host's architecture are kept.
+func MigrateJSONToSQL(stateDir string, backend Backend) (bool, error) {
+	b, ok := backend.(*sqlBackend)
+	if !ok {
+		return false, fmt.Errorf("not an SQL backend")
+	}
+
+	stateFile := path.Join(stateDir, StoreDBName+".json")
+	if _, err := os.Stat(stateFile); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	state, err := NewJSONBackend(stateDir).load()
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := b.load()
+	if err != nil {
+		return false, err
+	}
+	if !allChanged(&existing).empty() {
+		return false, fmt.Errorf("cannot migrate %s, the database already contains a state", stateFile)
+	}
+
+	err = b.transaction(func(tx *sql.Tx) error {
+		return b.saveV0(tx, &state)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(stateFile, stateFile+".migrated")
+}
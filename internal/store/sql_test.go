@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+// openSQLiteDB returns a new SQLite database in `dir`. It is limited to one
+// connection, so that tests can count the rows their changes touch.
+func openSQLiteDB(t *testing.T, dir string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path.Join(dir, "state.db"))
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// changedRows returns the number of rows which were inserted, updated or
+// deleted through the connection of `db`.
+func changedRows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT total_changes()`).Scan(&n))
+	return n
+}
+
+func newSQLTestStore(t *testing.T, db *sql.DB, arch distro.Arch) *Store {
+	t.Helper()
+	backend, err := NewSQLBackend(db, "sqlite3")
+	require.NoError(t, err)
+	s, err := NewWithBackend(backend, arch, nil)
+	require.NoError(t, err)
+	return s
+}
+
+// fillStore adds a record of every kind to `s`.
+func fillStore(t *testing.T, s *Store, arch distro.Arch) {
+	t.Helper()
+
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprint(bp, "first"))
+	require.NoError(t, s.PushBlueprint(bp, "second"))
+	require.NoError(t, s.TagBlueprint("test"))
+	require.NoError(t, s.PushBlueprintToWorkspace(blueprint.Blueprint{Name: "test", Version: "0.0.3"}))
+	require.NoError(t, s.Namespace("team").PushBlueprint(bp, "team"))
+	require.NoError(t, s.PushBlueprintToWorkspace(blueprint.Blueprint{Name: "draft", Version: "0.1.0"}))
+
+	s.PushSource("repo", SourceConfig{Name: "repo", Type: "yum-baseurl", URL: "https://example.com/repo"})
+	s.PushUploadProfile("aws", "prod", json.RawMessage(`{"region":"far-away-1"}`))
+	s.PushWebhook(Webhook{ID: uuid.New(), URL: "https://example.com/hook", Events: []string{"compose"}})
+	s.Namespace("team").PushSchedule(Schedule{
+		ID:         uuid.New(),
+		Blueprint:  "test",
+		ImageTypes: []string{"test_type"},
+		Cron:       "@daily",
+		OnChange:   true,
+		Created:    time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	imageType, err := arch.GetImageType("test_type")
+	require.NoError(t, err)
+	require.NoError(t, s.PushCompose(uuid.New(), &bp, []ImageBuild{{ImageType: imageType, JobID: uuid.New()}}))
+}
+
+// requireSameState asserts that `loaded` has the state of `s`, as it would be
+// after writing it to and reading it from a JSON document.
+func requireSameState(t *testing.T, s, loaded *Store, arch distro.Arch) {
+	t.Helper()
+	data, err := json.Marshal(s.toStoreV0())
+	require.NoError(t, err)
+	var state storeV0
+	require.NoError(t, json.Unmarshal(data, &state))
+	require.Equal(t, newStoreFromV0(state, arch, nil).toStoreV0(), loaded.toStoreV0())
+}
+
+func TestSQLBackend(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openSQLiteDB(t, dir)
+	defer db.Close()
+	s := newSQLTestStore(t, db, arch)
+	fillStore(t, s, arch)
+
+	// a new store sees the same state, including the blueprints of changes
+	loaded := newSQLTestStore(t, db, arch)
+	requireSameState(t, s, loaded, arch)
+	changes := loaded.GetBlueprintChanges("test")
+	bp, err := loaded.GetBlueprintAtCommit("test", changes[0].Commit)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.1", bp.Version)
+
+	// deletions delete rows
+	require.NoError(t, s.DeleteBlueprint("test"))
+	require.NoError(t, s.DeleteBlueprintFromWorkspace("draft"))
+	s.DeleteSourceByID("repo")
+	require.NoError(t, s.DeleteUploadProfile("aws", "prod"))
+	for _, webhook := range s.GetAllWebhooks() {
+		require.NoError(t, s.DeleteWebhook(webhook.ID))
+	}
+	for id := range s.GetAllComposes() {
+		require.NoError(t, s.DeleteCompose(id))
+	}
+	for _, schedule := range s.GetAllSchedules() {
+		require.NoError(t, s.DeleteSchedule(schedule.ID))
+	}
+
+	loaded = newSQLTestStore(t, db, arch)
+	requireSameState(t, s, loaded, arch)
+	require.Nil(t, loaded.GetBlueprintCommitted("test"))
+	require.Len(t, loaded.GetBlueprintChanges("test"), 2)
+	require.Empty(t, loaded.GetAllComposes())
+	require.Empty(t, loaded.GetAllWebhooks())
+	require.Empty(t, loaded.GetAllSchedules())
+}
+
+func TestSQLBackendWritesChangedRecords(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openSQLiteDB(t, dir)
+	defer db.Close()
+	s := newSQLTestStore(t, db, arch)
+	for i := 0; i < 20; i++ {
+		fillStore(t, s.Namespace("ns"+string(rune('a'+i))), arch)
+	}
+
+	// a source is replaced by deleting and inserting its row, regardless
+	// of how large the state is
+	changed := changedRows(t, db)
+	s.Namespace("nsa").PushSource("repo", SourceConfig{Name: "repo", URL: "https://example.com/other"})
+	require.Equal(t, 2, changedRows(t, db)-changed)
+
+	// deleting a blueprint which doesn't exist touches no rows
+	changed = changedRows(t, db)
+	require.Error(t, s.DeleteBlueprint("unknown"))
+	require.Equal(t, 0, changedRows(t, db)-changed)
+
+	// deleting a blueprint deletes its row and that of its workspace copy,
+	// and rewrites the rows of its two changes, which are kept
+	changed = changedRows(t, db)
+	require.NoError(t, s.Namespace("nsa").DeleteBlueprint("test"))
+	require.Equal(t, 6, changedRows(t, db)-changed)
+}
+
+func TestSQLBackendRollback(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openSQLiteDB(t, dir)
+	defer db.Close()
+	s := newSQLTestStore(t, db, arch)
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.1"}, "first"))
+
+	// the history is written after the blueprint, failing to write it
+	// rolls back the blueprint as well
+	_, err = db.Exec(`CREATE TRIGGER fail BEFORE INSERT ON blueprint_changes BEGIN SELECT RAISE(FAIL, 'cannot write'); END`)
+	require.NoError(t, err)
+	require.Panics(t, func() {
+		_ = s.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "1.0.0"}, "second")
+	})
+	_, err = db.Exec(`DROP TRIGGER fail`)
+	require.NoError(t, err)
+
+	loaded := newSQLTestStore(t, db, arch)
+	require.Equal(t, "0.0.1", loaded.GetBlueprintCommitted("test").Version)
+	require.Len(t, loaded.GetBlueprintChanges("test"), 1)
+}
+
+func TestSQLBackendMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openSQLiteDB(t, dir)
+	defer db.Close()
+
+	backend, err := NewSQLBackend(db, "sqlite3")
+	require.NoError(t, err)
+	version, err := backend.(*sqlBackend).schemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, len(sqlMigrations), version)
+
+	// migrations are applied once
+	_, err = NewSQLBackend(db, "sqlite3")
+	require.NoError(t, err)
+
+	// a newer schema is refused
+	_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, len(sqlMigrations)+1)
+	require.NoError(t, err)
+	_, err = NewSQLBackend(db, "sqlite3")
+	require.Error(t, err)
+}
+
+func TestSQLPlaceholders(t *testing.T) {
+	b := &sqlBackend{numberedPlaceholders: true}
+	require.Equal(t, `DELETE FROM t WHERE a = $1 AND b = $2`, b.query(`DELETE FROM t WHERE a = ? AND b = ?`))
+	b = &sqlBackend{}
+	require.Equal(t, `DELETE FROM t WHERE a = ?`, b.query(`DELETE FROM t WHERE a = ?`))
+}
+
+func TestMigrateJSONToSQL(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "osbuild-composer-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openSQLiteDB(t, dir)
+	defer db.Close()
+	backend, err := NewSQLBackend(db, "sqlite3")
+	require.NoError(t, err)
+
+	// nothing to migrate
+	migrated, err := MigrateJSONToSQL(dir, backend)
+	require.NoError(t, err)
+	require.False(t, migrated)
+
+	jsonStore := New(&dir, arch, nil)
+	fillStore(t, jsonStore, arch)
+
+	migrated, err = MigrateJSONToSQL(dir, backend)
+	require.NoError(t, err)
+	require.True(t, migrated)
+
+	_, err = os.Stat(path.Join(dir, "state.json"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dir, "state.json.migrated"))
+	require.NoError(t, err)
+
+	s, err := NewWithBackend(backend, arch, nil)
+	require.NoError(t, err)
+	requireSameState(t, jsonStore, s, arch)
+
+	// a state is not migrated into a database which has one
+	require.NoError(t, os.Rename(path.Join(dir, "state.json.migrated"), path.Join(dir, "state.json")))
+	_, err = MigrateJSONToSQL(dir, backend)
+	require.Error(t, err)
+}
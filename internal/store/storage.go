@@ -0,0 +1,58 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// StorageConfig is the format of the optional configuration of where the
+// state of the store is kept. It is shared by osbuild-composer and the tools
+// which work on its state.
+type StorageConfig struct {
+	// the SQL database to keep the state in, state.json by default
+	SQL struct {
+		// name of a database/sql driver which is linked into the program
+		Driver string `toml:"driver"`
+		DSN    string `toml:"dsn"`
+	} `toml:"sql"`
+}
+
+// LoadStorageConfig reads the storage configuration from `path`. It returns
+// an empty configuration when the file doesn't exist.
+func LoadStorageConfig(path string) (*StorageConfig, error) {
+	var config StorageConfig
+	_, err := toml.DecodeFile(path, &config)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Backend returns the backend the store keeps its state in. When an SQL
+// database is configured, the state in `stateDir` is migrated to it first,
+// and `migrated` is whether there was such a state.
+func (c *StorageConfig) Backend(stateDir string) (backend Backend, migrated bool, err error) {
+	if c.SQL.Driver == "" {
+		return NewJSONBackend(stateDir), false, nil
+	}
+
+	db, err := sql.Open(c.SQL.Driver, c.SQL.DSN)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot open database: %v", err)
+	}
+
+	backend, err = NewSQLBackend(db, c.SQL.Driver)
+	if err != nil {
+		return nil, false, err
+	}
+
+	migrated, err = MigrateJSONToSQL(stateDir, backend)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot migrate state to the database: %v", err)
+	}
+
+	return backend, migrated, nil
+}
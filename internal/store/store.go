@@ -6,15 +6,17 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/osbuild/osbuild-composer/internal/distro"
-	"github.com/osbuild/osbuild-composer/internal/jsondb"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
@@ -29,6 +31,11 @@ const StoreDBName = "state"
 
 // A Store contains all the persistent state of osbuild-composer, and is serialized
 // on every change, and deserialized on start.
+//
+// Blueprints, sources and composes belong to namespaces, so that several
+// tenants can share one store. The store returned by New works on blueprints
+// and sources of the default namespace, but on the composes of all
+// namespaces. Use Namespace() to get a view restricted to one namespace.
 type Store struct {
 	blueprints        map[string]blueprint.Blueprint
 	workspace         map[string]blueprint.Blueprint
@@ -36,12 +43,33 @@ type Store struct {
 	sources           map[string]SourceConfig
 	blueprintsChanges map[string]map[string]blueprint.Change
 	blueprintsCommits map[string][]string
+	uploadProfiles    map[string]map[string]json.RawMessage
+	webhooks          map[uuid.UUID]Webhook
+	schedules         map[uuid.UUID]Schedule
+	quotas            map[string]Quota
 
-	mu       sync.RWMutex // protects all fields
+	mu       *sync.RWMutex // protects all fields, shared by all views
 	stateDir *string
-	db       *jsondb.JSONDatabase
+	backend  Backend        // optional, persists the state
+	changed  *changeSet     // records changed since the last save, shared by all views
+	repo     *GitRepository // optional, records the history of blueprints
+
+	// the namespace of this view, and whether composes are restricted to it
+	namespace string
+	scoped    bool
+
+	blueprintChangeHandlers []BlueprintChangeHandler
+	composeChangeHandlers   []ComposeChangeHandler
 }
 
+// A BlueprintChangeHandler is called after the blueprint with the given name
+// in the given namespace was changed, committed, tagged, or deleted.
+type BlueprintChangeHandler func(namespace, name string)
+
+// A ComposeChangeHandler is called after the compose with the given id was
+// added, changed, or deleted.
+type ComposeChangeHandler func(id uuid.UUID)
+
 type SourceConfig struct {
 	Name     string `json:"name" toml:"name"`
 	Type     string `json:"type" toml:"type"`
@@ -51,6 +79,59 @@ type SourceConfig struct {
 	System   bool   `json:"system" toml:"system"`
 }
 
+// A Webhook is notified about the events in Events of its namespace, or
+// about all events of its namespace if Events is empty. Notifications are
+// signed with Secret.
+type Webhook struct {
+	ID        uuid.UUID
+	Namespace string
+	URL       string
+	Secret    string
+	Events    []string
+}
+
+// A Schedule composes a blueprint of a namespace automatically. With Cron, a
+// cron expression, it composes at the times of the expression. With OnChange,
+// it only composes when the packages the blueprint depsolves to differ from
+// those of its last compose; without Cron, this is checked whenever the
+// scheduler runs.
+type Schedule struct {
+	ID         uuid.UUID
+	Namespace  string
+	Blueprint  string
+	ImageTypes []string
+	// Upload is the upload request of the composes, as accepted by the
+	// compose API, or nil
+	Upload   json.RawMessage
+	Cron     string
+	OnChange bool
+
+	Created time.Time
+	// LastChecked is when the scheduler last ran the schedule, and
+	// LastCompose the compose it started last, or uuid.Nil
+	LastChecked time.Time
+	LastCompose uuid.UUID
+}
+
+func (schedule Schedule) deepCopy() Schedule {
+	schedule.ImageTypes = append([]string(nil), schedule.ImageTypes...)
+	if schedule.Upload != nil {
+		schedule.Upload = append(json.RawMessage(nil), schedule.Upload...)
+	}
+	return schedule
+}
+
+// A Quota limits the number of blueprints and composes of a namespace. Zero
+// means unlimited.
+type Quota struct {
+	Blueprints int
+	Composes   int
+}
+
+// ValidNamespace matches the names of namespaces. The default namespace is
+// the empty string.
+var ValidNamespace = regexp.MustCompile(`^[a-zA-Z0-9._-]*$`)
+
 type NotFoundError struct {
 	message string
 }
@@ -67,13 +148,23 @@ func (e *NoLocalTargetError) Error() string {
 	return e.message
 }
 
+// A QuotaExceededError is returned when a namespace would exceed its quota.
+type QuotaExceededError struct {
+	message string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.message
+}
+
 func New(stateDir *string, arch distro.Arch, log *log.Logger) *Store {
 	var storeStruct storeV0
-	var db *jsondb.JSONDatabase
+	var backend Backend
 
 	if stateDir != nil {
-		db = jsondb.New(*stateDir, 0600)
-		_, err := db.Read(StoreDBName, &storeStruct)
+		backend = NewJSONBackend(*stateDir)
+		var err error
+		storeStruct, err = backend.load()
 		if err != nil && log != nil {
 			log.Fatalf("cannot read state: %v", err)
 		}
@@ -82,11 +173,142 @@ func New(stateDir *string, arch distro.Arch, log *log.Logger) *Store {
 	store := newStoreFromV0(storeStruct, arch, log)
 
 	store.stateDir = stateDir
-	store.db = db
+	store.backend = backend
 
 	return store
 }
 
+// NewWithBackend returns a store which loads its state from `backend` and
+// persists all changes to it.
+func NewWithBackend(backend Backend, arch distro.Arch, log *log.Logger) (*Store, error) {
+	storeStruct, err := backend.load()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state: %v", err)
+	}
+
+	store := newStoreFromV0(storeStruct, arch, log)
+	store.backend = backend
+
+	return store, nil
+}
+
+// Namespace returns a view of the store which only contains the blueprints,
+// sources and composes of namespace `name`. It panics if `name` is invalid.
+func (s *Store) Namespace(name string) *Store {
+	if !ValidNamespace.MatchString(name) {
+		panic("invalid namespace: " + name)
+	}
+
+	view := *s
+	view.namespace = name
+	view.scoped = true
+	return &view
+}
+
+// NamespaceName returns the name of the namespace of this view.
+func (s *Store) NamespaceName() string {
+	return s.namespace
+}
+
+// key returns the key under which the blueprint or source `name` of this
+// view's namespace is stored. Keys of the default namespace are the plain
+// names, so that state written before namespaces existed stays valid.
+func (s *Store) key(name string) string {
+	if s.namespace == "" {
+		return name
+	}
+	return s.namespace + "/" + name
+}
+
+// nameOf returns the name of the blueprint or source stored under `key`,
+// and whether it belongs to this view's namespace.
+func (s *Store) nameOf(key string) (string, bool) {
+	namespace, name := splitKey(key)
+	return name, namespace == s.namespace
+}
+
+// splitKey returns the namespace and name of the blueprint or source stored
+// under `key`.
+func splitKey(key string) (string, string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// owns returns whether `compose` is visible in this view.
+func (s *Store) owns(compose Compose) bool {
+	return !s.scoped || compose.Namespace == s.namespace
+}
+
+// SetQuota sets the quota of namespace `namespace`. Quotas are
+// configuration and not persisted.
+func (s *Store) SetQuota(namespace string, quota Quota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotas[namespace] = quota
+}
+
+// GetQuota returns the quota of this view's namespace.
+func (s *Store) GetQuota() Quota {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.quotas[s.namespace]
+}
+
+// checkBlueprintQuota returns an error if adding blueprint `name` would
+// exceed the quota of this view's namespace. It must be called with the
+// lock held.
+func (s *Store) checkBlueprintQuota(name string) error {
+	limit := s.quotas[s.namespace].Blueprints
+	if limit == 0 {
+		return nil
+	}
+
+	key := s.key(name)
+	if _, exists := s.blueprints[key]; exists {
+		return nil
+	}
+	if _, exists := s.workspace[key]; exists {
+		return nil
+	}
+
+	if len(s.blueprintNames()) >= limit {
+		return &QuotaExceededError{fmt.Sprintf("namespace has reached its quota of %d blueprints", limit)}
+	}
+	return nil
+}
+
+// CheckComposeQuota returns an error if adding a compose would exceed the
+// quota of this view's namespace.
+func (s *Store) CheckComposeQuota() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.checkComposeQuota()
+}
+
+func (s *Store) checkComposeQuota() error {
+	limit := s.quotas[s.namespace].Composes
+	if limit == 0 {
+		return nil
+	}
+
+	count := 0
+	for _, compose := range s.composes {
+		if compose.Namespace == s.namespace {
+			count++
+		}
+	}
+
+	if count >= limit {
+		return &QuotaExceededError{fmt.Sprintf("namespace has reached its quota of %d composes", limit)}
+	}
+	return nil
+}
+
 func randomSHA1String() (string, error) {
 	hash := sha1.New()
 	data := make([]byte, 20)
@@ -109,37 +331,178 @@ func (s *Store) change(f func() error) error {
 
 	result := f()
 
-	if s.stateDir != nil {
-		err := s.db.Write(StoreDBName, s.toStoreV0())
+	if s.backend != nil {
+		err := s.backend.save(s, s.changed)
 		if err != nil {
 			panic(err)
 		}
 	}
+	s.changed.reset()
 
 	return result
 }
 
+// changeBlueprint is like change, but also calls the blueprint change
+// handlers for `name` when `f` succeeded.
+func (s *Store) changeBlueprint(name string, f func() error) error {
+	err := s.change(func() error {
+		s.changed.blueprints[s.key(name)] = true
+		return f()
+	})
+	if err == nil {
+		for _, handler := range s.blueprintChangeHandlers {
+			handler(s.namespace, name)
+		}
+	}
+	return err
+}
+
+// changeCompose is like change, but also calls the compose change handlers
+// for `id` when `f` succeeded.
+func (s *Store) changeCompose(id uuid.UUID, f func() error) error {
+	err := s.change(func() error {
+		s.changed.composes[id] = true
+		return f()
+	})
+	if err == nil {
+		for _, handler := range s.composeChangeHandlers {
+			handler(id)
+		}
+	}
+	return err
+}
+
+// SetGitRepository makes the store record the history of blueprints in
+// `repo`, so that commits of blueprints are git commits. Blueprints which were
+// committed before are added to the repository when they are committed
+// again. It must be called before the store is used concurrently.
+func (s *Store) SetGitRepository(repo *GitRepository) {
+	s.repo = repo
+}
+
+// SyncBlueprints imports the blueprints changed in the remote of the git
+// repository into the store, and pushes the commits made by the store to the
+// remote. Imported blueprints replace the committed blueprints of the store,
+// but not those in the workspace. It does nothing if the store has no git
+// repository.
+func (s *Store) SyncBlueprints() error {
+	if s.repo == nil {
+		return nil
+	}
+
+	err := s.repo.fetch()
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	err = s.change(func() error {
+		changes, err := s.repo.merge()
+		if err != nil {
+			return err
+		}
+
+		for _, change := range changes {
+			s.importBlueprintChange(change)
+			s.changed.blueprints[change.key] = true
+			changed = append(changed, change.key)
+		}
+		return nil
+	})
+
+	for _, key := range changed {
+		namespace, name := splitKey(key)
+		for _, handler := range s.blueprintChangeHandlers {
+			handler(namespace, name)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.repo.push()
+}
+
+// importBlueprintChange records a change pulled from the remote of the git
+// repository. It must be called with the lock held.
+func (s *Store) importBlueprintChange(c gitChange) {
+	if c.blueprint == nil {
+		delete(s.blueprints, c.key)
+		return
+	}
+
+	change := blueprint.Change{
+		Commit:    c.commit,
+		Message:   c.message,
+		Timestamp: c.timestamp.Format("2006-01-02T15:04:05Z"),
+		Blueprint: *c.blueprint,
+	}
+
+	if s.blueprintsChanges[c.key] == nil {
+		s.blueprintsChanges[c.key] = make(map[string]blueprint.Change)
+	}
+	if _, exists := s.blueprintsChanges[c.key][c.commit]; !exists {
+		s.blueprintsCommits[c.key] = append(s.blueprintsCommits[c.key], c.commit)
+	}
+	s.blueprintsChanges[c.key][c.commit] = change
+	s.blueprints[c.key] = *c.blueprint
+}
+
+// OnBlueprintChange registers `handler` to be called whenever a blueprint
+// changes. Handlers must be registered before the store is used
+// concurrently.
+func (s *Store) OnBlueprintChange(handler BlueprintChangeHandler) {
+	s.blueprintChangeHandlers = append(s.blueprintChangeHandlers, handler)
+}
+
+// OnComposeChange registers `handler` to be called whenever a compose
+// changes. Handlers must be registered before the store is used
+// concurrently.
+func (s *Store) OnComposeChange(handler ComposeChangeHandler) {
+	s.composeChangeHandlers = append(s.composeChangeHandlers, handler)
+}
+
 func (s *Store) ListBlueprints() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	names := make([]string, 0, len(s.blueprints))
-	for name := range s.blueprints {
-		names = append(names, name)
+	for key := range s.blueprints {
+		if name, ok := s.nameOf(key); ok {
+			names = append(names, name)
+		}
 	}
 	sort.Strings(names)
 
 	return names
 }
 
+// blueprintNames returns the names of all blueprints of this view's
+// namespace, including those which only exist in the workspace.
+func (s *Store) blueprintNames() map[string]bool {
+	names := make(map[string]bool)
+	for key := range s.blueprints {
+		if name, ok := s.nameOf(key); ok {
+			names[name] = true
+		}
+	}
+	for key := range s.workspace {
+		if name, ok := s.nameOf(key); ok {
+			names[name] = true
+		}
+	}
+	return names
+}
+
 func (s *Store) GetBlueprint(name string) (*blueprint.Blueprint, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	bp, inWorkspace := s.workspace[name]
+	bp, inWorkspace := s.workspace[s.key(name)]
 	if !inWorkspace {
 		var ok bool
-		bp, ok = s.blueprints[name]
+		bp, ok = s.blueprints[s.key(name)]
 		if !ok {
 			return nil, false
 		}
@@ -152,7 +515,7 @@ func (s *Store) GetBlueprintCommitted(name string) *blueprint.Blueprint {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	bp, ok := s.blueprints[name]
+	bp, ok := s.blueprints[s.key(name)]
 	if !ok {
 		return nil
 	}
@@ -166,16 +529,40 @@ func (s *Store) GetBlueprintChange(name string, commit string) (*blueprint.Chang
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, ok := s.blueprintsChanges[name]; !ok {
+	key := s.key(name)
+	if _, ok := s.blueprintsChanges[key]; !ok {
 		return nil, errors.New("Unknown blueprint")
 	}
-	change, ok := s.blueprintsChanges[name][commit]
+	change, ok := s.blueprintsChanges[key][commit]
 	if !ok {
 		return nil, errors.New("Unknown commit")
 	}
 	return &change, nil
 }
 
+// GetBlueprintAtCommit returns a blueprint as it was committed in `commit`.
+// Changes from before their blueprints were stored are read from the git
+// repository, if there is one.
+func (s *Store) GetBlueprintAtCommit(name string, commit string) (*blueprint.Blueprint, error) {
+	change, err := s.GetBlueprintChange(name, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Blueprint.Name != "" {
+		return &change.Blueprint, nil
+	}
+
+	if s.repo != nil {
+		bp, err := s.repo.blueprintAtCommit(s.key(name), commit)
+		if err == nil {
+			return bp, nil
+		}
+	}
+
+	return nil, fmt.Errorf("The blueprint of commit %s is not known", commit)
+}
+
 // GetBlueprintChanges returns the list of changes, oldest first
 func (s *Store) GetBlueprintChanges(name string) []blueprint.Change {
 	s.mu.RLock()
@@ -183,16 +570,17 @@ func (s *Store) GetBlueprintChanges(name string) []blueprint.Change {
 
 	var changes []blueprint.Change
 
-	for _, commit := range s.blueprintsCommits[name] {
-		changes = append(changes, s.blueprintsChanges[name][commit])
+	key := s.key(name)
+	for _, commit := range s.blueprintsCommits[key] {
+		changes = append(changes, s.blueprintsChanges[key][commit])
 	}
 
 	return changes
 }
 
 func (s *Store) PushBlueprint(bp blueprint.Blueprint, commitMsg string) error {
-	return s.change(func() error {
-		commit, err := randomSHA1String()
+	return s.changeBlueprint(bp.Name, func() error {
+		err := s.checkBlueprintQuota(bp.Name)
 		if err != nil {
 			return err
 		}
@@ -203,41 +591,60 @@ func (s *Store) PushBlueprint(bp blueprint.Blueprint, commitMsg string) error {
 			return err
 		}
 
+		key := s.key(bp.Name)
+
+		committed := bp
+		if old, ok := s.blueprints[key]; ok {
+			if bp.Version == "" || bp.Version == old.Version {
+				committed.BumpVersion(old.Version)
+			}
+		}
+
+		var commit string
+		if s.repo != nil {
+			commit, err = s.repo.commitBlueprint(key, committed, commitMsg)
+		} else {
+			commit, err = randomSHA1String()
+		}
+		if err != nil {
+			return err
+		}
+
 		timestamp := time.Now().Format("2006-01-02T15:04:05Z")
 		change := blueprint.Change{
 			Commit:    commit,
 			Message:   commitMsg,
 			Timestamp: timestamp,
-			Blueprint: bp,
+			Blueprint: committed,
 		}
 
-		delete(s.workspace, bp.Name)
-		if s.blueprintsChanges[bp.Name] == nil {
-			s.blueprintsChanges[bp.Name] = make(map[string]blueprint.Change)
+		delete(s.workspace, key)
+		if s.blueprintsChanges[key] == nil {
+			s.blueprintsChanges[key] = make(map[string]blueprint.Change)
 		}
-		s.blueprintsChanges[bp.Name][commit] = change
+		s.blueprintsChanges[key][commit] = change
 		// Keep track of the order of the commits
-		s.blueprintsCommits[bp.Name] = append(s.blueprintsCommits[bp.Name], commit)
+		s.blueprintsCommits[key] = append(s.blueprintsCommits[key], commit)
 
-		if old, ok := s.blueprints[bp.Name]; ok {
-			if bp.Version == "" || bp.Version == old.Version {
-				bp.BumpVersion(old.Version)
-			}
-		}
-		s.blueprints[bp.Name] = bp
+		s.blueprints[key] = committed
 		return nil
 	})
 }
 
 func (s *Store) PushBlueprintToWorkspace(bp blueprint.Blueprint) error {
-	return s.change(func() error {
+	return s.changeBlueprint(bp.Name, func() error {
+		err := s.checkBlueprintQuota(bp.Name)
+		if err != nil {
+			return err
+		}
+
 		// Make sure the blueprint has default values and that the version is valid
-		err := bp.Initialize()
+		err = bp.Initialize()
 		if err != nil {
 			return err
 		}
 
-		s.workspace[bp.Name] = bp
+		s.workspace[s.key(bp.Name)] = bp
 		return nil
 	})
 }
@@ -246,12 +653,19 @@ func (s *Store) PushBlueprintToWorkspace(bp blueprint.Blueprint) error {
 // if the blueprint does not exist it will return an error
 // The workspace copy is deleted unconditionally, it will not return an error if it does not exist.
 func (s *Store) DeleteBlueprint(name string) error {
-	return s.change(func() error {
-		delete(s.workspace, name)
-		if _, ok := s.blueprints[name]; !ok {
+	return s.changeBlueprint(name, func() error {
+		key := s.key(name)
+		delete(s.workspace, key)
+		if _, ok := s.blueprints[key]; !ok {
 			return fmt.Errorf("Unknown blueprint: %s", name)
 		}
-		delete(s.blueprints, name)
+		if s.repo != nil {
+			err := s.repo.deleteBlueprint(key, "Recipe "+name+" deleted")
+			if err != nil {
+				return err
+			}
+		}
+		delete(s.blueprints, key)
 		return nil
 	})
 }
@@ -259,11 +673,12 @@ func (s *Store) DeleteBlueprint(name string) error {
 // DeleteBlueprintFromWorkspace deletes the workspace copy of a blueprint
 // if the blueprint doesn't exist in the workspace it returns an error
 func (s *Store) DeleteBlueprintFromWorkspace(name string) error {
-	return s.change(func() error {
-		if _, ok := s.workspace[name]; !ok {
+	return s.changeBlueprint(name, func() error {
+		key := s.key(name)
+		if _, ok := s.workspace[key]; !ok {
 			return fmt.Errorf("Unknown blueprint: %s", name)
 		}
-		delete(s.workspace, name)
+		delete(s.workspace, key)
 		return nil
 	})
 }
@@ -271,38 +686,44 @@ func (s *Store) DeleteBlueprintFromWorkspace(name string) error {
 // TagBlueprint will tag the most recent commit
 // It will return an error if the blueprint doesn't exist
 func (s *Store) TagBlueprint(name string) error {
-	return s.change(func() error {
-		_, ok := s.blueprints[name]
+	return s.changeBlueprint(name, func() error {
+		key := s.key(name)
+		_, ok := s.blueprints[key]
 		if !ok {
 			return errors.New("Unknown blueprint")
 		}
 
-		if len(s.blueprintsCommits[name]) == 0 {
+		if len(s.blueprintsCommits[key]) == 0 {
 			return errors.New("No commits for blueprint")
 		}
 
-		latest := s.blueprintsCommits[name][len(s.blueprintsCommits[name])-1]
+		latest := s.blueprintsCommits[key][len(s.blueprintsCommits[key])-1]
 		// If the most recent commit already has a revision, don't bump it
-		if s.blueprintsChanges[name][latest].Revision != nil {
+		if s.blueprintsChanges[key][latest].Revision != nil {
 			return nil
 		}
 
 		// Get the latest revision for this blueprint
 		var revision int
-		var change blueprint.Change
-		for i := len(s.blueprintsCommits[name]) - 1; i >= 0; i-- {
-			commit := s.blueprintsCommits[name][i]
-			change = s.blueprintsChanges[name][commit]
-			if change.Revision != nil && *change.Revision > revision {
-				revision = *change.Revision
+		for i := len(s.blueprintsCommits[key]) - 1; i >= 0; i-- {
+			commit := s.blueprintsCommits[key][i]
+			if r := s.blueprintsChanges[key][commit].Revision; r != nil && *r > revision {
+				revision = *r
 				break
 			}
 		}
+		change := s.blueprintsChanges[key][latest]
 
 		// Bump the revision (if there was none it will start at 1)
 		revision++
+		if s.repo != nil {
+			err := s.repo.tagBlueprint(key, latest, revision)
+			if err != nil {
+				return err
+			}
+		}
 		change.Revision = &revision
-		s.blueprintsChanges[name][latest] = change
+		s.blueprintsChanges[key][latest] = change
 		return nil
 	})
 }
@@ -312,7 +733,10 @@ func (s *Store) GetCompose(id uuid.UUID) (Compose, bool) {
 	defer s.mu.RUnlock()
 
 	compose, exists := s.composes[id]
-	return compose, exists
+	if !exists || !s.owns(compose) {
+		return Compose{}, false
+	}
+	return compose, true
 }
 
 // GetAllComposes creates a deep copy of all composes present in this store
@@ -324,6 +748,9 @@ func (s *Store) GetAllComposes() map[uuid.UUID]Compose {
 	composes := make(map[uuid.UUID]Compose)
 
 	for id, singleCompose := range s.composes {
+		if !s.owns(singleCompose) {
+			continue
+		}
 		newCompose := singleCompose.DeepCopy()
 		composes[id] = newCompose
 	}
@@ -331,41 +758,43 @@ func (s *Store) GetAllComposes() map[uuid.UUID]Compose {
 	return composes
 }
 
-func (s *Store) PushCompose(composeID uuid.UUID, manifest distro.Manifest, imageType distro.ImageType, bp *blueprint.Blueprint, size uint64, targets []*target.Target, jobId uuid.UUID) error {
+// PushCompose adds a compose which builds `imageBuilds`. The image builds
+// are numbered in order.
+func (s *Store) PushCompose(composeID uuid.UUID, bp *blueprint.Blueprint, imageBuilds []ImageBuild) error {
 	if _, exists := s.GetCompose(composeID); exists {
 		panic("a compose with this id already exists")
 	}
 
-	if targets == nil {
-		targets = []*target.Target{}
+	now := time.Now()
+	var builds []ImageBuild
+	for i, ib := range imageBuilds {
+		ib.ID = i
+		ib.JobCreated = now
+		if ib.Targets == nil {
+			ib.Targets = []*target.Target{}
+		}
+		builds = append(builds, ib)
 	}
 
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+	return s.changeCompose(composeID, func() error {
+		err := s.checkComposeQuota()
+		if err != nil {
+			return err
+		}
+
 		s.composes[composeID] = Compose{
-			Blueprint: bp,
-			ImageBuild: ImageBuild{
-				Manifest:   manifest,
-				ImageType:  imageType,
-				Targets:    targets,
-				JobCreated: time.Now(),
-				Size:       size,
-				JobID:      jobId,
-			},
+			Namespace:   s.namespace,
+			Blueprint:   bp,
+			ImageBuilds: builds,
 		}
 		return nil
 	})
-	return nil
 }
 
 // PushTestCompose is used for testing
 // Set testSuccess to create a fake successful compose, otherwise it will create a failed compose
 // It does not actually run a compose job
-func (s *Store) PushTestCompose(composeID uuid.UUID, manifest distro.Manifest, imageType distro.ImageType, bp *blueprint.Blueprint, size uint64, targets []*target.Target, testSuccess bool) error {
-	if targets == nil {
-		targets = []*target.Target{}
-	}
-
+func (s *Store) PushTestCompose(composeID uuid.UUID, bp *blueprint.Blueprint, imageBuilds []ImageBuild, testSuccess bool) error {
 	var status common.ImageBuildState
 	if testSuccess {
 		status = common.IBFinished
@@ -373,31 +802,121 @@ func (s *Store) PushTestCompose(composeID uuid.UUID, manifest distro.Manifest, i
 		status = common.IBFailed
 	}
 
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+	now := time.Now()
+	var builds []ImageBuild
+	for i, ib := range imageBuilds {
+		ib.ID = i
+		ib.QueueStatus = status
+		ib.JobCreated = now
+		ib.JobStarted = now
+		if ib.Targets == nil {
+			ib.Targets = []*target.Target{}
+		}
+		builds = append(builds, ib)
+	}
+
+	return s.changeCompose(composeID, func() error {
+		err := s.checkComposeQuota()
+		if err != nil {
+			return err
+		}
+
 		s.composes[composeID] = Compose{
-			Blueprint: bp,
-			ImageBuild: ImageBuild{
-				QueueStatus: status,
-				Manifest:    manifest,
-				ImageType:   imageType,
-				Targets:     targets,
-				JobCreated:  time.Now(),
-				JobStarted:  time.Now(),
-				Size:        size,
-			},
+			Namespace:   s.namespace,
+			Blueprint:   bp,
+			ImageBuilds: builds,
 		}
 		return nil
 	})
+}
 
-	return nil
+// changeImageBuild calls `f` with a copy of the image build `imageBuildID`
+// of the compose `id` and stores the changes `f` makes to it.
+func (s *Store) changeImageBuild(id uuid.UUID, imageBuildID int, f func(ib *ImageBuild) error) error {
+	return s.changeCompose(id, func() error {
+		compose, exists := s.composes[id]
+		if !exists || !s.owns(compose) {
+			return &NotFoundError{}
+		}
+
+		// readers may still hold the previous version of the compose
+		compose = compose.DeepCopy()
+		ib, exists := compose.GetImageBuild(imageBuildID)
+		if !exists {
+			return &NotFoundError{"image build does not exist"}
+		}
+
+		err := f(ib)
+		if err != nil {
+			return err
+		}
+
+		s.composes[id] = compose
+		return nil
+	})
+}
+
+// SetComposeTargetResults stores the results the worker reported for the
+// targets of an image build of the compose with the given id, so that they
+// outlive the job.
+func (s *Store) SetComposeTargetResults(id uuid.UUID, imageBuildID int, results []*target.TargetResult) error {
+	return s.changeImageBuild(id, imageBuildID, func(ib *ImageBuild) error {
+		ib.TargetResults = results
+		return nil
+	})
+}
+
+// PushComposeUpload makes the job `jobID` upload the image `imageBuildID` of
+// the compose with the given id to `t`. The target is added to the image
+// build, unless it already belongs to it, in which case the previous upload
+// job is replaced.
+func (s *Store) PushComposeUpload(id uuid.UUID, imageBuildID int, t *target.Target, jobID uuid.UUID) error {
+	return s.changeImageBuild(id, imageBuildID, func(ib *ImageBuild) error {
+		known := false
+		for _, existing := range ib.Targets {
+			if existing.Uuid == t.Uuid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			ib.Targets = append(ib.Targets, t)
+		}
+
+		if ib.UploadJobs == nil {
+			ib.UploadJobs = make(map[uuid.UUID]uuid.UUID)
+		}
+		ib.UploadJobs[t.Uuid] = jobID
+		delete(ib.UploadRetries, t.Uuid)
+
+		return nil
+	})
+}
+
+// RetryComposeUpload replaces the job which uploads the image `imageBuildID`
+// of the compose with the given id to the target `targetID` by `jobID`, and
+// counts that as an automatic retry. Retries are reset by PushComposeUpload.
+func (s *Store) RetryComposeUpload(id uuid.UUID, imageBuildID int, targetID uuid.UUID, jobID uuid.UUID) error {
+	return s.changeImageBuild(id, imageBuildID, func(ib *ImageBuild) error {
+		if _, exists := ib.UploadJobs[targetID]; !exists {
+			return &NotFoundError{}
+		}
+
+		if ib.UploadRetries == nil {
+			ib.UploadRetries = make(map[uuid.UUID]int)
+		}
+		ib.UploadJobs[targetID] = jobID
+		ib.UploadRetries[targetID] += 1
+
+		return nil
+	})
 }
 
 // DeleteCompose deletes the compose from the state file and also removes all files on disk that are
 // associated with this compose
 func (s *Store) DeleteCompose(id uuid.UUID) error {
-	return s.change(func() error {
-		if _, exists := s.composes[id]; !exists {
+	return s.changeCompose(id, func() error {
+		if compose, exists := s.composes[id]; !exists || !s.owns(compose) {
 			return &NotFoundError{}
 		}
 
@@ -407,11 +926,13 @@ func (s *Store) DeleteCompose(id uuid.UUID) error {
 	})
 }
 
-// PushSource stores a SourceConfig in store.Sources
+// PushSource stores a SourceConfig in store.Sources. `key` must not contain
+// a slash, which separates the namespace from the name in the stored key.
 func (s *Store) PushSource(key string, source SourceConfig) {
 	// FIXME: handle or comment this possible error
 	_ = s.change(func() error {
-		s.sources[key] = source
+		s.sources[s.key(key)] = source
+		s.changed.sources[s.key(key)] = true
 		return nil
 	})
 }
@@ -421,8 +942,9 @@ func (s *Store) DeleteSourceByName(name string) {
 	// FIXME: handle or comment this possible error
 	_ = s.change(func() error {
 		for key := range s.sources {
-			if s.sources[key].Name == name {
+			if _, ok := s.nameOf(key); ok && s.sources[key].Name == name {
 				delete(s.sources, key)
+				s.changed.sources[key] = true
 				return nil
 			}
 		}
@@ -434,7 +956,8 @@ func (s *Store) DeleteSourceByName(name string) {
 func (s *Store) DeleteSourceByID(key string) {
 	// FIXME: handle or comment this possible error
 	_ = s.change(func() error {
-		delete(s.sources, key)
+		delete(s.sources, s.key(key))
+		s.changed.sources[s.key(key)] = true
 		return nil
 	})
 }
@@ -445,8 +968,10 @@ func (s *Store) ListSourcesByName() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	names := make([]string, 0, len(s.sources))
-	for _, source := range s.sources {
-		names = append(names, source.Name)
+	for key, source := range s.sources {
+		if _, ok := s.nameOf(key); ok {
+			names = append(names, source.Name)
+		}
 	}
 	sort.Strings(names)
 
@@ -459,8 +984,10 @@ func (s *Store) ListSourcesById() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	names := make([]string, 0, len(s.sources))
-	for name := range s.sources {
-		names = append(names, name)
+	for key := range s.sources {
+		if name, ok := s.nameOf(key); ok {
+			names = append(names, name)
+		}
 	}
 	sort.Strings(names)
 
@@ -471,7 +998,7 @@ func (s *Store) GetSource(name string) *SourceConfig {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	source, ok := s.sources[name]
+	source, ok := s.sources[s.key(name)]
 	if !ok {
 		return nil
 	}
@@ -485,8 +1012,10 @@ func (s *Store) GetAllSourcesByName() map[string]SourceConfig {
 
 	sources := make(map[string]SourceConfig)
 
-	for _, v := range s.sources {
-		sources[v.Name] = v
+	for k, v := range s.sources {
+		if _, ok := s.nameOf(k); ok {
+			sources[v.Name] = v
+		}
 	}
 
 	return sources
@@ -500,7 +1029,9 @@ func (s *Store) GetAllSourcesByID() map[string]SourceConfig {
 	sources := make(map[string]SourceConfig)
 
 	for k, v := range s.sources {
-		sources[k] = v
+		if name, ok := s.nameOf(k); ok {
+			sources[name] = v
+		}
 	}
 
 	return sources
@@ -545,3 +1076,212 @@ func (s *SourceConfig) RepoConfig(name string) rpmmd.RepoConfig {
 
 	return repo
 }
+
+// GetAllUploadProfiles returns the settings of all upload profiles of this
+// view's namespace, keyed by provider and profile name.
+func (s *Store) GetAllUploadProfiles() map[string]map[string]json.RawMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	profiles := make(map[string]map[string]json.RawMessage)
+	for provider, providerProfiles := range s.uploadProfiles {
+		for key, settings := range providerProfiles {
+			name, ok := s.nameOf(key)
+			if !ok {
+				continue
+			}
+			if profiles[provider] == nil {
+				profiles[provider] = make(map[string]json.RawMessage)
+			}
+			profiles[provider][name] = settings
+		}
+	}
+
+	return profiles
+}
+
+// GetUploadProfile returns the settings of the upload profile `name` of
+// `provider` in this view's namespace.
+func (s *Store) GetUploadProfile(provider, name string) (json.RawMessage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, exists := s.uploadProfiles[provider][s.key(name)]
+	return settings, exists
+}
+
+// PushUploadProfile stores the upload profile `name` of `provider` in this
+// view's namespace, replacing a profile with the same name.
+func (s *Store) PushUploadProfile(provider, name string, settings json.RawMessage) {
+	// FIXME: handle or comment this possible error
+	_ = s.change(func() error {
+		if s.uploadProfiles[provider] == nil {
+			s.uploadProfiles[provider] = make(map[string]json.RawMessage)
+		}
+		s.uploadProfiles[provider][s.key(name)] = settings
+		s.changed.uploadProfiles[[2]string{provider, s.key(name)}] = true
+		return nil
+	})
+}
+
+// DeleteUploadProfile removes the upload profile `name` of `provider` from
+// this view's namespace.
+func (s *Store) DeleteUploadProfile(provider, name string) error {
+	return s.change(func() error {
+		if _, exists := s.uploadProfiles[provider][s.key(name)]; !exists {
+			return &NotFoundError{}
+		}
+
+		delete(s.uploadProfiles[provider], s.key(name))
+		if len(s.uploadProfiles[provider]) == 0 {
+			delete(s.uploadProfiles, provider)
+		}
+		s.changed.uploadProfiles[[2]string{provider, s.key(name)}] = true
+
+		return nil
+	})
+}
+
+// ownsWebhook returns whether `webhook` is visible in this view.
+func (s *Store) ownsWebhook(webhook Webhook) bool {
+	return !s.scoped || webhook.Namespace == s.namespace
+}
+
+// GetAllWebhooks returns the webhooks of this view's namespace, or of all
+// namespaces for the unrestricted store, sorted by their URL.
+func (s *Store) GetAllWebhooks() []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		if !s.ownsWebhook(webhook) {
+			continue
+		}
+		webhook.Events = append([]string(nil), webhook.Events...)
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].URL != webhooks[j].URL {
+			return webhooks[i].URL < webhooks[j].URL
+		}
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+
+	return webhooks
+}
+
+// PushWebhook stores `webhook` in this view's namespace, replacing the one
+// with the same ID.
+func (s *Store) PushWebhook(webhook Webhook) {
+	// FIXME: handle or comment this possible error
+	_ = s.change(func() error {
+		webhook.Events = append([]string(nil), webhook.Events...)
+		webhook.Namespace = s.namespace
+		s.webhooks[webhook.ID] = webhook
+		s.changed.webhooks[webhook.ID] = true
+		return nil
+	})
+}
+
+// DeleteWebhook removes the webhook with the given id.
+func (s *Store) DeleteWebhook(id uuid.UUID) error {
+	return s.change(func() error {
+		if webhook, exists := s.webhooks[id]; !exists || !s.ownsWebhook(webhook) {
+			return &NotFoundError{}
+		}
+
+		delete(s.webhooks, id)
+		s.changed.webhooks[id] = true
+		return nil
+	})
+}
+
+// ownsSchedule returns whether `schedule` is visible in this view.
+func (s *Store) ownsSchedule(schedule Schedule) bool {
+	return !s.scoped || schedule.Namespace == s.namespace
+}
+
+// GetAllSchedules returns the schedules of this view's namespace, or of all
+// namespaces for the unrestricted store, sorted by their blueprint.
+func (s *Store) GetAllSchedules() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := []Schedule{}
+	for _, schedule := range s.schedules {
+		if s.ownsSchedule(schedule) {
+			schedules = append(schedules, schedule.deepCopy())
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].Namespace != schedules[j].Namespace {
+			return schedules[i].Namespace < schedules[j].Namespace
+		}
+		if schedules[i].Blueprint != schedules[j].Blueprint {
+			return schedules[i].Blueprint < schedules[j].Blueprint
+		}
+		return schedules[i].ID.String() < schedules[j].ID.String()
+	})
+
+	return schedules
+}
+
+// GetSchedule returns the schedule with the given id, if it is visible in
+// this view.
+func (s *Store) GetSchedule(id uuid.UUID) (Schedule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, exists := s.schedules[id]
+	if !exists || !s.ownsSchedule(schedule) {
+		return Schedule{}, false
+	}
+	return schedule.deepCopy(), true
+}
+
+// PushSchedule stores `schedule` in this view's namespace, replacing the one
+// with the same ID.
+func (s *Store) PushSchedule(schedule Schedule) {
+	// FIXME: handle or comment this possible error
+	_ = s.change(func() error {
+		schedule = schedule.deepCopy()
+		schedule.Namespace = s.namespace
+		s.schedules[schedule.ID] = schedule
+		s.changed.schedules[schedule.ID] = true
+		return nil
+	})
+}
+
+// SetScheduleRun records that the schedule with the given id was run at
+// `checked`, and started compose `composeID`, unless it is uuid.Nil.
+func (s *Store) SetScheduleRun(id uuid.UUID, checked time.Time, composeID uuid.UUID) error {
+	return s.change(func() error {
+		schedule, exists := s.schedules[id]
+		if !exists || !s.ownsSchedule(schedule) {
+			return &NotFoundError{"schedule does not exist"}
+		}
+
+		schedule.LastChecked = checked
+		if composeID != uuid.Nil {
+			schedule.LastCompose = composeID
+		}
+		s.schedules[id] = schedule
+		s.changed.schedules[id] = true
+		return nil
+	})
+}
+
+// DeleteSchedule removes the schedule with the given id.
+func (s *Store) DeleteSchedule(id uuid.UUID) error {
+	return s.change(func() error {
+		schedule, exists := s.schedules[id]
+		if !exists || !s.ownsSchedule(schedule) {
+			return &NotFoundError{"schedule does not exist"}
+		}
+
+		delete(s.schedules, id)
+		s.changed.schedules[id] = true
+		return nil
+	})
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -57,7 +58,7 @@ func (suite *storeTest) SetupSuite() {
 	}
 	suite.myCompose = Compose{
 		Blueprint:  &suite.myBP,
-		ImageBuild: suite.myImageBuild,
+		ImageBuilds: []ImageBuild{suite.myImageBuild},
 	}
 	suite.myImageBuild = ImageBuild{
 		ID: 123,
@@ -203,6 +204,21 @@ func (suite *storeTest) TestGetBlueprintChange() {
 	suite.EqualError(err, "Unknown commit")
 }
 
+func (suite *storeTest) TestGetBlueprintAtCommitReloaded() {
+	suite.NoError(suite.myStore.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.1"}, "first"))
+	suite.NoError(suite.myStore.PushBlueprint(blueprint.Blueprint{Name: "test", Version: "0.0.2", Description: "changed"}, "second"))
+	changes := suite.myStore.GetBlueprintChanges("test")
+
+	// the blueprints of changes survive reloading the store from disk
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	bp, err := reloaded.GetBlueprintAtCommit("test", changes[0].Commit)
+	suite.NoError(err)
+	suite.Equal("0.0.1", bp.Version)
+	bp, err = reloaded.GetBlueprintAtCommit("test", changes[1].Commit)
+	suite.NoError(err)
+	suite.Equal("changed", bp.Description)
+}
+
 func (suite *storeTest) TestTagBlueprint() {
 	Commit := make(map[string]blueprint.Change)
 	Commit[suite.CommitHash] = suite.myChange
@@ -226,6 +242,19 @@ func (suite *storeTest) TestTagBlueprint() {
 	suite.EqualError(suite.myStore.TagBlueprint("testBP"), "No commits for blueprint")
 }
 
+func (suite *storeTest) TestTagBlueprintLatestChange() {
+	suite.myStore.PushBlueprint(suite.myBP, "first commit")
+	suite.NoError(suite.myStore.TagBlueprint("testBP"))
+	suite.myStore.PushBlueprint(suite.myBP, "second commit")
+	suite.NoError(suite.myStore.TagBlueprint("testBP"))
+
+	// the tag is added to the latest change, which is left as it was
+	commits := suite.myStore.blueprintsCommits["testBP"]
+	change := suite.myStore.blueprintsChanges["testBP"][commits[len(commits)-1]]
+	suite.Equal("second commit", change.Message)
+	suite.Equal(2, *change.Revision)
+}
+
 func (suite *storeTest) TestDeleteBlueprint() {
 	suite.myStore.blueprints["testBP"] = suite.myBP
 	suite.NoError(suite.myStore.DeleteBlueprint("testBP"))
@@ -244,10 +273,10 @@ func (suite *storeTest) TestDeleteBlueprintFromWorkspace() {
 
 func (suite *storeTest) TestPushCompose() {
 	testID := uuid.New()
-	err := suite.myStore.PushCompose(testID, suite.myManifest, suite.myImageType, &suite.myBP, 123, nil, uuid.New())
+	err := suite.myStore.PushCompose(testID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}})
 	suite.NoError(err)
 	suite.Panics(func() {
-		err = suite.myStore.PushCompose(testID, suite.myManifest, suite.myImageType, &suite.myBP, 123, []*target.Target{suite.myTarget}, uuid.New())
+		err = suite.myStore.PushCompose(testID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, Targets: []*target.Target{suite.myTarget}, JobID: uuid.New()}})
 	})
 	suite.NoError(err)
 	testID = uuid.New()
@@ -255,13 +284,13 @@ func (suite *storeTest) TestPushCompose() {
 
 func (suite *storeTest) TestPushTestCompose() {
 	ID := uuid.New()
-	err := suite.myStore.PushTestCompose(ID, suite.myManifest, suite.myImageType, &suite.myBP, 123, nil, true)
+	err := suite.myStore.PushTestCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123}}, true)
 	suite.NoError(err)
-	suite.Equal(common.ImageBuildState(2), suite.myStore.composes[ID].ImageBuild.QueueStatus)
+	suite.Equal(common.ImageBuildState(2), suite.myStore.composes[ID].ImageBuilds[0].QueueStatus)
 	ID = uuid.New()
-	err = suite.myStore.PushTestCompose(ID, suite.myManifest, suite.myImageType, &suite.myBP, 123, []*target.Target{suite.myTarget}, false)
+	err = suite.myStore.PushTestCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, Targets: []*target.Target{suite.myTarget}}}, false)
 	suite.NoError(err)
-	suite.Equal(common.ImageBuildState(3), suite.myStore.composes[ID].ImageBuild.QueueStatus)
+	suite.Equal(common.ImageBuildState(3), suite.myStore.composes[ID].ImageBuilds[0].QueueStatus)
 
 }
 
@@ -283,6 +312,238 @@ func (suite *storeTest) TestDeleteCompose() {
 	suite.Error(err)
 }
 
+func (suite *storeTest) TestSetComposeTargetResults() {
+	ID := uuid.New()
+	err := suite.myStore.PushCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, Targets: []*target.Target{suite.myTarget}, JobID: uuid.New()}})
+	suite.NoError(err)
+
+	result := target.NewAWSTargetResult(&target.AWSTargetResultOptions{
+		AMIs: []target.AWSTargetResultAMI{{Region: "eu-central-1", AMI: "ami-1"}},
+	})
+	result.TargetUuid = suite.myTarget.Uuid
+	err = suite.myStore.SetComposeTargetResults(ID, 0, []*target.TargetResult{result})
+	suite.NoError(err)
+
+	// the results survive reloading the store from disk
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	compose, exists := reloaded.GetCompose(ID)
+	suite.True(exists)
+	suite.Equal([]*target.TargetResult{result}, compose.ImageBuilds[0].TargetResults)
+
+	// composes returned by the store don't share their results with it
+	compose = suite.myStore.GetAllComposes()[ID]
+	compose.ImageBuilds[0].TargetResults[0].Options.(*target.AWSTargetResultOptions).AMIs[0].AMI = "ami-2"
+	compose = suite.myStore.GetAllComposes()[ID]
+	suite.Equal("ami-1", compose.ImageBuilds[0].TargetResults[0].Options.(*target.AWSTargetResultOptions).AMIs[0].AMI)
+
+	err = suite.myStore.SetComposeTargetResults(uuid.New(), 0, []*target.TargetResult{result})
+	suite.Error(err)
+}
+
+func (suite *storeTest) TestPushComposeUpload() {
+	ID := uuid.New()
+	err := suite.myStore.PushCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, Targets: []*target.Target{suite.myTarget}, JobID: uuid.New()}})
+	suite.NoError(err)
+
+	upload := target.NewAWSTarget(&target.AWSTargetOptions{Region: "eu-central-1"})
+	jobID := uuid.New()
+	err = suite.myStore.PushComposeUpload(ID, 0, upload, jobID)
+	suite.NoError(err)
+
+	// pushing an existing target again only replaces its job
+	retryJobID := uuid.New()
+	err = suite.myStore.PushComposeUpload(ID, 0, upload, retryJobID)
+	suite.NoError(err)
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	compose, exists := reloaded.GetCompose(ID)
+	suite.True(exists)
+	suite.Len(compose.ImageBuilds[0].Targets, 2)
+	suite.Equal(upload.Uuid, compose.ImageBuilds[0].Targets[1].Uuid)
+	suite.Equal(map[uuid.UUID]uuid.UUID{upload.Uuid: retryJobID}, compose.ImageBuilds[0].UploadJobs)
+
+	err = suite.myStore.PushComposeUpload(uuid.New(), 0, upload, jobID)
+	suite.Error(err)
+}
+
+func (suite *storeTest) TestRetryComposeUpload() {
+	ID := uuid.New()
+	err := suite.myStore.PushCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, Targets: []*target.Target{suite.myTarget}, JobID: uuid.New()}})
+	suite.NoError(err)
+
+	upload := target.NewAWSTarget(&target.AWSTargetOptions{Region: "eu-central-1"})
+	err = suite.myStore.RetryComposeUpload(ID, 0, upload.Uuid, uuid.New())
+	suite.Error(err)
+
+	err = suite.myStore.PushComposeUpload(ID, 0, upload, uuid.New())
+	suite.NoError(err)
+	retryJobID := uuid.New()
+	err = suite.myStore.RetryComposeUpload(ID, 0, upload.Uuid, retryJobID)
+	suite.NoError(err)
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	compose, exists := reloaded.GetCompose(ID)
+	suite.True(exists)
+	suite.Equal(retryJobID, compose.ImageBuilds[0].UploadJobs[upload.Uuid])
+	suite.Equal(1, compose.ImageBuilds[0].UploadRetries[upload.Uuid])
+
+	// scheduling the upload again resets the retries
+	err = suite.myStore.PushComposeUpload(ID, 0, upload, uuid.New())
+	suite.NoError(err)
+	compose, _ = suite.myStore.GetCompose(ID)
+	suite.Equal(0, compose.ImageBuilds[0].UploadRetries[upload.Uuid])
+}
+
+func (suite *storeTest) TestMultipleImageBuilds() {
+	ID := uuid.New()
+	first := ImageBuild{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}
+	second := ImageBuild{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 456, JobID: uuid.New()}
+	err := suite.myStore.PushCompose(ID, &suite.myBP, []ImageBuild{first, second})
+	suite.NoError(err)
+
+	upload := target.NewAWSTarget(&target.AWSTargetOptions{Region: "eu-central-1"})
+	err = suite.myStore.PushComposeUpload(ID, 1, upload, uuid.New())
+	suite.NoError(err)
+	err = suite.myStore.PushComposeUpload(ID, 2, upload, uuid.New())
+	suite.Error(err)
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	compose, exists := reloaded.GetCompose(ID)
+	suite.True(exists)
+	suite.Len(compose.ImageBuilds, 2)
+	for i, ib := range compose.ImageBuilds {
+		suite.Equal(i, ib.ID)
+	}
+	suite.Equal(uint64(456), compose.ImageBuilds[1].Size)
+	suite.Empty(compose.ImageBuilds[0].Targets)
+	suite.Len(compose.ImageBuilds[1].Targets, 1)
+
+	ib, exists := compose.ImageBuildByJobID(second.JobID)
+	suite.True(exists)
+	suite.Equal(1, ib.ID)
+
+	ib, t, exists := compose.FindTarget(upload.Uuid)
+	suite.True(exists)
+	suite.Equal(1, ib.ID)
+	suite.Equal(upload.Uuid, t.Uuid)
+}
+
+func (suite *storeTest) TestUploadProfiles() {
+	settings := json.RawMessage(`{"region":"eu-central-1"}`)
+	suite.myStore.PushUploadProfile("aws", "default", settings)
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	profile, exists := reloaded.GetUploadProfile("aws", "default")
+	suite.True(exists)
+	suite.JSONEq(string(settings), string(profile))
+	suite.Len(reloaded.GetAllUploadProfiles()["aws"], 1)
+
+	_, exists = reloaded.GetUploadProfile("azure", "default")
+	suite.False(exists)
+
+	err := suite.myStore.DeleteUploadProfile("aws", "default")
+	suite.NoError(err)
+	suite.Empty(suite.myStore.GetAllUploadProfiles())
+
+	err = suite.myStore.DeleteUploadProfile("aws", "default")
+	suite.Error(err)
+
+	// profiles of other namespaces aren't visible
+	ns := suite.myStore.Namespace("ns")
+	ns.PushUploadProfile("aws", "default", settings)
+	_, exists = suite.myStore.GetUploadProfile("aws", "default")
+	suite.False(exists)
+	suite.Empty(suite.myStore.GetAllUploadProfiles())
+	suite.Error(suite.myStore.DeleteUploadProfile("aws", "default"))
+	suite.Len(New(&suite.dir, suite.myArch, nil).Namespace("ns").GetAllUploadProfiles()["aws"], 1)
+}
+
+func (suite *storeTest) TestChangeHandlers() {
+	var blueprints []string
+	var composes []uuid.UUID
+	suite.myStore.OnBlueprintChange(func(namespace, name string) {
+		blueprints = append(blueprints, namespace+"/"+name)
+	})
+	suite.myStore.OnComposeChange(func(id uuid.UUID) {
+		composes = append(composes, id)
+	})
+
+	suite.NoError(suite.myStore.PushBlueprint(suite.myBP, "testing commit"))
+	suite.NoError(suite.myStore.PushBlueprintToWorkspace(suite.myBP))
+	suite.NoError(suite.myStore.Namespace("team").PushBlueprint(suite.myBP, "testing commit"))
+	suite.Equal([]string{"/" + suite.myBP.Name, "/" + suite.myBP.Name, "team/" + suite.myBP.Name}, blueprints)
+
+	// failed changes don't call the handlers
+	suite.Error(suite.myStore.DeleteBlueprint("unknown"))
+	suite.Len(blueprints, 3)
+
+	ID := uuid.New()
+	suite.NoError(suite.myStore.PushCompose(ID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}}))
+	suite.NoError(suite.myStore.DeleteCompose(ID))
+	suite.Error(suite.myStore.DeleteCompose(ID))
+	suite.Equal([]uuid.UUID{ID, ID}, composes)
+}
+
+func (suite *storeTest) TestWebhooks() {
+	first := Webhook{ID: uuid.New(), URL: "https://a.example.com/hook", Secret: "secret", Events: []string{"compose"}}
+	second := Webhook{ID: uuid.New(), URL: "https://b.example.com/hook"}
+	suite.myStore.PushWebhook(second)
+	suite.myStore.PushWebhook(first)
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	suite.Equal([]Webhook{first, second}, reloaded.GetAllWebhooks())
+
+	// namespaces only see their own webhooks
+	ns := suite.myStore.Namespace("ns")
+	third := Webhook{ID: uuid.New(), URL: "https://c.example.com/hook"}
+	ns.PushWebhook(third)
+	third.Namespace = "ns"
+	suite.Equal([]Webhook{third}, ns.GetAllWebhooks())
+	suite.Equal([]Webhook{first, second}, suite.myStore.Namespace("").GetAllWebhooks())
+	suite.Error(ns.DeleteWebhook(first.ID))
+	suite.Equal([]Webhook{third}, New(&suite.dir, suite.myArch, nil).Namespace("ns").GetAllWebhooks())
+
+	suite.NoError(suite.myStore.DeleteWebhook(first.ID))
+	suite.Error(suite.myStore.DeleteWebhook(first.ID))
+	suite.Equal([]Webhook{second, third}, suite.myStore.GetAllWebhooks())
+}
+
+func (suite *storeTest) TestSchedules() {
+	created := time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC)
+	first := Schedule{ID: uuid.New(), Blueprint: "a", ImageTypes: []string{"qcow2"}, Cron: "@daily", Created: created}
+	second := Schedule{ID: uuid.New(), Blueprint: "b", ImageTypes: []string{"qcow2", "ami"}, Upload: json.RawMessage(`{"provider":"aws"}`), OnChange: true, Created: created}
+	suite.myStore.PushSchedule(second)
+	suite.myStore.PushSchedule(first)
+
+	// schedules belong to the namespace they were pushed to
+	team := Schedule{ID: uuid.New(), Blueprint: "a", Created: created}
+	suite.myStore.Namespace("team").PushSchedule(team)
+	team.Namespace = "team"
+	suite.Equal([]Schedule{team}, suite.myStore.Namespace("team").GetAllSchedules())
+	suite.Equal([]Schedule{first, second}, suite.myStore.Namespace("").GetAllSchedules())
+	_, exists := suite.myStore.Namespace("").GetSchedule(team.ID)
+	suite.False(exists)
+	suite.Error(suite.myStore.Namespace("").DeleteSchedule(team.ID))
+
+	checked := created.Add(time.Hour)
+	composeID := uuid.New()
+	suite.NoError(suite.myStore.SetScheduleRun(first.ID, checked, composeID))
+	suite.NoError(suite.myStore.SetScheduleRun(first.ID, checked.Add(time.Hour), uuid.Nil))
+	first.LastChecked = checked.Add(time.Hour)
+	first.LastCompose = composeID
+	suite.Error(suite.myStore.SetScheduleRun(uuid.New(), checked, uuid.Nil))
+
+	reloaded := New(&suite.dir, suite.myArch, nil)
+	suite.Equal([]Schedule{first, second, team}, reloaded.GetAllSchedules())
+	schedule, exists := reloaded.GetSchedule(first.ID)
+	suite.True(exists)
+	suite.Equal(first, schedule)
+
+	suite.NoError(suite.myStore.DeleteSchedule(first.ID))
+	suite.Error(suite.myStore.DeleteSchedule(first.ID))
+	suite.Equal([]Schedule{second, team}, suite.myStore.GetAllSchedules())
+}
+
 func (suite *storeTest) TestDeleteSourceByName() {
 	suite.myStore.sources = make(map[string]SourceConfig)
 	suite.myStore.sources["testSource"] = suite.mySourceConfig
@@ -401,3 +662,72 @@ func (suite *storeTest) TestRepoConfigMirrorlist() {
 func TestStore(t *testing.T) {
 	suite.Run(t, new(storeTest))
 }
+
+func (suite *storeTest) TestNamespaces() {
+	team := suite.myStore.Namespace("team")
+
+	suite.NoError(suite.myStore.PushBlueprint(suite.myBP, "default commit"))
+	teamBP := suite.myBP
+	teamBP.Description = "team blueprint"
+	suite.NoError(team.PushBlueprint(teamBP, "team commit"))
+
+	// same-named blueprints are independent
+	suite.Equal([]string{suite.myBP.Name}, suite.myStore.ListBlueprints())
+	suite.Equal([]string{suite.myBP.Name}, team.ListBlueprints())
+	suite.Equal("team blueprint", team.GetBlueprintCommitted(suite.myBP.Name).Description)
+	suite.Equal(suite.myBP.Description, suite.myStore.GetBlueprintCommitted(suite.myBP.Name).Description)
+	suite.Len(team.GetBlueprintChanges(suite.myBP.Name), 1)
+	suite.NoError(team.DeleteBlueprint(suite.myBP.Name))
+	suite.NotNil(suite.myStore.GetBlueprintCommitted(suite.myBP.Name))
+	suite.Empty(suite.myStore.Namespace("other").ListBlueprints())
+
+	team.PushSource("repo", suite.mySourceConfig)
+	suite.Equal([]string{"repo"}, team.ListSourcesById())
+	suite.Empty(suite.myStore.ListSourcesById())
+	suite.Contains(team.GetAllSourcesByID(), "repo")
+
+	// the unscoped store sees the composes of all namespaces
+	defaultID := uuid.New()
+	teamID := uuid.New()
+	suite.NoError(suite.myStore.PushCompose(defaultID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}}))
+	suite.NoError(team.PushCompose(teamID, &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}}))
+	suite.Len(suite.myStore.GetAllComposes(), 2)
+	suite.Len(suite.myStore.Namespace("").GetAllComposes(), 1)
+	suite.Contains(team.GetAllComposes(), teamID)
+	_, exists := team.GetCompose(defaultID)
+	suite.False(exists)
+	suite.Error(team.DeleteCompose(defaultID))
+
+	// namespaces are persisted
+	reloaded := New(&suite.dir, suite.myArch, nil).Namespace("team")
+	suite.Equal([]string{"repo"}, reloaded.ListSourcesById())
+	compose, exists := reloaded.GetCompose(teamID)
+	suite.True(exists)
+	suite.Equal("team", compose.Namespace)
+
+	suite.Panics(func() { suite.myStore.Namespace("a/b") })
+}
+
+func (suite *storeTest) TestQuotas() {
+	suite.myStore.SetQuota("team", Quota{Blueprints: 1, Composes: 1})
+	team := suite.myStore.Namespace("team")
+	suite.Equal(Quota{Blueprints: 1, Composes: 1}, team.GetQuota())
+
+	suite.NoError(team.PushBlueprintToWorkspace(suite.myBP))
+	// changing an existing blueprint is always possible
+	suite.NoError(team.PushBlueprint(suite.myBP, "commit"))
+	other := suite.myBP
+	other.Name = "other"
+	err := team.PushBlueprint(other, "commit")
+	suite.IsType(&QuotaExceededError{}, err)
+	suite.IsType(&QuotaExceededError{}, team.PushBlueprintToWorkspace(other))
+
+	suite.NoError(team.CheckComposeQuota())
+	suite.NoError(team.PushCompose(uuid.New(), &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}}))
+	suite.IsType(&QuotaExceededError{}, team.CheckComposeQuota())
+	suite.IsType(&QuotaExceededError{}, team.PushCompose(uuid.New(), &suite.myBP, []ImageBuild{{Manifest: suite.myManifest, ImageType: suite.myImageType, Size: 123, JobID: uuid.New()}}))
+
+	// other namespaces are not affected
+	suite.NoError(suite.myStore.PushBlueprint(other, "commit"))
+	suite.NoError(suite.myStore.CheckComposeQuota())
+}
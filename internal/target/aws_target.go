@@ -1,12 +1,19 @@
 package target
 
 type AWSTargetOptions struct {
-	Filename        string `json:"filename"`
-	Region          string `json:"region"`
-	AccessKeyID     string `json:"accessKeyID"`
-	SecretAccessKey string `json:"secretAccessKey"`
-	Bucket          string `json:"bucket"`
-	Key             string `json:"key"`
+	Filename          string            `json:"filename"`
+	Region            string            `json:"region"`
+	AccessKeyID       string            `json:"accessKeyID"`
+	SecretAccessKey   string            `json:"secretAccessKey"`
+	Bucket            string            `json:"bucket"`
+	Key               string            `json:"key"`
+	ShareWithAccounts []string          `json:"shareWithAccounts,omitempty"`
+	CopyToRegions     []string          `json:"copyToRegions,omitempty"`
+	Tags              map[string]string `json:"tags,omitempty"`
+	EnaSupport        *bool             `json:"enaSupport,omitempty"`
+	SriovNetSupport   bool              `json:"sriovNetSupport,omitempty"`
+	BootMode          string            `json:"bootMode,omitempty"`
+	Architecture      string            `json:"architecture,omitempty"`
 }
 
 func (AWSTargetOptions) isTargetOptions() {}
@@ -14,3 +21,18 @@ func (AWSTargetOptions) isTargetOptions() {}
 func NewAWSTarget(options *AWSTargetOptions) *Target {
 	return newTarget("org.osbuild.aws", options)
 }
+
+type AWSTargetResultAMI struct {
+	Region string `json:"region"`
+	AMI    string `json:"ami"`
+}
+
+type AWSTargetResultOptions struct {
+	AMIs []AWSTargetResultAMI `json:"amis"`
+}
+
+func (AWSTargetResultOptions) isTargetResultOptions() {}
+
+func NewAWSTargetResult(options *AWSTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.aws", options)
+}
@@ -5,6 +5,23 @@ type AzureTargetOptions struct {
 	StorageAccount   string `json:"storageAccount"`
 	StorageAccessKey string `json:"storageAccessKey"`
 	Container        string `json:"container"`
+
+	// A managed image is created from the uploaded blob when ResourceGroup
+	// is set. This requires the credentials of a service principal.
+	TenantID       string `json:"tenantID,omitempty"`
+	ClientID       string `json:"clientID,omitempty"`
+	ClientSecret   string `json:"clientSecret,omitempty"`
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	ResourceGroup  string `json:"resourceGroup,omitempty"`
+	Location       string `json:"location,omitempty"`
+	// "V1" (the default) or "V2" for images booting with UEFI
+	HyperVGeneration string `json:"hyperVGeneration,omitempty"`
+
+	// A version of an existing image definition in a shared image gallery
+	// is created from the managed image when Gallery is set.
+	Gallery             string `json:"gallery,omitempty"`
+	GalleryImage        string `json:"galleryImage,omitempty"`
+	GalleryImageVersion string `json:"galleryImageVersion,omitempty"`
 }
 
 func (AzureTargetOptions) isTargetOptions() {}
@@ -12,3 +29,15 @@ func (AzureTargetOptions) isTargetOptions() {}
 func NewAzureTarget(options *AzureTargetOptions) *Target {
 	return newTarget("org.osbuild.azure", options)
 }
+
+type AzureTargetResultOptions struct {
+	BlobURL               string `json:"blobURL"`
+	ImageID               string `json:"imageID,omitempty"`
+	GalleryImageVersionID string `json:"galleryImageVersionID,omitempty"`
+}
+
+func (AzureTargetResultOptions) isTargetResultOptions() {}
+
+func NewAzureTargetResult(options *AzureTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.azure", options)
+}
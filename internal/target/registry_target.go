@@ -0,0 +1,28 @@
+package target
+
+type RegistryTargetOptions struct {
+	Filename   string   `json:"filename"`
+	Registry   string   `json:"registry"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+	TLSVerify  *bool    `json:"tlsVerify,omitempty"`
+}
+
+func (RegistryTargetOptions) isTargetOptions() {}
+
+func NewRegistryTarget(options *RegistryTargetOptions) *Target {
+	return newTarget("org.osbuild.registry", options)
+}
+
+type RegistryTargetResultOptions struct {
+	Digest string   `json:"digest"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+func (RegistryTargetResultOptions) isTargetResultOptions() {}
+
+func NewRegistryTargetResult(options *RegistryTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.registry", options)
+}
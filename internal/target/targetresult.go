@@ -0,0 +1,101 @@
+package target
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// TargetResult describes what a target produced when it was handled by a
+// worker, for example the digest of a pushed container image.
+type TargetResult struct {
+	TargetUuid uuid.UUID           `json:"target_uuid"`
+	Name       string              `json:"name"`
+	Options    TargetResultOptions `json:"options"`
+}
+
+func newTargetResult(name string, options TargetResultOptions) *TargetResult {
+	return &TargetResult{
+		Name:    name,
+		Options: options,
+	}
+}
+
+type TargetResultOptions interface {
+	isTargetResultOptions()
+}
+
+// DeepCopy returns a copy of the target result which shares no memory with
+// the original, including its options.
+func (targetResult *TargetResult) DeepCopy() *TargetResult {
+	var options TargetResultOptions
+	switch o := targetResult.Options.(type) {
+	case *AWSTargetResultOptions:
+		newOptions := *o
+		if o.AMIs != nil {
+			newOptions.AMIs = make([]AWSTargetResultAMI, len(o.AMIs))
+			copy(newOptions.AMIs, o.AMIs)
+		}
+		options = &newOptions
+	case *AzureTargetResultOptions:
+		newOptions := *o
+		options = &newOptions
+	case *RegistryTargetResultOptions:
+		newOptions := *o
+		if o.Tags != nil {
+			newOptions.Tags = make([]string, len(o.Tags))
+			copy(newOptions.Tags, o.Tags)
+		}
+		options = &newOptions
+	default:
+		options = o
+	}
+
+	return &TargetResult{
+		TargetUuid: targetResult.TargetUuid,
+		Name:       targetResult.Name,
+		Options:    options,
+	}
+}
+
+type rawTargetResult struct {
+	TargetUuid uuid.UUID       `json:"target_uuid"`
+	Name       string          `json:"name"`
+	Options    json.RawMessage `json:"options"`
+}
+
+func (targetResult *TargetResult) UnmarshalJSON(data []byte) error {
+	var rawTR rawTargetResult
+	err := json.Unmarshal(data, &rawTR)
+	if err != nil {
+		return err
+	}
+	options, err := UnmarshalTargetResultOptions(rawTR.Name, rawTR.Options)
+	if err != nil {
+		return err
+	}
+
+	targetResult.TargetUuid = rawTR.TargetUuid
+	targetResult.Name = rawTR.Name
+	targetResult.Options = options
+
+	return nil
+}
+
+func UnmarshalTargetResultOptions(targetName string, rawOptions json.RawMessage) (TargetResultOptions, error) {
+	var options TargetResultOptions
+	switch targetName {
+	case "org.osbuild.aws":
+		options = new(AWSTargetResultOptions)
+	case "org.osbuild.azure":
+		options = new(AzureTargetResultOptions)
+	case "org.osbuild.registry":
+		options = new(RegistryTargetResultOptions)
+	default:
+		return nil, errors.New("unexpected target result name")
+	}
+	err := json.Unmarshal(rawOptions, options)
+
+	return options, err
+}
@@ -2,8 +2,11 @@ package awsupload
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -19,6 +22,43 @@ type AWS struct {
 	uploader *s3manager.Uploader
 	importer *ec2.EC2
 	s3       *s3.S3
+	sess     *session.Session
+	region   string
+}
+
+// RegisterOptions customize the AMIs created by RegisterWithOptions(). The
+// zero value registers a single private AMI with ENA support in the region
+// of the uploader.
+type RegisterOptions struct {
+	// AWS account IDs which are allowed to launch the AMIs
+	ShareWithAccounts []string
+
+	// Regions into which the AMI is copied after it was registered
+	CopyToRegions []string
+
+	// Tags added to the AMIs and the snapshot backing them, in addition
+	// to the Name tag
+	Tags map[string]string
+
+	// Defaults to true when nil
+	EnaSupport *bool
+
+	// Enables enhanced networking with the Intel 82599 VF interface
+	SriovNetSupport bool
+
+	// Either "legacy-bios" or "uefi". The default of the region is used
+	// when empty.
+	BootMode string
+
+	// Architecture of the image, as named by the distribution, e.g.
+	// "aarch64". Defaults to x86_64 when empty.
+	Architecture string
+}
+
+// AMI is an image registered in a specific region.
+type AMI struct {
+	Region string
+	ID     string
 }
 
 func New(region, accessKeyID, accessKey string) (*AWS, error) {
@@ -38,6 +78,8 @@ func New(region, accessKeyID, accessKey string) (*AWS, error) {
 		uploader: s3manager.NewUploader(sess),
 		importer: ec2.New(sess),
 		s3:       s3.New(sess),
+		sess:     sess,
+		region:   region,
 	}, nil
 }
 
@@ -118,6 +160,71 @@ func WaitUntilImportSnapshotTaskCompletedWithContext(c *ec2.EC2, ctx aws.Context
 // fully import, tags the snapshot, cleans up the image in S3, and registers
 // an AMI in AWS.
 func (a *AWS) Register(name, bucket, key string) (*string, error) {
+	amis, err := a.RegisterWithOptions(name, bucket, key, RegisterOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return aws.String(amis[0].ID), nil
+}
+
+// RegisterWithOptions works like Register(), but also shares, copies and
+// tags the AMI according to `options`. The AMI in the region of the uploader
+// is always the first one in the returned list.
+//
+// The image is deleted from S3 regardless of whether the import succeeded.
+// If anything fails after the snapshot was imported, all AMIs registered so
+// far are deregistered and their snapshots are deleted, so that no
+// half-finished images are left behind.
+func (a *AWS) RegisterWithOptions(name, bucket, key string, options RegisterOptions) ([]AMI, error) {
+	architecture, err := ec2Architecture(options.Architecture)
+	if err != nil {
+		a.deleteObject(bucket, key)
+		return nil, err
+	}
+
+	snapshotID, err := a.importSnapshot(name, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	amis, err := a.registerAMIs(name, snapshotID, architecture, options)
+	if err != nil {
+		a.cleanup(amis, snapshotID)
+		return nil, err
+	}
+
+	return amis, nil
+}
+
+// ec2Architecture returns the EC2 name of the distribution architecture
+// `arch`.
+func ec2Architecture(arch string) (string, error) {
+	switch arch {
+	case "", "x86_64":
+		return "x86_64", nil
+	case "aarch64":
+		return "arm64", nil
+	}
+	return "", fmt.Errorf("architecture %s is not supported by EC2", arch)
+}
+
+func (a *AWS) deleteObject(bucket, key string) {
+	log.Printf("[AWS] 🧹 Deleting image from S3: %s/%s", bucket, key)
+	_, err := a.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("[AWS] Error deleting image from S3: %v", err)
+	}
+}
+
+func (a *AWS) importSnapshot(name, bucket, key string) (*string, error) {
+	// we no longer need the object in s3 once the import is done, no matter
+	// whether it succeeded
+	defer a.deleteObject(bucket, key)
+
 	log.Printf("[AWS] 📥 Importing snapshot from image: %s/%s", bucket, key)
 	snapshotDescription := fmt.Sprintf("Image Builder AWS Import of %s", name)
 	importTaskOutput, err := a.importer.ImportSnapshot(
@@ -145,16 +252,7 @@ func (a *AWS) Register(name, bucket, key string) (*string, error) {
 		},
 	)
 	if err != nil {
-		return nil, err
-	}
-
-	// we no longer need the object in s3, let's just delete it
-	log.Printf("[AWS] 🧹 Deleting image from S3: %s/%s", bucket, key)
-	_, err = a.s3.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
+		a.abortImport(importTaskOutput.ImportTaskId)
 		return nil, err
 	}
 
@@ -169,47 +267,279 @@ func (a *AWS) Register(name, bucket, key string) (*string, error) {
 		return nil, err
 	}
 
-	snapshotID := importOutput.ImportSnapshotTasks[0].SnapshotTaskDetail.SnapshotId
+	return importOutput.ImportSnapshotTasks[0].SnapshotTaskDetail.SnapshotId, nil
+}
+
+// abortImport cancels the import task `taskID` after waiting for it failed,
+// and deletes the snapshot it may have created already. Errors are only
+// logged, like in cleanup().
+func (a *AWS) abortImport(taskID *string) {
+	log.Printf("[AWS] 🧹 Canceling snapshot import %s", *taskID)
+	_, err := a.importer.CancelImportTask(&ec2.CancelImportTaskInput{
+		ImportTaskId: taskID,
+	})
+	if err != nil {
+		log.Printf("[AWS] Error canceling snapshot import %s: %v", *taskID, err)
+	}
+
+	output, err := a.importer.DescribeImportSnapshotTasks(&ec2.DescribeImportSnapshotTasksInput{
+		ImportTaskIds: []*string{taskID},
+	})
+	if err != nil {
+		log.Printf("[AWS] Error describing snapshot import %s: %v", *taskID, err)
+		return
+	}
+
+	for _, task := range output.ImportSnapshotTasks {
+		if task.SnapshotTaskDetail != nil && aws.StringValue(task.SnapshotTaskDetail.SnapshotId) != "" {
+			deleteSnapshot(a.importer, task.SnapshotTaskDetail.SnapshotId)
+		}
+	}
+}
+
+// registerAMIs registers the AMI and all of its copies. It returns the AMIs
+// that were registered even if it fails, so that they can be cleaned up.
+func (a *AWS) registerAMIs(name string, snapshotID *string, architecture string, options RegisterOptions) ([]AMI, error) {
+	var amis []AMI
+	tags := ec2Tags(name, options.Tags)
 
 	// Tag the snapshot with the image name.
 	req, _ := a.importer.CreateTagsRequest(
 		&ec2.CreateTagsInput{
 			Resources: []*string{snapshotID},
-			Tags: []*ec2.Tag{
-				{
-					Key:   aws.String("Name"),
-					Value: aws.String(name),
-				},
-			},
+			Tags:      tags,
 		},
 	)
-	err = req.Send()
+	err := req.Send()
 	if err != nil {
-		return nil, err
+		return amis, err
 	}
 
-	log.Printf("[AWS] 📋 Registering AMI from imported snapshot: %s", *snapshotID)
-	registerOutput, err := a.importer.RegisterImage(
-		&ec2.RegisterImageInput{
-			Architecture:       aws.String("x86_64"),
-			VirtualizationType: aws.String("hvm"),
-			Name:               aws.String(name),
-			RootDeviceName:     aws.String("/dev/sda1"),
-			EnaSupport:         aws.Bool(true),
-			BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-				{
-					DeviceName: aws.String("/dev/sda1"),
-					Ebs: &ec2.EbsBlockDevice{
-						SnapshotId: snapshotID,
-					},
+	enaSupport := true
+	if options.EnaSupport != nil {
+		enaSupport = *options.EnaSupport
+	}
+
+	registerInput := &ec2.RegisterImageInput{
+		Architecture:       aws.String(architecture),
+		VirtualizationType: aws.String("hvm"),
+		Name:               aws.String(name),
+		RootDeviceName:     aws.String("/dev/sda1"),
+		EnaSupport:         aws.Bool(enaSupport),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{
+				DeviceName: aws.String("/dev/sda1"),
+				Ebs: &ec2.EbsBlockDevice{
+					SnapshotId: snapshotID,
 				},
 			},
 		},
-	)
-	if err != nil {
-		return nil, err
+	}
+	if options.SriovNetSupport {
+		registerInput.SriovNetSupport = aws.String("simple")
 	}
 
+	log.Printf("[AWS] 📋 Registering AMI from imported snapshot: %s", *snapshotID)
+	registerReq, registerOutput := a.importer.RegisterImageRequest(registerInput)
+	if options.BootMode != "" {
+		registerReq.Handlers.Build.PushBack(addQueryParameter("BootMode", options.BootMode))
+	}
+	err = registerReq.Send()
+	if err != nil {
+		return amis, err
+	}
 	log.Printf("[AWS] 🎉 AMI registered: %s", *registerOutput.ImageId)
-	return registerOutput.ImageId, nil
+	amis = append(amis, AMI{Region: a.region, ID: *registerOutput.ImageId})
+
+	err = finishAMI(a.importer, registerOutput.ImageId, tags, options.ShareWithAccounts)
+	if err != nil {
+		return amis, err
+	}
+
+	for _, region := range options.CopyToRegions {
+		if region == a.region {
+			continue
+		}
+
+		log.Printf("[AWS] 📦 Copying AMI %s to %s", *registerOutput.ImageId, region)
+		regionalEC2 := ec2.New(a.sess, aws.NewConfig().WithRegion(region))
+		copyOutput, err := regionalEC2.CopyImage(&ec2.CopyImageInput{
+			Name:          aws.String(name),
+			SourceImageId: registerOutput.ImageId,
+			SourceRegion:  aws.String(a.region),
+		})
+		if err != nil {
+			return amis, err
+		}
+		amis = append(amis, AMI{Region: region, ID: *copyOutput.ImageId})
+
+		err = finishAMI(regionalEC2, copyOutput.ImageId, tags, options.ShareWithAccounts)
+		if err != nil {
+			return amis, err
+		}
+		log.Printf("[AWS] 🎉 AMI copied: %s", *copyOutput.ImageId)
+	}
+
+	return amis, nil
+}
+
+// finishAMI waits until the AMI is available, because it cannot be modified
+// before that, and tags and shares it.
+func finishAMI(c *ec2.EC2, imageID *string, tags []*ec2.Tag, shareWithAccounts []string) error {
+	err := c.WaitUntilImageAvailable(&ec2.DescribeImagesInput{
+		ImageIds: []*string{imageID},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{imageID},
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(shareWithAccounts) == 0 {
+		return nil
+	}
+
+	log.Printf("[AWS] 🤝 Sharing AMI %s with %v", *imageID, shareWithAccounts)
+	var permissions []*ec2.LaunchPermission
+	for _, account := range shareWithAccounts {
+		permissions = append(permissions, &ec2.LaunchPermission{UserId: aws.String(account)})
+	}
+	_, err = c.ModifyImageAttribute(&ec2.ModifyImageAttributeInput{
+		ImageId: imageID,
+		LaunchPermission: &ec2.LaunchPermissionModifications{
+			Add: permissions,
+		},
+	})
+
+	return err
+}
+
+// cleanup removes everything registerAMIs() left behind. Errors are only
+// logged, because they would hide the error that caused the cleanup.
+//
+// The first AMI is backed by the imported snapshot, but copies of it are
+// backed by snapshots of their own, which are deleted with them.
+func (a *AWS) cleanup(amis []AMI, snapshotID *string) {
+	for i, ami := range amis {
+		c := ec2.New(a.sess, aws.NewConfig().WithRegion(ami.Region))
+
+		var snapshots []*string
+		if i > 0 {
+			snapshots = copySnapshots(c, ami)
+		}
+
+		log.Printf("[AWS] 🧹 Deregistering AMI %s in %s", ami.ID, ami.Region)
+		_, err := c.DeregisterImage(&ec2.DeregisterImageInput{
+			ImageId: aws.String(ami.ID),
+		})
+		if err != nil {
+			log.Printf("[AWS] Error deregistering AMI %s: %v", ami.ID, err)
+		}
+
+		for _, snapshot := range snapshots {
+			deleteSnapshot(c, snapshot)
+		}
+	}
+
+	deleteSnapshot(a.importer, snapshotID)
+}
+
+// copySnapshots returns the snapshots backing the copied AMI `ami`. Copies
+// only have snapshots once they are available, so this waits for the copy
+// to finish.
+func copySnapshots(c *ec2.EC2, ami AMI) []*string {
+	input := &ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(ami.ID)},
+	}
+
+	err := c.WaitUntilImageAvailable(input)
+	if err != nil {
+		log.Printf("[AWS] Error waiting for AMI %s: %v", ami.ID, err)
+	}
+
+	output, err := c.DescribeImages(input)
+	if err != nil {
+		log.Printf("[AWS] Error describing AMI %s: %v", ami.ID, err)
+		return nil
+	}
+
+	var snapshots []*string
+	for _, image := range output.Images {
+		for _, mapping := range image.BlockDeviceMappings {
+			if mapping.Ebs != nil && aws.StringValue(mapping.Ebs.SnapshotId) != "" {
+				snapshots = append(snapshots, mapping.Ebs.SnapshotId)
+			}
+		}
+	}
+
+	return snapshots
+}
+
+func deleteSnapshot(c *ec2.EC2, snapshotID *string) {
+	log.Printf("[AWS] 🧹 Deleting snapshot %s", *snapshotID)
+	_, err := c.DeleteSnapshot(&ec2.DeleteSnapshotInput{
+		SnapshotId: snapshotID,
+	})
+	if err != nil {
+		log.Printf("[AWS] Error deleting snapshot %s: %v", *snapshotID, err)
+	}
+}
+
+// ec2Tags returns the Name tag followed by `tags`, sorted by key.
+func ec2Tags(name string, tags map[string]string) []*ec2.Tag {
+	result := []*ec2.Tag{
+		{
+			Key:   aws.String("Name"),
+			Value: aws.String(name),
+		},
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		if key == "Name" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result = append(result, &ec2.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+
+	return result
+}
+
+// addQueryParameter returns a request handler which adds a parameter to an
+// already built EC2 query request. This is used for parameters which are
+// newer than the vendored SDK.
+func addQueryParameter(name, value string) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.Error != nil {
+			return
+		}
+
+		raw, err := ioutil.ReadAll(r.GetBody())
+		if err != nil {
+			r.Error = err
+			return
+		}
+
+		values, err := url.ParseQuery(string(raw))
+		if err != nil {
+			r.Error = err
+			return
+		}
+		values.Set(name, value)
+		r.SetBufferBody([]byte(values.Encode()))
+	}
 }
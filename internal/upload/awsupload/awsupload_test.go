@@ -0,0 +1,158 @@
+package awsupload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEC2Tags(t *testing.T) {
+	tags := ec2Tags("image", map[string]string{
+		"b":    "2",
+		"a":    "1",
+		"Name": "ignored",
+	})
+
+	require.Len(t, tags, 3)
+	require.Equal(t, "Name", *tags[0].Key)
+	require.Equal(t, "image", *tags[0].Value)
+	require.Equal(t, "a", *tags[1].Key)
+	require.Equal(t, "b", *tags[2].Key)
+}
+
+func TestAddQueryParameter(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Region:      aws.String("us-east-1"),
+	})
+	require.NoError(t, err)
+
+	req, _ := ec2.New(sess).RegisterImageRequest(&ec2.RegisterImageInput{
+		Name: aws.String("image"),
+	})
+	req.Handlers.Build.PushBack(addQueryParameter("BootMode", "uefi"))
+	require.NoError(t, req.Build())
+
+	raw, err := ioutil.ReadAll(req.GetBody())
+	require.NoError(t, err)
+	values, err := url.ParseQuery(string(raw))
+	require.NoError(t, err)
+	require.Equal(t, "RegisterImage", values.Get("Action"))
+	require.Equal(t, "image", values.Get("Name"))
+	require.Equal(t, "uefi", values.Get("BootMode"))
+}
+
+func TestEC2Architecture(t *testing.T) {
+	for arch, expected := range map[string]string{"": "x86_64", "x86_64": "x86_64", "aarch64": "arm64"} {
+		actual, err := ec2Architecture(arch)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	_, err := ec2Architecture("s390x")
+	require.Error(t, err)
+}
+
+// fakeEC2 answers EC2 API calls with `responses`, keyed by action, and
+// records the calls it received.
+type fakeEC2 struct {
+	mu        sync.Mutex
+	calls     []string
+	responses map[string]string
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := r.Form.Get("Action")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := action
+	for _, param := range []string{"ImageId", "ImageId.1", "SnapshotId", "ImportTaskId", "ImportTaskId.1"} {
+		if value := r.Form.Get(param); value != "" {
+			call += " " + value
+		}
+	}
+	f.calls = append(f.calls, call)
+
+	fmt.Fprintf(w, "<%sResponse>%s</%sResponse>", action, f.responses[action], action)
+}
+
+func newFakeAWS(t *testing.T, f *fakeEC2) (*AWS, func()) {
+	server := httptest.NewServer(f)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Region:      aws.String("eu-central-1"),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return &AWS{
+		importer: ec2.New(sess),
+		sess:     sess,
+		region:   "eu-central-1",
+	}, server.Close
+}
+
+func TestCleanup(t *testing.T) {
+	f := &fakeEC2{
+		responses: map[string]string{
+			"DescribeImages": `<imagesSet><item><imageId>ami-2</imageId><imageState>available</imageState>` +
+				`<blockDeviceMapping><item><deviceName>/dev/sda1</deviceName><ebs><snapshotId>snap-2</snapshotId></ebs></item></blockDeviceMapping>` +
+				`</item></imagesSet>`,
+		},
+	}
+	a, closeServer := newFakeAWS(t, f)
+	defer closeServer()
+
+	a.cleanup([]AMI{{Region: "eu-central-1", ID: "ami-1"}, {Region: "us-east-1", ID: "ami-2"}}, aws.String("snap-1"))
+
+	// the snapshot of the copy is deleted after its AMI was deregistered
+	sort.Strings(f.calls)
+	require.Equal(t, []string{
+		"DeleteSnapshot snap-1",
+		"DeleteSnapshot snap-2",
+		"DeregisterImage ami-1",
+		"DeregisterImage ami-2",
+		"DescribeImages ami-2",
+		"DescribeImages ami-2",
+	}, f.calls)
+}
+
+func TestAbortImport(t *testing.T) {
+	f := &fakeEC2{
+		responses: map[string]string{
+			"DescribeImportSnapshotTasks": `<importSnapshotTaskSet><item><importTaskId>import-snap-1</importTaskId>` +
+				`<snapshotTaskDetail><snapshotId>snap-1</snapshotId><status>deleting</status></snapshotTaskDetail>` +
+				`</item></importSnapshotTaskSet>`,
+		},
+	}
+	a, closeServer := newFakeAWS(t, f)
+	defer closeServer()
+
+	a.abortImport(aws.String("import-snap-1"))
+
+	require.Equal(t, []string{
+		"CancelImportTask import-snap-1",
+		"DescribeImportSnapshotTasks import-snap-1",
+		"DeleteSnapshot snap-1",
+	}, f.calls)
+}
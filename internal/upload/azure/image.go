@@ -0,0 +1,327 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	defaultLoginEndpoint      = "https://login.microsoftonline.com"
+	defaultManagementEndpoint = "https://management.azure.com"
+	computeAPIVersion         = "2019-12-01"
+
+	// creating a gallery image version includes replicating it, which may
+	// take a while
+	defaultOperationTimeout = 2 * time.Hour
+)
+
+// ClientCredentials identify a service principal, which is used to manage
+// resources in a subscription.
+// See https://docs.microsoft.com/en-us/azure/active-directory/develop/app-objects-and-service-principals
+type ClientCredentials struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+}
+
+// ManagedImageOptions describe the managed image which is created from an
+// uploaded VHD blob.
+type ManagedImageOptions struct {
+	ResourceGroup string
+	Location      string
+	ImageName     string
+
+	// Either "V1" for images booting with BIOS, or "V2" for images booting
+	// with UEFI. Defaults to "V1" when empty.
+	HyperVGeneration string
+}
+
+// GalleryImageVersionOptions describe a version of an image definition in a
+// shared image gallery, which is created from a managed image. The gallery
+// and the image definition must already exist in the resource group of the
+// managed image.
+type GalleryImageVersionOptions struct {
+	Gallery         string
+	ImageDefinition string
+	Version         string
+}
+
+// ManagementClient creates resources with the Azure Resource Manager REST API.
+type ManagementClient struct {
+	credentials        ClientCredentials
+	httpClient         *http.Client
+	loginEndpoint      string
+	managementEndpoint string
+	pollInterval       time.Duration
+	operationTimeout   time.Duration
+	token              *adal.ServicePrincipalToken
+}
+
+// NewManagementClient creates a client for the subscription in `credentials`.
+func NewManagementClient(credentials ClientCredentials) *ManagementClient {
+	return &ManagementClient{
+		credentials:        credentials,
+		httpClient:         &http.Client{},
+		loginEndpoint:      defaultLoginEndpoint,
+		managementEndpoint: defaultManagementEndpoint,
+		pollInterval:       10 * time.Second,
+		operationTimeout:   defaultOperationTimeout,
+	}
+}
+
+// BlobURL returns the URL of the blob the image described by `metadata` is
+// uploaded to by UploadImage().
+func BlobURL(storageAccount string, metadata ImageMetadata) string {
+	imageName := metadata.ImageName
+	if !strings.HasSuffix(imageName, ".vhd") {
+		imageName = imageName + ".vhd"
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", storageAccount, metadata.ContainerName, imageName)
+}
+
+// CreateManagedImage creates a generalized Linux managed image from the VHD
+// page blob at `blobURL` and returns the resource ID of the new image.
+func (c *ManagementClient) CreateManagedImage(ctx context.Context, options ManagedImageOptions, blobURL string) (string, error) {
+	resource := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/images/%s",
+		c.credentials.SubscriptionID, options.ResourceGroup, options.ImageName)
+
+	generation := options.HyperVGeneration
+	switch generation {
+	case "":
+		generation = "V1"
+	case "V1", "V2":
+	default:
+		return "", fmt.Errorf("unexpected hyper-v generation: %s", generation)
+	}
+
+	body := map[string]interface{}{
+		"location": options.Location,
+		"properties": map[string]interface{}{
+			"hyperVGeneration": generation,
+			"storageProfile": map[string]interface{}{
+				"osDisk": map[string]interface{}{
+					"osType":  "Linux",
+					"osState": "Generalized",
+					"blobUri": blobURL,
+				},
+			},
+		},
+	}
+
+	return c.createResource(ctx, resource, body)
+}
+
+// CreateGalleryImageVersion creates a new version of an image definition in a
+// shared image gallery from the managed image `imageID` and returns the
+// resource ID of the new version. The version is replicated to the location of
+// the managed image only.
+func (c *ManagementClient) CreateGalleryImageVersion(ctx context.Context, options GalleryImageVersionOptions, image ManagedImageOptions, imageID string) (string, error) {
+	resource := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s/versions/%s",
+		c.credentials.SubscriptionID, image.ResourceGroup, options.Gallery, options.ImageDefinition, options.Version)
+
+	body := map[string]interface{}{
+		"location": image.Location,
+		"properties": map[string]interface{}{
+			"storageProfile": map[string]interface{}{
+				"source": map[string]interface{}{
+					"id": imageID,
+				},
+			},
+			"publishingProfile": map[string]interface{}{
+				"targetRegions": []interface{}{
+					map[string]interface{}{
+						"name": image.Location,
+					},
+				},
+			},
+		},
+	}
+
+	return c.createResource(ctx, resource, body)
+}
+
+// authenticate makes sure the client holds an access token for the
+// management API, which doesn't expire within the next few minutes. Tokens are
+// short-lived, and creating a resource may take longer than their lifetime.
+func (c *ManagementClient) authenticate(ctx context.Context) error {
+	if c.token == nil {
+		config, err := adal.NewOAuthConfig(c.loginEndpoint, c.credentials.TenantID)
+		if err != nil {
+			return fmt.Errorf("cannot configure azure authentication: %v", err)
+		}
+
+		token, err := adal.NewServicePrincipalToken(*config, c.credentials.ClientID, c.credentials.ClientSecret, c.managementEndpoint+"/")
+		if err != nil {
+			return fmt.Errorf("cannot configure azure authentication: %v", err)
+		}
+		token.SetSender(c.httpClient)
+		c.token = token
+	}
+
+	err := c.token.EnsureFreshWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot authenticate to azure: %v", err)
+	}
+
+	return nil
+}
+
+func (c *ManagementClient) request(ctx context.Context, method, u string, body interface{}) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := c.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token.OAuthToken())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// createResource creates (or updates) `resource` and waits until it is
+// provisioned. It returns the ID of the resource. It gives up when `ctx` is
+// done or the operation didn't finish within the client's operation timeout.
+func (c *ManagementClient) createResource(ctx context.Context, resource string, body interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.operationTimeout)
+	defer cancel()
+
+	resourceURL := fmt.Sprintf("%s%s?api-version=%s", c.managementEndpoint, resource, computeAPIVersion)
+	resp, err := c.request(ctx, http.MethodPut, resourceURL, body)
+	if err != nil {
+		return "", fmt.Errorf("cannot create %s: %v", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("creating %s returned %s: %s", resource, resp.Status, errorMessage(resp))
+	}
+
+	var created armResource
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse response when creating %s: %v", resource, err)
+	}
+
+	if created.ID == "" {
+		created.ID = resource
+	}
+
+	// Long-running operations announce where their status can be polled.
+	// Fall back to polling the resource itself, if they don't.
+	statusURL := resp.Header.Get("Azure-AsyncOperation")
+	state := created.Properties.ProvisioningState
+	for {
+		if statusURL != "" {
+			state, err = c.operationStatus(ctx, statusURL)
+		} else if state == "" {
+			state, err = c.provisioningState(ctx, resourceURL)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch strings.ToLower(state) {
+		case "succeeded":
+			return created.ID, nil
+		case "failed", "canceled":
+			return "", fmt.Errorf("creating %s did not succeed: %s", resource, state)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("creating %s did not finish: %v", resource, ctx.Err())
+		case <-time.After(c.pollInterval):
+		}
+		state = ""
+	}
+}
+
+type armResource struct {
+	ID         string `json:"id"`
+	Properties struct {
+		ProvisioningState string `json:"provisioningState"`
+	} `json:"properties"`
+}
+
+func (c *ManagementClient) operationStatus(ctx context.Context, statusURL string) (string, error) {
+	resp, err := c.request(ctx, http.MethodGet, statusURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot get operation status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting operation status returned %s: %s", resp.Status, errorMessage(resp))
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse operation status: %v", err)
+	}
+
+	return status.Status, nil
+}
+
+// provisioningState returns the provisioning state of the resource at
+// `resourceURL`.
+func (c *ManagementClient) provisioningState(ctx context.Context, resourceURL string) (string, error) {
+	resp, err := c.request(ctx, http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot get provisioning state: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting provisioning state returned %s: %s", resp.Status, errorMessage(resp))
+	}
+
+	var r armResource
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse provisioning state: %v", err)
+	}
+
+	return r.Properties.ProvisioningState, nil
+}
+
+// errorMessage extracts the message of an Azure Resource Manager error
+// response.
+func errorMessage(resp *http.Response) string {
+	var armError struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&armError)
+	if err != nil || armError.Error.Message == "" {
+		return "unknown error"
+	}
+
+	return fmt.Sprintf("%s: %s", armError.Error.Code, armError.Error.Message)
+}
@@ -0,0 +1,224 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAzure is a stand-in for the login and resource manager endpoints. It
+// creates resources asynchronously: they are reported as in progress the
+// first time their operation status is queried. Access tokens are valid for
+// an hour, unless `tokenLifetime` is set.
+type fakeAzure struct {
+	resources     map[string]map[string]interface{}
+	polled        map[string]bool
+	tokens        map[string]time.Time
+	tokenLifetime time.Duration
+	fail          bool
+	stuck         bool
+}
+
+func newFakeAzure() *fakeAzure {
+	return &fakeAzure{
+		resources: make(map[string]map[string]interface{}),
+		polled:    make(map[string]bool),
+		tokens:    make(map[string]time.Time),
+	}
+}
+
+func (f *fakeAzure) validToken(authorization string) bool {
+	expires, ok := f.tokens[strings.TrimPrefix(authorization, "Bearer ")]
+	return ok && time.Now().Before(expires)
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/oauth2/token"):
+		if r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lifetime := f.tokenLifetime
+		if lifetime == 0 {
+			lifetime = time.Hour
+		}
+		token := fmt.Sprintf("t0ken-%d", len(f.tokens))
+		expires := time.Now().Add(lifetime)
+		f.tokens[token] = expires
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": token,
+			"expires_in":   fmt.Sprintf("%d", int(lifetime.Seconds())),
+			"expires_on":   fmt.Sprintf("%f", float64(expires.UnixNano())/1e9),
+		})
+		return
+
+	case !f.validToken(r.Header.Get("Authorization")):
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/operations/"):
+		id := strings.TrimPrefix(r.URL.Path, "/operations")
+		status := "InProgress"
+		if f.polled[id] && !f.stuck {
+			status = "Succeeded"
+			if f.fail {
+				status = "Failed"
+			}
+		}
+		f.polled[id] = true
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": status})
+
+	case r.Method == http.MethodPut:
+		if r.URL.Query().Get("api-version") != computeAPIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.resources[r.URL.Path] = body
+		w.Header().Set("Azure-AsyncOperation", "http://"+r.Host+"/operations"+r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": r.URL.Path,
+			"properties": map[string]string{
+				"provisioningState": "Creating",
+			},
+		})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestClient(server *httptest.Server, secret string) *ManagementClient {
+	c := NewManagementClient(ClientCredentials{
+		TenantID:       "tenant",
+		ClientID:       "client",
+		ClientSecret:   secret,
+		SubscriptionID: "subscription",
+	})
+	c.loginEndpoint = server.URL
+	c.managementEndpoint = server.URL
+	c.pollInterval = 0
+	return c
+}
+
+func TestCreateManagedImage(t *testing.T) {
+	fake := newFakeAzure()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	image := ManagedImageOptions{
+		ResourceGroup: "group",
+		Location:      "westeurope",
+		ImageName:     "image",
+	}
+	blobURL := BlobURL("account", ImageMetadata{ContainerName: "container", ImageName: "image"})
+	require.Equal(t, "https://account.blob.core.windows.net/container/image.vhd", blobURL)
+
+	c := newTestClient(server, "secret")
+	imageID, err := c.CreateManagedImage(context.Background(), image, blobURL)
+	require.NoError(t, err)
+	require.Equal(t, "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/image", imageID)
+	require.Equal(t, "westeurope", fake.resources[imageID]["location"])
+	require.Equal(t, "V1", fake.resources[imageID]["properties"].(map[string]interface{})["hyperVGeneration"])
+	osDisk := fake.resources[imageID]["properties"].(map[string]interface{})["storageProfile"].(map[string]interface{})["osDisk"].(map[string]interface{})
+	require.Equal(t, blobURL, osDisk["blobUri"])
+
+	versionID, err := c.CreateGalleryImageVersion(context.Background(), GalleryImageVersionOptions{
+		Gallery:         "gallery",
+		ImageDefinition: "definition",
+		Version:         "1.0.0",
+	}, image, imageID)
+	require.NoError(t, err)
+	require.Equal(t, "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/galleries/gallery/images/definition/versions/1.0.0", versionID)
+	source := fake.resources[versionID]["properties"].(map[string]interface{})["storageProfile"].(map[string]interface{})["source"].(map[string]interface{})
+	require.Equal(t, imageID, source["id"])
+
+	fake.fail = true
+	image.ImageName = "failing"
+	_, err = c.CreateManagedImage(context.Background(), image, blobURL)
+	require.Error(t, err)
+
+	_, err = newTestClient(server, "wrong").CreateManagedImage(context.Background(), image, blobURL)
+	require.Error(t, err)
+}
+
+func TestCreateManagedImageHyperVGeneration(t *testing.T) {
+	fake := newFakeAzure()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	image := ManagedImageOptions{
+		ResourceGroup:    "group",
+		Location:         "westeurope",
+		ImageName:        "image",
+		HyperVGeneration: "V2",
+	}
+	c := newTestClient(server, "secret")
+	imageID, err := c.CreateManagedImage(context.Background(), image, "https://account.blob.core.windows.net/container/image.vhd")
+	require.NoError(t, err)
+	require.Equal(t, "V2", fake.resources[imageID]["properties"].(map[string]interface{})["hyperVGeneration"])
+
+	image.HyperVGeneration = "V3"
+	_, err = c.CreateManagedImage(context.Background(), image, "https://account.blob.core.windows.net/container/image.vhd")
+	require.Error(t, err)
+}
+
+func TestCreateManagedImageTimeout(t *testing.T) {
+	fake := newFakeAzure()
+	fake.stuck = true
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	image := ManagedImageOptions{
+		ResourceGroup: "group",
+		Location:      "westeurope",
+		ImageName:     "image",
+	}
+	blobURL := "https://account.blob.core.windows.net/container/image.vhd"
+
+	c := newTestClient(server, "secret")
+	c.pollInterval = 10 * time.Millisecond
+	c.operationTimeout = 100 * time.Millisecond
+	_, err := c.CreateManagedImage(context.Background(), image, blobURL)
+	require.Error(t, err)
+
+	c.operationTimeout = defaultOperationTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = c.CreateManagedImage(ctx, image, blobURL)
+	require.Error(t, err)
+}
+
+func TestCreateManagedImageRefreshesToken(t *testing.T) {
+	fake := newFakeAzure()
+	fake.tokenLifetime = 50 * time.Millisecond
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	image := ManagedImageOptions{
+		ResourceGroup: "group",
+		Location:      "westeurope",
+		ImageName:     "image",
+	}
+
+	// the first token expires while waiting for the operation
+	c := newTestClient(server, "secret")
+	c.pollInterval = 100 * time.Millisecond
+	_, err := c.CreateManagedImage(context.Background(), image, "https://account.blob.core.windows.net/container/image.vhd")
+	require.NoError(t, err)
+	require.Greater(t, len(fake.tokens), 1)
+}
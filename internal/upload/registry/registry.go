@@ -0,0 +1,417 @@
+// Package registry pushes OCI image archives to container registries that
+// implement the Docker Registry HTTP API V2 (also known as the OCI
+// distribution specification).
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+const mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+// Credentials are used to authenticate against the registry. If both fields
+// are empty, the registry is accessed anonymously.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Client pushes images into a single registry.
+type Client struct {
+	baseURL     *url.URL
+	credentials Credentials
+	httpClient  *http.Client
+
+	// authorization is the value of the Authorization header sent with
+	// every request, once the authentication scheme of the registry is
+	// known.
+	authorization string
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type index struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// New creates a client for `registry`, which is either a host name with an
+// optional port, in which case https is used, or a URL.
+func New(registry string, credentials Credentials, tlsVerify bool) (*Client, error) {
+	if !strings.Contains(registry, "://") {
+		registry = "https://" + registry
+	}
+
+	baseURL, err := url.Parse(registry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry address %s: %v", registry, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !tlsVerify {
+		/* #nosec G402 */
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		baseURL:     baseURL,
+		credentials: credentials,
+		httpClient:  &http.Client{Transport: transport},
+	}, nil
+}
+
+// PushArchive pushes the OCI archive stored in `fileName` into `repository`
+// and tags it with all of `tags`. It returns the digest of the image
+// manifest, which identifies the image in the registry independently of its
+// tags.
+func (c *Client) PushArchive(fileName, repository string, tags []string) (string, error) {
+	var idx index
+	err := readArchiveJSON(fileName, "index.json", &idx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(idx.Manifests) != 1 {
+		return "", fmt.Errorf("expected exactly one manifest in %s, got %d", fileName, len(idx.Manifests))
+	}
+	manifestDescriptor := idx.Manifests[0]
+
+	rawManifest, err := readArchiveFile(fileName, blobPath(manifestDescriptor.Digest))
+	if err != nil {
+		return "", err
+	}
+
+	var m manifest
+	err = json.Unmarshal(rawManifest, &m)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse image manifest: %v", err)
+	}
+
+	mediaType := manifestDescriptor.MediaType
+	if mediaType == "" {
+		mediaType = m.MediaType
+	}
+	if mediaType == "" {
+		mediaType = mediaTypeOCIManifest
+	}
+
+	err = c.authenticate(repository)
+	if err != nil {
+		return "", err
+	}
+
+	for _, blob := range append([]descriptor{m.Config}, m.Layers...) {
+		err = c.pushBlob(fileName, repository, blob)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	references := tags
+	if len(references) == 0 {
+		references = []string{manifestDescriptor.Digest}
+	}
+
+	for _, reference := range references {
+		err = c.pushManifest(repository, reference, mediaType, rawManifest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return manifestDescriptor.Digest, nil
+}
+
+func (c *Client) url(p string) string {
+	u := *c.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	return u.String()
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	return c.httpClient.Do(req)
+}
+
+// authenticate finds out how the registry wants clients to authenticate and
+// sets up the authorization header accordingly. Registries announce this in
+// the WWW-Authenticate header of the version check endpoint.
+func (c *Client) authenticate(repository string) error {
+	resp, err := c.httpClient.Get(c.url("/v2/"))
+	if err != nil {
+		return fmt.Errorf("cannot reach registry: %v", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+	default:
+		return fmt.Errorf("registry version check returned %s", resp.Status)
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req, err := http.NewRequest(http.MethodGet, c.url("/v2/"), nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+
+	case "bearer":
+		token, err := c.fetchToken(params, repository)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported authentication scheme: '%s'", scheme)
+	}
+}
+
+func (c *Client) fetchToken(params map[string]string, repository string) (string, error) {
+	realm, ok := params["realm"]
+	if !ok {
+		return "", errors.New("registry did not send a token realm")
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %s: %v", realm, err)
+	}
+
+	query := u.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", repository))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.credentials.Username != "" || c.credentials.Password != "" {
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch registry token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching registry token returned %s", resp.Status)
+	}
+
+	var reply struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&reply)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse registry token: %v", err)
+	}
+
+	if reply.Token != "" {
+		return reply.Token, nil
+	}
+	if reply.AccessToken != "" {
+		return reply.AccessToken, nil
+	}
+
+	return "", errors.New("registry did not return a token")
+}
+
+func (c *Client) pushBlob(fileName, repository string, blob descriptor) error {
+	req, err := http.NewRequest(http.MethodHead, c.url(fmt.Sprintf("/v2/%s/blobs/%s", repository, blob.Digest)), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("cannot check for blob %s: %v", blob.Digest, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	req, err = http.NewRequest(http.MethodPost, c.url(fmt.Sprintf("/v2/%s/blobs/uploads/", repository)), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err = c.do(req)
+	if err != nil {
+		return fmt.Errorf("cannot start upload of blob %s: %v", blob.Digest, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("starting upload of blob %s returned %s", blob.Digest, resp.Status)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("registry did not return an upload location for blob %s: %v", blob.Digest, err)
+	}
+
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	content, err := findArchiveFile(f, blobPath(blob.Digest))
+	if err != nil {
+		return err
+	}
+
+	req, err = http.NewRequest(http.MethodPut, location.String(), content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = blob.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err = c.do(req)
+	if err != nil {
+		return fmt.Errorf("cannot upload blob %s: %v", blob.Digest, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("uploading blob %s returned %s", blob.Digest, resp.Status)
+	}
+
+	return nil
+}
+
+func (c *Client) pushManifest(repository, reference, mediaType string, content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.url(fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("cannot push manifest %s: %v", reference, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("pushing manifest %s returned %s", reference, resp.Status)
+	}
+
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header of the form
+// `Bearer realm="...",service="..."` into its scheme and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], "\"")
+	}
+
+	return parts[0], params
+}
+
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// findArchiveFile advances the tar archive in `r` to the file called `name`
+// and returns a reader for its content.
+func findArchiveFile(r io.Reader, name string) (io.Reader, error) {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read archive: %v", err)
+		}
+
+		if path.Clean(header.Name) == name {
+			return tr, nil
+		}
+	}
+}
+
+func readArchiveFile(fileName, name string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content, err := findArchiveFile(f, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(content)
+}
+
+func readArchiveJSON(fileName, name string, v interface{}) error {
+	content, err := readArchiveFile(fileName, name)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package registry_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/registry"
+)
+
+// fakeRegistry is a minimal in-memory stand-in for a container registry,
+// which implements just enough of the distribution API to push images.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	username  string
+	password  string
+	uploads   int
+}
+
+func newFakeRegistry(username, password string) *fakeRegistry {
+	return &fakeRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		username:  username,
+		password:  password,
+	}
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.username != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != r.username || password != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	p := req.URL.Path
+	switch {
+	case p == "/v2/":
+		w.WriteHeader(http.StatusOK)
+
+	case req.Method == http.MethodHead && strings.Contains(p, "/blobs/"):
+		digest := path.Base(p)
+		if _, exists := r.blobs[digest]; !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case req.Method == http.MethodPost && strings.HasSuffix(p, "/blobs/uploads/"):
+		w.Header().Set("Location", p+"session")
+		w.WriteHeader(http.StatusAccepted)
+
+	case req.Method == http.MethodPut && strings.HasSuffix(p, "/blobs/uploads/session"):
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		digest := req.URL.Query().Get("digest")
+		if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(content)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = content
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+
+	case req.Method == http.MethodPut && strings.Contains(p, "/manifests/"):
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.manifests[strings.TrimPrefix(p, "/v2/")] = content
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// writeArchive creates an OCI archive with a single image and returns the
+// path to it and the digest of its manifest.
+func writeArchive(t *testing.T, dir string) (string, string) {
+	layer := []byte("layer content")
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    digestOf(config),
+			"size":      len(config),
+		},
+		"layers": []interface{}{
+			map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar",
+				"digest":    digestOf(layer),
+				"size":      len(layer),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []interface{}{
+			map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest":    digestOf(manifest),
+				"size":      len(manifest),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"index.json", index},
+		{"blobs/sha256/" + strings.TrimPrefix(digestOf(manifest), "sha256:"), manifest},
+		{"blobs/sha256/" + strings.TrimPrefix(digestOf(config), "sha256:"), config},
+		{"blobs/sha256/" + strings.TrimPrefix(digestOf(layer), "sha256:"), layer},
+	}
+
+	archivePath := path.Join(dir, "container.tar")
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, file := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name: file.name,
+			Mode: 0644,
+			Size: int64(len(file.content)),
+		})
+		require.NoError(t, err)
+		_, err = tw.Write(file.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	return archivePath, digestOf(manifest)
+}
+
+func TestPushArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	archive, manifestDigest := writeArchive(t, dir)
+
+	t.Run("anonymous", func(t *testing.T) {
+		fake := newFakeRegistry("", "")
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client, err := registry.New(server.URL, registry.Credentials{}, true)
+		require.NoError(t, err)
+
+		digest, err := client.PushArchive(archive, "osbuild/test", []string{"latest", "v1"})
+		require.NoError(t, err)
+		require.Equal(t, manifestDigest, digest)
+		require.Len(t, fake.blobs, 2)
+		require.Contains(t, fake.manifests, "osbuild/test/manifests/latest")
+		require.Contains(t, fake.manifests, "osbuild/test/manifests/v1")
+		require.Equal(t, manifestDigest, digestOf(fake.manifests["osbuild/test/manifests/latest"]))
+
+		// pushing again doesn't upload the blobs again
+		_, err = client.PushArchive(archive, "osbuild/test", nil)
+		require.NoError(t, err)
+		require.Equal(t, 2, fake.uploads)
+		require.Contains(t, fake.manifests, "osbuild/test/manifests/"+manifestDigest)
+	})
+
+	t.Run("basic-auth", func(t *testing.T) {
+		fake := newFakeRegistry("user", "secret")
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client, err := registry.New(server.URL, registry.Credentials{Username: "user", Password: "secret"}, true)
+		require.NoError(t, err)
+		digest, err := client.PushArchive(archive, "osbuild/test", []string{"latest"})
+		require.NoError(t, err)
+		require.Equal(t, manifestDigest, digest)
+
+		client, err = registry.New(server.URL, registry.Credentials{Username: "user", Password: "wrong"}, true)
+		require.NoError(t, err)
+		_, err = client.PushArchive(archive, "osbuild/test", []string{"latest"})
+		require.Error(t, err)
+	})
+
+	t.Run("bearer-token", func(t *testing.T) {
+		fake := newFakeRegistry("", "")
+		mux := http.NewServeMux()
+		var server *httptest.Server
+		mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+			require.Equal(t, "repository:osbuild/test:pull,push", req.URL.Query().Get("scope"))
+			require.Equal(t, "fake", req.URL.Query().Get("service"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		})
+		mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") != "Bearer t0ken" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fake.ServeHTTP(w, req)
+		})
+		server = httptest.NewServer(mux)
+		defer server.Close()
+
+		client, err := registry.New(server.URL, registry.Credentials{}, true)
+		require.NoError(t, err)
+		digest, err := client.PushArchive(archive, "osbuild/test", []string{"latest"})
+		require.NoError(t, err)
+		require.Equal(t, manifestDigest, digest)
+	})
+
+	t.Run("invalid-archive", func(t *testing.T) {
+		client, err := registry.New("localhost:1", registry.Credentials{}, true)
+		require.NoError(t, err)
+		_, err = client.PushArchive(path.Join(dir, "does-not-exist.tar"), "osbuild/test", nil)
+		require.Error(t, err)
+	})
+}
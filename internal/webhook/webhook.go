@@ -0,0 +1,148 @@
+// Package webhook delivers event notifications to HTTP endpoints. Each
+// notification is a JSON document POSTed to the endpoint, signed with a
+// secret shared with the receiver, and retried when delivery fails.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SignatureHeader contains the HMAC-SHA256 of the request body, keyed with
+// the webhook's secret, in the form "sha256=<hex digest>". It is only set
+// for webhooks with a secret.
+const SignatureHeader = "X-Composer-Signature-256"
+
+// EventHeader contains the type of the event, e.g. "compose".
+const EventHeader = "X-Composer-Event"
+
+// DeliveryHeader contains a unique id of the notification, which is the
+// same for all attempts to deliver it.
+const DeliveryHeader = "X-Composer-Delivery"
+
+// Notification is the body of every request sent to a webhook.
+type Notification struct {
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Sender delivers notifications in the background.
+type Sender struct {
+	client *http.Client
+	logger *log.Logger
+
+	// number of attempts and the delay before the first retry, which
+	// doubles with every further retry
+	maxAttempts int
+	retryDelay  time.Duration
+
+	wg sync.WaitGroup
+}
+
+func NewSender(client *http.Client, logger *log.Logger) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Sender{
+		client:      client,
+		logger:      logger,
+		maxAttempts: 5,
+		retryDelay:  time.Second,
+	}
+}
+
+// Sign returns the value of SignatureHeader for `body`.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns whether `signature` is the valid value of SignatureHeader
+// for `body`.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// Send notifies the webhook at `url` about an event of type `event`. It
+// returns immediately and delivers the notification in the background.
+func (s *Sender) Send(url, secret, event string, data interface{}) error {
+	body, err := json.Marshal(Notification{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	delivery := uuid.New().String()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		delay := s.retryDelay
+		for attempt := 1; ; attempt++ {
+			err := s.deliver(url, secret, event, delivery, body)
+			if err == nil {
+				return
+			}
+
+			if attempt >= s.maxAttempts {
+				if s.logger != nil {
+					s.logger.Printf("giving up delivering %s event to webhook %s: %v", event, url, err)
+				}
+				return
+			}
+
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+
+	return nil
+}
+
+// Wait blocks until all notifications were delivered or given up on.
+func (s *Sender) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Sender) deliver(url, secret, event, delivery string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, delivery)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
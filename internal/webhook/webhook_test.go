@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"compose"}`)
+	signature := Sign("secret", body)
+
+	require.Equal(t, "sha256=", signature[:7])
+	require.True(t, Verify("secret", body, signature))
+	require.False(t, Verify("other", body, signature))
+	require.False(t, Verify("secret", []byte(`{}`), signature))
+}
+
+func TestSend(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+
+	// fails the first two attempts
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		if len(requests) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sender := NewSender(nil, nil)
+	sender.retryDelay = time.Millisecond
+
+	err := sender.Send(server.URL, "secret", "compose", map[string]string{"id": "42"})
+	require.NoError(t, err)
+	sender.Wait()
+
+	require.Len(t, requests, 3)
+	for i, r := range requests {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "compose", r.Header.Get(EventHeader))
+		require.Equal(t, requests[0].Header.Get(DeliveryHeader), r.Header.Get(DeliveryHeader))
+		require.True(t, Verify("secret", bodies[i], r.Header.Get(SignatureHeader)))
+	}
+
+	var notification struct {
+		Event string            `json:"event"`
+		Data  map[string]string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(bodies[2], &notification))
+	require.Equal(t, "compose", notification.Event)
+	require.Equal(t, map[string]string{"id": "42"}, notification.Data)
+}
+
+func TestSendGivesUp(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		require.Empty(t, r.Header.Get(SignatureHeader))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sender := NewSender(nil, nil)
+	sender.retryDelay = time.Millisecond
+	sender.maxAttempts = 3
+
+	// no signature without a secret
+	err := sender.Send(server.URL, "", "upload", nil)
+	require.NoError(t, err)
+	sender.Wait()
+
+	require.Equal(t, 3, attempts)
+}
@@ -0,0 +1,260 @@
+package weldr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/sbom"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// advisoriesArtifact is the name of the job artifact the advisory report of
+// an image is stored as when it is built.
+const advisoriesArtifact = "advisories.json"
+
+// Number of finished images waiting for their advisory report. Images which
+// finish while the queue is full get no stored report; theirs is checked
+// when it is requested instead.
+const advisoryCheckQueueSize = 64
+
+type advisoryCheck struct {
+	composeID uuid.UUID
+	compose   store.Compose
+	ib        store.ImageBuild
+}
+
+// advisoryReport lists the advisories which ship newer versions of packages
+// installed into an image, as published by the repositories when the report
+// was checked.
+type advisoryReport struct {
+	ID         uuid.UUID             `json:"uuid"`
+	ImageBuild int                   `json:"image_build"`
+	Checked    time.Time             `json:"checked"`
+	Advisories []advisoryReportEntry `json:"advisories"`
+}
+
+type advisoryReportEntry struct {
+	ID       string                  `json:"id"`
+	Type     string                  `json:"type"`
+	Severity string                  `json:"severity,omitempty"`
+	Title    string                  `json:"title"`
+	Issued   string                  `json:"issued,omitempty"`
+	CVEs     []string                `json:"cves,omitempty"`
+	Packages []advisoryReportPackage `json:"packages"`
+}
+
+type advisoryReportPackage struct {
+	Name      string `json:"name"`
+	Arch      string `json:"arch"`
+	Installed string `json:"installed"`
+	Fixed     string `json:"fixed"`
+}
+
+// checkAdvisories checks the packages installed into the image built by `ib`
+// against the advisories the repositories of namespace `ns` currently
+// publish.
+func (api *API) checkAdvisories(ns *store.Store, composeID uuid.UUID, ib store.ImageBuild, status *composeStatus) (*advisoryReport, error) {
+	advisories, err := api.rpmmd.FetchAdvisories(api.allRepositories(ns), api.distro.ModulePlatformID(), api.arch.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []rpmmd.PackageSpec
+	for _, pkg := range sbom.ImagePackages(status.Result, ib.Packages) {
+		installed = append(installed, rpmmd.PackageSpec{
+			Name:    pkg.Name,
+			Epoch:   pkg.Epoch,
+			Version: pkg.Version,
+			Release: pkg.Release,
+			Arch:    pkg.Arch,
+		})
+	}
+
+	report := &advisoryReport{
+		ID:         composeID,
+		ImageBuild: ib.ID,
+		Checked:    time.Now(),
+		Advisories: []advisoryReportEntry{},
+	}
+	for _, match := range rpmmd.MatchAdvisories(advisories, installed) {
+		entry := advisoryReportEntry{
+			ID:       match.Advisory.ID,
+			Type:     match.Advisory.Type,
+			Severity: match.Advisory.Severity,
+			Title:    match.Advisory.Title,
+			Issued:   match.Advisory.Issued,
+			CVEs:     match.Advisory.CVEs,
+		}
+		for _, pkg := range match.Packages {
+			entry.Packages = append(entry.Packages, advisoryReportPackage{
+				Name:      pkg.Installed.Name,
+				Arch:      pkg.Installed.Arch,
+				Installed: pkg.Installed.GetEVR(),
+				Fixed:     pkg.Fixed.EVR(),
+			})
+		}
+		report.Advisories = append(report.Advisories, entry)
+	}
+
+	return report, nil
+}
+
+// queueAdvisoryCheck queues storing the advisory report of the image built by
+// `ib`, for RunAdvisoryChecks. It doesn't block.
+func (api *API) queueAdvisoryCheck(composeID uuid.UUID, compose store.Compose, ib store.ImageBuild) {
+	select {
+	case api.advisoryChecks <- advisoryCheck{composeID, compose, ib}:
+	default:
+		if api.logger != nil {
+			api.logger.Printf("not storing advisory report of compose %s: too many images are waiting for theirs", composeID)
+		}
+	}
+}
+
+// RunAdvisoryChecks stores the advisory reports of finished images one after
+// the other, until `ctx` is canceled.
+func (api *API) RunAdvisoryChecks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case check := <-api.advisoryChecks:
+			err := api.attachAdvisories(check.composeID, check.compose, check.ib)
+			if err != nil && api.logger != nil {
+				api.logger.Printf("cannot store advisory report of compose %s: %v", check.composeID, err)
+			}
+		}
+	}
+}
+
+// attachAdvisories stores the advisory report of the image built by `ib` as
+// an artifact of its job, so that the advisories outstanding when the image
+// was built are kept next to it.
+func (api *API) attachAdvisories(composeID uuid.UUID, compose store.Compose, ib store.ImageBuild) error {
+	report, err := api.checkAdvisories(api.store.Namespace(compose.Namespace), composeID, ib, api.getImageBuildStatus(ib))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(report)
+	if err != nil {
+		return err
+	}
+
+	return api.workers.AddArtifact(ib.JobID, advisoriesArtifact, &buf)
+}
+
+// storedAdvisories returns the advisory report stored when the image built by
+// `ib` finished, if there is one.
+func (api *API) storedAdvisories(ib store.ImageBuild) (*advisoryReport, bool) {
+	reader, _, err := api.workers.JobArtifact(ib.JobID, advisoriesArtifact)
+	if err != nil {
+		return nil, false
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, false
+	}
+
+	var report advisoryReport
+	err = json.Unmarshal(data, &report)
+	if err != nil {
+		return nil, false
+	}
+
+	return &report, true
+}
+
+// composeAdvisoriesHandler returns the advisories which affect packages in an
+// image of a finished compose. By default, this is the report stored when the
+// image was built. With "recheck=true", or when no report was stored, the
+// packages are checked against the advisories the repositories publish now.
+func (api *API) composeAdvisoriesHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 0) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid build uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	compose, exists := ns.GetCompose(id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Compose %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	recheck := false
+	if value := request.URL.Query().Get("recheck"); value != "" {
+		recheck, err = strconv.ParseBool(value)
+		if err != nil {
+			errors := responseError{
+				ID:  "BadQuery",
+				Msg: "BadRequest: invalid value for 'recheck': " + err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	ib, ok := imageBuildParam(writer, request, compose)
+	if !ok {
+		return
+	}
+
+	imageBuildStatus := api.getComposeStatus(compose).ImageBuilds[ib.ID]
+	if imageBuildStatus.State != common.CFinished {
+		errors := responseError{
+			ID:  "BuildInWrongState",
+			Msg: fmt.Sprintf("Build %s is in wrong state: %s", uuidString, imageBuildStatus.State.ToString()),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	report, stored := api.storedAdvisories(*ib)
+	if recheck || !stored {
+		report, err = api.checkAdvisories(ns, id, *ib, imageBuildStatus)
+		if err != nil {
+			errors := responseError{
+				ID:  "AdvisoriesError",
+				Msg: fmt.Sprintf("Cannot fetch advisories: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	err = json.NewEncoder(writer).Encode(report)
+	common.PanicOnError(err)
+}
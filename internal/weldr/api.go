@@ -17,6 +17,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -25,12 +26,14 @@ import (
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/composes"
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue"
 	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/target"
+	"github.com/osbuild/osbuild-composer/internal/webhook"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 )
 
@@ -45,8 +48,25 @@ type API struct {
 
 	logger *log.Logger
 	router *httprouter.Router
+	events *eventHub
+
+	webhooks *webhook.Sender
+
+	authenticators []Authenticator
+	auditLog       io.Writer
+	auditMu        sync.Mutex
 
 	compatOutputDir string
+
+	retention   RetentionPolicy
+	diskUsage   DiskUsageFunc
+	retentionMu sync.Mutex
+
+	manifestSchemas *osbuild.Schemas
+
+	advisoryChecks chan advisoryCheck
+
+	uploadRetryDelay time.Duration
 }
 
 // systemRepoIDs returns a list of the system repos
@@ -58,6 +78,21 @@ func (api *API) systemRepoNames() (names []string) {
 	return names
 }
 
+// SetManifestSchemas sets the schemas of osbuild's stages which manifests are
+// validated against before they're queued. They default to the schemas
+// vendored into composer.
+func (api *API) SetManifestSchemas(schemas *osbuild.Schemas) {
+	api.manifestSchemas = schemas
+}
+
+func (api *API) validateManifest(manifest *distro.Manifest) error {
+	err := api.manifestSchemas.Validate(&manifest.Manifest)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+	return nil
+}
+
 var ValidBlueprintName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
 func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmmd.RepoConfig, logger *log.Logger, store *store.Store, workers *worker.Server, compatOutputDir string) *API {
@@ -70,6 +105,11 @@ func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmm
 		repos:           repos,
 		logger:          logger,
 		compatOutputDir: compatOutputDir,
+		webhooks:        webhook.NewSender(nil, logger),
+		manifestSchemas: osbuild.VendoredSchemas(),
+		advisoryChecks:  make(chan advisoryCheck, advisoryCheckQueueSize),
+
+		uploadRetryDelay: defaultUploadRetryDelay,
 	}
 
 	api.router = httprouter.New()
@@ -78,71 +118,238 @@ func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmm
 	api.router.MethodNotAllowed = http.HandlerFunc(methodNotAllowedHandler)
 	api.router.NotFound = http.HandlerFunc(notFoundHandler)
 
-	api.router.GET("/api/status", api.statusHandler)
-	api.router.GET("/api/v:version/projects/source/list", api.sourceListHandler)
-	api.router.GET("/api/v:version/projects/source/info/", api.sourceEmptyInfoHandler)
-	api.router.GET("/api/v:version/projects/source/info/:sources", api.sourceInfoHandler)
-	api.router.POST("/api/v:version/projects/source/new", api.sourceNewHandler)
-	api.router.DELETE("/api/v:version/projects/source/delete/*source", api.sourceDeleteHandler)
+	api.router.GET("/api/status", api.authorize(RoleNone, api.statusHandler))
+	api.router.GET("/api/v:version/projects/source/list", api.authorize(RoleViewer, api.sourceListHandler))
+	api.router.GET("/api/v:version/projects/source/info/", api.authorize(RoleViewer, api.sourceEmptyInfoHandler))
+	api.router.GET("/api/v:version/projects/source/info/:sources", api.authorize(RoleViewer, api.sourceInfoHandler))
+	api.router.POST("/api/v:version/projects/source/new", api.authorize(RoleAdmin, api.sourceNewHandler))
+	api.router.DELETE("/api/v:version/projects/source/delete/*source", api.authorize(RoleAdmin, api.sourceDeleteHandler))
 
-	api.router.GET("/api/v:version/projects/depsolve", api.projectsDepsolveHandler)
-	api.router.GET("/api/v:version/projects/depsolve/*projects", api.projectsDepsolveHandler)
+	api.router.GET("/api/v:version/projects/depsolve", api.authorize(RoleViewer, api.projectsDepsolveHandler))
+	api.router.GET("/api/v:version/projects/depsolve/*projects", api.authorize(RoleViewer, api.projectsDepsolveHandler))
 
-	api.router.GET("/api/v:version/modules/list", api.modulesListHandler)
-	api.router.GET("/api/v:version/modules/list/*modules", api.modulesListHandler)
-	api.router.GET("/api/v:version/projects/list", api.projectsListHandler)
-	api.router.GET("/api/v:version/projects/list/", api.projectsListHandler)
+	api.router.GET("/api/v:version/modules/list", api.authorize(RoleViewer, api.modulesListHandler))
+	api.router.GET("/api/v:version/modules/list/*modules", api.authorize(RoleViewer, api.modulesListHandler))
+	api.router.GET("/api/v:version/projects/list", api.authorize(RoleViewer, api.projectsListHandler))
+	api.router.GET("/api/v:version/projects/list/", api.authorize(RoleViewer, api.projectsListHandler))
 
 	// these are the same, except that modules/info also includes dependencies
-	api.router.GET("/api/v:version/modules/info", api.modulesInfoHandler)
-	api.router.GET("/api/v:version/modules/info/*modules", api.modulesInfoHandler)
-	api.router.GET("/api/v:version/projects/info", api.modulesInfoHandler)
-	api.router.GET("/api/v:version/projects/info/*modules", api.modulesInfoHandler)
-
-	api.router.GET("/api/v:version/blueprints/list", api.blueprintsListHandler)
-	api.router.GET("/api/v:version/blueprints/info/*blueprints", api.blueprintsInfoHandler)
-	api.router.GET("/api/v:version/blueprints/depsolve/*blueprints", api.blueprintsDepsolveHandler)
-	api.router.GET("/api/v:version/blueprints/freeze/*blueprints", api.blueprintsFreezeHandler)
-	api.router.GET("/api/v:version/blueprints/diff/:blueprint/:from/:to", api.blueprintsDiffHandler)
-	api.router.GET("/api/v:version/blueprints/changes/*blueprints", api.blueprintsChangesHandler)
-	api.router.POST("/api/v:version/blueprints/new", api.blueprintsNewHandler)
-	api.router.POST("/api/v:version/blueprints/workspace", api.blueprintsWorkspaceHandler)
-	api.router.POST("/api/v:version/blueprints/undo/:blueprint/:commit", api.blueprintUndoHandler)
-	api.router.POST("/api/v:version/blueprints/tag/:blueprint", api.blueprintsTagHandler)
-	api.router.DELETE("/api/v:version/blueprints/delete/:blueprint", api.blueprintDeleteHandler)
-	api.router.DELETE("/api/v:version/blueprints/workspace/:blueprint", api.blueprintDeleteWorkspaceHandler)
-
-	api.router.POST("/api/v:version/compose", api.composeHandler)
-	api.router.DELETE("/api/v:version/compose/delete/:uuids", api.composeDeleteHandler)
-	api.router.GET("/api/v:version/compose/types", api.composeTypesHandler)
-	api.router.GET("/api/v:version/compose/queue", api.composeQueueHandler)
-	api.router.GET("/api/v:version/compose/status/:uuids", api.composeStatusHandler)
-	api.router.GET("/api/v:version/compose/info/:uuid", api.composeInfoHandler)
-	api.router.GET("/api/v:version/compose/finished", api.composeFinishedHandler)
-	api.router.GET("/api/v:version/compose/failed", api.composeFailedHandler)
-	api.router.GET("/api/v:version/compose/image/:uuid", api.composeImageHandler)
-	api.router.GET("/api/v:version/compose/metadata/:uuid", api.composeMetadataHandler)
-	api.router.GET("/api/v:version/compose/results/:uuid", api.composeResultsHandler)
-	api.router.GET("/api/v:version/compose/logs/:uuid", api.composeLogsHandler)
-	api.router.GET("/api/v:version/compose/log/:uuid", api.composeLogHandler)
-	api.router.POST("/api/v:version/compose/uploads/schedule/:uuid", api.uploadsScheduleHandler)
-	api.router.DELETE("/api/v:version/compose/cancel/:uuid", api.composeCancelHandler)
-
-	api.router.DELETE("/api/v:version/upload/delete/:uuid", api.uploadsDeleteHandler)
-	api.router.GET("/api/v:version/upload/info/:uuid", api.uploadsInfoHandler)
-	api.router.GET("/api/v:version/upload/log/:uuid", api.uploadsLogHandler)
-	api.router.POST("/api/v:version/upload/reset/:uuid", api.uploadsResetHandler)
-	api.router.DELETE("/api/v:version/upload/cancel/:uuid", api.uploadsCancelHandler)
-
-	api.router.GET("/api/v:version/upload/providers", api.providersHandler)
-	api.router.POST("/api/v:version/upload/providers/save", api.providersSaveHandler)
-	api.router.DELETE("/api/v:version/upload/providers/delete/:provider/:profile", api.providersDeleteHandler)
+	api.router.GET("/api/v:version/modules/info", api.authorize(RoleViewer, api.modulesInfoHandler))
+	api.router.GET("/api/v:version/modules/info/*modules", api.authorize(RoleViewer, api.modulesInfoHandler))
+	api.router.GET("/api/v:version/projects/info", api.authorize(RoleViewer, api.modulesInfoHandler))
+	api.router.GET("/api/v:version/projects/info/*modules", api.authorize(RoleViewer, api.modulesInfoHandler))
+
+	api.router.GET("/api/v:version/blueprints/list", api.authorize(RoleViewer, api.blueprintsListHandler))
+	api.router.GET("/api/v:version/blueprints/info/*blueprints", api.authorize(RoleViewer, api.blueprintsInfoHandler))
+	api.router.GET("/api/v:version/blueprints/depsolve/*blueprints", api.authorize(RoleViewer, api.blueprintsDepsolveHandler))
+	api.router.GET("/api/v:version/blueprints/freeze/*blueprints", api.authorize(RoleViewer, api.blueprintsFreezeHandler))
+	api.router.GET("/api/v:version/blueprints/diff/:blueprint/:from/:to", api.authorize(RoleViewer, api.blueprintsDiffHandler))
+	api.router.GET("/api/v:version/blueprints/changes/*blueprints", api.authorize(RoleViewer, api.blueprintsChangesHandler))
+	api.router.POST("/api/v:version/blueprints/new", api.authorize(RoleComposer, api.blueprintsNewHandler))
+	api.router.POST("/api/v:version/blueprints/workspace", api.authorize(RoleComposer, api.blueprintsWorkspaceHandler))
+	api.router.POST("/api/v:version/blueprints/undo/:blueprint/:commit", api.authorize(RoleComposer, api.blueprintUndoHandler))
+	api.router.POST("/api/v:version/blueprints/tag/:blueprint", api.authorize(RoleComposer, api.blueprintsTagHandler))
+	api.router.POST("/api/v:version/blueprints/sync", api.authorize(RoleAdmin, api.blueprintsSyncHandler))
+	api.router.DELETE("/api/v:version/blueprints/delete/:blueprint", api.authorize(RoleAdmin, api.blueprintDeleteHandler))
+	api.router.DELETE("/api/v:version/blueprints/workspace/:blueprint", api.authorize(RoleComposer, api.blueprintDeleteWorkspaceHandler))
+
+	api.router.POST("/api/v:version/compose", api.authorize(RoleComposer, api.composeHandler))
+	api.router.POST("/api/v:version/compose/rebuild/:uuid", api.authorize(RoleComposer, api.composeRebuildHandler))
+	api.router.DELETE("/api/v:version/compose/delete/:uuids", api.authorize(RoleComposer, api.composeDeleteHandler))
+	api.router.GET("/api/v:version/compose/retention", api.authorize(RoleAdmin, api.composeRetentionHandler))
+	api.router.GET("/api/v:version/compose/types", api.authorize(RoleViewer, api.composeTypesHandler))
+	api.router.GET("/api/v:version/compose/queue", api.authorize(RoleViewer, api.composeQueueHandler))
+	api.router.GET("/api/v:version/compose/status/:uuids", api.authorize(RoleViewer, api.composeStatusHandler))
+	api.router.GET("/api/v:version/compose/info/:uuid", api.authorize(RoleViewer, api.composeInfoHandler))
+	api.router.GET("/api/v:version/compose/finished", api.authorize(RoleViewer, api.composeFinishedHandler))
+	api.router.GET("/api/v:version/compose/failed", api.authorize(RoleViewer, api.composeFailedHandler))
+	api.router.GET("/api/v:version/compose/image/:uuid", api.authorize(RoleViewer, api.composeImageHandler))
+	api.router.GET("/api/v:version/compose/metadata/:uuid", api.authorize(RoleViewer, api.composeMetadataHandler))
+	api.router.GET("/api/v:version/compose/results/:uuid", api.authorize(RoleViewer, api.composeResultsHandler))
+	api.router.GET("/api/v:version/compose/sbom/:uuid", api.authorize(RoleViewer, api.composeSBOMHandler))
+	api.router.GET("/api/v:version/compose/advisories/:uuid", api.authorize(RoleViewer, api.composeAdvisoriesHandler))
+	api.router.GET("/api/v:version/compose/logs/:uuid", api.authorize(RoleViewer, api.composeLogsHandler))
+	api.router.GET("/api/v:version/compose/log/:uuid", api.authorize(RoleViewer, api.composeLogHandler))
+	api.router.POST("/api/v:version/compose/uploads/schedule/:uuid", api.authorize(RoleComposer, api.uploadsScheduleHandler))
+	api.router.DELETE("/api/v:version/compose/cancel/:uuid", api.authorize(RoleComposer, api.composeCancelHandler))
+
+	api.router.DELETE("/api/v:version/upload/delete/:uuid", api.authorize(RoleComposer, api.uploadsDeleteHandler))
+	api.router.GET("/api/v:version/upload/info/:uuid", api.authorize(RoleViewer, api.uploadsInfoHandler))
+	api.router.GET("/api/v:version/upload/log/:uuid", api.authorize(RoleViewer, api.uploadsLogHandler))
+	api.router.POST("/api/v:version/upload/reset/:uuid", api.authorize(RoleComposer, api.uploadsResetHandler))
+	api.router.DELETE("/api/v:version/upload/cancel/:uuid", api.authorize(RoleComposer, api.uploadsCancelHandler))
+
+	api.router.GET("/api/v:version/upload/providers", api.authorize(RoleViewer, api.providersHandler))
+	api.router.POST("/api/v:version/upload/providers/save", api.authorize(RoleAdmin, api.providersSaveHandler))
+	api.router.DELETE("/api/v:version/upload/providers/delete/:provider/:profile", api.authorize(RoleAdmin, api.providersDeleteHandler))
+
+	api.router.GET("/api/v:version/events", api.authorize(RoleViewer, api.eventsHandler))
+
+	api.router.GET("/api/v:version/webhooks/list", api.authorize(RoleAdmin, api.webhooksListHandler))
+	api.router.POST("/api/v:version/webhooks/new", api.authorize(RoleAdmin, api.webhooksNewHandler))
+	api.router.DELETE("/api/v:version/webhooks/delete/:id", api.authorize(RoleAdmin, api.webhooksDeleteHandler))
+
+	api.router.GET("/api/v:version/schedules/list", api.authorize(RoleViewer, api.schedulesListHandler))
+	api.router.POST("/api/v:version/schedules/new", api.authorize(RoleComposer, api.schedulesNewHandler))
+	api.router.DELETE("/api/v:version/schedules/delete/:id", api.authorize(RoleComposer, api.schedulesDeleteHandler))
+	api.router.POST("/api/v:version/schedules/run/:id", api.authorize(RoleComposer, api.schedulesRunHandler))
+
+	// publish events about finished jobs before jobFinished retries them
+	api.setupEvents()
+	workers.OnJobFinished(api.jobFinished)
 
 	return api
 }
 
+// maxUploadRetries is how often a failed upload is retried automatically.
+const maxUploadRetries = 2
+
+// defaultUploadRetryDelay is how long a failed upload waits before it is
+// retried the first time. The delay doubles with every retry, so that uploads
+// survive short outages of the cloud they upload to.
+const defaultUploadRetryDelay = time.Minute
+
+// jobFinished is called when a worker finished a job, which is either the
+// image build of a compose or one of its uploads.
+//
+// It persists the target results of the job in the compose, so that they are
+// available after the job queue forgot about the job. When an upload failed,
+// it is retried after a delay, unless it failed too often already. When the
+// image build
+// failed, its uploads are canceled, because there's nothing to upload.
+func (api *API) jobFinished(jobID uuid.UUID, result *worker.OSBuildJobResult) {
+	for composeID, compose := range api.store.GetAllComposes() {
+		for _, ib := range compose.ImageBuilds {
+			isImageJob := ib.JobID == jobID
+			targetID, isUploadJob := uploadJobTarget(ib, jobID)
+			if !isImageJob && !isUploadJob {
+				continue
+			}
+
+			if len(result.TargetResults) > 0 {
+				results := mergeTargetResults(ib.TargetResults, result.TargetResults)
+				err := api.store.SetComposeTargetResults(composeID, ib.ID, results)
+				if err != nil && api.logger != nil {
+					api.logger.Printf("cannot store target results of compose %s: %v", composeID, err)
+				}
+			}
+
+			if result.OSBuildOutput != nil && result.OSBuildOutput.Success {
+				if isImageJob {
+					err := api.attachSBOMs(composeID, compose, ib)
+					if err != nil && api.logger != nil {
+						api.logger.Printf("cannot store bills of materials of compose %s: %v", composeID, err)
+					}
+					api.queueAdvisoryCheck(composeID, compose, ib)
+				}
+				return
+			}
+
+			if isImageJob {
+				api.cancelUploads(ib)
+			} else if retries := ib.UploadRetries[targetID]; retries < maxUploadRetries {
+				imageBuildID := ib.ID
+				time.AfterFunc(api.uploadRetryDelay<<uint(retries), func() {
+					err := api.retryUpload(composeID, imageBuildID, targetID, jobID)
+					if err != nil && api.logger != nil {
+						api.logger.Printf("cannot retry upload %s of compose %s: %v", targetID, composeID, err)
+					}
+				})
+			}
+			return
+		}
+	}
+}
+
+// uploadJobTarget returns the target the job `jobID` of `ib` uploads to, if
+// it is an upload job.
+func uploadJobTarget(ib store.ImageBuild, jobID uuid.UUID) (uuid.UUID, bool) {
+	for targetID, uploadJobID := range ib.UploadJobs {
+		if uploadJobID == jobID {
+			return targetID, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// cancelUploads cancels all upload jobs of `ib`. Uploads which are done
+// already are not affected.
+func (api *API) cancelUploads(ib store.ImageBuild) {
+	for targetID, jobID := range ib.UploadJobs {
+		err := api.workers.Cancel(jobID)
+		if err != nil && api.logger != nil {
+			api.logger.Printf("cannot cancel upload %s: %v", targetID, err)
+		}
+	}
+}
+
+// retryUpload enqueues a new job for the upload to `targetID`, which failed
+// in job `failedJobID`. It does nothing if the upload was reset or the
+// compose deleted in the meantime.
+func (api *API) retryUpload(composeID uuid.UUID, imageBuildID int, targetID, failedJobID uuid.UUID) error {
+	compose, exists := api.store.GetCompose(composeID)
+	if !exists {
+		return nil
+	}
+	ib, exists := compose.GetImageBuild(imageBuildID)
+	if !exists || ib.UploadJobs[targetID] != failedJobID {
+		return nil
+	}
+
+	for _, t := range ib.Targets {
+		if t.Uuid != targetID {
+			continue
+		}
+
+		jobID, err := api.workers.EnqueueUpload(ib.JobID, ib.ImageType.Filename(), t)
+		if err != nil {
+			return err
+		}
+
+		return api.store.RetryComposeUpload(composeID, imageBuildID, targetID, jobID)
+	}
+
+	return fmt.Errorf("target %s doesn't exist", targetID)
+}
+
+// mergeTargetResults returns `results` with all results for targets which
+// are present in `update` replaced by the ones in `update`.
+func mergeTargetResults(results, update []*target.TargetResult) []*target.TargetResult {
+	updated := make(map[uuid.UUID]bool)
+	for _, result := range update {
+		updated[result.TargetUuid] = true
+	}
+
+	var merged []*target.TargetResult
+	for _, result := range results {
+		if !updated[result.TargetUuid] {
+			merged = append(merged, result)
+		}
+	}
+
+	return append(merged, update...)
+}
+
+// Handle serves all requests below `prefix` with `handler`, which is
+// usually another API. Clients must be viewers to read and composers to make
+// changes.
+func (api *API) Handle(prefix string, handler http.Handler) {
+	handle := func(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		handler.ServeHTTP(writer, request)
+	}
+
+	path := prefix + "/*path"
+	api.router.GET(path, api.authorize(RoleViewer, handle))
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		api.router.Handle(method, path, api.authorize(RoleComposer, handle))
+	}
+}
+
 func (api *API) Serve(listener net.Listener) error {
-	server := http.Server{Handler: api}
+	server := http.Server{
+		Handler:     api,
+		ConnContext: peerCredentialsContext,
+	}
 
 	err := server.Serve(listener)
 	if err != nil && err != http.ErrServerClosed {
@@ -162,25 +369,110 @@ func (api *API) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 }
 
 type composeStatus struct {
-	State    common.ComposeState
-	Queued   time.Time
-	Started  time.Time
-	Finished time.Time
-	Result   *osbuild.Result
+	State         common.ComposeState
+	Queued        time.Time
+	Started       time.Time
+	Finished      time.Time
+	Result        *osbuild.Result
+	TargetResults []*target.TargetResult
+
+	// UploadStates contains the states of uploads which run as separate
+	// jobs, keyed by target UUID. All other uploads share the state of the
+	// image build.
+	UploadStates map[uuid.UUID]common.ComposeState
+
+	// ImageBuilds contains the statuses of the image builds of a compose,
+	// indexed by their ID. It is not set for the status of an image build.
+	ImageBuilds []*composeStatus
+}
+
+func (cs *composeStatus) uploadState(targetID uuid.UUID) common.ComposeState {
+	if state, exists := cs.UploadStates[targetID]; exists {
+		return state
+	}
+	return cs.State
 }
 
-// Returns the state of the image in `compose` and the times the job was
-// queued, started, and finished. Assumes that there's only one image in the
-// compose.
+// Returns the state of the images in `compose` and the times their jobs
+// were queued, started, and finished. A compose is waiting until one of its
+// images is built, finished or failed once all images are done, and failed
+// when any of them failed.
 func (api *API) getComposeStatus(compose store.Compose) *composeStatus {
-	jobId := compose.ImageBuild.JobID
+	var builds []*composeStatus
+	for _, ib := range compose.ImageBuilds {
+		builds = append(builds, api.getImageBuildStatus(ib))
+	}
+
+	if len(builds) == 1 {
+		status := *builds[0]
+		status.ImageBuilds = builds
+		return &status
+	}
+
+	status := &composeStatus{
+		State:        common.CFinished,
+		UploadStates: make(map[uuid.UUID]common.ComposeState),
+		ImageBuilds:  builds,
+	}
+
+	waiting := true
+	done := true
+	for i, build := range builds {
+		switch build.State {
+		case common.CWaiting:
+			done = false
+		case common.CRunning:
+			done = false
+			waiting = false
+		case common.CFailed:
+			waiting = false
+			status.State = common.CFailed
+		default:
+			waiting = false
+		}
+
+		if status.Queued.IsZero() || build.Queued.Before(status.Queued) {
+			status.Queued = build.Queued
+		}
+		if !build.Started.IsZero() && (status.Started.IsZero() || build.Started.Before(status.Started)) {
+			status.Started = build.Started
+		}
+		if build.Finished.After(status.Finished) {
+			status.Finished = build.Finished
+		}
+
+		// the logs of the first failed build are the most interesting
+		if status.Result == nil || (build.State == common.CFailed && status.Result.Success) {
+			status.Result = build.Result
+		}
+
+		status.TargetResults = append(status.TargetResults, build.TargetResults...)
+		for _, t := range compose.ImageBuilds[i].Targets {
+			status.UploadStates[t.Uuid] = build.uploadState(t.Uuid)
+		}
+	}
+
+	switch {
+	case waiting:
+		status.State = common.CWaiting
+	case !done:
+		status.State = common.CRunning
+	}
+
+	return status
+}
+
+// Returns the state of the image built by `ib`, and the times its job was
+// queued, started, and finished.
+func (api *API) getImageBuildStatus(ib store.ImageBuild) *composeStatus {
+	jobId := ib.JobID
 
 	// backwards compatibility: composes that were around before splitting
 	// the job queue from the store still contain their valid status and
 	// times. Return those here as a fallback.
 	if jobId == uuid.Nil {
 		var state common.ComposeState
-		switch compose.ImageBuild.QueueStatus {
+		switch ib.QueueStatus {
 		case common.IBWaiting:
 			state = common.CWaiting
 		case common.IBRunning:
@@ -192,37 +484,86 @@ func (api *API) getComposeStatus(compose store.Compose) *composeStatus {
 		}
 		return &composeStatus{
 			State:    state,
-			Queued:   compose.ImageBuild.JobCreated,
-			Started:  compose.ImageBuild.JobStarted,
-			Finished: compose.ImageBuild.JobFinished,
+			Queued:   ib.JobCreated,
+			Started:  ib.JobStarted,
+			Finished: ib.JobFinished,
 			Result:   &osbuild.Result{},
+
+			TargetResults: ib.TargetResults,
 		}
 	}
 
 	// is it ok to ignore this error?
 	jobStatus, _ := api.workers.JobStatus(jobId)
+
+	// prefer the results stored with the compose, the job queue doesn't
+	// necessarily keep them around
+	targetResults := ib.TargetResults
+	if len(targetResults) == 0 {
+		targetResults = jobStatus.Result.TargetResults
+	}
+
+	uploadStates := make(map[uuid.UUID]common.ComposeState)
+	for targetID, uploadJobID := range ib.UploadJobs {
+		uploadStatus, err := api.workers.JobStatus(uploadJobID)
+		if err != nil {
+			uploadStates[targetID] = common.CFailed
+			continue
+		}
+		uploadStates[targetID] = uploadStatus.State
+		targetResults = mergeTargetResults(targetResults, uploadStatus.Result.TargetResults)
+	}
+
 	return &composeStatus{
-		State:    jobStatus.State,
-		Queued:   jobStatus.Queued,
-		Started:  jobStatus.Started,
-		Finished: jobStatus.Finished,
-		Result:   jobStatus.Result.OSBuildOutput,
+		State:         jobStatus.State,
+		Queued:        jobStatus.Queued,
+		Started:       jobStatus.Started,
+		Finished:      jobStatus.Finished,
+		Result:        jobStatus.Result.OSBuildOutput,
+		TargetResults: targetResults,
+		UploadStates:  uploadStates,
+	}
+}
+
+// imageBuildParam returns the image build of `compose` which is selected by
+// the "image_build" query parameter of `request`, or the first one if the
+// parameter isn't set. It writes an error response when there's no such
+// image build.
+func imageBuildParam(writer http.ResponseWriter, request *http.Request, compose store.Compose) (*store.ImageBuild, bool) {
+	param := request.URL.Query().Get("image_build")
+	if param == "" {
+		return &compose.ImageBuilds[0], true
+	}
+
+	id, err := strconv.Atoi(param)
+	if err == nil {
+		if ib, exists := compose.GetImageBuild(id); exists {
+			return ib, true
+		}
 	}
+
+	errors := responseError{
+		ID:  "UnknownImageBuild",
+		Msg: fmt.Sprintf("Compose has no image build %s", param),
+	}
+	statusResponseError(writer, http.StatusBadRequest, errors)
+	return nil, false
 }
 
-// Opens the image file for `compose`. This asks the worker server for the
-// artifact first, and then falls back to looking in
-// `{outputs}/{composeId}/{imageBuildId}` for backwards compatibility.
-func (api *API) openImageFile(composeId uuid.UUID, compose store.Compose) (io.Reader, int64, error) {
-	name := compose.ImageBuild.ImageType.Filename()
+// Opens the image file of the image build `ib` of compose `composeId`. This
+// asks the worker server for the artifact first, and then falls back to
+// looking in `{outputs}/{composeId}/{imageBuildId}` for backwards
+// compatibility.
+func (api *API) openImageFile(composeId uuid.UUID, ib store.ImageBuild) (io.Reader, int64, error) {
+	name := ib.ImageType.Filename()
 
-	reader, size, err := api.workers.JobArtifact(compose.ImageBuild.JobID, name)
+	reader, size, err := api.workers.JobArtifact(ib.JobID, name)
 	if err != nil {
 		if api.compatOutputDir == "" || err != jobqueue.ErrNotExist {
 			return nil, 0, err
 		}
 
-		p := path.Join(api.compatOutputDir, composeId.String(), "0", name)
+		p := path.Join(api.compatOutputDir, composeId.String(), strconv.Itoa(ib.ID), name)
 		f, err := os.Open(p)
 		if err != nil {
 			return nil, 0, err
@@ -316,6 +657,52 @@ func verifyStringsWithRegex(writer http.ResponseWriter, strings []string, re *re
 	return true
 }
 
+// parseComposeQueryParams parses the search parameters of the compose lists
+// and responds with an error if they are invalid.
+func parseComposeQueryParams(writer http.ResponseWriter, values url.Values) (*composeQuery, uint, bool) {
+	query, err := parseComposeQuery(values)
+	if err != nil {
+		errors := responseError{
+			ID:  "BadQuery",
+			Msg: fmt.Sprintf("BadRequest: %s", err.Error()),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return nil, 0, false
+	}
+
+	if len(query.Blueprint) > 0 && !verifyStringsWithRegex(writer, []string{query.Blueprint}, ValidBlueprintName) {
+		return nil, 0, false
+	}
+
+	limit, err := parseComposeLimit(values)
+	if err != nil {
+		errors := responseError{
+			ID:  "BadLimitOrOffset",
+			Msg: fmt.Sprintf("BadRequest: %s", err.Error()),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return nil, 0, false
+	}
+
+	return query, limit, true
+}
+
+// quotaExceeded responds with an error if `err` is a store.QuotaExceededError
+// and returns whether it did.
+func quotaExceeded(writer http.ResponseWriter, err error) bool {
+	var quotaErr *store.QuotaExceededError
+	if !errors_package.As(err, &quotaErr) {
+		return false
+	}
+
+	errors := responseError{
+		ID:  "QuotaExceeded",
+		Msg: quotaErr.Error(),
+	}
+	statusResponseError(writer, http.StatusForbidden, errors)
+	return true
+}
+
 func statusResponseError(writer http.ResponseWriter, code int, errors ...responseError) {
 	type reply struct {
 		Status bool            `json:"status"`
@@ -355,6 +742,8 @@ func (api *API) sourceListHandler(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type reply struct {
 		Sources []string `json:"sources"`
 	}
@@ -363,9 +752,9 @@ func (api *API) sourceListHandler(writer http.ResponseWriter, request *http.Requ
 	// In the v1 API this was changed to separate the Name and the Id (a short identifier)
 	var names []string
 	if isRequestVersionAtLeast(params, 1) {
-		names = api.store.ListSourcesById()
+		names = ns.ListSourcesById()
 	} else {
-		names = api.store.ListSourcesByName()
+		names = ns.ListSourcesByName()
 	}
 	names = append(names, api.systemRepoNames()...)
 
@@ -390,7 +779,7 @@ func (api *API) sourceEmptyInfoHandler(writer http.ResponseWriter, request *http
 
 // getSourceConfigs retrieves the list of sources from the system repos an store
 // Returning a list of store.SourceConfig entries indexed by the id of the source
-func (api *API) getSourceConfigs(params httprouter.Params) (map[string]store.SourceConfig, []responseError) {
+func (api *API) getSourceConfigs(ns *store.Store, params httprouter.Params) (map[string]store.SourceConfig, []responseError) {
 	names := params.ByName("sources")
 
 	sources := map[string]store.SourceConfig{}
@@ -398,7 +787,7 @@ func (api *API) getSourceConfigs(params httprouter.Params) (map[string]store.Sou
 
 	// if names is "*" we want all sources
 	if names == "*" {
-		sources = api.store.GetAllSourcesByID()
+		sources = ns.GetAllSourcesByID()
 		for _, repo := range api.repos {
 			sources[repo.Name] = store.NewSourceConfig(repo, true)
 		}
@@ -417,7 +806,7 @@ func (api *API) getSourceConfigs(params httprouter.Params) (map[string]store.Sou
 				continue
 			}
 			// check if the source is in the store
-			if source := api.store.GetSource(name); source != nil {
+			if source := ns.GetSource(name); source != nil {
 				sources[name] = *source
 			} else {
 				error := responseError{
@@ -452,7 +841,7 @@ func (api *API) sourceInfoHandler(writer http.ResponseWriter, request *http.Requ
 
 // sourceInfoHandlerV0 handles the API v0 response
 func (api *API) sourceInfoHandlerV0(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	sources, errors := api.getSourceConfigs(params)
+	sources, errors := api.getSourceConfigs(api.Namespace(request), params)
 
 	// V0 responses use the source name as the key
 	v0Sources := make(map[string]SourceConfigV0, len(sources))
@@ -493,7 +882,7 @@ func (api *API) sourceInfoHandlerV0(writer http.ResponseWriter, request *http.Re
 
 // sourceInfoHandlerV1 handles the API v0 response
 func (api *API) sourceInfoHandlerV1(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	sources, errors := api.getSourceConfigs(params)
+	sources, errors := api.getSourceConfigs(api.Namespace(request), params)
 
 	// V1 responses use the source id as the key
 	v1Sources := make(map[string]SourceConfigV1, len(sources))
@@ -566,6 +955,8 @@ func (api *API) sourceNewHandler(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	contentType := request.Header["Content-Type"]
 	if len(contentType) == 0 {
 		errors := responseError{
@@ -601,6 +992,9 @@ func (api *API) sourceNewHandler(writer http.ResponseWriter, request *http.Reque
 			err = errors_package.New("'type' field is missing from request")
 		} else if len(source.SourceConfig().URL) == 0 {
 			err = errors_package.New("'url' field is missing from request")
+		} else if strings.Contains(source.GetKey(), "/") || strings.Contains(source.GetName(), "/") {
+			// the store separates namespaces from source names with a slash
+			err = errors_package.New("'id' and 'name' fields cannot contain '/'")
 		}
 	}
 
@@ -613,7 +1007,7 @@ func (api *API) sourceNewHandler(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	api.store.PushSource(source.GetKey(), source.SourceConfig())
+	ns.PushSource(source.GetKey(), source.SourceConfig())
 
 	statusResponseOK(writer)
 }
@@ -623,6 +1017,8 @@ func (api *API) sourceDeleteHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	name := strings.Split(params.ByName("source"), ",")
 
 	if name[0] == "/" {
@@ -649,9 +1045,9 @@ func (api *API) sourceDeleteHandler(writer http.ResponseWriter, request *http.Re
 
 	// Only delete the first name, which will have a / at the start because of the /*source route
 	if isRequestVersionAtLeast(params, 1) {
-		api.store.DeleteSourceByID(name[0][1:])
+		ns.DeleteSourceByID(name[0][1:])
 	} else {
-		api.store.DeleteSourceByName(name[0][1:])
+		ns.DeleteSourceByName(name[0][1:])
 	}
 
 	statusResponseOK(writer)
@@ -662,6 +1058,8 @@ func (api *API) modulesListHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type module struct {
 		Name      string `json:"name"`
 		GroupType string `json:"group_type"`
@@ -687,7 +1085,7 @@ func (api *API) modulesListHandler(writer http.ResponseWriter, request *http.Req
 
 	modulesParam := params.ByName("modules")
 
-	availablePackages, err := api.fetchPackageList()
+	availablePackages, err := api.fetchPackageList(ns)
 
 	if err != nil {
 		errors := responseError{
@@ -756,6 +1154,8 @@ func (api *API) projectsListHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type reply struct {
 		Total    uint                `json:"total"`
 		Offset   uint                `json:"offset"`
@@ -773,7 +1173,7 @@ func (api *API) projectsListHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	availablePackages, err := api.fetchPackageList()
+	availablePackages, err := api.fetchPackageList(ns)
 
 	if err != nil {
 		errors := responseError{
@@ -809,6 +1209,8 @@ func (api *API) modulesInfoHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type projectsReply struct {
 		Projects []rpmmd.PackageInfo `json:"projects"`
 	}
@@ -844,7 +1246,7 @@ func (api *API) modulesInfoHandler(writer http.ResponseWriter, request *http.Req
 
 	names := strings.Split(modules, ",")
 
-	availablePackages, err := api.fetchPackageList()
+	availablePackages, err := api.fetchPackageList(ns)
 
 	if err != nil {
 		errors := responseError{
@@ -945,11 +1347,14 @@ func (api *API) blueprintsListHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type reply struct {
 		Total      uint     `json:"total"`
 		Offset     uint     `json:"offset"`
 		Limit      uint     `json:"limit"`
 		Blueprints []string `json:"blueprints"`
+		NextCursor string   `json:"next_cursor,omitempty"`
 	}
 
 	offset, limit, err := parseOffsetAndLimit(request.URL.Query())
@@ -962,16 +1367,32 @@ func (api *API) blueprintsListHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	names := api.store.ListBlueprints()
+	query, err := parseBlueprintQuery(request.URL.Query())
+	if err != nil {
+		errors := responseError{
+			ID:  "BadQuery",
+			Msg: fmt.Sprintf("BadRequest: %s", err.Error()),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	names := query.filter(ns.ListBlueprints())
 	total := uint(len(names))
 	offset = min(offset, total)
 	limit = min(limit, total-offset)
 
+	var next string
+	if offset+limit < total && limit > 0 {
+		next = encodeCursor("name", names[offset+limit-1])
+	}
+
 	err = json.NewEncoder(writer).Encode(reply{
 		Total:      total,
 		Offset:     offset,
 		Limit:      limit,
 		Blueprints: names[offset : offset+limit],
+		NextCursor: next,
 	})
 	common.PanicOnError(err)
 }
@@ -981,6 +1402,8 @@ func (api *API) blueprintsInfoHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type change struct {
 		Changed bool   `json:"changed"`
 		Name    string `json:"name"`
@@ -1024,7 +1447,7 @@ func (api *API) blueprintsInfoHandler(writer http.ResponseWriter, request *http.
 	blueprintErrors := []responseError{}
 
 	for _, name := range names {
-		blueprint, changed := api.store.GetBlueprint(name)
+		blueprint, changed := ns.GetBlueprint(name)
 		if blueprint == nil {
 			blueprintErrors = append(blueprintErrors, responseError{
 				ID:  "UnknownBlueprint",
@@ -1079,6 +1502,8 @@ func (api *API) blueprintsDepsolveHandler(writer http.ResponseWriter, request *h
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type entry struct {
 		Blueprint    blueprint.Blueprint `json:"blueprint"`
 		Dependencies []rpmmd.PackageSpec `json:"dependencies"`
@@ -1109,7 +1534,7 @@ func (api *API) blueprintsDepsolveHandler(writer http.ResponseWriter, request *h
 	blueprints := []entry{}
 	blueprintsErrors := []responseError{}
 	for _, name := range names {
-		blueprint, _ := api.store.GetBlueprint(name)
+		blueprint, _ := ns.GetBlueprint(name)
 		if blueprint == nil {
 			blueprintsErrors = append(blueprintsErrors, responseError{
 				ID:  "UnknownBlueprint",
@@ -1118,7 +1543,7 @@ func (api *API) blueprintsDepsolveHandler(writer http.ResponseWriter, request *h
 			continue
 		}
 
-		dependencies, _, err := api.depsolveBlueprint(blueprint, nil)
+		dependencies, _, err := api.depsolveBlueprint(ns, blueprint, nil)
 
 		if err != nil {
 			blueprintsErrors = append(blueprintsErrors, responseError{
@@ -1166,6 +1591,8 @@ func (api *API) blueprintsFreezeHandler(writer http.ResponseWriter, request *htt
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type blueprintFrozen struct {
 		Blueprint blueprint.Blueprint `json:"blueprint"`
 	}
@@ -1196,7 +1623,7 @@ func (api *API) blueprintsFreezeHandler(writer http.ResponseWriter, request *htt
 	blueprints := []blueprintFrozen{}
 	errors := []responseError{}
 	for _, name := range names {
-		bp, _ := api.store.GetBlueprint(name)
+		bp, _ := ns.GetBlueprint(name)
 		if bp == nil {
 			rerr := responseError{
 				ID:  "UnknownBlueprint",
@@ -1207,7 +1634,7 @@ func (api *API) blueprintsFreezeHandler(writer http.ResponseWriter, request *htt
 		}
 		// Make a copy of the blueprint since we will be replacing the version globs
 		blueprint := bp.DeepCopy()
-		dependencies, _, err := api.depsolveBlueprint(&blueprint, nil)
+		dependencies, _, err := api.depsolveBlueprint(ns, &blueprint, nil)
 		if err != nil {
 			rerr := responseError{
 				ID:  "BlueprintsError",
@@ -1281,17 +1708,10 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	type pack struct {
-		Package blueprint.Package `json:"Package"`
-	}
-
-	type diff struct {
-		New *pack `json:"new"`
-		Old *pack `json:"old"`
-	}
+	ns := api.Namespace(request)
 
 	type reply struct {
-		Diffs []diff `json:"diff"`
+		Diffs []blueprint.DiffEntry `json:"diff"`
 	}
 
 	name := params.ByName("blueprint")
@@ -1318,27 +1738,8 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		statusResponseError(writer, http.StatusNotFound, errors)
 		return
 	}
-	if fromCommit != "NEWEST" {
-		errors := responseError{
-			ID:  "UnknownCommit",
-			Msg: fmt.Sprintf("ggit-error: revspec '%s' not found (-3)", fromCommit),
-		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
-		return
-	}
-	if toCommit != "WORKSPACE" {
-		errors := responseError{
-			ID:  "UnknownCommit",
-			Msg: fmt.Sprintf("ggit-error: revspec '%s' not found (-3)", toCommit),
-		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
-		return
-	}
 
-	// Fetch old and new blueprint details from store and return error if not found
-	oldBlueprint := api.store.GetBlueprintCommitted(name)
-	newBlueprint, _ := api.store.GetBlueprint(name)
-	if oldBlueprint == nil || newBlueprint == nil {
+	if ns.GetBlueprintCommitted(name) == nil {
 		errors := responseError{
 			ID:  "UnknownBlueprint",
 			Msg: fmt.Sprintf("Unknown blueprint name: %s", name),
@@ -1347,35 +1748,41 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	newSlice := newBlueprint.Packages
-	oldMap := make(map[string]blueprint.Package)
-	diffs := []diff{}
-
-	for _, oldPackage := range oldBlueprint.Packages {
-		oldMap[oldPackage.Name] = oldPackage
-	}
-
-	// For each package in new blueprint check if the old one contains it
-	for _, newPackage := range newSlice {
-		oldPackage, found := oldMap[newPackage.Name]
-		// If found remove from old packages map but otherwise create a diff with the added package
-		if found {
-			delete(oldMap, oldPackage.Name)
-			// Create a diff if the versions changed
-			if oldPackage.Version != newPackage.Version {
-				diffs = append(diffs, diff{Old: &pack{oldPackage}, New: &pack{newPackage}})
+	// Fetch the blueprints to compare, which are either the newest commit,
+	// the workspace, or any commit of the blueprint
+	blueprintAt := func(commit string) *blueprint.Blueprint {
+		switch commit {
+		case "NEWEST":
+			return ns.GetBlueprintCommitted(name)
+		case "WORKSPACE":
+			bp, _ := ns.GetBlueprint(name)
+			return bp
+		default:
+			bp, err := ns.GetBlueprintAtCommit(name, commit)
+			if err != nil {
+				return nil
 			}
-		} else {
-			diffs = append(diffs, diff{Old: nil, New: &pack{newPackage}})
+			return bp
 		}
 	}
 
-	// All packages remaining in the old packages map have been removed in the new blueprint so create a diff
-	for _, oldPackage := range oldMap {
-		diffs = append(diffs, diff{Old: &pack{oldPackage}, New: nil})
+	oldBlueprint := blueprintAt(fromCommit)
+	newBlueprint := blueprintAt(toCommit)
+	for _, c := range []struct {
+		commit string
+		bp     *blueprint.Blueprint
+	}{{fromCommit, oldBlueprint}, {toCommit, newBlueprint}} {
+		if c.bp == nil {
+			errors := responseError{
+				ID:  "UnknownCommit",
+				Msg: fmt.Sprintf("ggit-error: revspec '%s' not found (-3)", c.commit),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
 	}
 
-	err := json.NewEncoder(writer).Encode(reply{diffs})
+	err := json.NewEncoder(writer).Encode(reply{blueprint.Diff(oldBlueprint, newBlueprint)})
 	common.PanicOnError(err)
 }
 
@@ -1384,6 +1791,8 @@ func (api *API) blueprintsChangesHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type change struct {
 		Changes []blueprint.Change `json:"changes"`
 		Name    string             `json:"name"`
@@ -1428,7 +1837,7 @@ func (api *API) blueprintsChangesHandler(writer http.ResponseWriter, request *ht
 	allChanges := []change{}
 	errors := []responseError{}
 	for _, name := range names {
-		bpChanges := api.store.GetBlueprintChanges(name)
+		bpChanges := ns.GetBlueprintChanges(name)
 		// Reverse the changes, newest first
 		reversed := make([]blueprint.Change, 0, len(bpChanges))
 		for i := len(bpChanges) - 1; i >= 0; i-- {
@@ -1464,6 +1873,8 @@ func (api *API) blueprintsNewHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	contentType := request.Header["Content-Type"]
 	if len(contentType) == 0 {
 		errors := responseError{
@@ -1507,8 +1918,10 @@ func (api *API) blueprintsNewHandler(writer http.ResponseWriter, request *http.R
 	}
 
 	commitMsg := "Recipe " + blueprint.Name + ", version " + blueprint.Version + " saved."
-	err = api.store.PushBlueprint(blueprint, commitMsg)
-	if err != nil {
+	err = ns.PushBlueprint(blueprint, commitMsg)
+	if quotaExceeded(writer, err) {
+		return
+	} else if err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
 			Msg: err.Error(),
@@ -1525,6 +1938,8 @@ func (api *API) blueprintsWorkspaceHandler(writer http.ResponseWriter, request *
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	contentType := request.Header["Content-Type"]
 	if len(contentType) == 0 {
 		errors := responseError{
@@ -1567,8 +1982,10 @@ func (api *API) blueprintsWorkspaceHandler(writer http.ResponseWriter, request *
 		return
 	}
 
-	err = api.store.PushBlueprintToWorkspace(blueprint)
-	if err != nil {
+	err = ns.PushBlueprintToWorkspace(blueprint)
+	if quotaExceeded(writer, err) {
+		return
+	} else if err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
 			Msg: err.Error(),
@@ -1585,6 +2002,8 @@ func (api *API) blueprintUndoHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	name := params.ByName("blueprint")
 	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
 		return
@@ -1595,7 +2014,7 @@ func (api *API) blueprintUndoHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	bpChange, err := api.store.GetBlueprintChange(name, commit)
+	bpChange, err := ns.GetBlueprintChange(name, commit)
 	if err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
@@ -1607,8 +2026,10 @@ func (api *API) blueprintUndoHandler(writer http.ResponseWriter, request *http.R
 
 	bp := bpChange.Blueprint
 	commitMsg := name + ".toml reverted to commit " + commit
-	err = api.store.PushBlueprint(bp, commitMsg)
-	if err != nil {
+	err = ns.PushBlueprint(bp, commitMsg)
+	if quotaExceeded(writer, err) {
+		return
+	} else if err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
 			Msg: err.Error(),
@@ -1624,12 +2045,14 @@ func (api *API) blueprintDeleteHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	name := params.ByName("blueprint")
 	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
 		return
 	}
 
-	if err := api.store.DeleteBlueprint(name); err != nil {
+	if err := ns.DeleteBlueprint(name); err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
 			Msg: err.Error(),
@@ -1645,12 +2068,14 @@ func (api *API) blueprintDeleteWorkspaceHandler(writer http.ResponseWriter, requ
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	name := params.ByName("blueprint")
 	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
 		return
 	}
 
-	if err := api.store.DeleteBlueprintFromWorkspace(name); err != nil {
+	if err := ns.DeleteBlueprintFromWorkspace(name); err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
 			Msg: err.Error(),
@@ -1667,12 +2092,14 @@ func (api *API) blueprintsTagHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	name := params.ByName("blueprint")
 	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
 		return
 	}
 
-	err := api.store.TagBlueprint(name)
+	err := ns.TagBlueprint(name)
 	if err != nil {
 		errors := responseError{
 			ID:  "BlueprintsError",
@@ -1684,6 +2111,27 @@ func (api *API) blueprintsTagHandler(writer http.ResponseWriter, request *http.R
 	statusResponseOK(writer)
 }
 
+// blueprintsSyncHandler synchronizes the blueprints of all namespaces with
+// the remote of the blueprint git repository right away, instead of waiting
+// for the next periodic sync. Hooks of the remote can call it when changes
+// are merged.
+func (api *API) blueprintsSyncHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	err := api.store.SyncBlueprints()
+	if err != nil {
+		errors := responseError{
+			ID:  "BlueprintsError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+	statusResponseOK(writer)
+}
+
 // Schedule new compose by first translating the appropriate blueprint into a pipeline and then
 // pushing it into the channel for waiting builds.
 func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -1691,15 +2139,21 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type OSTreeRequest struct {
 		Ref    string `json:"ref"`
 		Parent string `json:"parent"`
 	}
 
 	// https://weldr.io/lorax/pylorax.api.html#pylorax.api.v0.v0_compose_start
+	//
+	// Version 1 additionally accepts several image types in ComposeTypes,
+	// which are built from the same blueprint.
 	type ComposeRequest struct {
 		BlueprintName string         `json:"blueprint_name"`
 		ComposeType   string         `json:"compose_type"`
+		ComposeTypes  []string       `json:"compose_types"`
 		Size          uint64         `json:"size"`
 		OSTree        OSTreeRequest  `json:"ostree"`
 		Branch        string         `json:"branch"`
@@ -1732,14 +2186,26 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
-	imageType, err := api.arch.GetImageType(cr.ComposeType)
-	if err != nil {
-		errors := responseError{
-			ID:  "UnknownComposeType",
-			Msg: fmt.Sprintf("Unknown compose type for architecture: %s", cr.ComposeType),
+	composeTypes := []string{cr.ComposeType}
+	if isRequestVersionAtLeast(params, 1) && len(cr.ComposeTypes) > 0 {
+		composeTypes = cr.ComposeTypes
+		if cr.ComposeType != "" {
+			composeTypes = append([]string{cr.ComposeType}, composeTypes...)
 		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
-		return
+	}
+
+	var imageTypes []distro.ImageType
+	for _, composeType := range composeTypes {
+		imageType, err := api.arch.GetImageType(composeType)
+		if err != nil {
+			errors := responseError{
+				ID:  "UnknownComposeType",
+				Msg: fmt.Sprintf("Unknown compose type for architecture: %s", composeType),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+		imageTypes = append(imageTypes, imageType)
 	}
 
 	if !verifyStringsWithRegex(writer, []string{cr.BlueprintName}, ValidBlueprintName) {
@@ -1748,22 +2214,42 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 
 	composeID := uuid.New()
 
-	var targets []*target.Target
+	var upload *uploadRequest
 	if isRequestVersionAtLeast(params, 1) && cr.Upload != nil {
-		t := uploadRequestToTarget(*cr.Upload, imageType)
-		targets = append(targets, t)
-	}
+		// it's ambiguous which image to upload, those uploads must be
+		// scheduled for every image build separately
+		if len(imageTypes) > 1 {
+			errors := responseError{
+				ID:  "UploadError",
+				Msg: "cannot upload the images of a compose with several compose types, schedule an upload for each image build instead",
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
 
-	targets = append(targets, target.NewLocalTarget(
-		&target.LocalTargetOptions{
-			ComposeId:       composeID,
-			ImageBuildId:    0,
-			Filename:        imageType.Filename(),
-			StreamOptimized: imageType.Name() == "vmdk", // TODO: move conversion to osbuild
-		},
-	))
+		err = resolveUploadProfile(ns, cr.Upload)
+		if err != nil {
+			errors := responseError{
+				ID:  "UnknownProfile",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+
+		err = checkUploadImageType(*cr.Upload, imageTypes[0])
+		if err != nil {
+			errors := responseError{
+				ID:  "UploadError",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+		upload = cr.Upload
+	}
 
-	bp := api.store.GetBlueprintCommitted(cr.BlueprintName)
+	bp := ns.GetBlueprintCommitted(cr.BlueprintName)
 	if bp == nil {
 		errors := responseError{
 			ID:  "UnknownBlueprint",
@@ -1773,13 +2259,7 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
-	packages, buildPackages, err := api.depsolveBlueprint(bp, imageType)
-	if err != nil {
-		errors := responseError{
-			ID:  "DepsolveError",
-			Msg: err.Error(),
-		}
-		statusResponseError(writer, http.StatusInternalServerError, errors)
+	if quotaExceeded(writer, ns.CheckComposeQuota()) {
 		return
 	}
 
@@ -1794,22 +2274,50 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
-	size := imageType.Size(cr.Size)
-	manifest, err := imageType.Manifest(bp.Customizations,
-		distro.ImageOptions{
-			Size: size,
+	repos := api.allRepositories(ns)
+	depsolve := api.newDepsolver(repos)
+
+	var options []imageBuildOptions
+	for _, imageType := range imageTypes {
+		specs, excludeSpecs := imageType.Packages(*bp)
+		packages, err := depsolve(specs, excludeSpecs)
+		if err != nil {
+			errors := responseError{
+				ID:  "DepsolveError",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusInternalServerError, errors)
+			return
+		}
+
+		buildPackages, err := depsolve(imageType.BuildPackages(), nil)
+		if err != nil {
+			errors := responseError{
+				ID:  "DepsolveError",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusInternalServerError, errors)
+			return
+		}
+
+		options = append(options, imageBuildOptions{
+			ImageType: imageType,
+			Size:      imageType.Size(cr.Size),
 			OSTree: distro.OSTreeImageOptions{
 				Ref:    cr.OSTree.Ref,
 				Parent: cr.OSTree.Parent,
 			},
-		},
-		api.allRepositories(),
-		packages,
-		buildPackages)
+			Upload:        upload,
+			Packages:      packages,
+			BuildPackages: buildPackages,
+		})
+	}
+
+	imageBuilds, err := api.newImageBuilds(composeID, bp, repos, options)
 	if err != nil {
 		errors := responseError{
 			ID:  "ManifestCreationFailed",
-			Msg: fmt.Sprintf("failed to create osbuild manifest: %v", err),
+			Msg: err.Error(),
 		}
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
@@ -1818,17 +2326,16 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 	testMode := q.Get("test")
 	if testMode == "1" {
 		// Create a failed compose
-		err = api.store.PushTestCompose(composeID, manifest, imageType, bp, size, targets, false)
+		err = ns.PushTestCompose(composeID, bp, imageBuilds, false)
 	} else if testMode == "2" {
 		// Create a successful compose
-		err = api.store.PushTestCompose(composeID, manifest, imageType, bp, size, targets, true)
+		err = ns.PushTestCompose(composeID, bp, imageBuilds, true)
 	} else {
-		var jobId uuid.UUID
+		err = composes.Push(api.workers, ns, composeID, bp, imageBuilds)
+	}
 
-		jobId, err = api.workers.Enqueue(manifest, targets)
-		if err == nil {
-			err = api.store.PushCompose(composeID, manifest, imageType, bp, size, targets, jobId)
-		}
+	if quotaExceeded(writer, err) {
+		return
 	}
 
 	// TODO: we should probably do some kind of blueprint validation in future
@@ -1855,6 +2362,8 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	type composeDeleteStatus struct {
 		UUID   uuid.UUID `json:"uuid"`
 		Status bool      `json:"status"`
@@ -1880,7 +2389,7 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 			continue
 		}
 
-		compose, exists := api.store.GetCompose(id)
+		compose, exists := ns.GetCompose(id)
 		if !exists {
 			errors = append(errors, composeDeleteError{
 				"UnknownUUID",
@@ -1898,7 +2407,7 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 			continue
 		}
 
-		err = api.store.DeleteCompose(id)
+		err = api.deleteCompose(ns, id)
 		if err != nil {
 			errors = append(errors, composeDeleteError{
 				"ComposeError",
@@ -1907,15 +2416,6 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 			continue
 		}
 
-		// Delete artifacts from the worker server or — if that doesn't
-		// have this job — the compat output dir. Ignore errors,
-		// because there's no point of reporting them to the client
-		// after the compose itself has already been deleted.
-		err = api.workers.DeleteArtifacts(compose.ImageBuild.JobID)
-		if err == jobqueue.ErrNotExist && api.compatOutputDir != "" {
-			_ = os.RemoveAll(path.Join(api.compatOutputDir, id.String()))
-		}
-
 		results = append(results, composeDeleteStatus{id, true})
 	}
 
@@ -1933,6 +2433,8 @@ func (api *API) composeCancelHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	id, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -1944,7 +2446,7 @@ func (api *API) composeCancelHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	compose, exists := api.store.GetCompose(id)
+	compose, exists := ns.GetCompose(id)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -1964,14 +2466,20 @@ func (api *API) composeCancelHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	err = api.workers.Cancel(compose.ImageBuild.JobID)
-	if err != nil {
-		errors := responseError{
-			ID:  "InternalServerError",
-			Msg: fmt.Sprintf("Internal server error: %v", err),
+	// images which are built already are not affected
+	for _, ib := range compose.ImageBuilds {
+		err = api.workers.Cancel(ib.JobID)
+		if err != nil {
+			errors := responseError{
+				ID:  "InternalServerError",
+				Msg: fmt.Sprintf("Internal server error: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
 		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
-		return
+
+		// uploads would never run after the image build was canceled
+		api.cancelUploads(ib)
 	}
 
 	reply := CancelComposeStatusV0{id, true}
@@ -2004,6 +2512,8 @@ func (api *API) composeQueueHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	reply := struct {
 		New []*ComposeEntry `json:"new"`
 		Run []*ComposeEntry `json:"run"`
@@ -2011,7 +2521,7 @@ func (api *API) composeQueueHandler(writer http.ResponseWriter, request *http.Re
 
 	includeUploads := isRequestVersionAtLeast(params, 1)
 
-	composes := api.store.GetAllComposes()
+	composes := ns.GetAllComposes()
 	for id, compose := range composes {
 		composeStatus := api.getComposeStatus(compose)
 		switch composeStatus.State {
@@ -2027,18 +2537,22 @@ func (api *API) composeQueueHandler(writer http.ResponseWriter, request *http.Re
 }
 
 func (api *API) composeStatusHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	// TODO: lorax has some params: /api/v0/compose/status/<uuids>[?blueprint=<blueprint_name>&status=<compose_status>&type=<compose_type>]
+	// /api/v0/compose/status/<uuids>[?blueprint=<blueprint_name>&status=<compose_status>&type=<compose_type>]
+	// and the search parameters described at composeQuery
 	if !verifyRequestVersion(writer, params, 0) {
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	var reply struct {
-		UUIDs []*ComposeEntry `json:"uuids"`
+		UUIDs      []*ComposeEntry `json:"uuids"`
+		NextCursor string          `json:"next_cursor,omitempty"`
 	}
 
 	uuidsParam := params.ByName("uuids")
 
-	composes := api.store.GetAllComposes()
+	composes := ns.GetAllComposes()
 	uuids := []uuid.UUID{}
 
 	if uuidsParam != "*" {
@@ -2070,40 +2584,13 @@ func (api *API) composeStatusHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	filterBlueprint := q.Get("blueprint")
-	if len(filterBlueprint) > 0 && !verifyStringsWithRegex(writer, []string{filterBlueprint}, ValidBlueprintName) {
+	query, limit, ok := parseComposeQueryParams(writer, q)
+	if !ok {
 		return
 	}
 
-	filterStatus := q.Get("status")
-	filterImageType := q.Get("type")
-
-	filteredUUIDs := []uuid.UUID{}
-	for _, id := range uuids {
-		compose, exists := composes[id]
-		if !exists {
-			continue
-		}
-		composeStatus := api.getComposeStatus(compose)
-		if filterBlueprint != "" && compose.Blueprint.Name != filterBlueprint {
-			continue
-		} else if filterStatus != "" && composeStatus.State.ToString() != filterStatus {
-			continue
-		} else if filterImageType != "" && compose.ImageBuild.ImageType.Name() != filterImageType {
-			continue
-		}
-		filteredUUIDs = append(filteredUUIDs, id)
-	}
-
-	reply.UUIDs = []*ComposeEntry{}
 	includeUploads := isRequestVersionAtLeast(params, 1)
-	for _, id := range filteredUUIDs {
-		if compose, exists := composes[id]; exists {
-			composeStatus := api.getComposeStatus(compose)
-			reply.UUIDs = append(reply.UUIDs, composeToComposeEntry(id, compose, composeStatus, includeUploads))
-		}
-	}
-	sortComposeEntries(reply.UUIDs)
+	reply.UUIDs, reply.NextCursor = api.searchComposes(composes, uuids, query, limit, includeUploads)
 
 	err = json.NewEncoder(writer).Encode(reply)
 	common.PanicOnError(err)
@@ -2114,6 +2601,8 @@ func (api *API) composeInfoHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	id, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2125,7 +2614,7 @@ func (api *API) composeInfoHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	compose, exists := api.store.GetCompose(id)
+	compose, exists := ns.GetCompose(id)
 
 	if !exists {
 		errors := responseError{
@@ -2145,11 +2634,12 @@ func (api *API) composeInfoHandler(writer http.ResponseWriter, request *http.Req
 		Config      string               `json:"config"`    // anaconda config, let's ignore this field
 		Blueprint   *blueprint.Blueprint `json:"blueprint"` // blueprint not frozen!
 		Commit      string               `json:"commit"`    // empty for now
-		Deps        Dependencies         `json:"deps"`      // empty for now
+		Deps        Dependencies         `json:"deps"`      // empty for composes which didn't record their packages
 		ComposeType string               `json:"compose_type"`
 		QueueStatus string               `json:"queue_status"`
 		ImageSize   uint64               `json:"image_size"`
 		Uploads     []uploadResponse     `json:"uploads,omitempty"`
+		ImageBuilds []ImageBuildEntry    `json:"image_builds,omitempty"`
 	}
 
 	reply.ID = id
@@ -2157,15 +2647,26 @@ func (api *API) composeInfoHandler(writer http.ResponseWriter, request *http.Req
 	reply.Deps = Dependencies{
 		Packages: make([]map[string]interface{}, 0),
 	}
+	for _, pkg := range compose.ImageBuilds[0].Packages {
+		reply.Deps.Packages = append(reply.Deps.Packages, map[string]interface{}{
+			"name":    pkg.Name,
+			"epoch":   pkg.Epoch,
+			"version": pkg.Version,
+			"release": pkg.Release,
+			"arch":    pkg.Arch,
+		})
+	}
 	// Weldr API assumes only one image build per compose, that's why only the
-	// 1st build is considered
+	// 1st build is considered. All builds are listed in ImageBuilds when
+	// there are several.
 	composeStatus := api.getComposeStatus(compose)
-	reply.ComposeType = compose.ImageBuild.ImageType.Name()
+	reply.ComposeType = compose.ImageBuilds[0].ImageType.Name()
 	reply.QueueStatus = composeStatus.State.ToString()
-	reply.ImageSize = compose.ImageBuild.Size
+	reply.ImageSize = compose.ImageBuilds[0].Size
+	reply.ImageBuilds = imageBuildEntries(compose, composeStatus)
 
 	if isRequestVersionAtLeast(params, 1) {
-		reply.Uploads = targetsToUploadResponses(compose.ImageBuild.Targets, composeStatus.State)
+		reply.Uploads = targetsToUploadResponses(composeTargets(compose), composeStatus)
 	}
 
 	err = json.NewEncoder(writer).Encode(reply)
@@ -2177,6 +2678,8 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	uuid, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2188,7 +2691,7 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	compose, exists := api.store.GetCompose(uuid)
+	compose, exists := ns.GetCompose(uuid)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -2198,20 +2701,26 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
-	if composeStatus.State != common.CFinished {
+	ib, ok := imageBuildParam(writer, request, compose)
+	if !ok {
+		return
+	}
+
+	// the images of a compose can be downloaded as soon as they are built
+	imageBuildStatus := api.getComposeStatus(compose).ImageBuilds[ib.ID]
+	if imageBuildStatus.State != common.CFinished {
 		errors := responseError{
 			ID:  "BuildInWrongState",
-			Msg: fmt.Sprintf("Build %s is in wrong state: %s", uuidString, composeStatus.State.ToString()),
+			Msg: fmt.Sprintf("Build %s is in wrong state: %s", uuidString, imageBuildStatus.State.ToString()),
 		}
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	imageName := compose.ImageBuild.ImageType.Filename()
-	imageMime := compose.ImageBuild.ImageType.MIMEType()
+	imageName := ib.ImageType.Filename()
+	imageMime := ib.ImageType.MIMEType()
 
-	reader, fileSize, err := api.openImageFile(uuid, compose)
+	reader, fileSize, err := api.openImageFile(uuid, *ib)
 	if err != nil {
 		errors := responseError{
 			ID:  "InternalServerError",
@@ -2221,7 +2730,7 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	writer.Header().Set("Content-Disposition", "attachment; filename="+uuid.String()+"-"+imageName)
+	writer.Header().Set("Content-Disposition", "attachment; filename="+imageBuildName(uuid.String(), *ib)+"-"+imageName)
 	writer.Header().Set("Content-Type", imageMime)
 	writer.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
 
@@ -2235,6 +2744,8 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	uuid, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2246,7 +2757,7 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	compose, exists := api.store.GetCompose(uuid)
+	compose, exists := ns.GetCompose(uuid)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -2266,25 +2777,43 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	metadata, err := json.Marshal(&compose.ImageBuild.Manifest)
-	common.PanicOnError(err)
-
 	writer.Header().Set("Content-Disposition", "attachment; filename="+uuid.String()+"-metadata.tar")
 	writer.Header().Set("Content-Type", "application/x-tar")
 	// NOTE: Do not set Content-Length, it will use chunked transfer encoding automatically
 
 	tw := tar.NewWriter(writer)
-	hdr := &tar.Header{
-		Name:    uuid.String() + ".json",
-		Mode:    0600,
-		Size:    int64(len(metadata)),
-		ModTime: time.Now().Truncate(time.Second),
-	}
-	err = tw.WriteHeader(hdr)
-	common.PanicOnError(err)
+	for i, ib := range compose.ImageBuilds {
+		metadata, err := json.Marshal(&ib.Manifest)
+		common.PanicOnError(err)
 
-	_, err = tw.Write(metadata)
-	common.PanicOnError(err)
+		hdr := &tar.Header{
+			Name:    imageBuildName(uuid.String(), ib) + ".json",
+			Mode:    0600,
+			Size:    int64(len(metadata)),
+			ModTime: time.Now().Truncate(time.Second),
+		}
+		err = tw.WriteHeader(hdr)
+		common.PanicOnError(err)
+
+		_, err = tw.Write(metadata)
+		common.PanicOnError(err)
+
+		// the metadata osbuild reported for each stage, and their timing
+		stages, err := json.Marshal(newBuildMetadata(composeStatus.ImageBuilds[i]))
+		common.PanicOnError(err)
+
+		hdr = &tar.Header{
+			Name:    imageBuildName(uuid.String(), ib) + "-stages.json",
+			Mode:    0600,
+			Size:    int64(len(stages)),
+			ModTime: time.Now().Truncate(time.Second),
+		}
+		err = tw.WriteHeader(hdr)
+		common.PanicOnError(err)
+
+		_, err = tw.Write(stages)
+		common.PanicOnError(err)
+	}
 
 	err = tw.Close()
 	common.PanicOnError(err)
@@ -2296,6 +2825,8 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	uuid, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2307,7 +2838,7 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	compose, exists := api.store.GetCompose(uuid)
+	compose, exists := ns.GetCompose(uuid)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -2327,55 +2858,57 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	metadata, err := json.Marshal(&compose.ImageBuild.Manifest)
-	common.PanicOnError(err)
-
 	writer.Header().Set("Content-Disposition", "attachment; filename="+uuid.String()+".tar")
 	writer.Header().Set("Content-Type", "application/x-tar")
 	// NOTE: Do not set Content-Length, it should use chunked transfer encoding automatically
 
 	tw := tar.NewWriter(writer)
-	hdr := &tar.Header{
-		Name:    uuid.String() + ".json",
-		Mode:    0644,
-		Size:    int64(len(metadata)),
-		ModTime: time.Now().Truncate(time.Second),
-	}
-	err = tw.WriteHeader(hdr)
-	common.PanicOnError(err)
-	_, err = tw.Write(metadata)
-	common.PanicOnError(err)
-
-	// Add the logs
-	var fileContents bytes.Buffer
-	if composeStatus.Result != nil {
-		err = composeStatus.Result.Write(&fileContents)
+	for i, ib := range compose.ImageBuilds {
+		metadata, err := json.Marshal(&ib.Manifest)
 		common.PanicOnError(err)
 
-		hdr = &tar.Header{
-			Name:    "logs/osbuild.log",
+		hdr := &tar.Header{
+			Name:    imageBuildName(uuid.String(), ib) + ".json",
 			Mode:    0644,
-			Size:    int64(fileContents.Len()),
+			Size:    int64(len(metadata)),
 			ModTime: time.Now().Truncate(time.Second),
 		}
 		err = tw.WriteHeader(hdr)
 		common.PanicOnError(err)
-		_, err = tw.Write(fileContents.Bytes())
+		_, err = tw.Write(metadata)
 		common.PanicOnError(err)
-	}
 
-	reader, fileSize, err := api.openImageFile(uuid, compose)
-	if err == nil {
-		hdr = &tar.Header{
-			Name:    uuid.String() + "-" + compose.ImageBuild.ImageType.Filename(),
-			Mode:    0644,
-			Size:    int64(fileSize),
-			ModTime: time.Now().Truncate(time.Second),
+		// Add the logs
+		var fileContents bytes.Buffer
+		if result := composeStatus.ImageBuilds[i].Result; result != nil {
+			err = result.Write(&fileContents)
+			common.PanicOnError(err)
+
+			hdr = &tar.Header{
+				Name:    imageBuildName("logs/osbuild", ib) + ".log",
+				Mode:    0644,
+				Size:    int64(fileContents.Len()),
+				ModTime: time.Now().Truncate(time.Second),
+			}
+			err = tw.WriteHeader(hdr)
+			common.PanicOnError(err)
+			_, err = tw.Write(fileContents.Bytes())
+			common.PanicOnError(err)
+		}
+
+		reader, fileSize, err := api.openImageFile(uuid, ib)
+		if err == nil {
+			hdr = &tar.Header{
+				Name:    imageBuildName(uuid.String(), ib) + "-" + ib.ImageType.Filename(),
+				Mode:    0644,
+				Size:    int64(fileSize),
+				ModTime: time.Now().Truncate(time.Second),
+			}
+			err = tw.WriteHeader(hdr)
+			common.PanicOnError(err)
+			_, err = io.Copy(tw, reader)
+			common.PanicOnError(err)
 		}
-		err = tw.WriteHeader(hdr)
-		common.PanicOnError(err)
-		_, err = io.Copy(tw, reader)
-		common.PanicOnError(err)
 	}
 
 	err = tw.Close()
@@ -2387,6 +2920,8 @@ func (api *API) composeLogsHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	id, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2398,7 +2933,7 @@ func (api *API) composeLogsHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	compose, exists := api.store.GetCompose(id)
+	compose, exists := ns.GetCompose(id)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -2423,23 +2958,25 @@ func (api *API) composeLogsHandler(writer http.ResponseWriter, request *http.Req
 
 	tw := tar.NewWriter(writer)
 
-	// tar format needs to contain file size before the actual file content, therefore the intermediate buffer
-	var fileContents bytes.Buffer
-	err = composeStatus.Result.Write(&fileContents)
-	common.PanicOnError(err)
+	for i, ib := range compose.ImageBuilds {
+		// tar format needs to contain file size before the actual file content, therefore the intermediate buffer
+		var fileContents bytes.Buffer
+		err = composeStatus.ImageBuilds[i].Result.Write(&fileContents)
+		common.PanicOnError(err)
 
-	header := &tar.Header{
-		Name:    "logs/osbuild.log",
-		Mode:    0644,
-		Size:    int64(fileContents.Len()),
-		ModTime: time.Now().Truncate(time.Second),
-	}
+		header := &tar.Header{
+			Name:    imageBuildName("logs/osbuild", ib) + ".log",
+			Mode:    0644,
+			Size:    int64(fileContents.Len()),
+			ModTime: time.Now().Truncate(time.Second),
+		}
 
-	err = tw.WriteHeader(header)
-	common.PanicOnError(err)
+		err = tw.WriteHeader(header)
+		common.PanicOnError(err)
 
-	_, err = io.Copy(tw, &fileContents)
-	common.PanicOnError(err)
+		_, err = io.Copy(tw, &fileContents)
+		common.PanicOnError(err)
+	}
 
 	err = tw.Close()
 	common.PanicOnError(err)
@@ -2451,6 +2988,8 @@ func (api *API) composeLogHandler(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
+	ns := api.Namespace(request)
+
 	uuidString := params.ByName("uuid")
 	id, err := uuid.Parse(uuidString)
 	if err != nil {
@@ -2462,7 +3001,7 @@ func (api *API) composeLogHandler(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	compose, exists := api.store.GetCompose(id)
+	compose, exists := ns.GetCompose(id)
 	if !exists {
 		errors := responseError{
 			ID:  "UnknownUUID",
@@ -2487,8 +3026,10 @@ func (api *API) composeLogHandler(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	err = composeStatus.Result.Write(writer)
-	common.PanicOnError(err)
+	for _, status := range composeStatus.ImageBuilds {
+		err = status.Result.Write(writer)
+		common.PanicOnError(err)
+	}
 }
 
 func (api *API) composeFinishedHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -2496,19 +3037,26 @@ func (api *API) composeFinishedHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	reply := struct {
-		Finished []*ComposeEntry `json:"finished"`
-	}{[]*ComposeEntry{}}
+	ns := api.Namespace(request)
 
-	includeUploads := isRequestVersionAtLeast(params, 1)
-	for id, compose := range api.store.GetAllComposes() {
-		composeStatus := api.getComposeStatus(compose)
-		if composeStatus.State != common.CFinished {
-			continue
-		}
-		reply.Finished = append(reply.Finished, composeToComposeEntry(id, compose, composeStatus, includeUploads))
+	var reply struct {
+		Finished   []*ComposeEntry `json:"finished"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	query, limit, ok := parseComposeQueryParams(writer, request.URL.Query())
+	if !ok {
+		return
+	}
+
+	composes := ns.GetAllComposes()
+	ids := make([]uuid.UUID, 0, len(composes))
+	for id := range composes {
+		ids = append(ids, id)
 	}
-	sortComposeEntries(reply.Finished)
+
+	includeUploads := isRequestVersionAtLeast(params, 1)
+	reply.Finished, reply.NextCursor = api.searchComposes(composes, ids, query, limit, includeUploads, common.CFinished)
 
 	err := json.NewEncoder(writer).Encode(reply)
 	common.PanicOnError(err)
@@ -2519,40 +3067,48 @@ func (api *API) composeFailedHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	reply := struct {
-		Failed []*ComposeEntry `json:"failed"`
-	}{[]*ComposeEntry{}}
+	ns := api.Namespace(request)
 
-	includeUploads := isRequestVersionAtLeast(params, 1)
-	for id, compose := range api.store.GetAllComposes() {
-		composeStatus := api.getComposeStatus(compose)
-		if composeStatus.State != common.CFailed {
-			continue
-		}
-		reply.Failed = append(reply.Failed, composeToComposeEntry(id, compose, composeStatus, includeUploads))
+	var reply struct {
+		Failed     []*ComposeEntry `json:"failed"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	query, limit, ok := parseComposeQueryParams(writer, request.URL.Query())
+	if !ok {
+		return
+	}
+
+	composes := ns.GetAllComposes()
+	ids := make([]uuid.UUID, 0, len(composes))
+	for id := range composes {
+		ids = append(ids, id)
 	}
-	sortComposeEntries(reply.Failed)
+
+	includeUploads := isRequestVersionAtLeast(params, 1)
+	reply.Failed, reply.NextCursor = api.searchComposes(composes, ids, query, limit, includeUploads, common.CFailed)
 
 	err := json.NewEncoder(writer).Encode(reply)
 	common.PanicOnError(err)
 }
 
-func (api *API) fetchPackageList() (rpmmd.PackageList, error) {
-	packages, _, err := api.rpmmd.FetchMetadata(api.allRepositories(), api.distro.ModulePlatformID(), api.arch.Name())
+func (api *API) fetchPackageList(ns *store.Store) (rpmmd.PackageList, error) {
+	packages, _, err := api.rpmmd.FetchMetadata(api.allRepositories(ns), api.distro.ModulePlatformID(), api.arch.Name())
 	return packages, err
 }
 
-// Returns all configured repositories (base + sources) as rpmmd.RepoConfig
-func (api *API) allRepositories() []rpmmd.RepoConfig {
+// Returns all configured repositories (base + sources of the namespace of
+// `ns`) as rpmmd.RepoConfig
+func (api *API) allRepositories(ns *store.Store) []rpmmd.RepoConfig {
 	repos := append([]rpmmd.RepoConfig{}, api.repos...)
-	for id, source := range api.store.GetAllSourcesByID() {
+	for id, source := range ns.GetAllSourcesByID() {
 		repos = append(repos, source.RepoConfig(id))
 	}
 	return repos
 }
 
-func (api *API) depsolveBlueprint(bp *blueprint.Blueprint, imageType distro.ImageType) ([]rpmmd.PackageSpec, []rpmmd.PackageSpec, error) {
-	repos := api.allRepositories()
+func (api *API) depsolveBlueprint(ns *store.Store, bp *blueprint.Blueprint, imageType distro.ImageType) ([]rpmmd.PackageSpec, []rpmmd.PackageSpec, error) {
+	repos := api.allRepositories(ns)
 
 	specs := bp.GetPackages()
 	excludeSpecs := []string{}
@@ -2579,83 +3135,718 @@ func (api *API) depsolveBlueprint(bp *blueprint.Blueprint, imageType distro.Imag
 	return packages, buildPackages, err
 }
 
-func (api *API) uploadsScheduleHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
-		return
+// resolveUploadProfile fills in the settings of the provider profile of
+// namespace `ns` that `u` refers to, if it doesn't contain settings itself.
+func resolveUploadProfile(ns *store.Store, u *uploadRequest) error {
+	if u.Settings != nil {
+		return nil
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	data, exists := ns.GetUploadProfile(u.Provider, u.Profile)
+	if !exists {
+		return fmt.Errorf("Unknown %s profile: %s", u.Provider, u.Profile)
+	}
 
-func (api *API) uploadsDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
-		return
+	settings, err := unmarshalUploadSettings(u.Provider, data)
+	if err != nil {
+		return fmt.Errorf("Invalid %s profile %s: %v", u.Provider, u.Profile, err)
 	}
+	u.Settings = settings
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
+	return nil
 }
 
-func (api *API) uploadsInfoHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+func (api *API) uploadsScheduleHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	if !verifyRequestVersion(writer, params, 1) {
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	ns := api.Namespace(request)
 
-func (api *API) uploadsLogHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid build uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	compose, exists := ns.GetCompose(id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Compose %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
 
-func (api *API) uploadsResetHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
+	var upload uploadRequest
+	err = json.NewDecoder(request.Body).Decode(&upload)
+	if err != nil {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: fmt.Sprintf("invalid upload request: %v", err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	err = resolveUploadProfile(ns, &upload)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownProfile",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
 
-func (api *API) uploadsCancelHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
+	ib, ok := imageBuildParam(writer, request, compose)
+	if !ok {
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	err = checkUploadImageType(upload, ib.ImageType)
+	if err != nil {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
 
-func (api *API) providersHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
+	// composes without a job (from before the job queue existed or created
+	// in test mode) have no image a worker could upload
+	if ib.JobID == uuid.Nil || api.getImageBuildStatus(*ib).State == common.CFailed {
+		errors := responseError{
+			ID:  "BuildInWrongState",
+			Msg: fmt.Sprintf("Build %s cannot be uploaded", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
+	t := uploadRequestToTarget(upload, ib.ImageType)
+	err = api.enqueueUpload(id, *ib, t)
+	if err != nil {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	reply := struct {
+		Status   bool      `json:"status"`
+		UploadID uuid.UUID `json:"upload_id"`
+	}{
+		Status:   true,
+		UploadID: t.Uuid,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
 }
 
-func (api *API) providersSaveHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+// composeRebuildHandler starts a new compose which builds the same images as
+// an existing compose, from exactly the same packages. It fails when any of
+// those packages is not available from the repositories anymore, or when its
+// checksum changed. Uploads are not repeated.
+func (api *API) composeRebuildHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	if !verifyRequestVersion(writer, params, 1) {
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
-}
+	ns := api.Namespace(request)
 
-func (api *API) providersDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 1) {
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid build uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	// TODO: implement this route (it is v1 only)
-	notImplementedHandler(writer, request, params)
+	compose, exists := ns.GetCompose(id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Compose %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	// composes from before packages were recorded can't be reproduced
+	for _, ib := range compose.ImageBuilds {
+		if len(ib.Packages) == 0 {
+			errors := responseError{
+				ID:  "BuildInWrongState",
+				Msg: fmt.Sprintf("Compose %s cannot be rebuilt, its packages were not recorded", uuidString),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	if quotaExceeded(writer, ns.CheckComposeQuota()) {
+		return
+	}
+
+	bp := compose.Blueprint.DeepCopy()
+	repos := api.allRepositories(ns)
+	composeID := uuid.New()
+
+	var options []imageBuildOptions
+	for _, ib := range compose.ImageBuilds {
+		packages, err := api.resolveFrozenPackages(ib.Packages, repos)
+		var buildPackages []rpmmd.PackageSpec
+		if err == nil {
+			buildPackages, err = api.resolveFrozenPackages(ib.BuildPackages, repos)
+		}
+		if err != nil {
+			errors := responseError{
+				ID:  "PackagesUnavailable",
+				Msg: fmt.Sprintf("Compose %s cannot be rebuilt: %v", uuidString, err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+
+		options = append(options, imageBuildOptions{
+			ImageType:     ib.ImageType,
+			Size:          ib.Size,
+			OSTree:        ib.OSTree,
+			Packages:      packages,
+			BuildPackages: buildPackages,
+		})
+	}
+
+	imageBuilds, err := api.newImageBuilds(composeID, &bp, repos, options)
+	if err != nil {
+		errors := responseError{
+			ID:  "ManifestCreationFailed",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err = composes.Push(api.workers, ns, composeID, &bp, imageBuilds)
+	if quotaExceeded(writer, err) {
+		return
+	} else if err != nil {
+		errors := responseError{
+			ID:  "ComposePushErrored",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	reply := struct {
+		BuildID uuid.UUID `json:"build_id"`
+		Status  bool      `json:"status"`
+	}{
+		BuildID: composeID,
+		Status:  true,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+// resolveFrozenPackages looks up exactly `packages` in `repos`. It fails
+// unless every one of them is still available with the same checksum, and
+// returns them with their current locations.
+func (api *API) resolveFrozenPackages(packages []rpmmd.PackageSpec, repos []rpmmd.RepoConfig) ([]rpmmd.PackageSpec, error) {
+	if len(packages) == 0 {
+		return packages, nil
+	}
+
+	specs := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		specs = append(specs, pkg.GetNEVRA())
+	}
+
+	available, _, err := api.rpmmd.Depsolve(specs, nil, repos, api.distro.ModulePlatformID(), api.arch.Name())
+	if err != nil {
+		return nil, fmt.Errorf("packages are not available anymore: %v", err)
+	}
+
+	byNEVRA := make(map[string]rpmmd.PackageSpec)
+	for _, pkg := range available {
+		byNEVRA[pkg.GetNEVRA()] = pkg
+	}
+
+	resolved := make([]rpmmd.PackageSpec, 0, len(packages))
+	for _, pkg := range packages {
+		current, exists := byNEVRA[pkg.GetNEVRA()]
+		if !exists {
+			return nil, fmt.Errorf("package %s is not available anymore", pkg.GetNEVRA())
+		}
+		if current.Checksum != pkg.Checksum {
+			return nil, fmt.Errorf("package %s changed, its checksum is %s instead of %s", pkg.GetNEVRA(), current.Checksum, pkg.Checksum)
+		}
+		resolved = append(resolved, current)
+	}
+
+	return resolved, nil
+}
+
+// imageBuildOptions are the options of one image of a new compose, and the
+// packages it is built from.
+type imageBuildOptions struct {
+	ImageType     distro.ImageType
+	Size          uint64
+	OSTree        distro.OSTreeImageOptions
+	Upload        *uploadRequest
+	Packages      []rpmmd.PackageSpec
+	BuildPackages []rpmmd.PackageSpec
+}
+
+// newImageBuilds returns the image builds of compose `composeID`, which builds
+// `bp` into one image for each of `options`. Every image is stored locally,
+// and uploaded if its options contain an upload.
+func (api *API) newImageBuilds(composeID uuid.UUID, bp *blueprint.Blueprint, repos []rpmmd.RepoConfig, options []imageBuildOptions) ([]store.ImageBuild, error) {
+	var imageBuilds []store.ImageBuild
+	for i, o := range options {
+		manifest, err := o.ImageType.Manifest(bp.Customizations,
+			distro.ImageOptions{
+				Size:   o.Size,
+				OSTree: o.OSTree,
+				Container: distro.ContainerImageOptions{
+					Labels: blueprintContainerLabels(bp),
+				},
+			},
+			repos,
+			o.Packages,
+			o.BuildPackages)
+		if err == nil {
+			err = api.validateManifest(&manifest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create osbuild manifest: %v", err)
+		}
+
+		var targets []*target.Target
+		if o.Upload != nil {
+			targets = append(targets, uploadRequestToTarget(*o.Upload, o.ImageType))
+		}
+		targets = append(targets, newLocalTarget(composeID, i, o.ImageType))
+
+		imageBuilds = append(imageBuilds, store.ImageBuild{
+			Manifest:      manifest,
+			ImageType:     o.ImageType,
+			Targets:       targets,
+			Size:          o.Size,
+			Packages:      o.Packages,
+			BuildPackages: o.BuildPackages,
+			OSTree:        o.OSTree,
+		})
+	}
+
+	return imageBuilds, nil
+}
+
+// newDepsolver returns a function which depsolves package sets in `repos`.
+// Image types often share their package sets, it depsolves each of them
+// only once.
+func (api *API) newDepsolver(repos []rpmmd.RepoConfig) func(specs, excludeSpecs []string) ([]rpmmd.PackageSpec, error) {
+	depsolved := make(map[string][]rpmmd.PackageSpec)
+	return func(specs, excludeSpecs []string) ([]rpmmd.PackageSpec, error) {
+		key := fmt.Sprint(specs, excludeSpecs)
+		if packages, exists := depsolved[key]; exists {
+			return packages, nil
+		}
+		packages, _, err := api.rpmmd.Depsolve(specs, excludeSpecs, repos, api.distro.ModulePlatformID(), api.arch.Name())
+		if err != nil {
+			return nil, err
+		}
+		depsolved[key] = packages
+		return packages, nil
+	}
+}
+
+// newLocalTarget returns the target which stores the image of type
+// `imageType`, built by image build `imageBuildID` of a compose.
+func newLocalTarget(composeID uuid.UUID, imageBuildID int, imageType distro.ImageType) *target.Target {
+	return target.NewLocalTarget(
+		&target.LocalTargetOptions{
+			ComposeId:       composeID,
+			ImageBuildId:    imageBuildID,
+			Filename:        imageType.Filename(),
+			StreamOptimized: imageType.Name() == "vmdk", // TODO: move conversion to osbuild
+		},
+	)
+}
+
+// enqueueUpload enqueues a job which uploads the image of `ib` to `t`, and
+// adds it to the compose.
+func (api *API) enqueueUpload(composeID uuid.UUID, ib store.ImageBuild, t *target.Target) error {
+	jobID, err := api.workers.EnqueueUpload(ib.JobID, ib.ImageType.Filename(), t)
+	if err != nil {
+		return err
+	}
+
+	return api.store.PushComposeUpload(composeID, ib.ID, t, jobID)
+}
+
+// findUpload returns the compose the upload `id` belongs to, the image build
+// it uploads and its target.
+func (api *API) findUpload(ns *store.Store, id uuid.UUID) (uuid.UUID, store.ImageBuild, *target.Target, bool) {
+	composes := ns.GetAllComposes()
+	composeIDs := make([]uuid.UUID, 0, len(composes))
+	for composeID := range composes {
+		composeIDs = append(composeIDs, composeID)
+	}
+	// targets are unique to a compose, but look at composes in a stable
+	// order anyway to get predictable results
+	sort.Slice(composeIDs, func(i, j int) bool {
+		return composeIDs[i].String() < composeIDs[j].String()
+	})
+
+	for _, composeID := range composeIDs {
+		compose := composes[composeID]
+		ib, t, exists := compose.FindTarget(id)
+		// local targets are not uploads
+		if exists && t.Name != "org.osbuild.local" {
+			return composeID, *ib, t, true
+		}
+	}
+
+	return uuid.Nil, store.ImageBuild{}, nil, false
+}
+
+func (api *API) uploadsDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	// TODO: implement this route (it is v1 only)
+	notImplementedHandler(writer, request, params)
+}
+
+func (api *API) uploadsInfoHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid upload uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	_, ib, t, exists := api.findUpload(ns, id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Upload %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(ib)
+	uploads := targetsToUploadResponses([]*target.Target{t}, composeStatus)
+
+	reply := struct {
+		Status bool           `json:"status"`
+		Upload uploadResponse `json:"upload"`
+	}{
+		Status: true,
+		Upload: uploads[0],
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) uploadsLogHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	// TODO: implement this route (it is v1 only)
+	notImplementedHandler(writer, request, params)
+}
+
+func (api *API) uploadsResetHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid upload uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	composeID, ib, t, exists := api.findUpload(ns, id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Upload %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	// only the upload is retried, which requires a successfully built image
+	imageBuildStatus := api.getImageBuildStatus(ib)
+	if ib.JobID == uuid.Nil || imageBuildStatus.State != common.CFinished || imageBuildStatus.uploadState(t.Uuid) != common.CFailed {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: fmt.Sprintf("Upload %s cannot be reset, only failed uploads of finished builds can", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err = api.enqueueUpload(composeID, ib, t)
+	if err != nil {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	reply := struct {
+		Status bool      `json:"status"`
+		UUID   uuid.UUID `json:"uuid"`
+	}{
+		Status: true,
+		UUID:   id,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) uploadsCancelHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid upload uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	_, ib, t, exists := api.findUpload(ns, id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Upload %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	// uploads which are part of the image build can only be canceled
+	// together with the build
+	jobID, hasJob := ib.UploadJobs[t.Uuid]
+	state := api.getImageBuildStatus(ib).uploadState(t.Uuid)
+	if !hasJob || (state != common.CWaiting && state != common.CRunning) {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: fmt.Sprintf("Upload %s cannot be canceled", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err = api.workers.Cancel(jobID)
+	if err != nil {
+		errors := responseError{
+			ID:  "UploadError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	reply := struct {
+		Status bool      `json:"status"`
+		UUID   uuid.UUID `json:"uuid"`
+	}{
+		Status: true,
+		UUID:   id,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) providersHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	type provider struct {
+		Display        string                    `json:"display"`
+		SupportedTypes []string                  `json:"supported_types"`
+		Profiles       map[string]uploadSettings `json:"profiles"`
+	}
+
+	providers := map[string]*provider{
+		"aws": {
+			Display:        "AWS",
+			SupportedTypes: []string{"ami"},
+		},
+		"azure": {
+			Display:        "Azure",
+			SupportedTypes: []string{"vhd"},
+		},
+		"registry": {
+			Display:        "Container registry",
+			SupportedTypes: []string{"container"},
+		},
+	}
+
+	profiles := api.Namespace(request).GetAllUploadProfiles()
+	for name, p := range providers {
+		p.Profiles = make(map[string]uploadSettings)
+		for profile, data := range profiles[name] {
+			settings, err := unmarshalUploadSettings(name, data)
+			if err != nil {
+				// profiles are validated when they're saved
+				continue
+			}
+			p.Profiles[profile] = settings.withoutSecrets()
+		}
+	}
+
+	reply := struct {
+		Providers map[string]*provider `json:"providers"`
+	}{
+		Providers: providers,
+	}
+
+	err := json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) providersSaveHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	var req struct {
+		Provider string          `json:"provider"`
+		Profile  string          `json:"profile"`
+		Settings json.RawMessage `json:"settings"`
+	}
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		errors := responseError{
+			ID:  "ProviderError",
+			Msg: fmt.Sprintf("invalid provider profile: %v", err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	if !isValidProvider(req.Provider) {
+		errors := responseError{
+			ID:  "UnknownProvider",
+			Msg: fmt.Sprintf("Unknown provider: %s", req.Provider),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	if req.Profile == "" {
+		errors := responseError{
+			ID:  "ProviderError",
+			Msg: "profile name is required",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	if !verifyStringsWithRegex(writer, []string{req.Profile}, ValidBlueprintName) {
+		return
+	}
+
+	settings, err := unmarshalUploadSettings(req.Provider, req.Settings)
+	if err != nil {
+		errors := responseError{
+			ID:  "ProviderError",
+			Msg: fmt.Sprintf("invalid %s settings: %v", req.Provider, err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	// store the parsed settings to drop unknown fields
+	data, err := json.Marshal(settings)
+	common.PanicOnError(err)
+	api.Namespace(request).PushUploadProfile(req.Provider, req.Profile, data)
+
+	statusResponseOK(writer)
+}
+
+func (api *API) providersDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	provider := params.ByName("provider")
+	profile := params.ByName("profile")
+
+	if !isValidProvider(provider) {
+		errors := responseError{
+			ID:  "UnknownProvider",
+			Msg: fmt.Sprintf("Unknown provider: %s", provider),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err := api.Namespace(request).DeleteUploadProfile(provider, profile)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownProfile",
+			Msg: fmt.Sprintf("Unknown %s profile: %s", provider, profile),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	statusResponseOK(writer)
 }
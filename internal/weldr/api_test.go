@@ -3,11 +3,16 @@ package weldr
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path"
 	"strconv"
 	"testing"
 	"time"
@@ -16,14 +21,18 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	test_distro "github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue/testjobqueue"
 	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/sbom"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/test"
+	"github.com/osbuild/osbuild-composer/internal/worker"
 
 	"github.com/BurntSushi/toml"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -57,6 +66,10 @@ func TestBasic(t *testing.T) {
 		{"/api/v0/projects/source/info/*", http.StatusOK, `{"sources":{"test-id":{"name":"test-id","type":"yum-baseurl","url":"http://example.com/test/os/x86_64","check_gpg":true,"check_ssl":true,"system":true}},"errors":[]}`},
 
 		{"/api/v0/blueprints/list", http.StatusOK, `{"total":1,"offset":0,"limit":1,"blueprints":["test"]}`},
+		{"/api/v0/blueprints/list?name=te*", http.StatusOK, `{"total":1,"offset":0,"limit":1,"blueprints":["test"]}`},
+		{"/api/v0/blueprints/list?name=foo*", http.StatusOK, `{"total":0,"offset":0,"limit":0,"blueprints":[]}`},
+		{"/api/v0/blueprints/list?cursor=bmFtZQB0ZXN0", http.StatusOK, `{"total":0,"offset":0,"limit":0,"blueprints":[]}`},
+		{"/api/v0/blueprints/list?name=[", http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'name': syntax error in pattern"}]}`},
 		{"/api/v0/blueprints/info/", http.StatusNotFound, `{"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}],"status":false}`},
 		{"/api/v0/blueprints/info/foo", http.StatusOK, `{"blueprints":[],"changes":[],"errors":[{"id":"UnknownBlueprint","msg":"foo: "}]}`},
 	}
@@ -67,6 +80,30 @@ func TestBasic(t *testing.T) {
 	}
 }
 
+func TestBlueprintsListSearch(t *testing.T) {
+	var cases = []struct {
+		Path             string
+		ExpectedStatus   int
+		ExpectedResponse string
+	}{
+		{"/api/v0/blueprints/list?limit=2", http.StatusOK, `{"total":4,"offset":0,"limit":2,"blueprints":["search-a","search-b"],"next_cursor":"bmFtZQBzZWFyY2gtYg"}`},
+		{"/api/v0/blueprints/list?limit=2&cursor=bmFtZQBzZWFyY2gtYg", http.StatusOK, `{"total":2,"offset":0,"limit":2,"blueprints":["search-c","test"]}`},
+		{"/api/v0/blueprints/list?name=search-*&order=desc&limit=2", http.StatusOK, `{"total":3,"offset":0,"limit":2,"blueprints":["search-c","search-b"],"next_cursor":"bmFtZQBzZWFyY2gtYg"}`},
+		{"/api/v0/blueprints/list?name=search-*&order=desc&cursor=bmFtZQBzZWFyY2gtYg", http.StatusOK, `{"total":1,"offset":0,"limit":1,"blueprints":["search-a"]}`},
+		{"/api/v0/blueprints/list?order=desc&offset=1&limit=1", http.StatusOK, `{"total":4,"offset":1,"limit":1,"blueprints":["search-c"],"next_cursor":"bmFtZQBzZWFyY2gtYw"}`},
+		{"/api/v0/blueprints/list?cursor=invalid", http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'cursor'"}]}`},
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	for _, name := range []string{"search-c", "search-a", "search-b"} {
+		test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"`+name+`","description":"Test","packages":[],"version":"0.0.0"}`)
+	}
+
+	for _, c := range cases {
+		test.TestRoute(t, api, true, "GET", c.Path, ``, c.ExpectedStatus, c.ExpectedResponse)
+	}
+}
+
 func TestBlueprintsNew(t *testing.T) {
 	var cases = []struct {
 		Method         string
@@ -388,7 +425,10 @@ func TestBlueprintsDiff(t *testing.T) {
 		ExpectedStatus int
 		ExpectedJSON   string
 	}{
-		{"GET", "/api/v0/blueprints/diff/test/NEWEST/WORKSPACE", ``, http.StatusOK, `{"diff":[{"new":{"Package":{"name":"systemd","version":"123"}},"old":null},{"new":null,"old":{"Package":{"name":"httpd","version":"2.4.*"}}}]}`},
+		{"GET", "/api/v0/blueprints/diff/test/NEWEST/WORKSPACE", ``, http.StatusOK, `{"diff":[{"new":{"Version":"0.0.0"},"old":{"Version":"0.0.1"}},{"new":{"Package":{"name":"systemd","version":"123"}},"old":null},{"new":null,"old":{"Package":{"name":"httpd","version":"2.4.*"}}}]}`},
+		{"GET", "/api/v0/blueprints/diff/test/WORKSPACE/WORKSPACE", ``, http.StatusOK, `{"diff":[]}`},
+		{"GET", "/api/v0/blueprints/diff/test/NEWEST/abc123", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownCommit","msg":"ggit-error: revspec 'abc123' not found (-3)"}]}`},
+		{"GET", "/api/v0/blueprints/diff/test3-non/NEWEST/WORKSPACE", ``, http.StatusNotFound, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"Unknown blueprint name: test3-non"}]}`},
 	}
 
 	for _, c := range cases {
@@ -400,6 +440,28 @@ func TestBlueprintsDiff(t *testing.T) {
 	}
 }
 
+func TestBlueprintsDiffCommits(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","version":"0.0.1","customizations":{"hostname":"old","user":[{"name":"alice"},{"name":"bob","shell":"/bin/sh"}]}}`)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","version":"0.0.1","customizations":{"hostname":"new","user":[{"name":"bob","shell":"/bin/bash"}],"services":{"enabled":["sshd"]}}}`)
+
+	changes := test.SendHTTP(api, true, "GET", "/api/v0/blueprints/changes/test", ``)
+	var reply struct {
+		Blueprints []struct {
+			Changes []blueprint.Change `json:"changes"`
+		} `json:"blueprints"`
+	}
+	require.NoError(t, json.NewDecoder(changes.Body).Decode(&reply))
+	require.Len(t, reply.Blueprints[0].Changes, 2)
+	// changes are listed newest first
+	newest := reply.Blueprints[0].Changes[0].Commit
+	oldest := reply.Blueprints[0].Changes[1].Commit
+
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/diff/test/"+oldest+"/"+newest, ``, http.StatusOK,
+		`{"diff":[{"new":{"Version":"0.0.2"},"old":{"Version":"0.0.1"}},{"new":{"Customizations.hostname":"new"},"old":{"Customizations.hostname":"old"}},{"new":null,"old":{"Customizations.user":{"name":"alice"}}},{"new":{"Customizations.user":{"name":"bob","shell":"/bin/bash"}},"old":{"Customizations.user":{"name":"bob","shell":"/bin/sh"}}},{"new":{"Customizations.services.enabled":"sshd"},"old":null}]}`)
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/diff/test/"+newest+"/NEWEST", ``, http.StatusOK, `{"diff":[]}`)
+}
+
 func TestBlueprintsDelete(t *testing.T) {
 	var cases = []struct {
 		Method         string
@@ -435,6 +497,45 @@ func TestBlueprintsChanges(t *testing.T) {
 	test.SendHTTP(api, true, "DELETE", "/api/v0/blueprints/delete/"+id, ``)
 }
 
+func TestBlueprintsSync(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "weldr-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	api, s := createWeldrAPI(rpmmd_mock.BaseFixture)
+
+	// without a repository, there is nothing to sync
+	test.TestRoute(t, api, false, "POST", "/api/v0/blueprints/sync", ``, http.StatusNotFound, `{"status":false,"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/sync", ``, http.StatusOK, `{"status":true}`)
+
+	remote := path.Join(dir, "remote.git")
+	out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	repo, err := store.OpenGitRepository(path.Join(dir, "api"), remote, "")
+	require.NoError(t, err)
+	s.SetGitRepository(repo)
+
+	// another composer publishes a blueprint
+	otherRepo, err := store.OpenGitRepository(path.Join(dir, "other"), remote, "")
+	require.NoError(t, err)
+	other := store.New(nil, api.arch, nil)
+	other.SetGitRepository(otherRepo)
+	require.NoError(t, other.PushBlueprint(blueprint.Blueprint{Name: "shared", Description: "Shared", Version: "1.0.0"}, "Add shared"))
+	require.NoError(t, other.SyncBlueprints())
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/sync", ``, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "GET", "/api/v0/blueprints/info/shared", ``, http.StatusOK, `{"blueprints":[{"name":"shared","description":"Shared","version":"1.0.0","packages":[],"groups":[],"modules":[]}],"changes":[{"name":"shared","changed":false}],"errors":[]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v0/blueprints/changes/shared", ``, http.StatusOK, `{"blueprints":[{"changes":[{"commit":"`+other.GetBlueprintChanges("shared")[0].Commit+`","message":"Add shared","revision":null,"timestamp":""}],"name":"shared","total":1}],"errors":[],"limit":20,"offset":0}`, "timestamp")
+}
+
 func TestBlueprintsDepsolve(t *testing.T) {
 	var cases = []struct {
 		Fixture        rpmmd_mock.FixtureGenerator
@@ -461,6 +562,9 @@ func TestCompose(t *testing.T) {
 	require.NoError(t, err)
 	manifest, err := imgType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
 	require.NoError(t, err)
+	// the mock resolves every package set to the same packages
+	packages, _, err := rpmmd_mock.NewRPMMDMock(rpmmd_mock.NoComposesFixture()).Depsolve(nil, nil, nil, "", "")
+	require.NoError(t, err)
 	expectedComposeLocal := &store.Compose{
 		Blueprint: &blueprint.Blueprint{
 			Name:           "test",
@@ -470,16 +574,20 @@ func TestCompose(t *testing.T) {
 			Groups:         []blueprint.Group{},
 			Customizations: nil,
 		},
-		ImageBuild: store.ImageBuild{
-			QueueStatus: common.IBWaiting,
-			ImageType:   imgType,
-			Manifest:    manifest,
-			Targets: []*target.Target{
-				{
-					// skip Uuid and Created fields - they are ignored
-					Name: "org.osbuild.local",
-					Options: &target.LocalTargetOptions{
-						Filename: "test.img",
+		ImageBuilds: []store.ImageBuild{
+			{
+				QueueStatus:   common.IBWaiting,
+				ImageType:     imgType,
+				Manifest:      manifest,
+				Packages:      packages,
+				BuildPackages: packages,
+				Targets: []*target.Target{
+					{
+						// skip Uuid and Created fields - they are ignored
+						Name: "org.osbuild.local",
+						Options: &target.LocalTargetOptions{
+							Filename: "test.img",
+						},
 					},
 				},
 			},
@@ -494,35 +602,39 @@ func TestCompose(t *testing.T) {
 			Groups:         []blueprint.Group{},
 			Customizations: nil,
 		},
-		ImageBuild: store.ImageBuild{
-			QueueStatus: common.IBWaiting,
-			ImageType:   imgType,
-			Manifest:    manifest,
-			Targets: []*target.Target{
-				{
-					Name:      "org.osbuild.aws",
-					Status:    common.IBWaiting,
-					ImageName: "test_upload",
-					Options: &target.AWSTargetOptions{
-						Filename:        "test.img",
-						Region:          "frankfurt",
-						AccessKeyID:     "accesskey",
-						SecretAccessKey: "secretkey",
-						Bucket:          "clay",
-						Key:             "imagekey",
+		ImageBuilds: []store.ImageBuild{
+			{
+				QueueStatus:   common.IBWaiting,
+				ImageType:     imgType,
+				Manifest:      manifest,
+				Packages:      packages,
+				BuildPackages: packages,
+				Targets: []*target.Target{
+					{
+						Name:      "org.osbuild.aws",
+						Status:    common.IBWaiting,
+						ImageName: "test_upload",
+						Options: &target.AWSTargetOptions{
+							Filename:        "test.img",
+							Region:          "frankfurt",
+							AccessKeyID:     "accesskey",
+							SecretAccessKey: "secretkey",
+							Bucket:          "clay",
+							Key:             "imagekey",
+							Architecture:    "x86_64",
+						},
 					},
-				},
-				{
-					// skip Uuid and Created fields - they are ignored
-					Name: "org.osbuild.local",
-					Options: &target.LocalTargetOptions{
-						Filename: "test.img",
+					{
+						// skip Uuid and Created fields - they are ignored
+						Name: "org.osbuild.local",
+						Options: &target.LocalTargetOptions{
+							Filename: "test.img",
+						},
 					},
 				},
 			},
 		},
 	}
-
 	var cases = []struct {
 		External        bool
 		Method          string
@@ -536,6 +648,7 @@ func TestCompose(t *testing.T) {
 		{true, "POST", "/api/v0/compose", `{"blueprint_name": "http-server","compose_type": "qcow2","branch": "master"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"Unknown blueprint name: http-server"}]}`, nil, []string{"build_id"}},
 		{false, "POST", "/api/v0/compose", `{"blueprint_name": "test","compose_type": "qcow2","branch": "master"}`, http.StatusOK, `{"status": true}`, expectedComposeLocal, []string{"build_id"}},
 		{false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","settings":{"region":"frankfurt","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, expectedComposeLocalAndAws, []string{"build_id"}},
+		{false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"registry","settings":{"registry":"registry.example.com","repository":"osbuild/test","tags":["latest"],"username":"user","password":"secret"}}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"images of type qcow2 cannot be pushed to a container registry"}]}`, nil, nil},
 	}
 
 	for _, c := range cases {
@@ -557,11 +670,17 @@ func TestCompose(t *testing.T) {
 			break
 		}
 
-		require.NotNilf(t, composeStruct.ImageBuild.Manifest, "%s: the compose in the store did not contain a blueprint", c.Path)
+		require.NotNilf(t, composeStruct.ImageBuilds[0].Manifest, "%s: the compose in the store did not contain a blueprint", c.Path)
 
-		if diff := cmp.Diff(composeStruct, *c.ExpectedCompose, test.IgnoreDates(), test.IgnoreUuids(), test.Ignore("Targets.Options.Location"), test.CompareImageTypes()); diff != "" {
+		if diff := cmp.Diff(composeStruct, *c.ExpectedCompose, test.IgnoreDates(), test.IgnoreUuids(), test.Ignore("Targets.Options.Location"), test.Ignore("ImageBuilds.UploadJobs"), test.CompareImageTypes()); diff != "" {
 			t.Errorf("%s: compose in store isn't the same as expected, diff:\n%s", c.Path, diff)
 		}
+
+		// every upload runs in its own job
+		for _, target := range composeStruct.ImageBuilds[0].Targets {
+			_, hasJob := composeStruct.ImageBuilds[0].UploadJobs[target.Uuid]
+			require.Equalf(t, target.Name != "org.osbuild.local", hasJob, "%s: unexpected upload job for %s target", c.Path, target.Name)
+		}
 	}
 }
 
@@ -610,6 +729,18 @@ func TestComposeStatus(t *testing.T) {
 		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?name=test", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140},{"id":"30000000-0000-0000-0000-000000000001","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"RUNNING","job_created":1574857140,"job_started":1574857140},{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140},{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
 		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?status=FINISHED", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
 		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?type=qcow2", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140},{"id":"30000000-0000-0000-0000-000000000001","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"RUNNING","job_created":1574857140,"job_started":1574857140},{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140},{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?limit=2", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140},{"id":"30000000-0000-0000-0000-000000000001","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"RUNNING","job_created":1574857140,"job_started":1574857140}],"next_cursor":"aWQAMzAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAx"}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?limit=2&cursor=aWQAMzAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAx", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140},{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?order=desc&limit=2&cursor=aWQAMzAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAy", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000001","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"RUNNING","job_created":1574857140,"job_started":1574857140},{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?sort=finished&order=desc&limit=1", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?sort=finished&cursor=ZmluaXNoZWQAMDE1NzQ4NTcxNDAwMDAwMDAwMDAAMzAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAz", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: 'cursor' cannot be used with sort order 'finished', only with id, created, blueprint"}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?upload_status=FAILED", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?since=2019-11-27T12:19:00Z&until=1574857140", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140},{"id":"30000000-0000-0000-0000-000000000001","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"RUNNING","job_created":1574857140,"job_started":1574857140},{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140},{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?since=2019-11-27T12:19:01Z", ``, http.StatusOK, `{"uuids":[]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?sort=size", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'sort': must be one of id, created, started, finished, blueprint"}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?sort=created&cursor=aWQAMzAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAx", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: 'cursor' was returned for sort order 'id', not 'created'"}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?since=yesterday", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'since': parsing time \"yesterday\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"yesterday\" as \"2006\""}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/status/*?limit=-1", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadLimitOrOffset","msg":"BadRequest: invalid value for 'limit': strconv.ParseUint: parsing \"-1\": invalid syntax"}]}`},
 		{rpmmd_mock.BaseFixture, "GET", "/api/v1/compose/status/30000000-0000-0000-0000-000000000000", ``, http.StatusOK, `{"uuids":[{"id":"30000000-0000-0000-0000-000000000000","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"WAITING","job_created":1574857140,"uploads":[{"uuid":"10000000-0000-0000-0000-000000000000","status":"WAITING","provider_name":"aws","image_name":"awsimage","creation_time":1574857140,"settings":{"region":"frankfurt","bucket":"clay","key":"imagekey"}}]}]}`},
 	}
 
@@ -648,6 +779,644 @@ func TestComposeInfo(t *testing.T) {
 	}
 }
 
+func TestUploadsInfo(t *testing.T) {
+	var cases = []struct {
+		Method         string
+		Path           string
+		ExpectedStatus int
+		ExpectedJSON   string
+	}{
+		{"GET", "/api/v1/upload/info/10000000-0000-0000-0000-000000000000", http.StatusOK, `{"status":true,"upload":{"uuid":"10000000-0000-0000-0000-000000000000","status":"WAITING","provider_name":"aws","image_name":"awsimage","creation_time":1574857140,"settings":{"region":"frankfurt","bucket":"clay","key":"imagekey"}}}`},
+		{"GET", "/api/v1/upload/info/20000000-0000-0000-0000-000000000000", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Upload 20000000-0000-0000-0000-000000000000 doesn't exist"}]}`},
+		{"GET", "/api/v1/upload/info/42000000-0000-0000-0000-000000000000", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Upload 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`},
+		{"GET", "/api/v1/upload/info/42000000-0000", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"42000000-0000 is not a valid upload uuid"}]}`},
+	}
+
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	for _, c := range cases {
+		api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+		test.TestRoute(t, api, false, c.Method, c.Path, "", c.ExpectedStatus, c.ExpectedJSON)
+	}
+}
+
+// Checks that the results a worker reports for targets, like the digest of
+// a pushed container image, show up in the upload's info.
+func TestUploadsInfoTargetResults(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	var cases = []struct {
+		TargetName    string
+		Upload        string
+		ResultOptions string
+		ExpectedJSON  string
+	}{
+		{
+			"org.osbuild.aws",
+			`{"image_name":"test_upload","provider":"aws","settings":{"region":"eu-central-1","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey","shareWithAccounts":["123456789012"],"copyToRegions":["us-east-1"],"tags":{"team":"osbuild"},"bootMode":"uefi"}}`,
+			`{"amis":[{"region":"eu-central-1","ami":"ami-1"},{"region":"us-east-1","ami":"ami-2"}]}`,
+			`{"status":true,"upload":{"status":"FINISHED","provider_name":"aws","image_name":"test_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey","shareWithAccounts":["123456789012"],"copyToRegions":["us-east-1"],"tags":{"team":"osbuild"},"bootMode":"uefi","amis":[{"region":"eu-central-1","ami":"ami-1"},{"region":"us-east-1","ami":"ami-2"}]}}}`,
+		},
+		{
+			"org.osbuild.azure",
+			`{"image_name":"test_upload","provider":"azure","settings":{"storageAccount":"account","storageAccessKey":"key","container":"images","tenantID":"tenant","clientID":"client","clientSecret":"secret","subscriptionID":"subscription","resourceGroup":"group","location":"westeurope"}}`,
+			`{"blobURL":"https://account.blob.core.windows.net/images/test_upload.vhd","imageID":"/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/test_upload"}`,
+			`{"status":true,"upload":{"status":"FINISHED","provider_name":"azure","image_name":"test_upload","settings":{"container":"images","subscriptionID":"subscription","resourceGroup":"group","location":"westeurope","blobURL":"https://account.blob.core.windows.net/images/test_upload.vhd","imageID":"/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/test_upload"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+		test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":`+c.Upload+`}`, http.StatusOK, `{"status": true}`, "build_id")
+
+		var uploadTarget *target.Target
+		for _, compose := range s.GetAllComposes() {
+			for _, t := range compose.ImageBuilds[0].Targets {
+				if t.Name == c.TargetName {
+					uploadTarget = t
+				}
+			}
+		}
+		require.NotNil(t, uploadTarget)
+
+		// the image build, followed by the upload
+		finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+		finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true},"target_results":[{"target_uuid":"`+uploadTarget.Uuid.String()+`","name":"`+c.TargetName+`","options":`+c.ResultOptions+`}]}`)
+
+		test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadTarget.Uuid.String(), "", http.StatusOK, c.ExpectedJSON, "uuid", "creation_time")
+
+		// the results are persisted with the compose
+		for _, compose := range s.GetAllComposes() {
+			require.Len(t, compose.ImageBuilds[0].TargetResults, 1)
+			require.Equal(t, uploadTarget.Uuid, compose.ImageBuilds[0].TargetResults[0].TargetUuid)
+			require.Equal(t, c.TargetName, compose.ImageBuilds[0].TargetResults[0].Name)
+		}
+	}
+}
+
+// Checks that the digest of a pushed container image shows up in the
+// upload's settings. The test distro has no container image type, which
+// registry uploads require, so the target is converted directly.
+func TestUploadResponseRegistryDigest(t *testing.T) {
+	registryTarget := target.NewRegistryTarget(&target.RegistryTargetOptions{
+		Filename:   "container.tar",
+		Registry:   "registry.example.com",
+		Repository: "osbuild/test",
+		Tags:       []string{"latest"},
+		Username:   "user",
+		Password:   "secret",
+	})
+	result := target.NewRegistryTargetResult(&target.RegistryTargetResultOptions{
+		Digest: "sha256:0123",
+		Tags:   []string{"latest"},
+	})
+	result.TargetUuid = registryTarget.Uuid
+
+	uploads := targetsToUploadResponses([]*target.Target{registryTarget}, &composeStatus{
+		State:         common.CFinished,
+		TargetResults: []*target.TargetResult{result},
+	})
+	require.Len(t, uploads, 1)
+	require.Equal(t, "registry", uploads[0].ProviderName)
+	require.Equal(t, common.IBFinished, uploads[0].Status)
+	require.Equal(t, &registryUploadSettings{
+		Registry:   "registry.example.com",
+		Repository: "osbuild/test",
+		Tags:       []string{"latest"},
+		Digest:     "sha256:0123",
+	}, uploads[0].Settings)
+}
+
+func TestUploadProviders(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"default","settings":{"region":"eu-central-1","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey"}}`, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"gcp","profile":"default","settings":{}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownProvider","msg":"Unknown provider: gcp"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"broken","settings":{"bootMode":"bios"}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"ProviderError","msg":"invalid aws settings: unexpected boot mode: bios"}]}`)
+
+	// credentials of saved profiles are never returned
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/providers", "", http.StatusOK, `{"providers":{"aws":{"display":"AWS","supported_types":["ami"],"profiles":{"default":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}},"azure":{"display":"Azure","supported_types":["vhd"],"profiles":{}},"registry":{"display":"Container registry","supported_types":["container"],"profiles":{}}}}`)
+
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/upload/providers/delete/aws/default", "", http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/upload/providers/delete/aws/default", "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownProfile","msg":"Unknown aws profile: default"}]}`)
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/upload/providers/delete/gcp/default", "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownProvider","msg":"Unknown provider: gcp"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"team/default","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidChars","msg":"Invalid characters in API path"}]}`)
+}
+
+func TestUploadProfileNamespaces(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&TokenAuthenticator{
+		Tokens: []Token{
+			{Name: "a", Token: "token-a", Role: RoleAdmin, Namespace: "team-a"},
+			{Name: "b", Token: "token-b", Role: RoleAdmin, Namespace: "team-b"},
+		},
+	})
+
+	body := func(resp *http.Response) string {
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	resp := sendWithToken(api, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"default","settings":{"region":"eu-central-1","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey"}}`, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, team := range []string{"a", "b"} {
+		bp := `{"name":"test","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+		resp = sendWithToken(api, "POST", "/api/v0/blueprints/new", bp, "token-"+team)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// other namespaces can neither see, use nor delete the profile
+	resp = sendWithToken(api, "GET", "/api/v1/upload/providers", "", "token-b")
+	require.NotContains(t, body(resp), "clay")
+
+	compose := `{"blueprint_name":"test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","profile":"default"}}`
+	resp = sendWithToken(api, "POST", "/api/v1/compose", compose, "token-b")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body(resp), "Unknown aws profile: default")
+
+	schedule := `{"blueprint_name":"test","compose_types":["qcow2"],"cron":"@daily","upload":{"image_name":"test_upload","provider":"aws","profile":"default"}}`
+	resp = sendWithToken(api, "POST", "/api/v1/schedules/new", schedule, "token-b")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body(resp), "Unknown aws profile: default")
+
+	resp = sendWithToken(api, "DELETE", "/api/v1/upload/providers/delete/aws/default", "", "token-b")
+	require.Contains(t, body(resp), "UnknownProfile")
+
+	resp = sendWithToken(api, "GET", "/api/v1/upload/providers", "", "token-a")
+	require.Contains(t, body(resp), "clay")
+	resp = sendWithToken(api, "POST", "/api/v1/compose", compose, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendWithToken(api, "POST", "/api/v1/schedules/new", schedule, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestComposeUploadProfile(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","profile":"default"}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownProfile","msg":"Unknown aws profile: default"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"default","settings":{"region":"eu-central-1","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey"}}`, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","profile":"default"}}`, http.StatusOK, `{"status": true}`, "build_id")
+
+	var options *target.AWSTargetOptions
+	for _, compose := range s.GetAllComposes() {
+		for _, t := range compose.ImageBuilds[0].Targets {
+			if o, ok := t.Options.(*target.AWSTargetOptions); ok {
+				options = o
+			}
+		}
+	}
+	require.NotNil(t, options)
+	require.Equal(t, "accesskey", options.AccessKeyID)
+	require.Equal(t, "secretkey", options.SecretAccessKey)
+	require.Equal(t, "clay", options.Bucket)
+}
+
+// Returns the id of the only compose in `s`.
+func onlyComposeID(t *testing.T, s *store.Store) string {
+	t.Helper()
+
+	composes := s.GetAllComposes()
+	require.Len(t, composes, 1)
+	for id := range composes {
+		return id.String()
+	}
+	return ""
+}
+
+func TestUploadsSchedule(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/42000000-0000-0000-0000-000000000000", `{"image_name":"test_upload","provider":"aws","profile":"default"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Compose 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/"+composeID, `{"image_name":"test_upload","provider":"aws","profile":"default"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownProfile","msg":"Unknown aws profile: default"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/"+composeID, `{"image_name":"test_upload","provider":"registry","settings":{"registry":"registry.example.com","repository":"osbuild/test"}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"images of type qcow2 cannot be pushed to a container registry"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/providers/save", `{"provider":"aws","profile":"default","settings":{"region":"eu-central-1","accessKeyID":"accesskey","secretAccessKey":"secretkey","bucket":"clay","key":"imagekey"}}`, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/"+composeID, `{"image_name":"test_upload","provider":"aws","profile":"default"}`, http.StatusOK, `{"status":true}`, "upload_id")
+
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	require.Len(t, compose.ImageBuilds[0].Targets, 2)
+	uploadID := compose.ImageBuilds[0].Targets[1].Uuid.String()
+	require.Contains(t, compose.ImageBuilds[0].UploadJobs, compose.ImageBuilds[0].Targets[1].Uuid)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"WAITING","provider_name":"aws","image_name":"test_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+
+	// the upload runs after the image build
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/status/"+composeID, ``, http.StatusOK, `{"uuids":[{"id":"`+composeID+`","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED"}]}`, "job_created", "job_started", "job_finished", "uploads")
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"WAITING","provider_name":"aws","image_name":"test_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true},"target_results":[{"target_uuid":"`+uploadID+`","name":"org.osbuild.aws","options":{"amis":[{"region":"eu-central-1","ami":"ami-1"}]}}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FINISHED","provider_name":"aws","image_name":"test_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey","amis":[{"region":"eu-central-1","ami":"ami-1"}]}}}`, "uuid", "creation_time")
+
+	compose, _ = s.GetCompose(uuid.MustParse(composeID))
+	require.Len(t, compose.ImageBuilds[0].TargetResults, 1)
+}
+
+func TestUploadsResetCancel(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.uploadRetryDelay = time.Millisecond
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"compose_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/"+composeID, `{"image_name":"test_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}`, http.StatusOK, `{"status":true}`, "upload_id")
+
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	composeUploadID := compose.ImageBuilds[0].Targets[0].Uuid.String()
+	uploadID := compose.ImageBuilds[0].Targets[2].Uuid.String()
+
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/upload/cancel/"+uploadID, "", http.StatusOK, `{"status":true,"uuid":"`+uploadID+`"}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FAILED","provider_name":"aws","image_name":"test_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/upload/cancel/"+uploadID, "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"Upload `+uploadID+` cannot be canceled"}]}`)
+
+	// the image isn't built yet
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/reset/"+uploadID, "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"Upload `+uploadID+` cannot be reset, only failed uploads of finished builds can"}]}`)
+
+	// the canceled upload doesn't run after the image build, but the other
+	// one does and is retried automatically when it fails
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	for i := 0; i < maxUploadRetries; i++ {
+		finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+		waitForUploadStatus(t, api, composeUploadID, common.IBWaiting)
+		test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+composeUploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"WAITING","provider_name":"aws","image_name":"compose_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+	}
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+composeUploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FAILED","provider_name":"aws","image_name":"compose_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+
+	// failed uploads don't affect the compose
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/status/"+composeID, ``, http.StatusOK, `{"uuids":[{"id":"`+composeID+`","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED"}]}`, "job_created", "job_started", "job_finished", "uploads")
+
+	for _, id := range []string{composeUploadID, uploadID} {
+		test.TestRoute(t, api, false, "POST", "/api/v1/upload/reset/"+id, "", http.StatusOK, `{"status":true,"uuid":"`+id+`"}`)
+		test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+id, "", http.StatusOK, `{"status":true,"upload":{"status":"WAITING"}}`, "uuid", "creation_time", "provider_name", "image_name", "settings")
+		finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+		test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+id, "", http.StatusOK, `{"status":true,"upload":{"status":"FINISHED"}}`, "uuid", "creation_time", "provider_name", "image_name", "settings")
+		test.TestRoute(t, api, false, "POST", "/api/v1/upload/reset/"+id, "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"Upload `+id+` cannot be reset, only failed uploads of finished builds can"}]}`)
+	}
+}
+
+// Waits until the upload `uploadID` of `api` is in `status`.
+func waitForUploadStatus(t *testing.T, api *API, uploadID string, status common.ImageBuildState) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		response := test.SendHTTP(api, false, "GET", "/api/v1/upload/info/"+uploadID, "")
+		var reply struct {
+			Upload struct {
+				Status common.ImageBuildState `json:"status"`
+			} `json:"upload"`
+		}
+		err := json.NewDecoder(response.Body).Decode(&reply)
+		return err == nil && reply.Upload.Status == status
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestUploadRetryDelay(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.uploadRetryDelay = 100 * time.Millisecond
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"compose_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	uploadID := compose.ImageBuilds[0].Targets[0].Uuid.String()
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+
+	// the upload is not retried right away
+	failed := time.Now()
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FAILED"}}`, "uuid", "creation_time", "provider_name", "image_name", "settings")
+	waitForUploadStatus(t, api, uploadID, common.IBWaiting)
+	require.True(t, time.Since(failed) >= api.uploadRetryDelay)
+
+	// resetting the upload while it waits for its retry replaces the retry
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/reset/"+uploadID, "", http.StatusOK, `{"status":true,"uuid":"`+uploadID+`"}`)
+	compose, _ = s.GetCompose(uuid.MustParse(composeID))
+	resetJobID := compose.ImageBuilds[0].UploadJobs[uuid.MustParse(uploadID)]
+	time.Sleep(3 * api.uploadRetryDelay)
+	compose, _ = s.GetCompose(uuid.MustParse(composeID))
+	require.Equal(t, resetJobID, compose.ImageBuilds[0].UploadJobs[uuid.MustParse(uploadID)])
+}
+
+// Checks that uploads are canceled when building the image failed.
+func TestUploadsImageBuildFailed(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"compose_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	uploadID := compose.ImageBuilds[0].Targets[0].Uuid.String()
+
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FAILED","provider_name":"aws","image_name":"compose_upload","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, "uuid", "creation_time")
+	test.TestRoute(t, api, false, "POST", "/api/v1/upload/reset/"+uploadID, "", http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"Upload `+uploadID+` cannot be reset, only failed uploads of finished builds can"}]}`)
+
+	// there's nothing left to do for workers
+	response := test.SendHTTP(api.workers, false, "POST", "/job-queue/v1/jobs", `{}`)
+	require.Equal(t, http.StatusInternalServerError, response.StatusCode)
+}
+
+func TestComposeRebuild(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	require.NotEmpty(t, compose.ImageBuilds[0].Packages)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose/rebuild/"+composeID, ``, http.StatusNotFound, `{"status":false,"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/rebuild/42000000-0000-0000-0000-000000000000", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Compose 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`)
+
+	response := test.SendHTTP(api, false, "POST", "/api/v1/compose/rebuild/"+composeID, ``)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var reply struct {
+		BuildID uuid.UUID `json:"build_id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+
+	rebuilt, exists := s.GetCompose(reply.BuildID)
+	require.True(t, exists)
+	require.Equal(t, compose.Blueprint, rebuilt.Blueprint)
+	require.Equal(t, compose.ImageBuilds[0].Packages, rebuilt.ImageBuilds[0].Packages)
+	require.Equal(t, compose.ImageBuilds[0].BuildPackages, rebuilt.ImageBuilds[0].BuildPackages)
+	require.Equal(t, compose.ImageBuilds[0].Manifest, rebuilt.ImageBuilds[0].Manifest)
+	require.NotEqual(t, compose.ImageBuilds[0].JobID, rebuilt.ImageBuilds[0].JobID)
+	require.Equal(t, reply.BuildID, rebuilt.ImageBuilds[0].GetLocalTargetOptions().ComposeId)
+
+	// rebuilding fails when the packages in the repositories differ from
+	// the recorded ones
+	pushCompose := func(packages []rpmmd.PackageSpec) string {
+		id := uuid.New()
+		err := s.PushCompose(id, compose.Blueprint, []store.ImageBuild{
+			{
+				ImageType: compose.ImageBuilds[0].ImageType,
+				Manifest:  compose.ImageBuilds[0].Manifest,
+				Packages:  packages,
+			},
+		})
+		require.NoError(t, err)
+		return id.String()
+	}
+
+	changed := append([]rpmmd.PackageSpec{}, compose.ImageBuilds[0].Packages...)
+	changed[0].Checksum = "sha256:0000"
+	changedID := pushCompose(changed)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/rebuild/"+changedID, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"PackagesUnavailable","msg":"Compose `+changedID+` cannot be rebuilt: package `+changed[0].GetNEVRA()+` changed, its checksum is  instead of sha256:0000"}]}`)
+
+	missing := append([]rpmmd.PackageSpec{}, compose.ImageBuilds[0].Packages...)
+	missing[0].Version = "0.1"
+	missingID := pushCompose(missing)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/rebuild/"+missingID, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"PackagesUnavailable","msg":"Compose `+missingID+` cannot be rebuilt: package `+missing[0].GetNEVRA()+` is not available anymore"}]}`)
+
+	unrecordedID := pushCompose(nil)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/rebuild/"+unrecordedID, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BuildInWrongState","msg":"Compose `+unrecordedID+` cannot be rebuilt, its packages were not recorded"}]}`)
+}
+
+func TestComposeRebuildDepsolveError(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.BadDepsolve)
+	imageType, err := api.arch.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	id := uuid.New()
+	err = s.PushCompose(id, &blueprint.Blueprint{Name: "test"}, []store.ImageBuild{
+		{
+			ImageType: imageType,
+			Packages:  []rpmmd.PackageSpec{{Name: "go2rpm", Version: "1", Release: "4.fc31", Arch: "noarch"}},
+		},
+	})
+	require.NoError(t, err)
+
+	response := test.SendHTTP(api, false, "POST", "/api/v1/compose/rebuild/"+id.String(), ``)
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+	var reply struct {
+		Errors []responseError `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+	require.Len(t, reply.Errors, 1)
+	require.Equal(t, "PackagesUnavailable", reply.Errors[0].ID)
+	require.Contains(t, reply.Errors[0].Msg, "packages are not available anymore")
+}
+
+func TestComposeMultipleImageTypes(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	// uploads can't be part of composes with several images
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_types":["qcow2","qcow2"],"branch":"master","upload":{"image_name":"compose_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UploadError","msg":"cannot upload the images of a compose with several compose types, schedule an upload for each image build instead"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_types":["qcow2","vhd"],"branch":"master"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"Unknown compose type for architecture: vhd"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_types":["qcow2","qcow2"],"branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	require.Len(t, compose.ImageBuilds, 2)
+	require.NotEqual(t, compose.ImageBuilds[0].JobID, compose.ImageBuilds[1].JobID)
+	for i, ib := range compose.ImageBuilds {
+		require.Equal(t, i, ib.ID)
+		require.Equal(t, i, ib.GetLocalTargetOptions().ImageBuildId)
+	}
+
+	status := func(composeState, firstState, secondState string) {
+		t.Helper()
+		test.TestRoute(t, api, false, "GET", "/api/v1/compose/status/"+composeID, ``, http.StatusOK, `{"uuids":[{"id":"`+composeID+`","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"`+composeState+`","image_builds":[{"id":0,"compose_type":"qcow2","image_size":0,"queue_status":"`+firstState+`"},{"id":1,"compose_type":"qcow2","image_size":0,"queue_status":"`+secondState+`"}]}]}`, "job_created", "job_started", "job_finished", "uploads")
+	}
+
+	status("WAITING", "WAITING", "WAITING")
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	status("RUNNING", "FINISHED", "WAITING")
+
+	// every image build has its own image and uploads
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/image/"+composeID+"?image_build=1", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BuildInWrongState","msg":"Build `+composeID+` is in wrong state: WAITING"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/image/"+composeID+"?image_build=2", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownImageBuild","msg":"Compose has no image build 2"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose/uploads/schedule/"+composeID+"?image_build=1", `{"image_name":"test_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}`, http.StatusOK, `{"status":true}`, "upload_id")
+
+	compose, _ = s.GetCompose(uuid.MustParse(composeID))
+	require.Len(t, compose.ImageBuilds[0].Targets, 1)
+	require.Len(t, compose.ImageBuilds[1].Targets, 2)
+	require.Len(t, compose.ImageBuilds[1].UploadJobs, 1)
+
+	// the compose fails when one of its images does, and the upload of
+	// that image is canceled
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+	status("FAILED", "FINISHED", "FAILED")
+
+	uploadID := compose.ImageBuilds[1].Targets[1].Uuid.String()
+	test.TestRoute(t, api, false, "GET", "/api/v1/upload/info/"+uploadID, "", http.StatusOK, `{"status":true,"upload":{"status":"FAILED"}}`, "uuid", "creation_time", "provider_name", "image_name", "settings")
+}
+
+// Finishes the next job in the queue of `api`, like a worker would, by
+// sending `update` to the worker API.
+func finishNextJob(t *testing.T, api *API, update string) {
+	t.Helper()
+
+	workerRequest := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		api.workers.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	response := workerRequest("POST", "/job-queue/v1/jobs", `{}`)
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	var job struct {
+		Id string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+
+	response = workerRequest("PATCH", "/job-queue/v1/jobs/"+job.Id, update)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestComposeSBOM(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/sbom/"+composeID, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BuildInWrongState","msg":"Build `+composeID+` is in wrong state: WAITING"}]}`)
+
+	// osbuild reports the packages it installed, which are matched with the
+	// depsolved ones
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true,"stages":[{"name":"org.osbuild.rpm","success":true,"metadata":{"packages":[
+		{"name":"dep-package1","version":"1.33","release":"2.fc30","epoch":null,"arch":"x86_64","sigmd5":"00"},
+		{"name":"dep-package3","version":"3.0.3","release":"1.fc30","epoch":"7","arch":"x86_64","sigmd5":"00"}
+	]}}]}}`)
+
+	response := test.SendHTTP(api, false, "GET", "/api/v1/compose/sbom/"+composeID+"?format=cyclonedx", "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "attachment; filename="+composeID+"-sbom.cdx.json", response.Header.Get("Content-Disposition"))
+	var cyclonedx sbom.CycloneDXDocument
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&cyclonedx))
+	require.Equal(t, "test", cyclonedx.Metadata.Component.Name)
+	require.Len(t, cyclonedx.Components, 2)
+	require.Equal(t, "pkg:rpm/fedora/dep-package1@1.33-2.fc30?arch=x86_64", cyclonedx.Components[0].PURL)
+	require.Equal(t, "7:3.0.3-1.fc30", cyclonedx.Components[1].Version)
+
+	response = test.SendHTTP(api, false, "GET", "/api/v1/compose/sbom/"+composeID, "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "attachment; filename="+composeID+"-sbom.spdx.json", response.Header.Get("Content-Disposition"))
+	var spdx sbom.SPDXDocument
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&spdx))
+	require.Equal(t, "SPDX-2.2", spdx.SPDXVersion)
+	require.Len(t, spdx.Packages, 3)
+	require.Equal(t, "dep-package1", spdx.Packages[1].Name)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/sbom/"+composeID+"?format=xml", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'format': must be one of spdx, cyclonedx"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/sbom/42000000-0000-0000-0000-000000000000", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Compose 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`)
+}
+
+func TestComposeAdvisories(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/advisories/"+composeID, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BuildInWrongState","msg":"Build `+composeID+` is in wrong state: WAITING"}]}`)
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true,"stages":[{"name":"org.osbuild.rpm","success":true,"metadata":{"packages":[
+		{"name":"dep-package1","version":"1.33","release":"2.fc30","epoch":null,"arch":"x86_64","sigmd5":"00"},
+		{"name":"dep-package2","version":"2.9","release":"1.fc30","epoch":null,"arch":"x86_64","sigmd5":"00"}
+	]}}]}}`)
+
+	// dep-package1 is older than the one of the security advisory, but
+	// dep-package2 is newer than the one of the bugfix advisory
+	expected := `{"uuid":"` + composeID + `","image_build":0,"advisories":[{"id":"FEDORA-2020-0001","type":"security","severity":"Important","title":"dep-package1 security update","issued":"2020-06-01 00:00:00","cves":["CVE-2020-1234"],"packages":[{"name":"dep-package1","arch":"x86_64","installed":"1.33-2.fc30","fixed":"1.33-3.fc30"}]}]}`
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/advisories/"+composeID, ``, http.StatusOK, expected, "checked")
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/advisories/"+composeID+"?recheck=true", ``, http.StatusOK, expected, "checked")
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/advisories/"+composeID+"?recheck=maybe", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'recheck': strconv.ParseBool: parsing \"maybe\": invalid syntax"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/advisories/42000000-0000-0000-0000-000000000000", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Compose 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`)
+}
+
+func TestAdvisoryChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weldr-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// reports are stored as job artifacts
+	api, s := createWeldrAPI(func() rpmmd_mock.Fixture {
+		fixture := rpmmd_mock.NoComposesFixture()
+		fixture.Workers = worker.NewServer(nil, testjobqueue.New(), dir)
+		return fixture
+	})
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master"}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true,"stages":[{"name":"org.osbuild.rpm","success":true,"metadata":{"packages":[
+		{"name":"dep-package1","version":"1.33","release":"2.fc30","epoch":null,"arch":"x86_64","sigmd5":"00"}
+	]}}]}}`)
+
+	compose, _ := s.GetCompose(uuid.MustParse(composeID))
+	ib := compose.ImageBuilds[0]
+	_, stored := api.storedAdvisories(ib)
+	require.False(t, stored)
+
+	// finished images are only queued, and queueing doesn't block when too
+	// many are waiting already
+	for i := 0; i < advisoryCheckQueueSize; i++ {
+		api.queueAdvisoryCheck(uuid.MustParse(composeID), compose, ib)
+	}
+	require.Len(t, api.advisoryChecks, advisoryCheckQueueSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go api.RunAdvisoryChecks(ctx)
+
+	require.Eventually(t, func() bool {
+		_, stored := api.storedAdvisories(ib)
+		return stored
+	}, 5*time.Second, 10*time.Millisecond)
+	report, _ := api.storedAdvisories(ib)
+	require.Len(t, report.Advisories, 1)
+	require.Equal(t, "FEDORA-2020-0001", report.Advisories[0].ID)
+}
+
 func TestComposeLogs(t *testing.T) {
 	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
 		t.Skip("This test is for internal testing only")
@@ -713,6 +1482,30 @@ func TestComposeLogs(t *testing.T) {
 	}
 }
 
+func TestComposeMetadataStages(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	response := test.SendHTTP(api, false, "GET", "/api/v1/compose/metadata/30000000-0000-0000-0000-000000000002", "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	tr := tar.NewReader(response.Body)
+	_, err := tr.Next()
+	require.NoError(t, err)
+	h, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "30000000-0000-0000-0000-000000000002-stages.json", h.Name)
+
+	contents, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"duration": 0, "stages": []}`, string(contents))
+
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+}
+
 func TestComposeLog(t *testing.T) {
 	var cases = []struct {
 		Fixture          rpmmd_mock.FixtureGenerator
@@ -775,6 +1568,9 @@ func TestComposeFinished(t *testing.T) {
 		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/finished", ``, http.StatusOK, `{"finished":[{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
 		{rpmmd_mock.BaseFixture, "GET", "/api/v1/compose/finished", ``, http.StatusOK, `{"finished":[{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140,"uploads":[{"uuid":"10000000-0000-0000-0000-000000000000","status":"FINISHED","provider_name":"aws","image_name":"awsimage","creation_time":1574857140,"settings":{"region":"frankfurt","bucket":"clay","key":"imagekey"}}]}]}`},
 		{rpmmd_mock.NoComposesFixture, "GET", "/api/v0/compose/finished", ``, http.StatusOK, `{"finished":[]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/finished?blueprint=test&type=qcow2", ``, http.StatusOK, `{"finished":[{"id":"30000000-0000-0000-0000-000000000002","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FINISHED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/finished?status=FAILED", ``, http.StatusOK, `{"finished":[]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/finished?blueprint=unknown", ``, http.StatusOK, `{"finished":[]}`},
 	}
 
 	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
@@ -799,6 +1595,9 @@ func TestComposeFailed(t *testing.T) {
 		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/failed", ``, http.StatusOK, `{"failed":[{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
 		{rpmmd_mock.BaseFixture, "GET", "/api/v1/compose/failed", ``, http.StatusOK, `{"failed":[{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140,"uploads":[{"uuid":"10000000-0000-0000-0000-000000000000","status":"FAILED","provider_name":"aws","image_name":"awsimage","creation_time":1574857140,"settings":{"region":"frankfurt","bucket":"clay","key":"imagekey"}}]}]}`},
 		{rpmmd_mock.NoComposesFixture, "GET", "/api/v0/compose/failed", ``, http.StatusOK, `{"failed":[]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/failed?upload_status=FAILED&limit=1", ``, http.StatusOK, `{"failed":[{"id":"30000000-0000-0000-0000-000000000003","blueprint":"test","version":"0.0.0","compose_type":"qcow2","image_size":0,"queue_status":"FAILED","job_created":1574857140,"job_started":1574857140,"job_finished":1574857140}]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/failed?type=ami", ``, http.StatusOK, `{"failed":[]}`},
+		{rpmmd_mock.BaseFixture, "GET", "/api/v0/compose/failed?order=random", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'order': must be 'asc' or 'desc'"}]}`},
 	}
 
 	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
@@ -826,6 +1625,8 @@ func TestSourcesNew(t *testing.T) {
 		{"POST", "/api/v0/projects/source/new", `{"url": "https://download.opensuse.org/repositories/shells:/fish:/release:/3/Fedora_29/","type": "yum-baseurl","check_ssl": false,"check_gpg": false}`, http.StatusBadRequest, `{"errors": [{"id": "ProjectsError","msg": "Problem parsing POST body: 'name' field is missing from request"}],"status":false}`},
 		{"POST", "/api/v0/projects/source/new", `{"name": "fish", "type": "yum-baseurl","check_ssl": false,"check_gpg": false}`, http.StatusBadRequest, `{"errors": [{"id": "ProjectsError","msg": "Problem parsing POST body: 'url' field is missing from request"}],"status":false}`},
 		{"POST", "/api/v0/projects/source/new", `{"name": "fish", "url": "https://download.opensuse.org/repositories/shells:/fish:/release:/3/Fedora_29/","check_ssl": false,"check_gpg": false}`, http.StatusBadRequest, `{"errors": [{"id": "ProjectsError","msg": "Problem parsing POST body: 'type' field is missing from request"}],"status":false}`},
+		{"POST", "/api/v0/projects/source/new", `{"name": "team/fish","url": "https://download.opensuse.org/repositories/shells:/fish:/release:/3/Fedora_29/","type": "yum-baseurl","check_ssl": false,"check_gpg": false}`, http.StatusBadRequest, `{"errors": [{"id": "ProjectsError","msg": "Problem parsing POST body: 'id' and 'name' fields cannot contain '/'"}],"status":false}`},
+		{"POST", "/api/v1/projects/source/new", `{"id": "team/fish","name": "fish","url": "https://download.opensuse.org/repositories/shells:/fish:/release:/3/Fedora_29/","type": "yum-baseurl","check_ssl": false,"check_gpg": false}`, http.StatusBadRequest, `{"errors": [{"id": "ProjectsError","msg": "Problem parsing POST body: 'id' and 'name' fields cannot contain '/'"}],"status":false}`},
 	}
 
 	for _, c := range cases {
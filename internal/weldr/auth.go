@@ -0,0 +1,347 @@
+package weldr
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/user"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// Role is the set of permissions of a client. Every role includes the
+// permissions of the roles below it.
+type Role int
+
+const (
+	// RoleNone may only access routes which don't require authentication.
+	RoleNone Role = iota
+	// RoleViewer may read everything, except for webhooks.
+	RoleViewer
+	// RoleComposer may additionally change blueprint workspaces, start
+	// composes and manage uploads.
+	RoleComposer
+	// RoleAdmin may additionally delete blueprints and manage sources,
+	// upload profiles and webhooks.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleComposer: "composer",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, exists := roleNames[r]; exists {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the role called `name`.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role: %s", name)
+}
+
+// Identity is an authenticated client. Clients only see the blueprints,
+// sources and composes of their namespace.
+type Identity struct {
+	Name      string
+	Role      Role
+	Namespace string
+}
+
+type identityKey struct{}
+
+// Authenticator authenticates clients of the API.
+//
+// Authenticate returns nil when the request doesn't carry the kind of
+// credentials the authenticator handles, so that the next authenticator is
+// tried. It returns an error when the request carries invalid credentials.
+type Authenticator interface {
+	Authenticate(request *http.Request) (*Identity, error)
+}
+
+type peerCredentialsKey struct{}
+
+// peerCredentialsContext stores the credentials of the process on the
+// other end of unix socket connections in the connection's context.
+func peerCredentialsContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, peerCredentialsKey{}, cred)
+}
+
+// PeerCredentialsAuthenticator authenticates clients connecting via a unix
+// socket by the user id of their process. Clients get the highest role
+// configured for their user name or any of their groups, and the namespace
+// configured for their user name or else for one of their groups.
+type PeerCredentialsAuthenticator struct {
+	Users  map[string]Role
+	Groups map[string]Role
+
+	UserNamespaces  map[string]string
+	GroupNamespaces map[string]string
+}
+
+func (a *PeerCredentialsAuthenticator) Authenticate(request *http.Request) (*Identity, error) {
+	cred, ok := request.Context().Value(peerCredentialsKey{}).(*syscall.Ucred)
+	if !ok {
+		return nil, nil
+	}
+
+	u, err := user.LookupId(fmt.Sprint(cred.Uid))
+	if err != nil {
+		return nil, fmt.Errorf("unknown user id %d: %v", cred.Uid, err)
+	}
+
+	namespace, hasNamespace := a.UserNamespaces[u.Username]
+	identity := &Identity{
+		Name:      u.Username,
+		Role:      a.Users[u.Username],
+		Namespace: namespace,
+	}
+
+	if len(a.Groups) > 0 || (!hasNamespace && len(a.GroupNamespaces) > 0) {
+		gids, err := u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get groups of user %s: %v", u.Username, err)
+		}
+		for _, gid := range gids {
+			g, err := user.LookupGroupId(gid)
+			if err != nil {
+				continue
+			}
+			if role := a.Groups[g.Name]; role > identity.Role {
+				identity.Role = role
+			}
+			if namespace, exists := a.GroupNamespaces[g.Name]; exists && !hasNamespace {
+				identity.Namespace = namespace
+				hasNamespace = true
+			}
+		}
+	}
+
+	return identity, nil
+}
+
+// ClientCertificateAuthenticator authenticates clients by the common name
+// of the TLS client certificate they presented. Verifying the certificate
+// is up to the TLS configuration of the listener.
+type ClientCertificateAuthenticator struct {
+	Subjects   map[string]Role
+	Namespaces map[string]string
+}
+
+func (a *ClientCertificateAuthenticator) Authenticate(request *http.Request) (*Identity, error) {
+	if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	name := request.TLS.PeerCertificates[0].Subject.CommonName
+	role, exists := a.Subjects[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown client certificate: %s", name)
+	}
+
+	return &Identity{Name: name, Role: role, Namespace: a.Namespaces[name]}, nil
+}
+
+// Token is a secret which clients pass in the "Authorization: Bearer"
+// header to authenticate as `Name`.
+type Token struct {
+	Name      string
+	Token     string
+	Role      Role
+	Namespace string
+}
+
+// TokenAuthenticator authenticates clients by bearer tokens.
+type TokenAuthenticator struct {
+	Tokens []Token
+}
+
+func (a *TokenAuthenticator) Authenticate(request *http.Request) (*Identity, error) {
+	header := request.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, fmt.Errorf("unsupported authorization scheme")
+	}
+	secret := []byte(strings.TrimPrefix(header, "Bearer "))
+
+	for _, token := range a.Tokens {
+		if subtle.ConstantTimeCompare(secret, []byte(token.Token)) == 1 {
+			return &Identity{Name: token.Name, Role: token.Role, Namespace: token.Namespace}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+// SetAuthenticators enables authentication. Requests are authenticated by
+// the first authenticator which handles their credentials. Without
+// authenticators, all requests are allowed everything.
+func (api *API) SetAuthenticators(authenticators ...Authenticator) {
+	api.authenticators = authenticators
+}
+
+// SetAuditLog enables logging all calls which change state to `w`, as one
+// JSON object per line.
+func (api *API) SetAuditLog(w io.Writer) {
+	api.auditLog = w
+}
+
+func (api *API) authenticate(request *http.Request) (*Identity, error) {
+	if len(api.authenticators) == 0 {
+		return &Identity{Role: RoleAdmin}, nil
+	}
+
+	for _, authenticator := range api.authenticators {
+		identity, err := authenticator.Authenticate(request)
+		if err != nil {
+			return nil, err
+		}
+		if identity != nil {
+			return identity, nil
+		}
+	}
+
+	return nil, fmt.Errorf("authentication required")
+}
+
+// authorize returns a handler which calls `handle` only for clients with at
+// least role `role`. All calls which aren't read-only are written to the
+// audit log, including rejected ones.
+func (api *API) authorize(role Role, handle httprouter.Handle) httprouter.Handle {
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		identity, err := api.authenticate(request)
+
+		if api.auditLog != nil && request.Method != "GET" && request.Method != "HEAD" {
+			w := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+			writer = w
+			defer func() {
+				api.audit(request, identity, w.status)
+			}()
+		}
+
+		if role == RoleNone {
+			handle(writer, request, params)
+			return
+		}
+
+		if err != nil {
+			errors := responseError{
+				ID:  "Unauthorized",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusUnauthorized, errors)
+			return
+		}
+
+		if identity.Role < role {
+			errors := responseError{
+				ID:  "Forbidden",
+				Msg: fmt.Sprintf("%s role required", role),
+			}
+			statusResponseError(writer, http.StatusForbidden, errors)
+			return
+		}
+
+		ctx := context.WithValue(request.Context(), identityKey{}, identity)
+		handle(writer, request.WithContext(ctx), params)
+	}
+}
+
+// Namespace returns the view of the store for the namespace of the client
+// which sent `request`. Clients of routes which don't require
+// authentication use the default namespace.
+func (api *API) Namespace(request *http.Request) *store.Store {
+	name := ""
+	if identity, ok := request.Context().Value(identityKey{}).(*Identity); ok {
+		name = identity.Namespace
+	}
+	return api.store.Namespace(name)
+}
+
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+}
+
+func (api *API) audit(request *http.Request, identity *Identity, status int) {
+	entry := auditEntry{
+		Time:       time.Now().UTC(),
+		RemoteAddr: request.RemoteAddr,
+		Method:     request.Method,
+		Path:       request.URL.Path,
+		Status:     status,
+	}
+	if identity != nil {
+		entry.User = identity.Name
+		entry.Role = identity.Role.String()
+	}
+
+	line, err := json.Marshal(entry)
+	common.PanicOnError(err)
+
+	api.auditMu.Lock()
+	defer api.auditMu.Unlock()
+
+	_, err = api.auditLog.Write(append(line, '\n'))
+	if err != nil && api.logger != nil {
+		api.logger.Printf("cannot write audit log: %v", err)
+	}
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
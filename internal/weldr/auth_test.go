@@ -0,0 +1,271 @@
+package weldr
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/test"
+)
+
+// Sends a request to `api`, authenticated by `token` if it isn't empty.
+func sendWithToken(api *API, method, path, body, token string) *http.Response {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, req)
+	return recorder.Result()
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RoleNone, RoleViewer, RoleComposer, RoleAdmin} {
+		parsed, err := ParseRole(role.String())
+		require.NoError(t, err)
+		require.Equal(t, role, parsed)
+	}
+
+	_, err := ParseRole("root")
+	require.Error(t, err)
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&TokenAuthenticator{
+		Tokens: []Token{
+			{Name: "ci", Token: "viewer-token", Role: RoleViewer},
+			{Name: "release", Token: "composer-token", Role: RoleComposer},
+		},
+	})
+
+	var auditLog bytes.Buffer
+	api.SetAuditLog(&auditLog)
+
+	send := func(method, path, body, token string) *http.Response {
+		return sendWithToken(api, method, path, body, token)
+	}
+
+	// the status route doesn't require authentication
+	require.Equal(t, http.StatusOK, send("GET", "/api/status", "", "").StatusCode)
+
+	require.Equal(t, http.StatusUnauthorized, send("GET", "/api/v0/blueprints/list", "", "").StatusCode)
+	require.Equal(t, http.StatusUnauthorized, send("GET", "/api/v0/blueprints/list", "", "wrong").StatusCode)
+	require.Equal(t, http.StatusOK, send("GET", "/api/v0/blueprints/list", "", "viewer-token").StatusCode)
+
+	bp := `{"name":"auth","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+	require.Equal(t, http.StatusForbidden, send("POST", "/api/v0/blueprints/new", bp, "viewer-token").StatusCode)
+	require.Equal(t, http.StatusOK, send("POST", "/api/v0/blueprints/new", bp, "composer-token").StatusCode)
+
+	// deleting blueprints requires the admin role
+	require.Equal(t, http.StatusForbidden, send("DELETE", "/api/v0/blueprints/delete/auth", "", "composer-token").StatusCode)
+
+	// only mutating calls are audited
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(auditLog.String()), "\n") {
+		var entry auditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "ci", entries[0].User)
+	require.Equal(t, http.StatusForbidden, entries[0].Status)
+	require.Equal(t, "viewer", entries[0].Role)
+
+	require.Equal(t, "release", entries[1].User)
+	require.Equal(t, "POST", entries[1].Method)
+	require.Equal(t, "/api/v0/blueprints/new", entries[1].Path)
+	require.Equal(t, http.StatusOK, entries[1].Status)
+
+	require.Equal(t, "DELETE", entries[2].Method)
+	require.Equal(t, http.StatusForbidden, entries[2].Status)
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	a := &ClientCertificateAuthenticator{
+		Subjects: map[string]Role{"builder": RoleComposer},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v0/blueprints/list", nil)
+	identity, err := a.Authenticate(req)
+	require.NoError(t, err)
+	require.Nil(t, identity)
+
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "builder"}}},
+	}
+	identity, err = a.Authenticate(req)
+	require.NoError(t, err)
+	require.Equal(t, &Identity{Name: "builder", Role: RoleComposer}, identity)
+
+	req.TLS.PeerCertificates[0].Subject.CommonName = "intruder"
+	_, err = a.Authenticate(req)
+	require.Error(t, err)
+}
+
+func TestPeerCredentialsAuthentication(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	socket := path.Join(t.TempDir(), "api.socket")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&PeerCredentialsAuthenticator{
+		Users: map[string]Role{current.Username: RoleComposer},
+	})
+
+	go func() {
+		_ = api.Serve(listener)
+	}()
+	defer listener.Close()
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	send := func(method, path, body string) int {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	bp := `{"name":"auth","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+	require.Equal(t, http.StatusOK, send("POST", "/api/v0/blueprints/new", bp))
+	require.Equal(t, http.StatusForbidden, send("DELETE", "/api/v0/blueprints/delete/auth", ""))
+
+	// requests which don't come through a unix socket aren't authenticated
+	test.TestRoute(t, api, false, "GET", "/api/v0/blueprints/list", ``, http.StatusUnauthorized, `{"status":false,"errors":[{"id":"Unauthorized","msg":"authentication required"}]}`)
+}
+
+func TestNamespaces(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&TokenAuthenticator{
+		Tokens: []Token{
+			{Name: "a", Token: "token-a", Role: RoleComposer, Namespace: "team-a"},
+			{Name: "b", Token: "token-b", Role: RoleComposer, Namespace: "team-b"},
+		},
+	})
+	s.SetQuota("team-b", store.Quota{Blueprints: 1, Composes: 1})
+
+	body := func(resp *http.Response) string {
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// both namespaces have their own blueprint called "shared"
+	for _, team := range []string{"a", "b"} {
+		bp := `{"name":"shared","description":"team ` + team + `","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+		resp := sendWithToken(api, "POST", "/api/v0/blueprints/new", bp, "token-"+team)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp := sendWithToken(api, "GET", "/api/v0/blueprints/info/shared", "", "token-b")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, body(resp), `"description":"team b"`)
+
+	// the default namespace and its blueprints aren't visible
+	resp = sendWithToken(api, "GET", "/api/v0/blueprints/list", "", "token-a")
+	require.JSONEq(t, `{"total":1,"offset":0,"limit":1,"blueprints":["shared"]}`, body(resp))
+
+	resp = sendWithToken(api, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"shared","compose_type":"qcow2","branch":"master"}`, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reply struct {
+		BuildID string `json:"build_id"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body(resp)), &reply))
+
+	resp = sendWithToken(api, "GET", "/api/v0/compose/finished", "", "token-a")
+	require.Contains(t, body(resp), reply.BuildID)
+	resp = sendWithToken(api, "GET", "/api/v0/compose/finished", "", "token-b")
+	require.JSONEq(t, `{"finished":[]}`, body(resp))
+	resp = sendWithToken(api, "GET", "/api/v0/compose/queue", "", "token-b")
+	require.JSONEq(t, `{"new":[],"run":[]}`, body(resp))
+	resp = sendWithToken(api, "DELETE", "/api/v0/compose/delete/"+reply.BuildID, "", "token-b")
+	require.Contains(t, body(resp), "UnknownUUID")
+
+	// team b is limited to one blueprint and one compose
+	other := `{"name":"other","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+	resp = sendWithToken(api, "POST", "/api/v0/blueprints/new", other, "token-b")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Contains(t, body(resp), "QuotaExceeded")
+	resp = sendWithToken(api, "POST", "/api/v0/blueprints/new", other, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	compose := `{"blueprint_name":"shared","compose_type":"qcow2","branch":"master"}`
+	resp = sendWithToken(api, "POST", "/api/v0/compose", compose, "token-b")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendWithToken(api, "POST", "/api/v0/compose", compose, "token-b")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Contains(t, body(resp), "QuotaExceeded")
+
+	// the composes of all namespaces are known to the store
+	require.Len(t, s.GetAllComposes(), 2)
+}
+
+func TestHandle(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&TokenAuthenticator{
+		Tokens: []Token{
+			{Name: "ci", Token: "viewer-token", Role: RoleViewer, Namespace: "team-a"},
+		},
+	})
+
+	var namespace string
+	api.Handle("/api/other/v1", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		namespace = api.Namespace(request).NamespaceName()
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+
+	require.Equal(t, http.StatusUnauthorized, sendWithToken(api, "GET", "/api/other/v1/foo", "", "").StatusCode)
+	require.Equal(t, http.StatusNoContent, sendWithToken(api, "GET", "/api/other/v1/foo", "", "viewer-token").StatusCode)
+	require.Equal(t, "team-a", namespace)
+	require.Equal(t, http.StatusForbidden, sendWithToken(api, "POST", "/api/other/v1/foo", "{}", "viewer-token").StatusCode)
+
+	// the routes of the weldr API are not affected
+	require.Equal(t, http.StatusOK, sendWithToken(api, "GET", "/api/v0/blueprints/list", "", "viewer-token").StatusCode)
+}
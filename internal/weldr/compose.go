@@ -1,12 +1,15 @@
 package weldr
 
 import (
-	"sort"
+	"strconv"
 
 	"github.com/google/uuid"
 
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/target"
 )
 
 type ComposeEntry struct {
@@ -20,6 +23,16 @@ type ComposeEntry struct {
 	JobStarted  float64                `json:"job_started,omitempty"`
 	JobFinished float64                `json:"job_finished,omitempty"`
 	Uploads     []uploadResponse       `json:"uploads,omitempty"`
+	ImageBuilds []ImageBuildEntry      `json:"image_builds,omitempty"`
+}
+
+// ImageBuildEntry describes one of the images of a compose which builds
+// several compose types.
+type ImageBuildEntry struct {
+	ID          int                    `json:"id"`
+	ComposeType string                 `json:"compose_type"`
+	ImageSize   uint64                 `json:"image_size"`
+	QueueStatus common.ImageBuildState `json:"queue_status"`
 }
 
 func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeStatus, includeUploads bool) *ComposeEntry {
@@ -28,10 +41,11 @@ func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeS
 	composeEntry.ID = id
 	composeEntry.Blueprint = compose.Blueprint.Name
 	composeEntry.Version = compose.Blueprint.Version
-	composeEntry.ComposeType = compose.ImageBuild.ImageType.Name()
+	composeEntry.ComposeType = compose.ImageBuilds[0].ImageType.Name()
+	composeEntry.ImageBuilds = imageBuildEntries(compose, status)
 
 	if includeUploads {
-		composeEntry.Uploads = targetsToUploadResponses(compose.ImageBuild.Targets, status.State)
+		composeEntry.Uploads = targetsToUploadResponses(composeTargets(compose), status)
 	}
 
 	switch status.State {
@@ -46,7 +60,7 @@ func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeS
 
 	case common.CFinished:
 		composeEntry.QueueStatus = common.IBFinished
-		composeEntry.ImageSize = compose.ImageBuild.Size
+		composeEntry.ImageSize = compose.ImageBuilds[0].Size
 		composeEntry.JobCreated = float64(status.Queued.UnixNano()) / 1000000000
 		composeEntry.JobStarted = float64(status.Started.UnixNano()) / 1000000000
 		composeEntry.JobFinished = float64(status.Finished.UnixNano()) / 1000000000
@@ -63,8 +77,135 @@ func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeS
 	return &composeEntry
 }
 
-func sortComposeEntries(entries []*ComposeEntry) {
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].ID.String() < entries[j].ID.String()
-	})
+// imageBuildEntries returns entries for the images of `compose`, if it
+// builds more than one. Composes with a single image are described by their
+// ComposeEntry alone.
+func imageBuildEntries(compose store.Compose, status *composeStatus) []ImageBuildEntry {
+	if len(compose.ImageBuilds) < 2 {
+		return nil
+	}
+
+	var entries []ImageBuildEntry
+	for i, ib := range compose.ImageBuilds {
+		entry := ImageBuildEntry{
+			ID:          ib.ID,
+			ComposeType: ib.ImageType.Name(),
+			QueueStatus: imageBuildState(status.ImageBuilds[i].State),
+		}
+		if entry.QueueStatus == common.IBFinished {
+			entry.ImageSize = ib.Size
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func imageBuildState(state common.ComposeState) common.ImageBuildState {
+	switch state {
+	case common.CWaiting:
+		return common.IBWaiting
+	case common.CRunning:
+		return common.IBRunning
+	case common.CFinished:
+		return common.IBFinished
+	case common.CFailed:
+		return common.IBFailed
+	default:
+		panic("invalid compose state")
+	}
+}
+
+// composeTargets returns the targets of all images of `compose`.
+func composeTargets(compose store.Compose) []*target.Target {
+	var targets []*target.Target
+	for _, ib := range compose.ImageBuilds {
+		targets = append(targets, ib.Targets...)
+	}
+	return targets
+}
+
+// hasImageType returns whether one of the images of `compose` is of type
+// `name`.
+func hasImageType(compose store.Compose, name string) bool {
+	for _, ib := range compose.ImageBuilds {
+		if ib.ImageType.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildMetadata describes how an image was built: how long its job ran, and
+// the metadata and duration of every stage osbuild ran, in order.
+type buildMetadata struct {
+	Duration float64              `json:"duration"`
+	Stages   []stageMetadataEntry `json:"stages"`
+}
+
+type stageMetadataEntry struct {
+	// Pipeline is "build" for stages of the build pipeline, "tree" for
+	// stages of the pipeline, and "assembler" for the assembler
+	Pipeline string                `json:"pipeline"`
+	Name     string                `json:"name"`
+	Success  bool                  `json:"success"`
+	Duration float64               `json:"duration,omitempty"`
+	Metadata osbuild.StageMetadata `json:"metadata,omitempty"`
+}
+
+func newBuildMetadata(status *composeStatus) *buildMetadata {
+	metadata := &buildMetadata{Stages: []stageMetadataEntry{}}
+
+	if !status.Started.IsZero() && !status.Finished.IsZero() {
+		metadata.Duration = status.Finished.Sub(status.Started).Seconds()
+	}
+
+	addStages := func(pipeline string, stages []osbuild.StageResult) {
+		for _, stage := range stages {
+			metadata.Stages = append(metadata.Stages, stageMetadataEntry{
+				Pipeline: pipeline,
+				Name:     stage.Name,
+				Success:  stage.Success,
+				Duration: stage.Duration,
+				Metadata: stage.Metadata,
+			})
+		}
+	}
+
+	if result := status.Result; result != nil {
+		if result.Build != nil {
+			addStages("build", result.Build.Stages)
+		}
+		addStages("tree", result.Stages)
+		if result.Assembler != nil {
+			addStages("assembler", []osbuild.StageResult{*result.Assembler})
+		}
+	}
+
+	return metadata
+}
+
+// imageBuildName appends the id of `ib` to `name`, unless it's the first
+// image of its compose. This keeps file names of composes with a single
+// image the way they always were.
+func imageBuildName(name string, ib store.ImageBuild) string {
+	if ib.ID == 0 {
+		return name
+	}
+	return name + "-" + strconv.Itoa(ib.ID)
+}
+
+// Returns the labels of container images built from `bp`, using the
+// pre-defined annotation keys of the OCI image spec.
+func blueprintContainerLabels(bp *blueprint.Blueprint) map[string]string {
+	labels := map[string]string{
+		"org.opencontainers.image.title": bp.Name,
+	}
+	if bp.Version != "" {
+		labels["org.opencontainers.image.version"] = bp.Version
+	}
+	if bp.Description != "" {
+		labels["org.opencontainers.image.description"] = bp.Description
+	}
+	return labels
 }
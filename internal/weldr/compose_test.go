@@ -0,0 +1,48 @@
+package weldr
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+)
+
+func TestNewBuildMetadata(t *testing.T) {
+	var result osbuild.Result
+	err := json.Unmarshal([]byte(`{
+		"success": true,
+		"build": {"success": true, "stages": [{"name": "org.osbuild.rpm", "success": true, "metadata": {"packages": []}, "duration": 20}]},
+		"stages": [
+			{"name": "org.osbuild.rpm", "success": true, "metadata": {"packages": []}, "duration": 100.5},
+			{"name": "org.osbuild.locale", "success": true, "metadata": null}
+		],
+		"assembler": {"name": "org.osbuild.ostree.commit", "success": true, "metadata": {"compose": {"ref": "test", "ostree-commit": "abcdef"}}, "duration": 40}
+	}`), &result)
+	require.NoError(t, err)
+
+	started := time.Date(2020, 6, 25, 13, 0, 0, 0, time.UTC)
+	metadata := newBuildMetadata(&composeStatus{
+		Started:  started,
+		Finished: started.Add(3 * time.Minute),
+		Result:   &result,
+	})
+
+	data, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"duration": 180,
+		"stages": [
+			{"pipeline": "build", "name": "org.osbuild.rpm", "success": true, "duration": 20, "metadata": {"packages": []}},
+			{"pipeline": "tree", "name": "org.osbuild.rpm", "success": true, "duration": 100.5, "metadata": {"packages": []}},
+			{"pipeline": "tree", "name": "org.osbuild.locale", "success": true},
+			{"pipeline": "assembler", "name": "org.osbuild.ostree.commit", "success": true, "duration": 40, "metadata": {
+				"compose": {"ref": "test", "ostree-commit": "abcdef"}
+			}}
+		]
+	}`, string(data))
+
+	require.Equal(t, &buildMetadata{Stages: []stageMetadataEntry{}}, newBuildMetadata(&composeStatus{}))
+}
@@ -0,0 +1,503 @@
+package weldr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+// Number of past events kept around for clients which resume a stream.
+const eventHistorySize = 1000
+
+// Number of events buffered for each client. Clients which fall behind
+// further than this are disconnected and have to resume.
+const eventSubscriberBuffer = 64
+
+// Interval in which comments are sent to idle clients, so that proxies
+// don't close the connection.
+var eventKeepAliveInterval = 15 * time.Second
+
+type event struct {
+	ID   uint64
+	Type string
+	Data interface{}
+
+	// only clients of this namespace receive the event
+	Namespace string
+}
+
+// Sent as "compose" event whenever the state of a compose changes. Only the
+// id is set when the compose was deleted.
+type composeEvent struct {
+	ID        uuid.UUID            `json:"id"`
+	Namespace string               `json:"namespace,omitempty"`
+	Blueprint string               `json:"blueprint,omitempty"`
+	Version   string               `json:"version,omitempty"`
+	State     *common.ComposeState `json:"state,omitempty"`
+	Deleted   bool                 `json:"deleted,omitempty"`
+}
+
+// Sent as "upload" event whenever the state of an upload changes.
+type uploadEvent struct {
+	UUID      uuid.UUID           `json:"uuid"`
+	Namespace string              `json:"namespace,omitempty"`
+	ComposeID uuid.UUID           `json:"compose_id"`
+	ImageName string              `json:"image_name"`
+	State     common.ComposeState `json:"state"`
+}
+
+// Sent as "blueprint" event whenever a blueprint or its workspace copy
+// changes. Version is empty when the blueprint was deleted.
+type blueprintEvent struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// Sent as "job" event whenever a worker starts or finishes a job, or a job
+// is canceled.
+type jobEvent struct {
+	ID        uuid.UUID  `json:"id"`
+	Namespace string     `json:"namespace,omitempty"`
+	ComposeID uuid.UUID  `json:"compose_id"`
+	Upload    *uuid.UUID `json:"upload,omitempty"`
+	Status    string     `json:"status"`
+}
+
+// eventHub distributes events to all subscribed clients and keeps a history
+// of recent events, so that clients can resume after reconnecting.
+//
+// Events are numbered from 1 every time composer starts. Their ids are
+// prefixed by `epoch`, which is different after each start, so that clients
+// can't mistake the events of one run for the ones of another.
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string
+	lastID      uint64
+	history     []event
+	subscribers map[chan event]bool
+
+	// called for every published event
+	onPublish func(e event)
+
+	// serializes computing and publishing state transitions
+	transitions sync.Mutex
+
+	// last states which were sent, to only send actual transitions
+	composeStates     map[uuid.UUID]common.ComposeState
+	uploadStates      map[uuid.UUID]common.ComposeState
+	composeUploads    map[uuid.UUID][]uuid.UUID
+	composeNamespaces map[uuid.UUID]string
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		epoch:             strings.Split(uuid.New().String(), "-")[0],
+		subscribers:       make(map[chan event]bool),
+		composeStates:     make(map[uuid.UUID]common.ComposeState),
+		uploadStates:      make(map[uuid.UUID]common.ComposeState),
+		composeUploads:    make(map[uuid.UUID][]uuid.UUID),
+		composeNamespaces: make(map[uuid.UUID]string),
+	}
+}
+
+func (h *eventHub) publish(namespace, eventType string, data interface{}) {
+	e := h.record(namespace, eventType, data)
+
+	// called without holding the lock, so that slow webhooks don't block
+	// subscribers and other publishers
+	if h.onPublish != nil {
+		h.onPublish(e)
+	}
+}
+
+// record adds an event to the history and sends it to all subscribers.
+func (h *eventHub) record(namespace, eventType string, data interface{}) event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e := event{
+		ID:        h.lastID,
+		Type:      eventType,
+		Data:      data,
+		Namespace: namespace,
+	}
+
+	h.history = append(h.history, e)
+	if len(h.history) > eventHistorySize {
+		h.history = h.history[len(h.history)-eventHistorySize:]
+	}
+
+	for c := range h.subscribers {
+		select {
+		case c <- e:
+		default:
+			// the client is too slow, make it reconnect
+			delete(h.subscribers, c)
+			close(c)
+		}
+	}
+
+	return e
+}
+
+// eventID returns the id clients see for event number `id`.
+func (h *eventHub) eventID(id uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// parseEventID returns the number of the event with id `id`, and whether
+// it was published since composer started. Ids of earlier runs are not an
+// error, the events of those runs are lost.
+func (h *eventHub) parseEventID(id string) (uint64, bool, error) {
+	parts := strings.Split(id, "-")
+	n, err := strconv.ParseUint(parts[len(parts)-1], 10, 64)
+	if err != nil || len(parts) > 2 {
+		return 0, false, fmt.Errorf("invalid event id: %s", id)
+	}
+
+	if len(parts) != 2 || parts[0] != h.epoch {
+		return 0, false, nil
+	}
+	return n, true, nil
+}
+
+// subscribe returns a channel receiving all events published from now on,
+// and the events after `lastID` which were published already. It also
+// returns the number of the last published event, and whether the backlog
+// is complete, which it is not when the history doesn't reach back to
+// `lastID` anymore.
+func (h *eventHub) subscribe(lastID uint64) (chan event, []event, uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var backlog []event
+	for _, e := range h.history {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+	complete := len(h.history) == 0 || h.history[0].ID <= lastID+1
+
+	c := make(chan event, eventSubscriberBuffer)
+	h.subscribers[c] = true
+
+	return c, backlog, h.lastID, complete
+}
+
+func (h *eventHub) unsubscribe(c chan event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[c] {
+		delete(h.subscribers, c)
+		close(c)
+	}
+}
+
+// updateComposeState records the state of a compose of namespace
+// `namespace` and returns whether it changed.
+func (h *eventHub) updateComposeState(namespace string, id uuid.UUID, state common.ComposeState) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old, exists := h.composeStates[id]
+	h.composeStates[id] = state
+	h.composeNamespaces[id] = namespace
+	return !exists || old != state
+}
+
+// updateUploadState records the state of an upload of compose `composeID`
+// and returns whether it changed.
+func (h *eventHub) updateUploadState(composeID, id uuid.UUID, state common.ComposeState) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old, exists := h.uploadStates[id]
+	if !exists {
+		h.composeUploads[composeID] = append(h.composeUploads[composeID], id)
+	}
+	h.uploadStates[id] = state
+	return !exists || old != state
+}
+
+// forgetCompose removes the recorded states of compose `id` and its uploads
+// and returns its namespace and whether the compose was known.
+func (h *eventHub) forgetCompose(id uuid.UUID) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, exists := h.composeStates[id]
+	namespace := h.composeNamespaces[id]
+	delete(h.composeStates, id)
+	delete(h.composeNamespaces, id)
+	for _, upload := range h.composeUploads[id] {
+		delete(h.uploadStates, upload)
+	}
+	delete(h.composeUploads, id)
+	return namespace, exists
+}
+
+// setupEvents records the current states of all composes and registers the
+// hooks which publish events.
+func (api *API) setupEvents() {
+	api.events = newEventHub()
+	api.events.onPublish = api.notifyWebhooks
+
+	for id, compose := range api.store.GetAllComposes() {
+		status := api.getComposeStatus(compose)
+		api.events.updateComposeState(compose.Namespace, id, status.State)
+		for _, t := range composeTargets(compose) {
+			if t.Name != "org.osbuild.local" {
+				api.events.updateUploadState(id, t.Uuid, status.uploadState(t.Uuid))
+			}
+		}
+	}
+
+	api.store.OnBlueprintChange(api.blueprintChanged)
+	api.store.OnComposeChange(api.composeChanged)
+	api.workers.OnJobStarted(func(id uuid.UUID, jobType string) {
+		api.jobChanged(id, "started")
+	})
+	api.workers.OnJobFinished(func(id uuid.UUID, result *worker.OSBuildJobResult) {
+		status := "finished"
+		if result.OSBuildOutput == nil || !result.OSBuildOutput.Success {
+			status = "failed"
+		}
+		api.jobChanged(id, status)
+	})
+	api.workers.OnJobCanceled(func(id uuid.UUID) {
+		api.jobChanged(id, "canceled")
+	})
+}
+
+func (api *API) blueprintChanged(namespace, name string) {
+	bp, _ := api.store.Namespace(namespace).GetBlueprint(name)
+	if bp == nil {
+		api.events.publish(namespace, "blueprint", blueprintEvent{
+			Name:      name,
+			Namespace: namespace,
+			Deleted:   true,
+		})
+		return
+	}
+
+	api.events.publish(namespace, "blueprint", blueprintEvent{
+		Name:      name,
+		Namespace: namespace,
+		Version:   bp.Version,
+	})
+}
+
+// composeChanged publishes the state transitions of compose `id` and its
+// uploads since the last time it was called for this compose.
+func (api *API) composeChanged(id uuid.UUID) {
+	api.events.transitions.Lock()
+	defer api.events.transitions.Unlock()
+
+	compose, exists := api.store.GetCompose(id)
+	if !exists {
+		if namespace, known := api.events.forgetCompose(id); known {
+			api.events.publish(namespace, "compose", composeEvent{
+				ID:        id,
+				Namespace: namespace,
+				Deleted:   true,
+			})
+		}
+		return
+	}
+
+	status := api.getComposeStatus(compose)
+
+	if api.events.updateComposeState(compose.Namespace, id, status.State) {
+		api.events.publish(compose.Namespace, "compose", composeEvent{
+			ID:        id,
+			Namespace: compose.Namespace,
+			Blueprint: compose.Blueprint.Name,
+			Version:   compose.Blueprint.Version,
+			State:     &status.State,
+		})
+	}
+
+	for _, t := range composeTargets(compose) {
+		if t.Name == "org.osbuild.local" {
+			continue
+		}
+
+		state := status.uploadState(t.Uuid)
+		if api.events.updateUploadState(id, t.Uuid, state) {
+			api.events.publish(compose.Namespace, "upload", uploadEvent{
+				UUID:      t.Uuid,
+				Namespace: compose.Namespace,
+				ComposeID: id,
+				ImageName: t.ImageName,
+				State:     state,
+			})
+		}
+	}
+}
+
+// jobChanged publishes a "job" event for job `id` and the state transitions
+// of the compose the job belongs to.
+func (api *API) jobChanged(id uuid.UUID, status string) {
+	for composeID, compose := range api.store.GetAllComposes() {
+		for _, ib := range compose.ImageBuilds {
+			isImageJob := ib.JobID == id
+			targetID, isUploadJob := uploadJobTarget(ib, id)
+			if !isImageJob && !isUploadJob {
+				continue
+			}
+
+			e := jobEvent{
+				ID:        id,
+				Namespace: compose.Namespace,
+				ComposeID: composeID,
+				Status:    status,
+			}
+			if isUploadJob {
+				e.Upload = &targetID
+			}
+			api.events.publish(compose.Namespace, "job", e)
+			api.composeChanged(composeID)
+			return
+		}
+	}
+}
+
+// eventsHandler streams events to the client as server-sent events.
+//
+// Clients resume a stream by passing the id of the last event they received.
+// When composer can't send them all events after that one, because it
+// restarted or they were disconnected for too long, they receive a "resync"
+// event instead, after which they have to fetch the state they track again.
+func (api *API) eventsHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		errors := responseError{
+			ID:  "HTTPError",
+			Msg: "Streaming is not supported",
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	// EventSource clients send the id of the last event they received when
+	// reconnecting. Allow passing it as query parameter for other clients.
+	lastEventID := request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = request.URL.Query().Get("last_event_id")
+	}
+
+	var lastID uint64
+	current := true
+	if lastEventID != "" {
+		var err error
+		lastID, current, err = api.events.parseEventID(lastEventID)
+		if err != nil {
+			errors := responseError{
+				ID:  "InvalidChars",
+				Msg: fmt.Sprintf("invalid last event id: %s", lastEventID),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	// clients only receive the events of their namespace
+	namespace := api.Namespace(request).NamespaceName()
+
+	c, backlog, publishedID, complete := api.events.subscribe(lastID)
+	if lastEventID == "" {
+		// new clients only receive new events
+		backlog = nil
+	}
+	defer api.events.unsubscribe(c)
+
+	// clients which missed events, because composer restarted or they
+	// were gone for too long, have to fetch the current state again
+	resync := lastEventID != "" && (!current || !complete)
+	if resync {
+		backlog = nil
+	}
+
+	// optional comma-separated list of event types
+	var types map[string]bool
+	if t := request.URL.Query().Get("types"); t != "" {
+		types = make(map[string]bool)
+		for _, eventType := range strings.Split(t, ",") {
+			types[eventType] = true
+		}
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e event) error {
+		if e.Namespace != namespace || (types != nil && !types[e.Type]) {
+			return nil
+		}
+		data, err := json.Marshal(e.Data)
+		common.PanicOnError(err)
+		_, err = fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", api.events.eventID(e.ID), e.Type, data)
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if resync {
+		_, err := fmt.Fprintf(writer, "id: %s\nevent: resync\ndata: {}\n\n", api.events.eventID(publishedID))
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+
+	for _, e := range backlog {
+		if send(e) != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e, ok := <-c:
+			if !ok {
+				return
+			}
+			if send(e) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(writer, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
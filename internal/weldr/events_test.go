@@ -0,0 +1,218 @@
+package weldr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/test"
+)
+
+type testEvent struct {
+	ID   string
+	Type string
+	Data map[string]interface{}
+}
+
+// Connects to the event stream of `server` and returns a channel receiving
+// the parsed events. The stream is closed when `ctx` is done.
+func streamEvents(t *testing.T, ctx context.Context, server *httptest.Server, query, lastEventID string) <-chan testEvent {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v1/events"+query, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan testEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		var e testEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				e.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.Data)
+			case line == "" && e.Type != "":
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+				e = testEvent{}
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan testEvent) testEvent {
+	t.Helper()
+
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "event stream was closed")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return testEvent{}
+}
+
+func TestEvents(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.uploadRetryDelay = time.Millisecond
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// new clients only receive new events
+	live := streamEvents(t, ctx, server, "", "")
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/blueprints/new", `{"name":"events","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`, http.StatusOK, `{"status":true}`)
+	e := nextEvent(t, live)
+	require.Equal(t, "blueprint", e.Type)
+	require.Equal(t, map[string]interface{}{"name": "events", "version": "0.0.1"}, e.Data)
+	blueprintEventID := e.ID
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, "build_id")
+	composeID := onlyComposeID(t, s)
+
+	e = nextEvent(t, live)
+	require.Equal(t, "compose", e.Type)
+	require.Equal(t, map[string]interface{}{"id": composeID, "blueprint": "test", "version": "0.0.0", "state": "WAITING"}, e.Data)
+	composeEventID := e.ID
+	e = nextEvent(t, live)
+	require.Equal(t, "upload", e.Type)
+	require.Equal(t, composeID, e.Data["compose_id"])
+	require.Equal(t, "WAITING", e.Data["state"])
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+
+	e = nextEvent(t, live)
+	require.Equal(t, "job", e.Type)
+	require.Equal(t, "started", e.Data["status"])
+	require.NotContains(t, e.Data, "upload")
+	e = nextEvent(t, live)
+	require.Equal(t, "compose", e.Type)
+	require.Equal(t, "RUNNING", e.Data["state"])
+	e = nextEvent(t, live)
+	require.Equal(t, "job", e.Type)
+	require.Equal(t, "finished", e.Data["status"])
+	e = nextEvent(t, live)
+	require.Equal(t, "compose", e.Type)
+	require.Equal(t, "FINISHED", e.Data["state"])
+	lastEventID := e.ID
+
+	// resuming replays everything after the given event
+	resumed := streamEvents(t, ctx, server, "", blueprintEventID)
+	e = nextEvent(t, resumed)
+	require.Equal(t, composeEventID, e.ID)
+	require.Equal(t, "compose", e.Type)
+	require.Equal(t, "WAITING", e.Data["state"])
+
+	// clients can filter by event type
+	filtered := streamEvents(t, ctx, server, "?types=upload", lastEventID)
+
+	finishNextJob(t, api, `{"status":"FAILED","result":{"success":false}}`)
+
+	e = nextEvent(t, filtered)
+	require.Equal(t, "upload", e.Type)
+	require.Equal(t, "RUNNING", e.Data["state"])
+	e = nextEvent(t, filtered)
+	require.Equal(t, "upload", e.Type)
+	require.Equal(t, "FAILED", e.Data["state"])
+	// the failed upload is retried automatically
+	e = nextEvent(t, filtered)
+	require.Equal(t, "upload", e.Type)
+	require.Equal(t, "WAITING", e.Data["state"])
+
+	test.TestRoute(t, api, false, "DELETE", "/api/v0/blueprints/delete/events", ``, http.StatusOK, `{"status":true}`)
+	for {
+		e = nextEvent(t, live)
+		if e.Type == "blueprint" {
+			break
+		}
+	}
+	require.Equal(t, map[string]interface{}{"name": "events", "deleted": true}, e.Data)
+
+	response := test.SendHTTP(api, false, "GET", "/api/v1/events?last_event_id=foo", "")
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// ids from before composer restarted make clients resync, whether
+	// they have the current format or not
+	for _, id := range []string{"1", "0a1b2c3d-1"} {
+		restarted := streamEvents(t, ctx, server, "?types=upload", id)
+		e = nextEvent(t, restarted)
+		require.Equal(t, "resync", e.Type)
+		require.True(t, strings.HasPrefix(e.ID, api.events.epoch+"-"), e.ID)
+	}
+}
+
+func TestEventHubHistory(t *testing.T) {
+	h := newEventHub()
+	for i := 0; i < eventHistorySize+2; i++ {
+		h.publish("", "blueprint", blueprintEvent{Name: "test"})
+	}
+
+	id, current, err := h.parseEventID(h.eventID(3))
+	require.NoError(t, err)
+	require.True(t, current)
+	require.Equal(t, uint64(3), id)
+
+	// the history starts at event 3
+	_, backlog, lastID, complete := h.subscribe(2)
+	require.True(t, complete)
+	require.Len(t, backlog, eventHistorySize)
+	require.Equal(t, uint64(eventHistorySize+2), lastID)
+
+	_, _, _, complete = h.subscribe(1)
+	require.False(t, complete)
+
+	_, _, err = h.parseEventID("a-b-1")
+	require.Error(t, err)
+}
+
+func TestEventHubOnPublishUnlocked(t *testing.T) {
+	h := newEventHub()
+
+	// subscribers are served while the hook runs, which may take a while
+	// when it sends webhooks
+	var missed []event
+	h.onPublish = func(e event) {
+		_, missed, _, _ = h.subscribe(0)
+	}
+	h.publish("", "blueprint", blueprintEvent{Name: "test"})
+
+	require.Len(t, missed, 1)
+	require.Equal(t, "blueprint", missed[0].Type)
+}
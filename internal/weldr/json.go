@@ -28,6 +28,7 @@ type BlueprintsListV0 struct {
 	Offset     uint     `json:"offset"`
 	Limit      uint     `json:"limit"`
 	Blueprints []string `json:"blueprints"`
+	NextCursor string   `json:"next_cursor,omitempty"`
 }
 
 // ResponseError holds the API response error details
@@ -296,13 +297,16 @@ type ComposeEntryV0 struct {
 }
 
 type ComposeFinishedResponseV0 struct {
-	Finished []ComposeEntryV0 `json:"finished"`
+	Finished   []ComposeEntryV0 `json:"finished"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 type ComposeFailedResponseV0 struct {
-	Failed []ComposeEntryV0 `json:"failed"`
+	Failed     []ComposeEntryV0 `json:"failed"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 type ComposeStatusResponseV0 struct {
-	UUIDs []ComposeEntryV0 `json:"uuids"`
+	UUIDs      []ComposeEntryV0 `json:"uuids"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 
 type ComposeTypeV0 struct {
@@ -0,0 +1,330 @@
+package weldr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// A RetentionPolicy decides which finished and failed composes are deleted
+// by the garbage collector. Zero values disable the respective rule. Composes
+// which are still building or uploading are never deleted.
+type RetentionPolicy struct {
+	// MaxAge is how long composes are kept after they finished.
+	MaxAge time.Duration
+
+	// MaxComposesPerBlueprint is how many composes of each blueprint of a
+	// namespace are kept. The oldest ones are deleted first.
+	MaxComposesPerBlueprint int
+
+	// KeepLastSuccessful protects the newest finished compose of each
+	// blueprint from all other rules.
+	KeepLastSuccessful bool
+
+	// When more than HighWatermark percent of the disk that artifacts are
+	// stored on is used, the oldest composes are deleted until usage is
+	// expected to drop below LowWatermark percent. LowWatermark defaults
+	// to HighWatermark.
+	HighWatermark float64
+	LowWatermark  float64
+}
+
+// A DiskUsageFunc returns the used and the total bytes of the disk that
+// artifacts are stored on.
+type DiskUsageFunc func() (used, total uint64, err error)
+
+// Reasons why a compose is deleted, as reported in retentionEntry.
+const (
+	retentionMaxAge      = "max_age"
+	retentionMaxComposes = "max_composes_per_blueprint"
+	retentionDiskUsage   = "disk_watermark"
+)
+
+type retentionEntry struct {
+	ID          uuid.UUID              `json:"id"`
+	Namespace   string                 `json:"namespace,omitempty"`
+	Blueprint   string                 `json:"blueprint"`
+	QueueStatus common.ImageBuildState `json:"queue_status"`
+	JobFinished float64                `json:"job_finished"`
+	Size        uint64                 `json:"size"`
+	Reason      string                 `json:"reason"`
+}
+
+type retentionReport struct {
+	Composes []retentionEntry `json:"composes"`
+	// the sum of the sizes of the artifacts of all composes in the report
+	Size uint64 `json:"size"`
+}
+
+// forNamespace returns the part of the report about the composes of
+// namespace `namespace`.
+func (r retentionReport) forNamespace(namespace string) retentionReport {
+	filtered := retentionReport{Composes: []retentionEntry{}}
+	for _, entry := range r.Composes {
+		if entry.Namespace == namespace {
+			filtered.Composes = append(filtered.Composes, entry)
+			filtered.Size += entry.Size
+		}
+	}
+	return filtered
+}
+
+// SetRetentionPolicy sets the policy which composes are deleted by the
+// garbage collector and the compose/retention route. `diskUsage` may be nil
+// if the policy has no watermarks.
+func (api *API) SetRetentionPolicy(policy RetentionPolicy, diskUsage DiskUsageFunc) {
+	api.retentionMu.Lock()
+	defer api.retentionMu.Unlock()
+
+	api.retention = policy
+	api.diskUsage = diskUsage
+}
+
+// CollectGarbage deletes all composes which the retention policy doesn't
+// keep, together with their artifacts and jobs, every `interval` until `ctx`
+// is canceled.
+func (api *API) CollectGarbage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report := api.retentionReport(time.Now())
+		for _, entry := range report.Composes {
+			err := api.deleteCompose(api.store, entry.ID)
+			if err != nil {
+				if api.logger != nil {
+					api.logger.Printf("cannot delete compose %s: %v", entry.ID, err)
+				}
+				continue
+			}
+			if api.logger != nil {
+				api.logger.Printf("deleted compose %s (%s)", entry.ID, entry.Reason)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retentionReport returns the composes which the retention policy doesn't
+// keep at time `now`, oldest first.
+func (api *API) retentionReport(now time.Time) retentionReport {
+	api.retentionMu.Lock()
+	policy := api.retention
+	diskUsage := api.diskUsage
+	api.retentionMu.Unlock()
+
+	type candidate struct {
+		entry     retentionEntry
+		finished  time.Time
+		protected bool
+	}
+
+	// Group the composes which are done by blueprint, newest first.
+	groups := map[string][]*candidate{}
+	for id, compose := range api.store.GetAllComposes() {
+		status := api.getComposeStatus(compose)
+		if !composeDone(status) {
+			continue
+		}
+		c := &candidate{
+			entry: retentionEntry{
+				ID:          id,
+				Namespace:   compose.Namespace,
+				Blueprint:   compose.Blueprint.Name,
+				QueueStatus: imageBuildState(status.State),
+				JobFinished: float64(status.Finished.UnixNano()) / 1000000000,
+			},
+			finished: status.Finished,
+		}
+		key := compose.Namespace + "/" + compose.Blueprint.Name
+		groups[key] = append(groups[key], c)
+	}
+
+	var candidates []*candidate
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].finished.Equal(group[j].finished) {
+				return group[i].entry.ID.String() > group[j].entry.ID.String()
+			}
+			return group[i].finished.After(group[j].finished)
+		})
+
+		keptSuccessful := false
+		for i, c := range group {
+			if policy.KeepLastSuccessful && !keptSuccessful && c.entry.QueueStatus == common.IBFinished {
+				keptSuccessful = true
+				c.protected = true
+			} else if policy.MaxComposesPerBlueprint > 0 && i >= policy.MaxComposesPerBlueprint {
+				c.entry.Reason = retentionMaxComposes
+			} else if policy.MaxAge > 0 && now.Sub(c.finished) > policy.MaxAge {
+				c.entry.Reason = retentionMaxAge
+			}
+		}
+		candidates = append(candidates, group...)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].finished.Equal(candidates[j].finished) {
+			return candidates[i].entry.ID.String() < candidates[j].entry.ID.String()
+		}
+		return candidates[i].finished.Before(candidates[j].finished)
+	})
+
+	report := retentionReport{Composes: []retentionEntry{}}
+	for _, c := range candidates {
+		if c.entry.Reason != "" {
+			c.entry.Size = api.composeSize(c.entry.ID)
+			report.Size += c.entry.Size
+		}
+	}
+
+	// Delete the oldest of the remaining composes until enough space is
+	// freed. Sizes are only estimates: deleting a compose might free less,
+	// for example when the file system compresses or deduplicates data.
+	if policy.HighWatermark > 0 && diskUsage != nil {
+		used, total, err := diskUsage()
+		if err != nil && api.logger != nil {
+			api.logger.Printf("cannot get disk usage: %v", err)
+		}
+		if err == nil && float64(used) > float64(total)*policy.HighWatermark/100 {
+			low := policy.LowWatermark
+			if low == 0 || low > policy.HighWatermark {
+				low = policy.HighWatermark
+			}
+			target := uint64(float64(total) * low / 100)
+			for _, c := range candidates {
+				if report.Size >= used || used-report.Size <= target {
+					break
+				}
+				if c.entry.Reason != "" || c.protected {
+					continue
+				}
+				c.entry.Reason = retentionDiskUsage
+				c.entry.Size = api.composeSize(c.entry.ID)
+				report.Size += c.entry.Size
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		if c.entry.Reason != "" {
+			report.Composes = append(report.Composes, c.entry)
+		}
+	}
+
+	return report
+}
+
+// composeDone returns whether a compose and all its uploads are finished or
+// have failed.
+func composeDone(status *composeStatus) bool {
+	if status.State != common.CFinished && status.State != common.CFailed {
+		return false
+	}
+	for _, state := range status.UploadStates {
+		if state != common.CFinished && state != common.CFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// composeSize returns the size in bytes of the artifacts of compose `id`.
+func (api *API) composeSize(id uuid.UUID) uint64 {
+	compose, exists := api.store.GetCompose(id)
+	if !exists {
+		return 0
+	}
+
+	var size uint64
+	compat := false
+	for _, ib := range compose.ImageBuilds {
+		n, err := api.workers.ArtifactsSize(ib.JobID)
+		if err == jobqueue.ErrNotExist {
+			compat = true
+			continue
+		}
+		if err == nil {
+			size += uint64(n)
+		}
+	}
+
+	if compat && api.compatOutputDir != "" {
+		_ = filepath.Walk(path.Join(api.compatOutputDir, id.String()), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				size += uint64(info.Size())
+			}
+			return nil
+		})
+	}
+
+	return size
+}
+
+// deleteCompose deletes compose `id` from the store view `ns`, and then its
+// artifacts and jobs. Errors about the latter are only logged, because the
+// compose itself is gone at that point.
+func (api *API) deleteCompose(ns *store.Store, id uuid.UUID) error {
+	compose, exists := ns.GetCompose(id)
+	if !exists {
+		return &store.NotFoundError{}
+	}
+
+	err := ns.DeleteCompose(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete artifacts from the worker server or — if that doesn't have
+	// this job — the compat output dir. Uploads depend on the job that
+	// built their image, so they have to be deleted first.
+	for _, ib := range compose.ImageBuilds {
+		api.cancelUploads(ib)
+		for _, jobID := range ib.UploadJobs {
+			err = api.workers.DeleteJob(jobID)
+			if err != nil && err != jobqueue.ErrNotExist && api.logger != nil {
+				api.logger.Printf("cannot delete upload job %s: %v", jobID, err)
+			}
+		}
+
+		err = api.workers.DeleteJob(ib.JobID)
+		if err == jobqueue.ErrNotExist {
+			if api.compatOutputDir != "" {
+				_ = os.RemoveAll(path.Join(api.compatOutputDir, id.String()))
+			}
+		} else if err != nil && api.logger != nil {
+			api.logger.Printf("cannot delete job %s: %v", ib.JobID, err)
+		}
+	}
+
+	return nil
+}
+
+// composeRetentionHandler reports which composes of the request's namespace
+// the garbage collector would delete if it ran now, without deleting them.
+func (api *API) composeRetentionHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	report := api.retentionReport(time.Now()).forNamespace(api.Namespace(request).NamespaceName())
+	err := json.NewEncoder(writer).Encode(report)
+	common.PanicOnError(err)
+}
@@ -0,0 +1,197 @@
+package weldr
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/common"
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/test"
+)
+
+// pushRetentionCompose adds a compose of blueprint `name` which finished
+// `age` ago, and writes an artifact of `size` bytes for it.
+func pushRetentionCompose(t *testing.T, api *API, s *store.Store, name string, age time.Duration, success bool, size int) uuid.UUID {
+	t.Helper()
+
+	imageType, err := api.arch.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	queueStatus := common.IBFailed
+	if success {
+		queueStatus = common.IBFinished
+	}
+
+	id := uuid.New()
+	finished := time.Now().Add(-age)
+	err = s.PushCompose(id, &blueprint.Blueprint{Name: name}, []store.ImageBuild{
+		{
+			ImageType:   imageType,
+			QueueStatus: queueStatus,
+			JobStarted:  finished,
+			JobFinished: finished,
+		},
+	})
+	require.NoError(t, err)
+
+	dir := path.Join(api.compatOutputDir, id.String(), "0")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "disk.qcow2"), make([]byte, size), 0644))
+
+	return id
+}
+
+func retentionReportIDs(report retentionReport) map[uuid.UUID]string {
+	ids := make(map[uuid.UUID]string)
+	for _, entry := range report.Composes {
+		ids[entry.ID] = entry.Reason
+	}
+	return ids
+}
+
+func TestRetentionReport(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	dir, err := ioutil.TempDir("", "weldr-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	api.compatOutputDir = dir
+
+	day := 24 * time.Hour
+	oldSuccess := pushRetentionCompose(t, api, s, "one", 10*day, true, 100)
+	oldFailure := pushRetentionCompose(t, api, s, "one", 9*day, false, 10)
+	recentSuccess := pushRetentionCompose(t, api, s, "one", 2*day, true, 100)
+	recentFailure := pushRetentionCompose(t, api, s, "one", 1*day, false, 10)
+	other := pushRetentionCompose(t, api, s, "two", 8*day, true, 100)
+
+	// nothing is deleted without a policy
+	report := api.retentionReport(time.Now())
+	require.Empty(t, report.Composes)
+	require.Equal(t, uint64(0), report.Size)
+
+	api.SetRetentionPolicy(RetentionPolicy{MaxAge: 7 * day}, nil)
+	report = api.retentionReport(time.Now())
+	require.Equal(t, map[uuid.UUID]string{
+		oldSuccess: retentionMaxAge,
+		oldFailure: retentionMaxAge,
+		other:      retentionMaxAge,
+	}, retentionReportIDs(report))
+	require.Equal(t, uint64(210), report.Size)
+	require.Equal(t, oldSuccess, report.Composes[0].ID)
+
+	// the newest successful compose of each blueprint is kept
+	api.SetRetentionPolicy(RetentionPolicy{MaxAge: 7 * day, KeepLastSuccessful: true}, nil)
+	report = api.retentionReport(time.Now())
+	require.Equal(t, map[uuid.UUID]string{
+		oldSuccess: retentionMaxAge,
+		oldFailure: retentionMaxAge,
+	}, retentionReportIDs(report))
+
+	api.SetRetentionPolicy(RetentionPolicy{MaxComposesPerBlueprint: 2}, nil)
+	report = api.retentionReport(time.Now())
+	require.Equal(t, map[uuid.UUID]string{
+		oldSuccess: retentionMaxComposes,
+		oldFailure: retentionMaxComposes,
+	}, retentionReportIDs(report))
+
+	// the kept successful compose doesn't count towards the maximum
+	api.SetRetentionPolicy(RetentionPolicy{MaxComposesPerBlueprint: 1, KeepLastSuccessful: true}, nil)
+	report = api.retentionReport(time.Now())
+	require.Equal(t, map[uuid.UUID]string{
+		oldSuccess: retentionMaxComposes,
+		oldFailure: retentionMaxComposes,
+	}, retentionReportIDs(report))
+
+	// 95% of the disk are used, so 150 bytes have to be freed to reach the
+	// low watermark of 80%
+	diskUsage := func() (uint64, uint64, error) {
+		return 950, 1000, nil
+	}
+	api.SetRetentionPolicy(RetentionPolicy{HighWatermark: 90, LowWatermark: 80, KeepLastSuccessful: true}, diskUsage)
+	report = api.retentionReport(time.Now())
+	require.Equal(t, map[uuid.UUID]string{
+		oldSuccess:    retentionDiskUsage,
+		oldFailure:    retentionDiskUsage,
+		recentFailure: retentionDiskUsage,
+	}, retentionReportIDs(report))
+	require.Equal(t, uint64(120), report.Size)
+	require.NotContains(t, retentionReportIDs(report), recentSuccess)
+
+	// usage below the high watermark doesn't delete anything
+	api.SetRetentionPolicy(RetentionPolicy{HighWatermark: 96}, diskUsage)
+	report = api.retentionReport(time.Now())
+	require.Empty(t, report.Composes)
+
+	// composes which are still running are never deleted
+	running := uuid.New()
+	imageType, err := api.arch.GetImageType("qcow2")
+	require.NoError(t, err)
+	err = s.PushCompose(running, &blueprint.Blueprint{Name: "one"}, []store.ImageBuild{
+		{ImageType: imageType, QueueStatus: common.IBRunning},
+	})
+	require.NoError(t, err)
+	api.SetRetentionPolicy(RetentionPolicy{MaxComposesPerBlueprint: 1}, nil)
+	report = api.retentionReport(time.Now())
+	require.NotContains(t, retentionReportIDs(report), running)
+	require.NotContains(t, retentionReportIDs(report), recentFailure)
+}
+
+func TestComposeRetention(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	dir, err := ioutil.TempDir("", "weldr-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	api.compatOutputDir = dir
+
+	old := pushRetentionCompose(t, api, s, "test", 48*time.Hour, true, 42)
+	recent := pushRetentionCompose(t, api, s, "test", time.Hour, true, 42)
+	otherOld := pushRetentionCompose(t, api, s.Namespace("other"), "test", 48*time.Hour, true, 42)
+	api.SetRetentionPolicy(RetentionPolicy{MaxAge: 24 * time.Hour}, nil)
+
+	// the composes of other namespaces aren't reported, but are collected
+	require.Len(t, api.retentionReport(time.Now()).Composes, 2)
+
+	test.TestRoute(t, api, false, "GET", "/api/v0/compose/retention", ``, http.StatusNotFound, `{"status":false,"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/retention", ``, http.StatusOK,
+		`{"composes":[{"id":"`+old.String()+`","blueprint":"test","queue_status":"FINISHED","size":42,"reason":"max_age"}],"size":42}`, "job_finished")
+
+	// the report is a dry run
+	_, exists := s.GetCompose(old)
+	require.True(t, exists)
+
+	// collect garbage once
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	api.CollectGarbage(ctx, time.Hour)
+
+	_, exists = s.GetCompose(old)
+	require.False(t, exists)
+	_, exists = s.GetCompose(otherOld)
+	require.False(t, exists)
+	_, err = os.Stat(path.Join(dir, old.String()))
+	require.True(t, os.IsNotExist(err))
+
+	_, exists = s.GetCompose(recent)
+	require.True(t, exists)
+	_, err = os.Stat(path.Join(dir, recent.String()))
+	require.NoError(t, err)
+
+	var report retentionReport
+	response := test.SendHTTP(api, false, "GET", "/api/v1/compose/retention", ``)
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&report))
+	require.Empty(t, report.Composes)
+}
@@ -0,0 +1,131 @@
+package weldr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/sbom"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// sbomFormats maps the formats of bills of materials which can be requested
+// to the suffixes of their file names.
+var sbomFormats = map[string]string{
+	"spdx":      ".spdx.json",
+	"cyclonedx": ".cdx.json",
+}
+
+func sbomDocument(image *sbom.Image, format string) interface{} {
+	if format == "cyclonedx" {
+		return image.CycloneDX()
+	}
+	return image.SPDX()
+}
+
+// imageSBOM returns the description of the image built by `ib` of compose
+// `composeID`, from which its bills of materials are generated.
+func imageSBOM(composeID uuid.UUID, compose store.Compose, ib store.ImageBuild, status *composeStatus) *sbom.Image {
+	return &sbom.Image{
+		ID:       imageBuildName(composeID.String(), ib),
+		Name:     compose.Blueprint.Name,
+		Version:  compose.Blueprint.Version,
+		Distro:   ib.ImageType.Arch().Distro().Name(),
+		Created:  status.Finished,
+		Packages: sbom.ImagePackages(status.Result, ib.Packages),
+	}
+}
+
+// attachSBOMs stores the bills of materials of the image built by `ib` as
+// artifacts of its job, in all formats, so that they are kept next to the
+// image.
+func (api *API) attachSBOMs(composeID uuid.UUID, compose store.Compose, ib store.ImageBuild) error {
+	image := imageSBOM(composeID, compose, ib, api.getImageBuildStatus(ib))
+
+	for format, suffix := range sbomFormats {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(sbomDocument(image, format))
+		if err != nil {
+			return err
+		}
+
+		err = api.workers.AddArtifact(ib.JobID, "sbom"+suffix, &buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// composeSBOMHandler returns a bill of materials of the packages in an image
+// of a compose, in the format given by the "format" query parameter, which is
+// either "spdx" (the default) or "cyclonedx".
+func (api *API) composeSBOMHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 0) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	uuidString := params.ByName("uuid")
+	id, err := uuid.Parse(uuidString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid build uuid", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	compose, exists := ns.GetCompose(id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Compose %s doesn't exist", uuidString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		format = "spdx"
+	}
+	suffix, ok := sbomFormats[format]
+	if !ok {
+		errors := responseError{
+			ID:  "BadQuery",
+			Msg: "BadRequest: invalid value for 'format': must be one of spdx, cyclonedx",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	ib, ok := imageBuildParam(writer, request, compose)
+	if !ok {
+		return
+	}
+
+	imageBuildStatus := api.getComposeStatus(compose).ImageBuilds[ib.ID]
+	if imageBuildStatus.State != common.CFinished {
+		errors := responseError{
+			ID:  "BuildInWrongState",
+			Msg: fmt.Sprintf("Build %s is in wrong state: %s", uuidString, imageBuildStatus.State.ToString()),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	image := imageSBOM(id, compose, *ib, imageBuildStatus)
+
+	writer.Header().Set("Content-Disposition", "attachment; filename="+imageBuildName(id.String(), *ib)+"-sbom"+suffix)
+	err = json.NewEncoder(writer).Encode(sbomDocument(image, format))
+	common.PanicOnError(err)
+}
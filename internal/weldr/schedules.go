@@ -0,0 +1,566 @@
+package weldr
+
+import (
+	"context"
+	"encoding/json"
+	errors_package "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/composes"
+	"github.com/osbuild/osbuild-composer/internal/cron"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// scheduleChangeInterval is how often schedules without a cron expression
+// look for changes of the packages of their blueprint.
+const scheduleChangeInterval = 15 * time.Minute
+
+var (
+	// errScheduleUnchanged is returned when a schedule which only composes
+	// on changes found none.
+	errScheduleUnchanged = errors_package.New("the packages of the blueprint didn't change since the last compose")
+
+	// errScheduleBusy is returned when the last compose of a schedule is
+	// still running.
+	errScheduleBusy = errors_package.New("the last compose of the schedule is still running")
+)
+
+type scheduleResponse struct {
+	ID           uuid.UUID      `json:"id"`
+	Blueprint    string         `json:"blueprint_name"`
+	ComposeTypes []string       `json:"compose_types"`
+	Upload       *uploadRequest `json:"upload,omitempty"`
+	Cron         string         `json:"cron,omitempty"`
+	OnChange     bool           `json:"on_change"`
+	Created      float64        `json:"created"`
+	LastChecked  float64        `json:"last_checked,omitempty"`
+	LastCompose  *uuid.UUID     `json:"last_compose,omitempty"`
+	Next         float64        `json:"next,omitempty"`
+}
+
+func unixTime(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1000000000
+}
+
+// scheduleNext returns when `schedule` is due next, or the zero time if it
+// never is.
+func scheduleNext(schedule store.Schedule) time.Time {
+	last := schedule.LastChecked
+	if last.IsZero() {
+		last = schedule.Created
+	}
+
+	if schedule.Cron == "" {
+		if schedule.LastChecked.IsZero() {
+			return schedule.Created
+		}
+		return last.Add(scheduleChangeInterval)
+	}
+
+	c, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(last)
+}
+
+// RunSchedules runs the schedules which are due every `interval` until `ctx`
+// is canceled. The interval should be a minute, the resolution of cron
+// expressions.
+func (api *API) RunSchedules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		api.runDueSchedules(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueSchedules runs all schedules which are due at `now`.
+func (api *API) runDueSchedules(now time.Time) {
+	for _, schedule := range api.store.GetAllSchedules() {
+		next := scheduleNext(schedule)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+
+		composeID, err := api.runSchedule(schedule, now, false)
+		if api.logger == nil {
+			continue
+		}
+		switch err {
+		case nil:
+			api.logger.Printf("schedule %s started compose %s", schedule.ID, composeID)
+		case errScheduleUnchanged, errScheduleBusy:
+		default:
+			api.logger.Printf("cannot run schedule %s: %v", schedule.ID, err)
+		}
+	}
+}
+
+// runSchedule starts a compose of `schedule` at `now`, unless its last
+// compose is still running, or, for schedules which only compose on
+// changes, its packages didn't change. `force` composes regardless of
+// changes.
+func (api *API) runSchedule(schedule store.Schedule, now time.Time, force bool) (uuid.UUID, error) {
+	ns := api.store.Namespace(schedule.Namespace)
+
+	// a schedule which fails is not retried before it is due again
+	err := ns.SetScheduleRun(schedule.ID, now, uuid.Nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	last, hasLast := ns.GetCompose(schedule.LastCompose)
+	if hasLast && !composeDone(api.getComposeStatus(last)) {
+		return uuid.Nil, errScheduleBusy
+	}
+
+	bp := ns.GetBlueprintCommitted(schedule.Blueprint)
+	if bp == nil {
+		return uuid.Nil, fmt.Errorf("unknown blueprint: %s", schedule.Blueprint)
+	}
+
+	err = ns.CheckComposeQuota()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var imageTypes []distro.ImageType
+	for _, name := range schedule.ImageTypes {
+		imageType, err := api.arch.GetImageType(name)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("unknown compose type for architecture: %s", name)
+		}
+		imageTypes = append(imageTypes, imageType)
+	}
+
+	var upload *uploadRequest
+	if schedule.Upload != nil {
+		upload = &uploadRequest{}
+		err = json.Unmarshal(schedule.Upload, upload)
+		if err == nil {
+			err = resolveUploadProfile(ns, upload)
+		}
+		if err == nil {
+			err = checkUploadImageType(*upload, imageTypes[0])
+		}
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("invalid upload: %v", err)
+		}
+	}
+
+	composeID := uuid.New()
+	imageBuilds, err := api.scheduledImageBuilds(ns, composeID, bp, imageTypes, upload)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if schedule.OnChange && !force && hasLast && !composeChanged(last, bp, imageBuilds) {
+		return uuid.Nil, errScheduleUnchanged
+	}
+
+	err = composes.Push(api.workers, ns, composeID, bp, imageBuilds)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = ns.SetScheduleRun(schedule.ID, now, composeID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return composeID, nil
+}
+
+// scheduledImageBuilds depsolves `bp` for each of `imageTypes` and returns
+// the image builds of a compose of them, like the compose route does.
+func (api *API) scheduledImageBuilds(ns *store.Store, composeID uuid.UUID, bp *blueprint.Blueprint, imageTypes []distro.ImageType, upload *uploadRequest) ([]store.ImageBuild, error) {
+	repos := api.allRepositories(ns)
+	depsolve := api.newDepsolver(repos)
+
+	var options []imageBuildOptions
+	for _, imageType := range imageTypes {
+		specs, excludeSpecs := imageType.Packages(*bp)
+		packages, err := depsolve(specs, excludeSpecs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot depsolve blueprint: %v", err)
+		}
+
+		buildPackages, err := depsolve(imageType.BuildPackages(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot depsolve build packages: %v", err)
+		}
+
+		options = append(options, imageBuildOptions{
+			ImageType:     imageType,
+			Size:          imageType.Size(0),
+			Upload:        upload,
+			Packages:      packages,
+			BuildPackages: buildPackages,
+		})
+	}
+
+	return api.newImageBuilds(composeID, bp, repos, options)
+}
+
+// composeChanged returns whether a compose of `bp` from `imageBuilds` would
+// differ from compose `last`, because the blueprint changed, or the image
+// types or any of their packages differ.
+func composeChanged(last store.Compose, bp *blueprint.Blueprint, imageBuilds []store.ImageBuild) bool {
+	if last.Blueprint == nil || last.Blueprint.Version != bp.Version || len(last.ImageBuilds) != len(imageBuilds) {
+		return true
+	}
+
+	samePackages := func(a, b []rpmmd.PackageSpec) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		nevras := make(map[string]bool)
+		for _, pkg := range a {
+			nevras[pkg.GetNEVRA()] = true
+		}
+		for _, pkg := range b {
+			if !nevras[pkg.GetNEVRA()] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i, ib := range imageBuilds {
+		lastIB := last.ImageBuilds[i]
+		if lastIB.ImageType.Name() != ib.ImageType.Name() ||
+			!samePackages(lastIB.Packages, ib.Packages) ||
+			!samePackages(lastIB.BuildPackages, ib.BuildPackages) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newScheduleResponse(schedule store.Schedule) scheduleResponse {
+	response := scheduleResponse{
+		ID:           schedule.ID,
+		Blueprint:    schedule.Blueprint,
+		ComposeTypes: schedule.ImageTypes,
+		Cron:         schedule.Cron,
+		OnChange:     schedule.OnChange,
+		Created:      unixTime(schedule.Created),
+		LastChecked:  unixTime(schedule.LastChecked),
+		Next:         unixTime(scheduleNext(schedule)),
+	}
+
+	if schedule.LastCompose != uuid.Nil {
+		response.LastCompose = &schedule.LastCompose
+	}
+
+	// credentials are never returned
+	if schedule.Upload != nil {
+		var upload uploadRequest
+		if json.Unmarshal(schedule.Upload, &upload) == nil {
+			if upload.Settings != nil {
+				upload.Settings = upload.Settings.withoutSecrets()
+			}
+			response.Upload = &upload
+		}
+	}
+
+	return response
+}
+
+func (api *API) schedulesListHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	schedules := []scheduleResponse{}
+	for _, schedule := range ns.GetAllSchedules() {
+		schedules = append(schedules, newScheduleResponse(schedule))
+	}
+
+	reply := struct {
+		Schedules []scheduleResponse `json:"schedules"`
+	}{
+		Schedules: schedules,
+	}
+
+	err := json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) schedulesNewHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	var req struct {
+		BlueprintName string          `json:"blueprint_name"`
+		ComposeTypes  []string        `json:"compose_types"`
+		Upload        json.RawMessage `json:"upload"`
+		Cron          string          `json:"cron"`
+		OnChange      bool            `json:"on_change"`
+	}
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		errors := responseError{
+			ID:  "ScheduleError",
+			Msg: fmt.Sprintf("invalid schedule: %v", err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	if !verifyStringsWithRegex(writer, []string{req.BlueprintName}, ValidBlueprintName) {
+		return
+	}
+
+	if ns.GetBlueprintCommitted(req.BlueprintName) == nil {
+		errors := responseError{
+			ID:  "UnknownBlueprint",
+			Msg: fmt.Sprintf("Unknown blueprint name: %s", req.BlueprintName),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	if len(req.ComposeTypes) == 0 {
+		errors := responseError{
+			ID:  "ScheduleError",
+			Msg: "a schedule needs at least one compose type",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+	for _, composeType := range req.ComposeTypes {
+		_, err := api.arch.GetImageType(composeType)
+		if err != nil {
+			errors := responseError{
+				ID:  "UnknownComposeType",
+				Msg: fmt.Sprintf("Unknown compose type for architecture: %s", composeType),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	// the upload is stored as requested, so that profiles are resolved
+	// whenever the schedule runs
+	var upload json.RawMessage
+	if len(req.Upload) > 0 && string(req.Upload) != "null" {
+		if len(req.ComposeTypes) > 1 {
+			errors := responseError{
+				ID:  "UploadError",
+				Msg: "cannot upload the images of a schedule with several compose types",
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+
+		var u uploadRequest
+		err = json.Unmarshal(req.Upload, &u)
+		if err == nil {
+			err = resolveUploadProfile(ns, &u)
+		}
+		if err == nil {
+			imageType, _ := api.arch.GetImageType(req.ComposeTypes[0])
+			err = checkUploadImageType(u, imageType)
+		}
+		if err != nil {
+			errors := responseError{
+				ID:  "UploadError",
+				Msg: fmt.Sprintf("invalid upload: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+		upload = req.Upload
+	}
+
+	now := time.Now()
+	if req.Cron == "" && !req.OnChange {
+		errors := responseError{
+			ID:  "ScheduleError",
+			Msg: "a schedule needs a cron expression, on_change, or both",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+	if req.Cron != "" {
+		c, err := cron.Parse(req.Cron)
+		if err == nil && c.Next(now).IsZero() {
+			err = errors_package.New("cron expression is never due")
+		}
+		if err != nil {
+			errors := responseError{
+				ID:  "ScheduleError",
+				Msg: fmt.Sprintf("invalid cron expression: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	schedule := store.Schedule{
+		ID:         uuid.New(),
+		Blueprint:  req.BlueprintName,
+		ImageTypes: req.ComposeTypes,
+		Upload:     upload,
+		Cron:       req.Cron,
+		OnChange:   req.OnChange,
+		Created:    now,
+	}
+	ns.PushSchedule(schedule)
+
+	reply := struct {
+		Status bool      `json:"status"`
+		ID     uuid.UUID `json:"id"`
+	}{
+		Status: true,
+		ID:     schedule.ID,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+// scheduleParam returns the schedule named by the "id" parameter, or writes
+// an error response and returns false if it doesn't exist.
+func scheduleParam(writer http.ResponseWriter, ns *store.Store, params httprouter.Params) (store.Schedule, bool) {
+	idString := params.ByName("id")
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid schedule uuid", idString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return store.Schedule{}, false
+	}
+
+	schedule, exists := ns.GetSchedule(id)
+	if !exists {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Schedule %s doesn't exist", idString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return store.Schedule{}, false
+	}
+
+	return schedule, true
+}
+
+func (api *API) schedulesDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	schedule, ok := scheduleParam(writer, ns, params)
+	if !ok {
+		return
+	}
+
+	err := ns.DeleteSchedule(schedule.ID)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Schedule %s doesn't exist", schedule.ID),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	statusResponseOK(writer)
+}
+
+// schedulesRunHandler runs a schedule right away, for example from a hook
+// of a repository. Schedules which only compose on changes only compose
+// when something changed, unless the "force" query parameter is true.
+func (api *API) schedulesRunHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	ns := api.Namespace(request)
+
+	schedule, ok := scheduleParam(writer, ns, params)
+	if !ok {
+		return
+	}
+
+	force := false
+	if value := request.URL.Query().Get("force"); value != "" {
+		var err error
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			errors := responseError{
+				ID:  "BadQuery",
+				Msg: "BadRequest: invalid value for 'force': " + err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	reply := struct {
+		Status  bool       `json:"status"`
+		BuildID *uuid.UUID `json:"build_id,omitempty"`
+		Changed bool       `json:"changed"`
+	}{
+		Status: true,
+	}
+
+	composeID, err := api.runSchedule(schedule, time.Now(), force)
+	switch {
+	case err == errScheduleUnchanged:
+	case err == errScheduleBusy:
+		errors := responseError{
+			ID:  "BuildInWrongState",
+			Msg: fmt.Sprintf("Compose %s of schedule %s is still running", schedule.LastCompose, schedule.ID),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	case quotaExceeded(writer, err):
+		return
+	case err != nil:
+		errors := responseError{
+			ID:  "ScheduleError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	default:
+		reply.BuildID = &composeID
+		reply.Changed = true
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
@@ -0,0 +1,185 @@
+package weldr
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/test"
+)
+
+// updatingRPMMD depsolves to the packages of the wrapped RPMMD, with the
+// release of the first one replaced by `release`, to simulate an update in
+// the repositories.
+type updatingRPMMD struct {
+	rpmmd.RPMMD
+	release string
+}
+
+func (r *updatingRPMMD) Depsolve(specs, excludeSpecs []string, repos []rpmmd.RepoConfig, modulePlatformID, arch string) ([]rpmmd.PackageSpec, map[string]string, error) {
+	packages, checksums, err := r.RPMMD.Depsolve(specs, excludeSpecs, repos, modulePlatformID, arch)
+	if err != nil || r.release == "" || len(packages) == 0 {
+		return packages, checksums, err
+	}
+
+	updated := append([]rpmmd.PackageSpec(nil), packages...)
+	updated[0].Release = r.release
+	return updated, checksums, nil
+}
+
+func newScheduleID(t *testing.T, api *API, body string) uuid.UUID {
+	t.Helper()
+
+	response := test.SendHTTP(api, false, "POST", "/api/v1/schedules/new", body)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var reply struct {
+		ID uuid.UUID `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+	return reply.ID
+}
+
+func TestSchedulesNew(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/schedules/list", ``, http.StatusOK, `{"schedules":[]}`)
+
+	var cases = []struct {
+		Body string
+		JSON string
+	}{
+		{`{"blueprint_name":"missing","compose_types":["qcow2"],"on_change":true}`, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"Unknown blueprint name: missing"}]}`},
+		{`{"blueprint_name":"test","on_change":true}`, `{"status":false,"errors":[{"id":"ScheduleError","msg":"a schedule needs at least one compose type"}]}`},
+		{`{"blueprint_name":"test","compose_types":["floppy"],"on_change":true}`, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"Unknown compose type for architecture: floppy"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2"]}`, `{"status":false,"errors":[{"id":"ScheduleError","msg":"a schedule needs a cron expression, on_change, or both"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2"],"cron":"0 0 * *"}`, `{"status":false,"errors":[{"id":"ScheduleError","msg":"invalid cron expression: cron expression must have 5 fields, got 4"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2"],"cron":"0 0 30 feb *"}`, `{"status":false,"errors":[{"id":"ScheduleError","msg":"invalid cron expression: cron expression is never due"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2","qcow2"],"cron":"@daily","upload":{"provider":"aws","image_name":"img","profile":"default"}}`, `{"status":false,"errors":[{"id":"UploadError","msg":"cannot upload the images of a schedule with several compose types"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2"],"cron":"@daily","upload":{"provider":"aws","image_name":"img","profile":"default"}}`, `{"status":false,"errors":[{"id":"UploadError","msg":"invalid upload: Unknown aws profile: default"}]}`},
+		{`{"blueprint_name":"test","compose_types":["qcow2"],"cron":"@daily","upload":{"provider":"registry","image_name":"img","settings":{"registry":"registry.example.com","repository":"osbuild/test"}}}`, `{"status":false,"errors":[{"id":"UploadError","msg":"invalid upload: images of type qcow2 cannot be pushed to a container registry"}]}`},
+	}
+	for _, c := range cases {
+		test.TestRoute(t, api, false, "POST", "/api/v1/schedules/new", c.Body, http.StatusBadRequest, c.JSON)
+	}
+
+	id := newScheduleID(t, api, `{"blueprint_name":"test","compose_types":["qcow2"],"cron":"@daily","upload":{"provider":"aws","image_name":"img","settings":{"region":"eu-central-1","accessKeyID":"key","secretAccessKey":"secret","bucket":"b","key":"k"}}}`)
+
+	// credentials are not returned
+	test.TestRoute(t, api, false, "GET", "/api/v1/schedules/list", ``, http.StatusOK,
+		`{"schedules":[{"id":"`+id.String()+`","blueprint_name":"test","compose_types":["qcow2"],"upload":{"provider":"aws","image_name":"img","settings":{"region":"eu-central-1","bucket":"b","key":"k"}},"cron":"@daily","on_change":false}]}`,
+		"created", "next")
+
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/schedules/delete/"+id.String(), ``, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/schedules/delete/"+id.String(), ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Schedule `+id.String()+` doesn't exist"}]}`)
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/schedules/delete/foo", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"foo is not a valid schedule uuid"}]}`)
+}
+
+func TestScheduleNext(t *testing.T) {
+	created := time.Date(2020, time.July, 15, 10, 30, 0, 0, time.UTC)
+
+	schedule := store.Schedule{OnChange: true, Created: created}
+	require.Equal(t, created, scheduleNext(schedule))
+	schedule.LastChecked = created.Add(time.Hour)
+	require.Equal(t, created.Add(time.Hour+scheduleChangeInterval), scheduleNext(schedule))
+
+	schedule = store.Schedule{Cron: "0 4 * * *", Created: created}
+	require.Equal(t, time.Date(2020, time.July, 16, 4, 0, 0, 0, time.UTC), scheduleNext(schedule))
+	schedule.LastChecked = time.Date(2020, time.July, 16, 4, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2020, time.July, 17, 4, 0, 0, 0, time.UTC), scheduleNext(schedule))
+}
+
+func TestRunSchedules(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	repos := &updatingRPMMD{RPMMD: api.rpmmd}
+	api.rpmmd = repos
+
+	id := newScheduleID(t, api, `{"blueprint_name":"test","compose_types":["qcow2"],"on_change":true}`)
+	schedule, exists := s.GetSchedule(id)
+	require.True(t, exists)
+	now := schedule.Created
+
+	// the first run composes, because there is no compose to compare to
+	api.runDueSchedules(now)
+	require.Len(t, s.GetAllComposes(), 1)
+	first := onlyComposeID(t, s)
+	schedule, _ = s.GetSchedule(id)
+	require.Equal(t, first, schedule.LastCompose.String())
+
+	// not due yet
+	now = now.Add(time.Minute)
+	api.runDueSchedules(now)
+	schedule, _ = s.GetSchedule(id)
+	require.True(t, schedule.LastChecked.Before(now))
+
+	// while the last compose is running, nothing is composed
+	repos.release = "3.fc30"
+	now = now.Add(scheduleChangeInterval)
+	api.runDueSchedules(now)
+	require.Len(t, s.GetAllComposes(), 1)
+
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+
+	// nothing changed since the last compose
+	repos.release = ""
+	now = now.Add(scheduleChangeInterval)
+	api.runDueSchedules(now)
+	require.Len(t, s.GetAllComposes(), 1)
+	test.TestRoute(t, api, false, "POST", "/api/v1/schedules/run/"+id.String(), ``, http.StatusOK, `{"status":true,"changed":false}`)
+	require.Len(t, s.GetAllComposes(), 1)
+
+	// an update of a package composes again
+	repos.release = "3.fc30"
+	now = now.Add(scheduleChangeInterval)
+	api.runDueSchedules(now)
+	require.Len(t, s.GetAllComposes(), 2)
+	schedule, _ = s.GetSchedule(id)
+	compose, exists := s.GetCompose(schedule.LastCompose)
+	require.True(t, exists)
+	require.Equal(t, "3.fc30", compose.ImageBuilds[0].Packages[0].Release)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/schedules/run/"+id.String(), ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BuildInWrongState","msg":"Compose `+schedule.LastCompose.String()+` of schedule `+id.String()+` is still running"}]}`)
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+
+	// forced runs compose without changes
+	test.TestRoute(t, api, false, "POST", "/api/v1/schedules/run/"+id.String()+"?force=true", ``, http.StatusOK, `{"status":true,"changed":true}`, "build_id")
+	require.Len(t, s.GetAllComposes(), 3)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/schedules/run/"+id.String()+"?force=maybe", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BadQuery","msg":"BadRequest: invalid value for 'force': strconv.ParseBool: parsing \"maybe\": invalid syntax"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/schedules/run/42000000-0000-0000-0000-000000000000", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Schedule 42000000-0000-0000-0000-000000000000 doesn't exist"}]}`)
+}
+
+func TestRunCronSchedule(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	id := newScheduleID(t, api, `{"blueprint_name":"test","compose_types":["qcow2"],"cron":"@daily"}`)
+	schedule, _ := s.GetSchedule(id)
+	next := scheduleNext(schedule)
+
+	api.runDueSchedules(next.Add(-time.Minute))
+	require.Empty(t, s.GetAllComposes())
+
+	api.runDueSchedules(next)
+	require.Len(t, s.GetAllComposes(), 1)
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+
+	// without on_change, a schedule composes even when nothing changed
+	api.runDueSchedules(next.Add(time.Hour))
+	require.Len(t, s.GetAllComposes(), 1)
+	api.runDueSchedules(next.Add(24 * time.Hour))
+	require.Len(t, s.GetAllComposes(), 2)
+
+	// schedules of deleted blueprints fail without composing
+	require.NoError(t, s.DeleteBlueprint("test"))
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	api.runDueSchedules(next.Add(48 * time.Hour))
+	require.Len(t, s.GetAllComposes(), 2)
+	schedule, _ = s.GetSchedule(id)
+	require.Equal(t, next.Add(48*time.Hour), schedule.LastChecked)
+}
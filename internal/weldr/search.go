@@ -0,0 +1,343 @@
+package weldr
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// composeQuery holds the query parameters which filter, sort and page the
+// composes listed by compose/status, compose/finished and compose/failed:
+//
+//	?blueprint=<name>&type=<compose_type>&status=<compose_status>
+//	&upload_status=<upload_status>&since=<time>&until=<time>
+//	&sort=<id|created|started|finished|blueprint>&order=<asc|desc>
+//	&limit=<n>&cursor=<next_cursor>
+//
+// `since` and `until` restrict the time the compose was queued and accept
+// either RFC 3339 or seconds since the epoch, like the job_* fields of the
+// responses. Without a `limit`, all matching composes are returned.
+//
+// Only the first page can be requested when sorting by `started` or
+// `finished`, because these change while composes run and a cursor could
+// skip or repeat composes. For these no `next_cursor` is returned.
+type composeQuery struct {
+	Blueprint    string
+	ImageType    string
+	State        string
+	UploadStatus string
+	Since        time.Time
+	Until        time.Time
+
+	Sort       string
+	Descending bool
+	Cursor     string
+}
+
+var composeSortOrders = []string{"id", "created", "started", "finished", "blueprint"}
+
+// composeCursorSortOrders are the sort orders whose keys never change, so
+// that cursors are stable.
+var composeCursorSortOrders = []string{"id", "created", "blueprint"}
+
+func parseComposeQuery(query url.Values) (*composeQuery, error) {
+	q := &composeQuery{
+		Blueprint:    query.Get("blueprint"),
+		ImageType:    query.Get("type"),
+		State:        query.Get("status"),
+		UploadStatus: query.Get("upload_status"),
+		Sort:         "id",
+	}
+
+	var err error
+	if v := query.Get("since"); v != "" {
+		q.Since, err = parseQueryTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for 'since': %v", err)
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		q.Until, err = parseQueryTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for 'until': %v", err)
+		}
+	}
+
+	if v := query.Get("sort"); v != "" {
+		if !isStringInSlice(composeSortOrders, v) {
+			return nil, fmt.Errorf("invalid value for 'sort': must be one of %s", strings.Join(composeSortOrders, ", "))
+		}
+		q.Sort = v
+	}
+
+	q.Descending, err = parseOrder(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Cursor, err = parseCursor(query, q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if q.Cursor != "" && !q.pageable() {
+		return nil, fmt.Errorf("'cursor' cannot be used with sort order '%s', only with %s", q.Sort, strings.Join(composeCursorSortOrders, ", "))
+	}
+
+	return q, nil
+}
+
+// parseComposeLimit returns the value of the `limit` query parameter, or 0
+// when it isn't set.
+func parseComposeLimit(query url.Values) (uint, error) {
+	v := query.Get("limit")
+	if v == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid value for 'limit': " + err.Error())
+	}
+	return uint(limit), nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*1000000000)), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseOrder(query url.Values) (bool, error) {
+	switch query.Get("order") {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, errors.New("invalid value for 'order': must be 'asc' or 'desc'")
+	}
+}
+
+// Cursors are opaque to clients. They contain the sort order they were
+// created for and the sort key of the last returned item, so that a page
+// starts right after it even when items were added or removed in between.
+
+func encodeCursor(sortOrder, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortOrder + "\x00" + key))
+}
+
+func parseCursor(query url.Values, sortOrder string) (string, error) {
+	v := query.Get("cursor")
+	if v == "" {
+		return "", nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return "", errors.New("invalid value for 'cursor'")
+	}
+	parts := strings.SplitN(string(data), "\x00", 2)
+	if len(parts) != 2 {
+		return "", errors.New("invalid value for 'cursor'")
+	}
+	if parts[0] != sortOrder {
+		return "", fmt.Errorf("'cursor' was returned for sort order '%s', not '%s'", parts[0], sortOrder)
+	}
+	return parts[1], nil
+}
+
+// pageable returns whether cursors can be used with the sort order of `q`.
+func (q *composeQuery) pageable() bool {
+	return isStringInSlice(composeCursorSortOrders, q.Sort)
+}
+
+func (q *composeQuery) matches(compose store.Compose, status *composeStatus) bool {
+	if q.Blueprint != "" && compose.Blueprint.Name != q.Blueprint {
+		return false
+	}
+	if q.ImageType != "" && !hasImageType(compose, q.ImageType) {
+		return false
+	}
+	if q.State != "" && status.State.ToString() != q.State {
+		return false
+	}
+	if !q.Since.IsZero() && status.Queued.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && status.Queued.After(q.Until) {
+		return false
+	}
+	if q.UploadStatus != "" {
+		for _, t := range composeTargets(compose) {
+			if status.uploadState(t.Uuid).ToString() == q.UploadStatus {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sortKey returns a string which orders composes as requested by the `sort`
+// parameter when compared lexically. Ties are broken by the compose id.
+func (q *composeQuery) sortKey(id uuid.UUID, compose store.Compose, status *composeStatus) string {
+	switch q.Sort {
+	case "created":
+		return timeKey(status.Queued) + "\x00" + id.String()
+	case "started":
+		return timeKey(status.Started) + "\x00" + id.String()
+	case "finished":
+		return timeKey(status.Finished) + "\x00" + id.String()
+	case "blueprint":
+		return compose.Blueprint.Name + "\x00" + id.String()
+	default:
+		return id.String()
+	}
+}
+
+func timeKey(t time.Time) string {
+	if t.IsZero() {
+		return fmt.Sprintf("%020d", 0)
+	}
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// searchComposes returns the entries for those composes in `ids` which match
+// `q` and are in one of `states`, if any are given. Entries are sorted and
+// limited to one page. The returned cursor points to the next page, and is
+// empty if this is the last one or the sort order cannot be paged.
+func (api *API) searchComposes(composes map[uuid.UUID]store.Compose, ids []uuid.UUID, q *composeQuery, limit uint, includeUploads bool, states ...common.ComposeState) ([]*ComposeEntry, string) {
+	type result struct {
+		key   string
+		entry *ComposeEntry
+	}
+
+	var results []result
+	for _, id := range ids {
+		compose, exists := composes[id]
+		if !exists {
+			continue
+		}
+		status := api.getComposeStatus(compose)
+		if len(states) > 0 && !hasComposeState(status.State, states) {
+			continue
+		}
+		if !q.matches(compose, status) {
+			continue
+		}
+		key := q.sortKey(id, compose, status)
+		if q.Cursor != "" && (q.Descending && key >= q.Cursor || !q.Descending && key <= q.Cursor) {
+			continue
+		}
+		results = append(results, result{key, composeToComposeEntry(id, compose, status, includeUploads)})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if q.Descending {
+			return results[i].key > results[j].key
+		}
+		return results[i].key < results[j].key
+	})
+
+	var next string
+	if limit > 0 && uint(len(results)) > limit {
+		results = results[:limit]
+		if q.pageable() {
+			next = encodeCursor(q.Sort, results[limit-1].key)
+		}
+	}
+
+	entries := []*ComposeEntry{}
+	for _, r := range results {
+		entries = append(entries, r.entry)
+	}
+	return entries, next
+}
+
+func hasComposeState(state common.ComposeState, states []common.ComposeState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// blueprintQuery holds the query parameters which filter and page the
+// names listed by blueprints/list:
+//
+//	?name=<glob>&order=<asc|desc>&cursor=<next_cursor>&offset=<n>&limit=<n>
+//
+// The offset is counted from the cursor, if one is given.
+type blueprintQuery struct {
+	Name       string
+	Descending bool
+	Cursor     string
+}
+
+func parseBlueprintQuery(query url.Values) (*blueprintQuery, error) {
+	q := &blueprintQuery{
+		Name: query.Get("name"),
+	}
+
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return nil, fmt.Errorf("invalid value for 'name': %v", err)
+	}
+
+	var err error
+	q.Descending, err = parseOrder(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Cursor, err = parseCursor(query, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// filter returns the names in `names`, which must be sorted, that match `q`
+// in the requested order.
+func (q *blueprintQuery) filter(names []string) []string {
+	filtered := []string{}
+	for _, name := range names {
+		if q.Name != "" {
+			if ok, _ := path.Match(q.Name, name); !ok {
+				continue
+			}
+		}
+		if q.Cursor != "" && (q.Descending && name >= q.Cursor || !q.Descending && name <= q.Cursor) {
+			continue
+		}
+		filtered = append(filtered, name)
+	}
+
+	if q.Descending {
+		for i, j := 0, len(filtered)-1; i < j; i, j = i+1, j-1 {
+			filtered[i], filtered[j] = filtered[j], filtered[i]
+		}
+	}
+
+	return filtered
+}
+
+func isStringInSlice(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package weldr
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/osbuild/osbuild-composer/internal/common"
@@ -23,35 +24,112 @@ type uploadResponse struct {
 
 type uploadSettings interface {
 	isUploadSettings()
+
+	// withoutSecrets returns a copy of the settings which doesn't contain
+	// any credentials, so that it can be shown to users.
+	withoutSecrets() uploadSettings
 }
 
 type awsUploadSettings struct {
-	Region          string `json:"region"`
-	AccessKeyID     string `json:"accessKeyID,omitempty"`
-	SecretAccessKey string `json:"secretAccessKey,omitempty"`
-	Bucket          string `json:"bucket"`
-	Key             string `json:"key"`
+	Region            string            `json:"region"`
+	AccessKeyID       string            `json:"accessKeyID,omitempty"`
+	SecretAccessKey   string            `json:"secretAccessKey,omitempty"`
+	Bucket            string            `json:"bucket"`
+	Key               string            `json:"key"`
+	ShareWithAccounts []string          `json:"shareWithAccounts,omitempty"`
+	CopyToRegions     []string          `json:"copyToRegions,omitempty"`
+	Tags              map[string]string `json:"tags,omitempty"`
+	EnaSupport        *bool             `json:"enaSupport,omitempty"`
+	SriovNetSupport   bool              `json:"sriovNetSupport,omitempty"`
+	BootMode          string            `json:"bootMode,omitempty"`
+
+	// AMIs are set by composer once the image was registered and are
+	// ignored when scheduling an upload.
+	AMIs []awsUploadAMI `json:"amis,omitempty"`
+}
+
+type awsUploadAMI struct {
+	Region string `json:"region"`
+	AMI    string `json:"ami"`
 }
 
 func (awsUploadSettings) isUploadSettings() {}
 
+func (s awsUploadSettings) withoutSecrets() uploadSettings {
+	s.AccessKeyID = ""
+	s.SecretAccessKey = ""
+	return &s
+}
+
 type azureUploadSettings struct {
-	StorageAccount   string `json:"storageAccount,omitempty"`
-	StorageAccessKey string `json:"storageAccessKey,omitempty"`
-	Container        string `json:"container"`
+	StorageAccount      string `json:"storageAccount,omitempty"`
+	StorageAccessKey    string `json:"storageAccessKey,omitempty"`
+	Container           string `json:"container"`
+	TenantID            string `json:"tenantID,omitempty"`
+	ClientID            string `json:"clientID,omitempty"`
+	ClientSecret        string `json:"clientSecret,omitempty"`
+	SubscriptionID      string `json:"subscriptionID,omitempty"`
+	ResourceGroup       string `json:"resourceGroup,omitempty"`
+	Location            string `json:"location,omitempty"`
+	HyperVGeneration    string `json:"hyperVGeneration,omitempty"`
+	Gallery             string `json:"gallery,omitempty"`
+	GalleryImage        string `json:"galleryImage,omitempty"`
+	GalleryImageVersion string `json:"galleryImageVersion,omitempty"`
+
+	// BlobURL, ImageID and GalleryImageVersionID are set by composer once
+	// the resources were created and are ignored when scheduling an upload.
+	BlobURL               string `json:"blobURL,omitempty"`
+	ImageID               string `json:"imageID,omitempty"`
+	GalleryImageVersionID string `json:"galleryImageVersionID,omitempty"`
 }
 
 func (azureUploadSettings) isUploadSettings() {}
 
+func (s azureUploadSettings) withoutSecrets() uploadSettings {
+	s.StorageAccount = ""
+	s.StorageAccessKey = ""
+	s.TenantID = ""
+	s.ClientID = ""
+	s.ClientSecret = ""
+	return &s
+}
+
+type registryUploadSettings struct {
+	Registry   string   `json:"registry"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+	TLSVerify  *bool    `json:"tls_verify,omitempty"`
+
+	// Digest is set by composer once the image was pushed and is ignored
+	// when scheduling an upload.
+	Digest string `json:"digest,omitempty"`
+}
+
+func (registryUploadSettings) isUploadSettings() {}
+
+func (s registryUploadSettings) withoutSecrets() uploadSettings {
+	s.Username = ""
+	s.Password = ""
+	return &s
+}
+
+// uploadRequest describes an upload in requests to `compose` and
+// `compose/uploads/schedule`. Instead of passing all settings, a request may
+// refer to a provider profile saved with `upload/providers/save`. Settings
+// are nil until the profile has been resolved in that case.
 type uploadRequest struct {
 	Provider  string         `json:"provider"`
 	ImageName string         `json:"image_name"`
+	Profile   string         `json:"profile,omitempty"`
 	Settings  uploadSettings `json:"settings"`
 }
 
 type rawUploadRequest struct {
 	Provider  string          `json:"provider"`
 	ImageName string          `json:"image_name"`
+	Profile   string          `json:"profile,omitempty"`
 	Settings  json.RawMessage `json:"settings"`
 }
 
@@ -63,35 +141,101 @@ func (u *uploadRequest) UnmarshalJSON(data []byte) error {
 	}
 
 	var settings uploadSettings
-	switch rawUploadRequest.Provider {
+	if len(rawUploadRequest.Settings) == 0 || string(rawUploadRequest.Settings) == "null" {
+		if rawUploadRequest.Profile == "" {
+			return errors.New("either settings or a profile are required")
+		}
+		if !isValidProvider(rawUploadRequest.Provider) {
+			return errors.New("unexpected provider name")
+		}
+	} else {
+		settings, err = unmarshalUploadSettings(rawUploadRequest.Provider, rawUploadRequest.Settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.Provider = rawUploadRequest.Provider
+	u.ImageName = rawUploadRequest.ImageName
+	u.Profile = rawUploadRequest.Profile
+	u.Settings = settings
+
+	return nil
+}
+
+func isValidProvider(provider string) bool {
+	switch provider {
+	case "aws", "azure", "registry":
+		return true
+	}
+	return false
+}
+
+// checkUploadImageType returns an error if images of `imageType` cannot be
+// uploaded as requested by `u`. Container registries only accept container
+// images, pushing anything else would only fail after the image was built.
+func checkUploadImageType(u uploadRequest, imageType distro.ImageType) error {
+	if u.Provider == "registry" && imageType.Name() != "container" {
+		return fmt.Errorf("images of type %s cannot be pushed to a container registry", imageType.Name())
+	}
+	return nil
+}
+
+// unmarshalUploadSettings parses and validates the settings of an upload to
+// `provider`.
+func unmarshalUploadSettings(provider string, data json.RawMessage) (uploadSettings, error) {
+	var settings uploadSettings
+	switch provider {
 	case "azure":
 		settings = new(azureUploadSettings)
 	case "aws":
 		settings = new(awsUploadSettings)
+	case "registry":
+		settings = new(registryUploadSettings)
 	default:
-		return errors.New("unexpected provider name")
+		return nil, errors.New("unexpected provider name")
 	}
-	err = json.Unmarshal(rawUploadRequest.Settings, settings)
+	err := json.Unmarshal(data, settings)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	u.Provider = rawUploadRequest.Provider
-	u.ImageName = rawUploadRequest.ImageName
-	u.Settings = settings
+	switch s := settings.(type) {
+	case *awsUploadSettings:
+		switch s.BootMode {
+		case "", "legacy-bios", "uefi":
+		default:
+			return nil, fmt.Errorf("unexpected boot mode: %s", s.BootMode)
+		}
+	case *azureUploadSettings:
+		if s.ResourceGroup != "" && s.Location == "" {
+			return nil, errors.New("location is required to create a managed image")
+		}
+		if s.Gallery != "" && (s.ResourceGroup == "" || s.GalleryImage == "" || s.GalleryImageVersion == "") {
+			return nil, errors.New("resourceGroup, galleryImage and galleryImageVersion are required to create a gallery image version")
+		}
+		switch s.HyperVGeneration {
+		case "", "V1", "V2":
+		default:
+			return nil, fmt.Errorf("unexpected hyper-v generation: %s", s.HyperVGeneration)
+		}
+	}
 
-	return err
+	return settings, nil
 }
 
 // Converts a `Target` to a serializable `uploadResponse`.
 //
 // This ignore the status in `targets`, because that's never set correctly.
 // Instead, it sets each target's status to the ImageBuildState equivalent of
-// `state`.
+// the state of its upload in `status`.
 //
 // This also ignores any sensitive data passed into targets. Access keys may
 // be passed as input to composer, but should not be possible to be queried.
-func targetsToUploadResponses(targets []*target.Target, state common.ComposeState) []uploadResponse {
+//
+// The target results in `status` are matched to targets by their UUID.
+func targetsToUploadResponses(targets []*target.Target, status *composeStatus) []uploadResponse {
+	results := status.TargetResults
 	var uploads []uploadResponse
 	for _, t := range targets {
 		upload := uploadResponse{
@@ -100,7 +244,7 @@ func targetsToUploadResponses(targets []*target.Target, state common.ComposeStat
 			CreationTime: float64(t.Created.UnixNano()) / 1000000000,
 		}
 
-		switch state {
+		switch status.uploadState(t.Uuid) {
 		case common.CWaiting:
 			upload.Status = common.IBWaiting
 		case common.CRunning:
@@ -114,19 +258,76 @@ func targetsToUploadResponses(targets []*target.Target, state common.ComposeStat
 		switch options := t.Options.(type) {
 		case *target.AWSTargetOptions:
 			upload.ProviderName = "aws"
-			upload.Settings = &awsUploadSettings{
-				Region: options.Region,
-				Bucket: options.Bucket,
-				Key:    options.Key,
+			settings := &awsUploadSettings{
+				Region:            options.Region,
+				Bucket:            options.Bucket,
+				Key:               options.Key,
+				ShareWithAccounts: options.ShareWithAccounts,
+				CopyToRegions:     options.CopyToRegions,
+				Tags:              options.Tags,
+				EnaSupport:        options.EnaSupport,
+				SriovNetSupport:   options.SriovNetSupport,
+				BootMode:          options.BootMode,
 				// AccessKeyID and SecretAccessKey are intentionally not included.
 			}
+			for _, result := range results {
+				if result.TargetUuid != t.Uuid {
+					continue
+				}
+				if resultOptions, ok := result.Options.(*target.AWSTargetResultOptions); ok {
+					for _, ami := range resultOptions.AMIs {
+						settings.AMIs = append(settings.AMIs, awsUploadAMI{
+							Region: ami.Region,
+							AMI:    ami.AMI,
+						})
+					}
+				}
+			}
+			upload.Settings = settings
 			uploads = append(uploads, upload)
 		case *target.AzureTargetOptions:
 			upload.ProviderName = "azure"
-			upload.Settings = &azureUploadSettings{
-				Container: options.Container,
-				// StorageAccount and StorageAccessKey are intentionally not included.
+			settings := &azureUploadSettings{
+				Container:           options.Container,
+				SubscriptionID:      options.SubscriptionID,
+				ResourceGroup:       options.ResourceGroup,
+				Location:            options.Location,
+				Gallery:             options.Gallery,
+				GalleryImage:        options.GalleryImage,
+				GalleryImageVersion: options.GalleryImageVersion,
+				// StorageAccount, StorageAccessKey, and the credentials
+				// of the service principal are intentionally not included.
+			}
+			for _, result := range results {
+				if result.TargetUuid != t.Uuid {
+					continue
+				}
+				if resultOptions, ok := result.Options.(*target.AzureTargetResultOptions); ok {
+					settings.BlobURL = resultOptions.BlobURL
+					settings.ImageID = resultOptions.ImageID
+					settings.GalleryImageVersionID = resultOptions.GalleryImageVersionID
+				}
+			}
+			upload.Settings = settings
+			uploads = append(uploads, upload)
+		case *target.RegistryTargetOptions:
+			upload.ProviderName = "registry"
+			settings := &registryUploadSettings{
+				Registry:   options.Registry,
+				Repository: options.Repository,
+				Tags:       options.Tags,
+				TLSVerify:  options.TLSVerify,
+				// Username and Password are intentionally not included.
+			}
+			for _, result := range results {
+				if result.TargetUuid != t.Uuid {
+					continue
+				}
+				if resultOptions, ok := result.Options.(*target.RegistryTargetResultOptions); ok {
+					settings.Digest = resultOptions.Digest
+				}
 			}
+			upload.Settings = settings
 			uploads = append(uploads, upload)
 		}
 	}
@@ -146,20 +347,48 @@ func uploadRequestToTarget(u uploadRequest, imageType distro.ImageType) *target.
 	case *awsUploadSettings:
 		t.Name = "org.osbuild.aws"
 		t.Options = &target.AWSTargetOptions{
-			Filename:        imageType.Filename(),
-			Region:          options.Region,
-			AccessKeyID:     options.AccessKeyID,
-			SecretAccessKey: options.SecretAccessKey,
-			Bucket:          options.Bucket,
-			Key:             options.Key,
+			Filename:          imageType.Filename(),
+			Region:            options.Region,
+			AccessKeyID:       options.AccessKeyID,
+			SecretAccessKey:   options.SecretAccessKey,
+			Bucket:            options.Bucket,
+			Key:               options.Key,
+			ShareWithAccounts: options.ShareWithAccounts,
+			CopyToRegions:     options.CopyToRegions,
+			Tags:              options.Tags,
+			EnaSupport:        options.EnaSupport,
+			SriovNetSupport:   options.SriovNetSupport,
+			BootMode:          options.BootMode,
+			Architecture:      imageType.Arch().Name(),
 		}
 	case *azureUploadSettings:
 		t.Name = "org.osbuild.azure"
 		t.Options = &target.AzureTargetOptions{
-			Filename:         imageType.Filename(),
-			StorageAccount:   options.StorageAccount,
-			StorageAccessKey: options.StorageAccessKey,
-			Container:        options.Container,
+			Filename:            imageType.Filename(),
+			StorageAccount:      options.StorageAccount,
+			StorageAccessKey:    options.StorageAccessKey,
+			Container:           options.Container,
+			TenantID:            options.TenantID,
+			ClientID:            options.ClientID,
+			ClientSecret:        options.ClientSecret,
+			SubscriptionID:      options.SubscriptionID,
+			ResourceGroup:       options.ResourceGroup,
+			Location:            options.Location,
+			HyperVGeneration:    options.HyperVGeneration,
+			Gallery:             options.Gallery,
+			GalleryImage:        options.GalleryImage,
+			GalleryImageVersion: options.GalleryImageVersion,
+		}
+	case *registryUploadSettings:
+		t.Name = "org.osbuild.registry"
+		t.Options = &target.RegistryTargetOptions{
+			Filename:   imageType.Filename(),
+			Registry:   options.Registry,
+			Repository: options.Repository,
+			Tags:       options.Tags,
+			Username:   options.Username,
+			Password:   options.Password,
+			TLSVerify:  options.TLSVerify,
 		}
 	}
 
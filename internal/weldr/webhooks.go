@@ -0,0 +1,206 @@
+package weldr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// Webhooks are notified about these event types. Filters may also name a
+// type and a state, like "compose.FINISHED".
+var webhookEventTypes = []string{"compose", "upload"}
+
+type webhookResponse struct {
+	ID     uuid.UUID `json:"id"`
+	URL    string    `json:"url"`
+	Events []string  `json:"events"`
+}
+
+func validWebhookEvent(filter string) bool {
+	parts := strings.SplitN(filter, ".", 2)
+
+	valid := false
+	for _, t := range webhookEventTypes {
+		if parts[0] == t {
+			valid = true
+		}
+	}
+	if !valid || len(parts) == 1 {
+		return valid
+	}
+
+	var state common.ComposeState
+	return state.UnmarshalJSON([]byte(`"`+parts[1]+`"`)) == nil
+}
+
+// webhookWantsEvent returns whether `webhook` subscribed to events of type
+// `eventType` about something which is in `state` now. `state` is nil for
+// deleted composes.
+func webhookWantsEvent(webhook store.Webhook, eventType string, state *common.ComposeState) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+
+	for _, filter := range webhook.Events {
+		if filter == eventType {
+			return true
+		}
+		if state != nil && filter == eventType+"."+state.ToString() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifyWebhooks sends compose and upload events to all webhooks of the
+// event's namespace which subscribed to them.
+func (api *API) notifyWebhooks(e event) {
+	var state *common.ComposeState
+	switch data := e.Data.(type) {
+	case composeEvent:
+		state = data.State
+	case uploadEvent:
+		state = &data.State
+	default:
+		return
+	}
+
+	for _, webhook := range api.store.Namespace(e.Namespace).GetAllWebhooks() {
+		if !webhookWantsEvent(webhook, e.Type, state) {
+			continue
+		}
+
+		err := api.webhooks.Send(webhook.URL, webhook.Secret, e.Type, e.Data)
+		if err != nil && api.logger != nil {
+			api.logger.Printf("cannot notify webhook %s: %v", webhook.ID, err)
+		}
+	}
+}
+
+func (api *API) webhooksListHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	// secrets are never returned
+	webhooks := []webhookResponse{}
+	for _, webhook := range api.Namespace(request).GetAllWebhooks() {
+		events := webhook.Events
+		if events == nil {
+			events = []string{}
+		}
+		webhooks = append(webhooks, webhookResponse{
+			ID:     webhook.ID,
+			URL:    webhook.URL,
+			Events: events,
+		})
+	}
+
+	reply := struct {
+		Webhooks []webhookResponse `json:"webhooks"`
+	}{
+		Webhooks: webhooks,
+	}
+
+	err := json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) webhooksNewHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		errors := responseError{
+			ID:  "WebhookError",
+			Msg: fmt.Sprintf("invalid webhook: %v", err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errors := responseError{
+			ID:  "WebhookError",
+			Msg: fmt.Sprintf("invalid webhook url: %s", req.URL),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	for _, filter := range req.Events {
+		if !validWebhookEvent(filter) {
+			errors := responseError{
+				ID:  "WebhookError",
+				Msg: fmt.Sprintf("invalid webhook event: %s", filter),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
+	webhook := store.Webhook{
+		ID:     uuid.New(),
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+	}
+	api.Namespace(request).PushWebhook(webhook)
+
+	reply := struct {
+		Status bool      `json:"status"`
+		ID     uuid.UUID `json:"id"`
+	}{
+		Status: true,
+		ID:     webhook.ID,
+	}
+
+	err = json.NewEncoder(writer).Encode(reply)
+	common.PanicOnError(err)
+}
+
+func (api *API) webhooksDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	idString := params.ByName("id")
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("%s is not a valid webhook uuid", idString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err = api.Namespace(request).DeleteWebhook(id)
+	if err != nil {
+		errors := responseError{
+			ID:  "UnknownUUID",
+			Msg: fmt.Sprintf("Webhook %s doesn't exist", idString),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	statusResponseOK(writer)
+}
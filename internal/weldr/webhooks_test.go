@@ -0,0 +1,146 @@
+package weldr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/test"
+	"github.com/osbuild/osbuild-composer/internal/webhook"
+)
+
+func TestWebhooks(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	var mu sync.Mutex
+	var received []string
+	listener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.True(t, webhook.Verify("secret", body, r.Header.Get(webhook.SignatureHeader)))
+
+		var notification struct {
+			Event string `json:"event"`
+			Data  struct {
+				State string `json:"state"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &notification))
+		require.Equal(t, notification.Event, r.Header.Get(webhook.EventHeader))
+
+		mu.Lock()
+		received = append(received, notification.Event+"."+notification.Data.State)
+		mu.Unlock()
+	}))
+	defer listener.Close()
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/webhooks/new", `{"url":"ftp://example.com"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"WebhookError","msg":"invalid webhook url: ftp://example.com"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/webhooks/new", `{"url":"`+listener.URL+`","events":["compose.DONE"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"WebhookError","msg":"invalid webhook event: compose.DONE"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/webhooks/new", `{"url":"`+listener.URL+`","secret":"secret","events":["compose.FINISHED","upload"]}`, http.StatusOK, `{"status":true}`, "id")
+
+	webhooks := api.store.GetAllWebhooks()
+	require.Len(t, webhooks, 1)
+	id := webhooks[0].ID.String()
+
+	// secrets are never returned
+	test.TestRoute(t, api, false, "GET", "/api/v1/webhooks/list", ``, http.StatusOK, `{"webhooks":[{"id":"`+id+`","url":"`+listener.URL+`","events":["compose.FINISHED","upload"]}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name": "test","compose_type":"qcow2","branch":"master","upload":{"image_name":"test_upload","provider":"aws","settings":{"region":"eu-central-1","bucket":"clay","key":"imagekey"}}}`, http.StatusOK, `{"status": true}`, "build_id")
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	api.webhooks.Wait()
+
+	mu.Lock()
+	sort.Strings(received)
+	require.Equal(t, []string{"compose.FINISHED", "upload.WAITING"}, received)
+	received = nil
+	mu.Unlock()
+
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/webhooks/delete/"+id, ``, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "DELETE", "/api/v1/webhooks/delete/"+id, ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownUUID","msg":"Webhook `+id+` doesn't exist"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/webhooks/list", ``, http.StatusOK, `{"webhooks":[]}`)
+
+	// deleted webhooks aren't notified anymore
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	api.webhooks.Wait()
+	require.Empty(t, received)
+}
+
+func TestWebhookNamespaces(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	var mu sync.Mutex
+	var received []string
+	listener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get(webhook.EventHeader))
+		mu.Unlock()
+	}))
+	defer listener.Close()
+
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	api.SetAuthenticators(&TokenAuthenticator{
+		Tokens: []Token{
+			{Name: "a", Token: "token-a", Role: RoleAdmin, Namespace: "team-a"},
+			{Name: "b", Token: "token-b", Role: RoleAdmin, Namespace: "team-b"},
+		},
+	})
+
+	body := func(resp *http.Response) string {
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	resp := sendWithToken(api, "POST", "/api/v1/webhooks/new", `{"url":"`+listener.URL+`","events":["compose.FINISHED"]}`, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	webhooks := api.store.GetAllWebhooks()
+	require.Len(t, webhooks, 1)
+	require.Equal(t, "team-a", webhooks[0].Namespace)
+	id := webhooks[0].ID.String()
+
+	// other namespaces can neither see nor delete the webhook
+	resp = sendWithToken(api, "GET", "/api/v1/webhooks/list", "", "token-b")
+	require.JSONEq(t, `{"webhooks":[]}`, body(resp))
+	resp = sendWithToken(api, "DELETE", "/api/v1/webhooks/delete/"+id, "", "token-b")
+	require.Contains(t, body(resp), "UnknownUUID")
+	resp = sendWithToken(api, "GET", "/api/v1/webhooks/list", "", "token-a")
+	require.Contains(t, body(resp), id)
+
+	for _, team := range []string{"a", "b"} {
+		bp := `{"name":"test","description":"","version":"0.0.1","packages":[],"modules":[],"groups":[]}`
+		resp = sendWithToken(api, "POST", "/api/v0/blueprints/new", bp, "token-"+team)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	compose := `{"blueprint_name":"test","compose_type":"qcow2","branch":"master"}`
+
+	// events of other namespaces aren't sent to the webhook
+	resp = sendWithToken(api, "POST", "/api/v1/compose", compose, "token-b")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	api.webhooks.Wait()
+	mu.Lock()
+	require.Empty(t, received)
+	mu.Unlock()
+
+	resp = sendWithToken(api, "POST", "/api/v1/compose", compose, "token-a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	finishNextJob(t, api, `{"status":"FINISHED","result":{"success":true}}`)
+	api.webhooks.Wait()
+	mu.Lock()
+	require.Equal(t, []string{"compose"}, received)
+	mu.Unlock()
+}
@@ -22,8 +22,9 @@ type PostJobQueueV1JobsJSONBody map[string]interface{}
 
 // PatchJobQueueV1JobsJobIdJSONBody defines parameters for PatchJobQueueV1JobsJobId.
 type PatchJobQueueV1JobsJobIdJSONBody struct {
-	Result interface{} `json:"result"`
-	Status string      `json:"status"`
+	Result        interface{}    `json:"result"`
+	Status        string         `json:"status"`
+	TargetResults *[]interface{} `json:"target_results,omitempty"`
 }
 
 // PostJobQueueV1JobsRequestBody defines body for PostJobQueueV1Jobs for application/json ContentType.
@@ -116,6 +117,9 @@ type ClientInterface interface {
 
 	PatchJobQueueV1JobsJobId(ctx context.Context, jobId string, body PatchJobQueueV1JobsJobIdJSONRequestBody) (*http.Response, error)
 
+	// GetJobQueueV1JobsJobIdArtifactsName request
+	GetJobQueueV1JobsJobIdArtifactsName(ctx context.Context, jobId string, name string) (*http.Response, error)
+
 	// PostJobQueueV1JobsJobIdArtifactsName request  with any body
 	PostJobQueueV1JobsJobIdArtifactsNameWithBody(ctx context.Context, jobId string, name string, contentType string, body io.Reader) (*http.Response, error)
 
@@ -198,6 +202,21 @@ func (c *Client) PatchJobQueueV1JobsJobId(ctx context.Context, jobId string, bod
 	return c.Client.Do(req)
 }
 
+func (c *Client) GetJobQueueV1JobsJobIdArtifactsName(ctx context.Context, jobId string, name string) (*http.Response, error) {
+	req, err := NewGetJobQueueV1JobsJobIdArtifactsNameRequest(c.Server, jobId, name)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.RequestEditor != nil {
+		err = c.RequestEditor(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) PostJobQueueV1JobsJobIdArtifactsNameWithBody(ctx context.Context, jobId string, name string, contentType string, body io.Reader) (*http.Response, error) {
 	req, err := NewPostJobQueueV1JobsJobIdArtifactsNameRequestWithBody(c.Server, jobId, name, contentType, body)
 	if err != nil {
@@ -347,6 +366,47 @@ func NewPatchJobQueueV1JobsJobIdRequestWithBody(server string, jobId string, con
 	return req, nil
 }
 
+// NewGetJobQueueV1JobsJobIdArtifactsNameRequest generates requests for GetJobQueueV1JobsJobIdArtifactsName
+func NewGetJobQueueV1JobsJobIdArtifactsNameRequest(server string, jobId string, name string) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParam("simple", false, "job_id", jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pathParam1 string
+
+	pathParam1, err = runtime.StyleParam("simple", false, "name", name)
+	if err != nil {
+		return nil, err
+	}
+
+	queryUrl, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := fmt.Sprintf("/job-queue/v1/jobs/%s/artifacts/%s", pathParam0, pathParam1)
+	if basePath[0] == '/' {
+		basePath = basePath[1:]
+	}
+
+	queryUrl, err = queryUrl.Parse(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewPostJobQueueV1JobsJobIdArtifactsNameRequestWithBody generates requests for PostJobQueueV1JobsJobIdArtifactsName with any type of body
 func NewPostJobQueueV1JobsJobIdArtifactsNameRequestWithBody(server string, jobId string, name string, contentType string, body io.Reader) (*http.Request, error) {
 	var err error
@@ -458,6 +518,9 @@ type ClientWithResponsesInterface interface {
 
 	PatchJobQueueV1JobsJobIdWithResponse(ctx context.Context, jobId string, body PatchJobQueueV1JobsJobIdJSONRequestBody) (*PatchJobQueueV1JobsJobIdResponse, error)
 
+	// GetJobQueueV1JobsJobIdArtifactsName request
+	GetJobQueueV1JobsJobIdArtifactsNameWithResponse(ctx context.Context, jobId string, name string) (*GetJobQueueV1JobsJobIdArtifactsNameResponse, error)
+
 	// PostJobQueueV1JobsJobIdArtifactsName request  with any body
 	PostJobQueueV1JobsJobIdArtifactsNameWithBodyWithResponse(ctx context.Context, jobId string, name string, contentType string, body io.Reader) (*PostJobQueueV1JobsJobIdArtifactsNameResponse, error)
 
@@ -469,9 +532,12 @@ type PostJobQueueV1JobsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
 	JSON200      *struct {
-		Id       string        `json:"id"`
-		Manifest interface{}   `json:"manifest"`
-		Targets  []interface{} `json:"targets"`
+		Filename   *string       `json:"filename,omitempty"`
+		Id         string        `json:"id"`
+		ImageJobId *string       `json:"image_job_id,omitempty"`
+		Manifest   interface{}   `json:"manifest"`
+		Targets    []interface{} `json:"targets"`
+		Type       *string       `json:"type,omitempty"`
 	}
 }
 
@@ -537,6 +603,27 @@ func (r PatchJobQueueV1JobsJobIdResponse) StatusCode() int {
 	return 0
 }
 
+type GetJobQueueV1JobsJobIdArtifactsNameResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+}
+
+// Status returns HTTPResponse.Status
+func (r GetJobQueueV1JobsJobIdArtifactsNameResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetJobQueueV1JobsJobIdArtifactsNameResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 type PostJobQueueV1JobsJobIdArtifactsNameResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
@@ -625,6 +712,15 @@ func (c *ClientWithResponses) PatchJobQueueV1JobsJobIdWithResponse(ctx context.C
 	return ParsePatchJobQueueV1JobsJobIdResponse(rsp)
 }
 
+// GetJobQueueV1JobsJobIdArtifactsNameWithResponse request returning *GetJobQueueV1JobsJobIdArtifactsNameResponse
+func (c *ClientWithResponses) GetJobQueueV1JobsJobIdArtifactsNameWithResponse(ctx context.Context, jobId string, name string) (*GetJobQueueV1JobsJobIdArtifactsNameResponse, error) {
+	rsp, err := c.GetJobQueueV1JobsJobIdArtifactsName(ctx, jobId, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetJobQueueV1JobsJobIdArtifactsNameResponse(rsp)
+}
+
 // PostJobQueueV1JobsJobIdArtifactsNameWithBodyWithResponse request with arbitrary body returning *PostJobQueueV1JobsJobIdArtifactsNameResponse
 func (c *ClientWithResponses) PostJobQueueV1JobsJobIdArtifactsNameWithBodyWithResponse(ctx context.Context, jobId string, name string, contentType string, body io.Reader) (*PostJobQueueV1JobsJobIdArtifactsNameResponse, error) {
 	rsp, err := c.PostJobQueueV1JobsJobIdArtifactsNameWithBody(ctx, jobId, name, contentType, body)
@@ -659,9 +755,12 @@ func ParsePostJobQueueV1JobsResponse(rsp *http.Response) (*PostJobQueueV1JobsRes
 	switch {
 	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
 		var dest struct {
-			Id       string        `json:"id"`
-			Manifest interface{}   `json:"manifest"`
-			Targets  []interface{} `json:"targets"`
+			Filename   *string       `json:"filename,omitempty"`
+			Id         string        `json:"id"`
+			ImageJobId *string       `json:"image_job_id,omitempty"`
+			Manifest   interface{}   `json:"manifest"`
+			Targets    []interface{} `json:"targets"`
+			Type       *string       `json:"type,omitempty"`
 		}
 		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
 			return nil, err
@@ -721,6 +820,25 @@ func ParsePatchJobQueueV1JobsJobIdResponse(rsp *http.Response) (*PatchJobQueueV1
 	return response, nil
 }
 
+// ParseGetJobQueueV1JobsJobIdArtifactsNameResponse parses an HTTP response from a GetJobQueueV1JobsJobIdArtifactsNameWithResponse call
+func ParseGetJobQueueV1JobsJobIdArtifactsNameResponse(rsp *http.Response) (*GetJobQueueV1JobsJobIdArtifactsNameResponse, error) {
+	bodyBytes, err := ioutil.ReadAll(rsp.Body)
+	defer rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetJobQueueV1JobsJobIdArtifactsNameResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	}
+
+	return response, nil
+}
+
 // ParsePostJobQueueV1JobsJobIdArtifactsNameResponse parses an HTTP response from a PostJobQueueV1JobsJobIdArtifactsNameWithResponse call
 func ParsePostJobQueueV1JobsJobIdArtifactsNameResponse(rsp *http.Response) (*PostJobQueueV1JobsJobIdArtifactsNameResponse, error) {
 	bodyBytes, err := ioutil.ReadAll(rsp.Body)
@@ -779,6 +897,9 @@ type ServerInterface interface {
 	// update-job
 	// (PATCH /job-queue/v1/jobs/{job_id})
 	PatchJobQueueV1JobsJobId(ctx echo.Context, jobId string) error
+	// get-image
+	// (GET /job-queue/v1/jobs/{job_id}/artifacts/{name})
+	GetJobQueueV1JobsJobIdArtifactsName(ctx echo.Context, jobId string, name string) error
 	// add-image
 	// (POST /job-queue/v1/jobs/{job_id}/artifacts/{name})
 	PostJobQueueV1JobsJobIdArtifactsName(ctx echo.Context, jobId string, name string) error
@@ -833,6 +954,30 @@ func (w *ServerInterfaceWrapper) PatchJobQueueV1JobsJobId(ctx echo.Context) erro
 	return err
 }
 
+// GetJobQueueV1JobsJobIdArtifactsName converts echo context to params.
+func (w *ServerInterfaceWrapper) GetJobQueueV1JobsJobIdArtifactsName(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "job_id" -------------
+	var jobId string
+
+	err = runtime.BindStyledParameter("simple", false, "job_id", ctx.Param("job_id"), &jobId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter job_id: %s", err))
+	}
+
+	// ------------- Path parameter "name" -------------
+	var name string
+
+	err = runtime.BindStyledParameter("simple", false, "name", ctx.Param("name"), &name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter name: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetJobQueueV1JobsJobIdArtifactsName(ctx, jobId, name)
+	return err
+}
+
 // PostJobQueueV1JobsJobIdArtifactsName converts echo context to params.
 func (w *ServerInterfaceWrapper) PostJobQueueV1JobsJobIdArtifactsName(ctx echo.Context) error {
 	var err error
@@ -891,6 +1036,7 @@ func RegisterHandlers(router EchoRouter, si ServerInterface) {
 	router.POST("/job-queue/v1/jobs", wrapper.PostJobQueueV1Jobs)
 	router.GET("/job-queue/v1/jobs/:job_id", wrapper.GetJobQueueV1JobsJobId)
 	router.PATCH("/job-queue/v1/jobs/:job_id", wrapper.PatchJobQueueV1JobsJobId)
+	router.GET("/job-queue/v1/jobs/:job_id/artifacts/:name", wrapper.GetJobQueueV1JobsJobIdArtifactsName)
 	router.POST("/job-queue/v1/jobs/:job_id/artifacts/:name", wrapper.PostJobQueueV1JobsJobIdArtifactsName)
 	router.GET("/status", wrapper.GetStatus)
 
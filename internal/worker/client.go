@@ -25,8 +25,14 @@ type Client struct {
 
 type Job struct {
 	Id       uuid.UUID
+	Type     string
 	Manifest distro.Manifest
 	Targets  []*target.Target
+
+	// ImageJobID and Filename identify the image an upload job uploads to
+	// its only target.
+	ImageJobID uuid.UUID
+	Filename   string
 }
 
 func NewClient(baseURL string, conf *tls.Config) (*Client, error) {
@@ -80,11 +86,20 @@ func (c *Client) AddJob() (*Job, error) {
 		return nil, err
 	}
 
-	return &Job{
-		jr.Id,
-		jr.Manifest,
-		jr.Targets,
-	}, nil
+	job := &Job{
+		Id:       jr.Id,
+		Type:     jr.Type,
+		Targets:  jr.Targets,
+		Filename: jr.Filename,
+	}
+	if jr.Manifest != nil {
+		job.Manifest = *jr.Manifest
+	}
+	if jr.ImageJobID != nil {
+		job.ImageJobID = *jr.ImageJobID
+	}
+
+	return job, nil
 }
 
 func (c *Client) JobCanceled(job *Job) bool {
@@ -107,10 +122,20 @@ func (c *Client) JobCanceled(job *Job) bool {
 	return jr.Canceled
 }
 
-func (c *Client) UpdateJob(job *Job, status common.ImageBuildState, result *osbuild.Result) error {
+func (c *Client) UpdateJob(job *Job, status common.ImageBuildState, result *osbuild.Result, targetResults []*target.TargetResult) error {
+	var tr *[]interface{}
+	if len(targetResults) > 0 {
+		results := make([]interface{}, len(targetResults))
+		for i, r := range targetResults {
+			results[i] = r
+		}
+		tr = &results
+	}
+
 	response, err := c.api.PatchJobQueueV1JobsJobId(context.Background(), job.Id.String(), api.PatchJobQueueV1JobsJobIdJSONRequestBody{
-		Result: result,
-		Status: status.ToString(),
+		Result:        result,
+		Status:        status.ToString(),
+		TargetResults: tr,
 	})
 	if err != nil {
 		return err
@@ -129,3 +154,22 @@ func (c *Client) UploadImage(job uuid.UUID, name string, reader io.Reader) error
 
 	return err
 }
+
+// DownloadImage writes the artifact called `name` of the finished job `job`
+// to `writer`.
+func (c *Client) DownloadImage(job uuid.UUID, name string, writer io.Writer) error {
+	response, err := c.api.GetJobQueueV1JobsJobIdArtifactsName(context.Background(), job.String(), name)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var er errorResponse
+		_ = json.NewDecoder(response.Body).Decode(&er)
+		return fmt.Errorf("couldn't download %s of job %s, got %d: %s", name, job, response.StatusCode, er.Message)
+	}
+
+	_, err = io.Copy(writer, response.Body)
+	return err
+}
@@ -18,8 +18,21 @@ type OSBuildJob struct {
 	Targets  []*target.Target `json:"targets,omitempty"`
 }
 
+// UploadJob uploads the image that was built by the job with id `ImageJobID`
+// to `Target`. The image is available as an artifact called `Filename` of
+// that job.
+//
+// Workers report the outcome of an upload job like that of an osbuild job,
+// with an osbuild result that only sets `success`.
+type UploadJob struct {
+	ImageJobID uuid.UUID      `json:"image_job_id"`
+	Filename   string         `json:"filename"`
+	Target     *target.Target `json:"target"`
+}
+
 type OSBuildJobResult struct {
-	OSBuildOutput *osbuild.Result `json:"osbuild_output,omitempty"`
+	OSBuildOutput *osbuild.Result        `json:"osbuild_output,omitempty"`
+	TargetResults []*target.TargetResult `json:"target_results,omitempty"`
 }
 
 //
@@ -39,8 +52,13 @@ type addJobRequest struct {
 
 type addJobResponse struct {
 	Id       uuid.UUID        `json:"id"`
-	Manifest distro.Manifest  `json:"manifest"`
+	Type     string           `json:"type"`
+	Manifest *distro.Manifest `json:"manifest"`
 	Targets  []*target.Target `json:"targets,omitempty"`
+
+	// only set for upload jobs
+	ImageJobID *uuid.UUID `json:"image_job_id,omitempty"`
+	Filename   string     `json:"filename,omitempty"`
 }
 
 type jobResponse struct {
@@ -49,8 +67,9 @@ type jobResponse struct {
 }
 
 type updateJobRequest struct {
-	Status common.ImageBuildState `json:"status"`
-	Result *osbuild.Result        `json:"result"`
+	Status        common.ImageBuildState `json:"status"`
+	Result        *osbuild.Result        `json:"result"`
+	TargetResults []*target.TargetResult `json:"target_results,omitempty"`
 }
 
 type updateJobResponse struct {
@@ -10,6 +10,9 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,8 +29,24 @@ type Server struct {
 	jobs         jobqueue.JobQueue
 	echo         *echo.Echo
 	artifactsDir string
+
+	jobStartedHandlers  []JobStartedHandler
+	jobFinishedHandlers []JobFinishedHandler
+	jobCanceledHandlers []JobCanceledHandler
 }
 
+// A JobStartedHandler is called after a worker picked up the job with the
+// given id and type.
+type JobStartedHandler func(id uuid.UUID, jobType string)
+
+// A JobFinishedHandler is called after a worker reported the result of the
+// job with the given id.
+type JobFinishedHandler func(id uuid.UUID, result *OSBuildJobResult)
+
+// A JobCanceledHandler is called after the job with the given id was
+// canceled.
+type JobCanceledHandler func(id uuid.UUID)
+
 type JobStatus struct {
 	State    common.ComposeState
 	Queued   time.Time
@@ -52,6 +71,24 @@ func NewServer(logger *log.Logger, jobs jobqueue.JobQueue, artifactsDir string)
 	return s
 }
 
+// OnJobStarted registers `handler` to be called whenever a worker starts a
+// job. Handlers must be registered before the server starts serving requests.
+func (s *Server) OnJobStarted(handler JobStartedHandler) {
+	s.jobStartedHandlers = append(s.jobStartedHandlers, handler)
+}
+
+// OnJobFinished registers `handler` to be called whenever a job finishes.
+// Handlers must be registered before the server starts serving requests.
+func (s *Server) OnJobFinished(handler JobFinishedHandler) {
+	s.jobFinishedHandlers = append(s.jobFinishedHandlers, handler)
+}
+
+// OnJobCanceled registers `handler` to be called whenever a job is canceled.
+// Handlers must be registered before the server starts serving requests.
+func (s *Server) OnJobCanceled(handler JobCanceledHandler) {
+	s.jobCanceledHandlers = append(s.jobCanceledHandlers, handler)
+}
+
 func (s *Server) Serve(listener net.Listener) error {
 	s.echo.Listener = listener
 
@@ -76,6 +113,19 @@ func (s *Server) Enqueue(manifest distro.Manifest, targets []*target.Target) (uu
 	return s.jobs.Enqueue("osbuild", job, nil)
 }
 
+// EnqueueUpload enqueues a job which uploads the image called `filename`,
+// which is built by the job `imageJobID`, to `t`. The upload job runs once
+// the image job finished.
+func (s *Server) EnqueueUpload(imageJobID uuid.UUID, filename string, t *target.Target) (uuid.UUID, error) {
+	job := UploadJob{
+		ImageJobID: imageJobID,
+		Filename:   filename,
+		Target:     t,
+	}
+
+	return s.jobs.Enqueue("upload", job, []uuid.UUID{imageJobID})
+}
+
 func (s *Server) JobStatus(id uuid.UUID) (*JobStatus, error) {
 	var canceled bool
 	var result OSBuildJobResult
@@ -108,12 +158,31 @@ func (s *Server) JobStatus(id uuid.UUID) (*JobStatus, error) {
 }
 
 func (s *Server) Cancel(id uuid.UUID) error {
-	return s.jobs.CancelJob(id)
+	err := s.jobs.CancelJob(id)
+	if err != nil {
+		return err
+	}
+
+	for _, handler := range s.jobCanceledHandlers {
+		handler(id)
+	}
+
+	return nil
+}
+
+// isValidArtifactName returns whether `name` names a file in the artifact
+// directory of a job, rather than a path leading out of it.
+func isValidArtifactName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
 }
 
 // Provides access to artifacts of a job. Returns an io.Reader for the artifact
 // and the artifact's size.
 func (s *Server) JobArtifact(id uuid.UUID, name string) (io.Reader, int64, error) {
+	if !isValidArtifactName(name) {
+		return nil, 0, fmt.Errorf("Invalid artifact name: %s", name)
+	}
+
 	status, err := s.JobStatus(id)
 	if err != nil {
 		return nil, 0, err
@@ -137,6 +206,37 @@ func (s *Server) JobArtifact(id uuid.UUID, name string) (io.Reader, int64, error
 	return f, info.Size(), nil
 }
 
+// AddArtifact stores `reader` as the artifact `name` of job `id`, next to the
+// artifacts the worker uploaded. It does nothing when the server doesn't keep
+// artifacts.
+func (s *Server) AddArtifact(id uuid.UUID, name string, reader io.Reader) error {
+	if s.artifactsDir == "" {
+		return nil
+	}
+
+	if !isValidArtifactName(name) {
+		return fmt.Errorf("invalid artifact name: %s", name)
+	}
+
+	err := os.MkdirAll(path.Join(s.artifactsDir, id.String()), 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create artifact directory: %v", err)
+	}
+
+	f, err := os.Create(path.Join(s.artifactsDir, id.String(), name))
+	if err != nil {
+		return fmt.Errorf("cannot create artifact file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, reader)
+	if err != nil {
+		return fmt.Errorf("error writing artifact file: %v", err)
+	}
+
+	return nil
+}
+
 // Deletes all artifacts for job `id`.
 func (s *Server) DeleteArtifacts(id uuid.UUID) error {
 	status, err := s.JobStatus(id)
@@ -151,6 +251,50 @@ func (s *Server) DeleteArtifacts(id uuid.UUID) error {
 	return os.RemoveAll(path.Join(s.artifactsDir, id.String()))
 }
 
+// Returns the total size in bytes of all artifacts of job `id`.
+func (s *Server) ArtifactsSize(id uuid.UUID) (int64, error) {
+	_, err := s.JobStatus(id)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	err = filepath.Walk(path.Join(s.artifactsDir, id.String()), func(_ string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// Deletes job `id` and all its artifacts. The job must have finished or been
+// canceled.
+func (s *Server) DeleteJob(id uuid.UUID) error {
+	status, err := s.JobStatus(id)
+	if err != nil {
+		return err
+	}
+
+	if status.Finished.IsZero() && !status.Canceled {
+		return jobqueue.ErrNotDone
+	}
+
+	err = s.jobs.DeleteJob(id)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(path.Join(s.artifactsDir, id.String()))
+}
+
 // apiHandlers implements api.ServerInterface - the http api route handlers
 // generated from api/openapi.yml. This is a separate object, because these
 // handlers should not be exposed on the `Server` object.
@@ -193,17 +337,49 @@ func (h *apiHandlers) PostJobQueueV1Jobs(ctx echo.Context) error {
 		return err
 	}
 
-	var job OSBuildJob
-	id, err := h.server.jobs.Dequeue(ctx.Request().Context(), []string{"osbuild"}, &job)
+	var args json.RawMessage
+	id, jobType, err := h.server.jobs.Dequeue(ctx.Request().Context(), []string{"osbuild", "upload"}, &args)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "%v", err)
 	}
 
-	return ctx.JSON(http.StatusCreated, addJobResponse{
-		Id:       id,
-		Manifest: job.Manifest,
-		Targets:  job.Targets,
-	})
+	for _, handler := range h.server.jobStartedHandlers {
+		handler(id, jobType)
+	}
+
+	switch jobType {
+	case "osbuild":
+		var job OSBuildJob
+		err = json.Unmarshal(args, &job)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "cannot parse job %s: %v", id, err)
+		}
+
+		return ctx.JSON(http.StatusCreated, addJobResponse{
+			Id:       id,
+			Type:     jobType,
+			Manifest: &job.Manifest,
+			Targets:  job.Targets,
+		})
+
+	case "upload":
+		var job UploadJob
+		err = json.Unmarshal(args, &job)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "cannot parse job %s: %v", id, err)
+		}
+
+		return ctx.JSON(http.StatusCreated, addJobResponse{
+			Id:         id,
+			Type:       jobType,
+			Targets:    []*target.Target{job.Target},
+			ImageJobID: &job.ImageJobID,
+			Filename:   job.Filename,
+		})
+
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected job type: %s", jobType)
+	}
 }
 
 func (h *apiHandlers) PatchJobQueueV1JobsJobId(ctx echo.Context, jobId string) error {
@@ -225,7 +401,11 @@ func (h *apiHandlers) PatchJobQueueV1JobsJobId(ctx echo.Context, jobId string) e
 		return echo.NewHTTPError(http.StatusBadRequest, "setting status of a job to waiting or running is not supported")
 	}
 
-	err = h.server.jobs.FinishJob(id, OSBuildJobResult{OSBuildOutput: body.Result})
+	result := OSBuildJobResult{
+		OSBuildOutput: body.Result,
+		TargetResults: body.TargetResults,
+	}
+	err = h.server.jobs.FinishJob(id, result)
 	if err != nil {
 		switch err {
 		case jobqueue.ErrNotExist:
@@ -237,15 +417,41 @@ func (h *apiHandlers) PatchJobQueueV1JobsJobId(ctx echo.Context, jobId string) e
 		}
 	}
 
+	for _, handler := range h.server.jobFinishedHandlers {
+		handler(id, &result)
+	}
+
 	return ctx.JSON(http.StatusOK, updateJobResponse{})
 }
 
+func (h *apiHandlers) GetJobQueueV1JobsJobIdArtifactsName(ctx echo.Context, jobId string, name string) error {
+	id, err := uuid.Parse(jobId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot parse compose id: %v", err)
+	}
+
+	reader, size, err := h.server.JobArtifact(id, name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "%v", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(size, 10))
+	return ctx.Stream(http.StatusOK, "application/octet-stream", reader)
+}
+
 func (h *apiHandlers) PostJobQueueV1JobsJobIdArtifactsName(ctx echo.Context, jobId string, name string) error {
 	id, err := uuid.Parse(jobId)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "cannot parse compose id: %v", err)
 	}
 
+	if !isValidArtifactName(name) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid artifact name: %s", name)
+	}
+
 	request := ctx.Request()
 
 	if h.server.artifactsDir == "" {
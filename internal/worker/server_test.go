@@ -2,15 +2,22 @@ package worker_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue/testjobqueue"
+	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/test"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 )
@@ -68,7 +75,7 @@ func TestCreate(t *testing.T) {
 	require.NoError(t, err)
 
 	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusCreated,
-		`{"id":"`+id.String()+`","manifest":{"sources":{},"pipeline":{}}}`, "created")
+		`{"id":"`+id.String()+`","type":"osbuild","manifest":{"sources":{},"pipeline":{}}}`, "created")
 
 	test.TestRoute(t, server, false, "GET", fmt.Sprintf("/job-queue/v1/jobs/%s", id), `{}`, http.StatusOK,
 		`{"id":"`+id.String()+`","canceled":false}`)
@@ -94,7 +101,7 @@ func TestCancel(t *testing.T) {
 	require.NoError(t, err)
 
 	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusCreated,
-		`{"id":"`+id.String()+`","manifest":{"sources":{},"pipeline":{}}}`, "created")
+		`{"id":"`+id.String()+`","type":"osbuild","manifest":{"sources":{},"pipeline":{}}}`, "created")
 
 	err = server.Cancel(id)
 	require.NoError(t, err)
@@ -169,3 +176,199 @@ func TestUpdate(t *testing.T) {
 		testUpdateTransition(t, c.From, c.To, c.ExpectedStatus)
 	}
 }
+
+func TestOnJobFinished(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+	server := worker.NewServer(nil, testjobqueue.New(), "")
+
+	var finished []uuid.UUID
+	var results []*worker.OSBuildJobResult
+	server.OnJobFinished(func(id uuid.UUID, result *worker.OSBuildJobResult) {
+		finished = append(finished, id)
+		results = append(results, result)
+	})
+
+	id, err := server.Enqueue(manifest, nil)
+	require.NoError(t, err)
+	test.SendHTTP(server, false, "POST", "/job-queue/v1/jobs", `{}`)
+
+	// failed updates don't call the handler
+	test.TestRoute(t, server, false, "PATCH", "/job-queue/v1/jobs/"+id.String(), `{"status":"RUNNING"}`, http.StatusBadRequest, "{}", "message")
+	require.Empty(t, finished)
+
+	targetUuid := uuid.New()
+	test.TestRoute(t, server, false, "PATCH", "/job-queue/v1/jobs/"+id.String(),
+		`{"status":"FINISHED","result":{"success":true},"target_results":[{"target_uuid":"`+targetUuid.String()+`","name":"org.osbuild.registry","options":{"digest":"sha256:0123"}}]}`,
+		http.StatusOK, "{}")
+	require.Equal(t, []uuid.UUID{id}, finished)
+	require.True(t, results[0].OSBuildOutput.Success)
+	require.Len(t, results[0].TargetResults, 1)
+	require.Equal(t, targetUuid, results[0].TargetResults[0].TargetUuid)
+}
+
+func TestOnJobStartedAndCanceled(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+	server := worker.NewServer(nil, testjobqueue.New(), "")
+
+	var started, canceled []uuid.UUID
+	var startedTypes []string
+	server.OnJobStarted(func(id uuid.UUID, jobType string) {
+		started = append(started, id)
+		startedTypes = append(startedTypes, jobType)
+	})
+	server.OnJobCanceled(func(id uuid.UUID) {
+		canceled = append(canceled, id)
+	})
+
+	id, err := server.Enqueue(manifest, nil)
+	require.NoError(t, err)
+	test.SendHTTP(server, false, "POST", "/job-queue/v1/jobs", `{}`)
+	require.Equal(t, []uuid.UUID{id}, started)
+	require.Equal(t, []string{"osbuild"}, startedTypes)
+
+	// nothing is started when there's no job
+	test.SendHTTP(server, false, "POST", "/job-queue/v1/jobs", `{}`)
+	require.Len(t, started, 1)
+
+	require.NoError(t, server.Cancel(id))
+	require.Equal(t, []uuid.UUID{id}, canceled)
+
+	require.Error(t, server.Cancel(uuid.New()))
+	require.Len(t, canceled, 1)
+}
+
+func TestUploadJob(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "worker-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	server := worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+
+	imageJobID, err := server.Enqueue(manifest, nil)
+	require.NoError(t, err)
+
+	uploadTarget := target.NewAWSTarget(&target.AWSTargetOptions{
+		Filename: "test.img",
+		Region:   "eu-central-1",
+		Bucket:   "bucket",
+	})
+	uploadJobID, err := server.EnqueueUpload(imageJobID, "test.img", uploadTarget)
+	require.NoError(t, err)
+
+	// the upload job waits for the image job
+	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusCreated,
+		`{"id":"`+imageJobID.String()+`","type":"osbuild","manifest":{"sources":{},"pipeline":{}}}`, "created")
+	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusInternalServerError, "{}", "message")
+
+	// artifacts are not available before the job finished
+	test.TestRoute(t, server, false, "GET", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/test.img", ``, http.StatusNotFound, "{}", "message")
+
+	test.SendHTTP(server, false, "POST", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/test.img", `image content`)
+	test.TestRoute(t, server, false, "PATCH", "/job-queue/v1/jobs/"+imageJobID.String(), `{"status":"FINISHED","result":{"success":true}}`, http.StatusOK, "{}")
+
+	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusCreated,
+		`{"id":"`+uploadJobID.String()+`","type":"upload","manifest":null,"image_job_id":"`+imageJobID.String()+`","filename":"test.img"}`, "targets")
+	test.TestNonJsonRoute(t, server, false, "GET", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/test.img", ``, http.StatusOK, `image content`)
+
+	// composer can add artifacts of its own next to the ones of the worker
+	require.NoError(t, server.AddArtifact(imageJobID, "test.json", strings.NewReader(`{}`)))
+	test.TestNonJsonRoute(t, server, false, "GET", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/test.json", ``, http.StatusOK, `{}`)
+	test.TestNonJsonRoute(t, server, false, "GET", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/test.img", ``, http.StatusOK, `image content`)
+
+	// artifact names cannot lead out of the job's directory
+	for _, name := range []string{"..", ".", "../" + uploadJobID.String(), ""} {
+		_, _, err = server.JobArtifact(imageJobID, name)
+		require.Error(t, err, name)
+		require.Error(t, server.AddArtifact(imageJobID, name, strings.NewReader(`{}`)), name)
+	}
+	test.TestRoute(t, server, false, "GET", "/job-queue/v1/jobs/"+imageJobID.String()+"/artifacts/%2e%2e", ``, http.StatusNotFound, "{}", "message")
+
+	test.TestRoute(t, server, false, "PATCH", "/job-queue/v1/jobs/"+uploadJobID.String(), `{"status":"FAILED","result":{"success":false}}`, http.StatusOK, "{}")
+	status, err := server.JobStatus(uploadJobID)
+	require.NoError(t, err)
+	require.Equal(t, common.CFailed, status.State)
+}
+
+func TestDeleteJob(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "worker-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	server := worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+
+	jobID, err := server.Enqueue(manifest, nil)
+	require.NoError(t, err)
+
+	// pending jobs cannot be deleted
+	err = server.DeleteJob(jobID)
+	require.Equal(t, jobqueue.ErrNotDone, err)
+
+	test.TestRoute(t, server, false, "POST", "/job-queue/v1/jobs", `{}`, http.StatusCreated,
+		`{"id":"`+jobID.String()+`","type":"osbuild","manifest":{"sources":{},"pipeline":{}}}`, "created")
+	test.SendHTTP(server, false, "POST", "/job-queue/v1/jobs/"+jobID.String()+"/artifacts/test.img", `image content`)
+	test.TestRoute(t, server, false, "PATCH", "/job-queue/v1/jobs/"+jobID.String(), `{"status":"FINISHED","result":{"success":true}}`, http.StatusOK, "{}")
+
+	size, err := server.ArtifactsSize(jobID)
+	require.NoError(t, err)
+	require.Equal(t, int64(len("image content")), size)
+
+	err = server.DeleteJob(jobID)
+	require.NoError(t, err)
+
+	_, err = server.JobStatus(jobID)
+	require.Equal(t, jobqueue.ErrNotExist, err)
+	_, err = os.Stat(path.Join(artifactsDir, jobID.String()))
+	require.True(t, os.IsNotExist(err))
+}
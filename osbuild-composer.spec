@@ -36,6 +36,7 @@ BuildRequires:  git
 BuildRequires:  golang(github.com/aws/aws-sdk-go)
 BuildRequires:  golang(github.com/Azure/azure-sdk-for-go)
 BuildRequires:  golang(github.com/Azure/azure-storage-blob-go/azblob)
+BuildRequires:  golang(github.com/Azure/go-autorest/autorest/adal)
 BuildRequires:  golang(github.com/BurntSushi/toml)
 BuildRequires:  golang(github.com/coreos/go-semver/semver)
 BuildRequires:  golang(github.com/coreos/go-systemd/activation)
@@ -55,6 +56,7 @@ Requires: systemd
 Requires: osbuild >= 18
 Requires: osbuild-ostree >= 18
 Requires: qemu-img
+Requires: git-core
 
 Provides: weldr
 
@@ -91,6 +93,7 @@ export GOFLAGS=-mod=vendor
 
 %gobuild -o _bin/osbuild-composer %{goipath}/cmd/osbuild-composer
 %gobuild -o _bin/osbuild-worker %{goipath}/cmd/osbuild-worker
+%gobuild -o _bin/osbuild-store-dump %{goipath}/cmd/osbuild-store-dump
 
 
 %if %{with tests} || 0%{?rhel}
@@ -119,6 +122,7 @@ go test -c -tags=integration -ldflags="${TEST_LDFLAGS}" -o _bin/osbuild-image-te
 install -m 0755 -vd                                         %{buildroot}%{_libexecdir}/osbuild-composer
 install -m 0755 -vp _bin/osbuild-composer                   %{buildroot}%{_libexecdir}/osbuild-composer/
 install -m 0755 -vp _bin/osbuild-worker                     %{buildroot}%{_libexecdir}/osbuild-composer/
+install -m 0755 -vp _bin/osbuild-store-dump                 %{buildroot}%{_libexecdir}/osbuild-composer/
 install -m 0755 -vp dnf-json                                %{buildroot}%{_libexecdir}/osbuild-composer/
 
 install -m 0755 -vd                                         %{buildroot}%{_datadir}/osbuild-composer/repositories
@@ -164,23 +168,25 @@ export GOPATH=$PWD/_build:%{gopath}
 %endif
 
 %post
-%systemd_post osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_post osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-api.socket
 
 %preun
-%systemd_preun osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_preun osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-api.socket
 
 %postun
-%systemd_postun_with_restart osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_postun_with_restart osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-api.socket
 
 %files
 %license LICENSE
 %doc README.md
 %{_libexecdir}/osbuild-composer/osbuild-composer
+%{_libexecdir}/osbuild-composer/osbuild-store-dump
 %{_libexecdir}/osbuild-composer/dnf-json
 %{_datadir}/osbuild-composer/
 %{_unitdir}/osbuild-composer.service
 %{_unitdir}/osbuild-composer.socket
 %{_unitdir}/osbuild-remote-worker.socket
+%{_unitdir}/osbuild-composer-api.socket
 %{_sysusersdir}/osbuild-composer.conf
 
 %package worker